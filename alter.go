@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// alterOp is one structured ALTER TABLE change from the form.
+type alterOp struct {
+	Action   string // add, drop, rename or type
+	Column   string
+	NewName  string
+	Type     string
+	Nullable bool
+	Default  string
+	// Using converts existing values on a PostgreSQL type change
+	Using string
+}
+
+func alterOpFromForm(c *gin.Context) alterOp {
+	return alterOp{
+		Action:   c.DefaultPostForm("action", "add"),
+		Column:   strings.TrimSpace(c.PostForm("column")),
+		NewName:  strings.TrimSpace(c.PostForm("new_name")),
+		Type:     strings.TrimSpace(c.PostForm("type")),
+		Nullable: c.PostForm("nullable") != "",
+		Default:  strings.TrimSpace(c.PostForm("default")),
+		Using:    strings.TrimSpace(c.PostForm("using")),
+	}
+}
+
+// alterTableSQL generates the driver's ALTER TABLE for op.
+func alterTableSQL(driver string, table tableInfo, op alterOp) (string, error) {
+	if strings.Contains(op.Type+op.Default+op.Using, ";") {
+		return "", fmt.Errorf("type, default and USING can't contain ';'")
+	}
+	prefix := "ALTER TABLE " + quoteIdent(driver, qualifiedName(table)) + " "
+	if op.Action != "add" {
+		if _, ok := findColumn(table, op.Column); !ok {
+			return "", fmt.Errorf("no column %q in %s", op.Column, qualifiedName(table))
+		}
+	}
+	column := quoteIdent(driver, op.Column)
+
+	// typeDef is the column type with nullability and default
+	typeDef := func() (string, error) {
+		if op.Type == "" {
+			return "", fmt.Errorf("a type is required")
+		}
+		def := op.Type
+		if driver == "clickhouse" {
+			if op.Nullable && !strings.HasPrefix(def, "Nullable(") {
+				def = "Nullable(" + def + ")"
+			}
+		} else if !op.Nullable {
+			def += " NOT NULL"
+		}
+		if op.Default != "" {
+			def += " DEFAULT " + op.Default
+		}
+		return def, nil
+	}
+
+	switch op.Action {
+	case "add":
+		if op.Column == "" {
+			return "", fmt.Errorf("a column name is required")
+		}
+		def, err := typeDef()
+		if err != nil {
+			return "", err
+		}
+		return prefix + "ADD COLUMN " + column + " " + def, nil
+	case "drop":
+		return prefix + "DROP COLUMN " + column, nil
+	case "rename":
+		if op.NewName == "" {
+			return "", fmt.Errorf("a new name is required")
+		}
+		return prefix + "RENAME COLUMN " + column + " TO " + quoteIdent(driver, op.NewName), nil
+	case "type":
+		if op.Type == "" {
+			return "", fmt.Errorf("a type is required")
+		}
+		switch driver {
+		case "postgres":
+			stmt := prefix + "ALTER COLUMN " + column + " TYPE " + op.Type
+			if op.Using != "" {
+				stmt += " USING " + op.Using
+			}
+			return stmt, nil
+		case "mysql", "clickhouse":
+			// MODIFY restates the whole column, nullability and default included
+			def, err := typeDef()
+			if err != nil {
+				return "", err
+			}
+			return prefix + "MODIFY COLUMN " + column + " " + def, nil
+		}
+		return "", fmt.Errorf("SQLite can't change column types, recreate the table instead")
+	}
+	return "", fmt.Errorf("unknown change %q", op.Action)
+}
+
+// transactionalDDL drivers can try a change and roll it back.
+func transactionalDDL(driver string) bool {
+	return driver == "postgres" || driver == "sqlite"
+}
+
+// alterTableHandler shows the ALTER form for a table, previews the
+// statement, dry-runs it in a rolled back transaction where DDL is
+// transactional, and runs it once the previewed statement is confirmed.
+func alterTableHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name := c.PostForm("table")
+	op := alterOpFromForm(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "alter.html", format, args...)
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	table, err := lookupTable(ctx, db, p.Driver, name)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	page := alterView{
+		Table:   name,
+		Columns: table.Columns,
+		Op:      op,
+		DryRun:  transactionalDDL(p.Driver),
+		Types:   columnTypeHints[p.Driver],
+	}
+	if c.PostForm("submitted") == "" {
+		page.Op.Nullable = true
+		render(c, http.StatusOK, page)
+		return
+	}
+
+	query, err := alterTableSQL(p.Driver, table, op)
+	if err != nil {
+		page.Problem = err.Error()
+		render(c, http.StatusBadRequest, page)
+		return
+	}
+	st := rowStatement{Query: query}
+	page.Statement = &st
+
+	if c.PostForm("dryrun") != "" && transactionalDDL(p.Driver) {
+		tx, err := db.BeginTx(ctx, nil)
+		if err == nil {
+			if p.Driver == "postgres" {
+				// don't queue behind other sessions' locks for the trial
+				_, err = tx.ExecContext(ctx, "SET LOCAL lock_timeout = '2s'")
+			}
+			if err == nil {
+				_, err = tx.ExecContext(ctx, query)
+			}
+			tx.Rollback()
+		}
+		if err != nil {
+			page.Problem = fmt.Sprintf("Dry run failed: %v", err)
+		} else {
+			page.Checked = true
+		}
+		render(c, http.StatusOK, page)
+		return
+	}
+	if c.PostForm("confirm") != st.Digest() {
+		render(c, http.StatusOK, page)
+		return
+	}
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		page.Problem = fmt.Sprintf("ALTER TABLE failed: %v", err)
+		render(c, http.StatusBadRequest, page)
+		return
+	}
+	invalidateSchema(p)
+
+	user := currentIdentity(c).User
+	log.Printf("%s altered table %s on %s", user, name, p.address())
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "alter_table",
+		Target: p.auditTarget(),
+		Query:  query,
+	})
+	render(c, http.StatusOK, alterView{Done: fmt.Sprintf("Altered %s.", name), Statement: &st})
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryAnalysis is what the rule-based analyzer could tell about a statement.
+// It works on tokens only, so it never needs a connection and tolerates
+// dialect quirks by skipping what it doesn't recognize.
+type queryAnalysis struct {
+	Statement  string
+	Reads      []string
+	Writes     []string
+	CTEs       []string
+	Joins      []string
+	Filters    []string
+	Aggregates []string
+	GroupBy    string
+	Having     string
+	OrderBy    string
+	Limit      string
+	Distinct   bool
+	AllColumns bool
+	Window     bool
+	Subqueries int
+	SetOps     []string
+	Warnings   []string
+}
+
+var aggregateFuncs = map[string]bool{
+	"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true,
+	"ARRAY_AGG": true, "STRING_AGG": true, "GROUP_CONCAT": true, "JSON_AGG": true,
+	"JSONB_AGG": true, "BOOL_AND": true, "BOOL_OR": true, "STDDEV": true,
+	"VARIANCE": true, "UNIQ": true, "UNIQEXACT": true, "GROUPARRAY": true,
+	"ARGMAX": true, "ARGMIN": true, "QUANTILE": true, "MEDIAN": true,
+}
+
+// clauseKeywords end a clause's text at the same nesting level.
+var clauseKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "PREWHERE": true, "GROUP": true,
+	"HAVING": true, "ORDER": true, "LIMIT": true, "OFFSET": true, "FETCH": true,
+	"UNION": true, "INTERSECT": true, "EXCEPT": true, "RETURNING": true,
+	"WINDOW": true, "SET": true, "VALUES": true, "ON": true, "USING": true,
+	"JOIN": true, "LEFT": true, "RIGHT": true, "INNER": true, "FULL": true,
+	"CROSS": true, "NATURAL": true, "OUTER": true, "FORMAT": true,
+	"SETTINGS": true, "FOR": true, "ARRAY": true, "GLOBAL": true, "ASOF": true,
+	"ANTI": true, "SEMI": true, "PASTE": true, "FINAL": true, "SAMPLE": true,
+}
+
+var joinModifiers = map[string]bool{
+	"LEFT": true, "RIGHT": true, "INNER": true, "FULL": true, "CROSS": true,
+	"NATURAL": true, "OUTER": true, "GLOBAL": true, "ASOF": true, "ANY": true,
+	"ALL": true, "SEMI": true, "ANTI": true, "STRAIGHT_JOIN": true,
+}
+
+// clauseEnd returns the index just past a clause starting at i, stopping at a
+// clause keyword, a semicolon or the parenthesis closing the enclosing level.
+func clauseEnd(tokens []sqlToken, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case t.is(";") && depth == 0:
+			return i
+		case depth == 0 && clauseKeywords[t.upper()]:
+			return i
+		}
+	}
+	return i
+}
+
+// splitAnd splits a condition on top-level ANDs. BETWEEN x AND y stays whole.
+func splitAnd(tokens []sqlToken) []string {
+	var parts []string
+	depth, start, between := 0, 0, false
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case depth == 0 && t.upper() == "BETWEEN":
+			between = true
+		case depth == 0 && t.upper() == "AND":
+			if between {
+				between = false
+				continue
+			}
+			parts = append(parts, joinTokens(tokens[start:i]))
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		parts = append(parts, joinTokens(tokens[start:]))
+	}
+	return parts
+}
+
+// readName reads a possibly qualified name at i and returns it with the
+// index after it, or "" if there is no name there.
+func readName(tokens []sqlToken, i int) (string, int) {
+	if i >= len(tokens) || (tokens[i].Kind != tokWord && tokens[i].Kind != tokIdent) {
+		return "", i
+	}
+	parts := []string{tokens[i].name()}
+	i++
+	for i+1 < len(tokens) && tokens[i].is(".") && (tokens[i+1].Kind == tokWord || tokens[i+1].Kind == tokIdent) {
+		parts = append(parts, tokens[i+1].name())
+		i += 2
+	}
+	return strings.Join(parts, "."), i
+}
+
+// skipAlias steps over "AS alias" or a bare alias after a table reference.
+func skipAlias(tokens []sqlToken, i int) int {
+	if i < len(tokens) && tokens[i].upper() == "AS" {
+		return i + 2
+	}
+	if i < len(tokens) && (tokens[i].Kind == tokIdent || (tokens[i].Kind == tokWord && !clauseKeywords[tokens[i].upper()])) {
+		return i + 1
+	}
+	return i
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// analyzeQuery walks the tokens of a single statement. Clauses of the
+// outermost query are reported in full; nested queries contribute the tables
+// they read and their filters.
+func analyzeQuery(query string) queryAnalysis {
+	tokens := tokenizeSQL(query)
+	a := queryAnalysis{Statement: firstKeyword(query)}
+	if len(tokens) == 0 {
+		return a
+	}
+
+	// isQuery[d] tells whether nesting level d is a query rather than a
+	// function call, so EXTRACT(YEAR FROM ts) is not taken for a table.
+	isQuery := []bool{true}
+	depth := 0
+	hasWhere := false
+	commaJoin := false
+	cte := make(map[string]bool)
+	writeTarget := func(name string) {
+		if name != "" {
+			a.Writes = appendUnique(a.Writes, name)
+		}
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		kw := t.upper()
+		switch {
+		case t.is("("):
+			depth++
+			next := ""
+			if i+1 < len(tokens) {
+				next = tokens[i+1].upper()
+			}
+			isQuery = append(isQuery, next == "SELECT" || next == "WITH" || next == "VALUES")
+			if next == "SELECT" {
+				a.Subqueries++
+			}
+			continue
+		case t.is(")"):
+			if depth > 0 {
+				depth--
+				isQuery = isQuery[:len(isQuery)-1]
+			}
+			continue
+		case t.Kind == tokWord && aggregateFuncs[kw] && i+1 < len(tokens) && tokens[i+1].is("("):
+			end := i + 2
+			for d := 1; end < len(tokens) && d > 0; end++ {
+				if tokens[end].is("(") {
+					d++
+				} else if tokens[end].is(")") {
+					d--
+				}
+			}
+			call := tokens[i:end]
+			a.Aggregates = appendUnique(a.Aggregates, strings.ToLower(t.Text)+joinTokens(call[1:]))
+			continue
+		}
+		if t.Kind != tokWord {
+			continue
+		}
+
+		switch kw {
+		case "AS":
+			// WITH name AS ( ... ) and subsequent ", name AS ("
+			if i >= 2 && i+1 < len(tokens) && tokens[i+1].is("(") {
+				prev := tokens[i-2]
+				if prev.upper() == "WITH" || prev.upper() == "RECURSIVE" || prev.is(",") {
+					name := tokens[i-1].name()
+					cte[strings.ToLower(name)] = true
+					a.CTEs = appendUnique(a.CTEs, name)
+				}
+			}
+		case "DISTINCT":
+			if depth == 0 && i > 0 && tokens[i-1].upper() == "SELECT" {
+				a.Distinct = true
+			}
+		case "SELECT":
+			if depth == 0 && i+1 < len(tokens) && tokens[i+1].is("*") {
+				a.AllColumns = true
+			}
+		case "OVER":
+			a.Window = true
+		case "UNION", "INTERSECT", "EXCEPT":
+			if depth == 0 {
+				op := kw
+				if i+1 < len(tokens) && tokens[i+1].upper() == "ALL" {
+					op += " ALL"
+				}
+				a.SetOps = append(a.SetOps, op)
+			}
+		case "INTO":
+			if i > 0 && (tokens[i-1].upper() == "INSERT" || tokens[i-1].upper() == "REPLACE" || tokens[i-1].upper() == "MERGE") {
+				name, _ := readName(tokens, i+1)
+				writeTarget(name)
+			}
+		case "UPDATE":
+			// the statement itself, possibly after a CTE; not FOR UPDATE or DO UPDATE
+			if i == 0 || (depth == 0 && a.Statement == "WITH" && tokens[i-1].is(")")) {
+				j := i + 1
+				if j < len(tokens) && tokens[j].upper() == "ONLY" {
+					j++
+				}
+				name, _ := readName(tokens, j)
+				writeTarget(name)
+			}
+		case "TABLE":
+			switch a.Statement {
+			case "CREATE", "ALTER", "DROP", "TRUNCATE":
+				j := i + 1
+				for j < len(tokens) && (tokens[j].upper() == "IF" || tokens[j].upper() == "NOT" || tokens[j].upper() == "EXISTS" || tokens[j].upper() == "ONLY") {
+					j++
+				}
+				name, _ := readName(tokens, j)
+				writeTarget(name)
+			}
+		case "TRUNCATE":
+			if i == 0 && len(tokens) > 1 && tokens[1].upper() != "TABLE" {
+				name, _ := readName(tokens, 1)
+				writeTarget(name)
+			}
+		case "FROM", "JOIN":
+			if !isQuery[len(isQuery)-1] {
+				continue
+			}
+			j := i + 1
+			if j < len(tokens) && (tokens[j].upper() == "LATERAL" || tokens[j].upper() == "ONLY") {
+				j++
+			}
+			if j < len(tokens) && tokens[j].is("(") {
+				// derived table, handled when the walk reaches it
+				continue
+			}
+			var names []string
+			for {
+				name, next := readName(tokens, j)
+				if name == "" {
+					break
+				}
+				// table functions such as generate_series(...) are not tables
+				if next < len(tokens) && tokens[next].is("(") {
+					break
+				}
+				names = append(names, name)
+				j = skipAlias(tokens, next)
+				if kw != "FROM" || j >= len(tokens) || !tokens[j].is(",") {
+					break
+				}
+				if depth == 0 {
+					commaJoin = true
+				}
+				j++
+			}
+			for _, name := range names {
+				if kw == "FROM" && tokens[i-1].upper() == "DELETE" {
+					writeTarget(name)
+					continue
+				}
+				if !cte[strings.ToLower(name)] {
+					a.Reads = appendUnique(a.Reads, name)
+				}
+			}
+			if kw == "JOIN" && len(names) == 1 {
+				start := i
+				for start > 0 && joinModifiers[tokens[start-1].upper()] {
+					start--
+				}
+				desc := joinTokens(tokens[start:i+1]) + " " + names[0]
+				if j < len(tokens) && (tokens[j].upper() == "ON" || tokens[j].upper() == "USING") {
+					end := clauseEnd(tokens, j+1)
+					desc += " " + strings.ToLower(tokens[j].Text) + " " + joinTokens(tokens[j+1:end])
+				}
+				a.Joins = append(a.Joins, desc)
+			}
+		case "WHERE", "PREWHERE":
+			end := clauseEnd(tokens, i+1)
+			for _, f := range splitAnd(tokens[i+1 : end]) {
+				if depth > 0 {
+					f += " (in a subquery)"
+				}
+				a.Filters = append(a.Filters, f)
+			}
+			if depth == 0 {
+				hasWhere = true
+			}
+		case "GROUP", "ORDER":
+			if depth == 0 && i+1 < len(tokens) && tokens[i+1].upper() == "BY" {
+				text := joinTokens(tokens[i+2 : clauseEnd(tokens, i+2)])
+				if kw == "GROUP" {
+					a.GroupBy = text
+				} else {
+					a.OrderBy = text
+				}
+			}
+		case "HAVING":
+			if depth == 0 {
+				a.Having = joinTokens(tokens[i+1 : clauseEnd(tokens, i+1)])
+			}
+		case "LIMIT":
+			if depth == 0 {
+				a.Limit = joinTokens(tokens[i+1 : clauseEnd(tokens, i+1)])
+			}
+		}
+	}
+
+	switch a.Statement {
+	case "UPDATE", "DELETE":
+		if !hasWhere {
+			a.Warnings = append(a.Warnings, "No WHERE clause: every row of the table is affected.")
+		}
+	case "SELECT", "WITH":
+		if commaJoin && !hasWhere {
+			a.Warnings = append(a.Warnings, "Tables listed with commas and no WHERE clause produce a cross product.")
+		}
+		if a.Limit != "" && a.OrderBy == "" {
+			a.Warnings = append(a.Warnings, "LIMIT without ORDER BY returns an arbitrary subset of rows.")
+		}
+	}
+	return a
+}
+
+// Sentences renders the analysis as plain-language bullet points.
+func (a queryAnalysis) Sentences() []string {
+	var out []string
+	add := func(format string, args ...interface{}) {
+		out = append(out, fmt.Sprintf(format, args...))
+	}
+	list := func(items []string) string { return strings.Join(items, ", ") }
+
+	switch a.Statement {
+	case "SELECT", "WITH", "VALUES", "TABLE":
+		add("Reads data and returns a result set.")
+	case "INSERT", "REPLACE":
+		add("Inserts rows into %s.", list(a.Writes))
+	case "UPDATE":
+		add("Updates rows in %s.", list(a.Writes))
+	case "DELETE":
+		add("Deletes rows from %s.", list(a.Writes))
+	case "MERGE":
+		add("Merges rows into %s.", list(a.Writes))
+	case "CREATE", "ALTER", "DROP", "TRUNCATE":
+		if len(a.Writes) > 0 {
+			add("Changes the schema: %s affecting %s.", a.Statement, list(a.Writes))
+		} else {
+			add("Changes the schema (%s).", a.Statement)
+		}
+	case "":
+		add("Nothing to analyze.")
+		return out
+	default:
+		add("Runs a %s statement.", a.Statement)
+	}
+	if a.Statement == "WITH" && len(a.Writes) > 0 {
+		add("Also modifies %s.", list(a.Writes))
+	}
+	if len(a.CTEs) > 0 {
+		add("Defines the named subqueries (CTEs) %s.", list(a.CTEs))
+	}
+	if len(a.Reads) > 0 {
+		add("Reads from %s.", list(a.Reads))
+	}
+	for _, j := range a.Joins {
+		add("Joins: %s.", j)
+	}
+	if a.AllColumns {
+		add("Returns every column (SELECT *).")
+	}
+	for _, f := range a.Filters {
+		add("Filters on %s.", f)
+	}
+	if len(a.Aggregates) > 0 {
+		add("Aggregates with %s.", list(a.Aggregates))
+	}
+	if a.GroupBy != "" {
+		add("Groups rows by %s.", a.GroupBy)
+	}
+	if a.Having != "" {
+		add("Keeps only groups where %s.", a.Having)
+	}
+	if a.Window {
+		add("Uses window functions (OVER).")
+	}
+	if a.Distinct {
+		add("Removes duplicate rows (DISTINCT).")
+	}
+	if len(a.SetOps) > 0 {
+		add("Combines results with %s.", list(a.SetOps))
+	}
+	if a.Subqueries == 1 {
+		add("Contains a nested subquery.")
+	} else if a.Subqueries > 1 {
+		add("Contains %d nested subqueries.", a.Subqueries)
+	}
+	if a.OrderBy != "" {
+		add("Sorts by %s.", a.OrderBy)
+	}
+	if a.Limit != "" {
+		add("Returns at most %s rows.", a.Limit)
+	}
+	return out
+}
+
+// explainQueryHandler describes what the query in the editor does without
+// running it. With mode=llm and the assistant enabled, the model explains it
+// instead.
+func explainQueryHandler(c *gin.Context) {
+	query := c.PostForm("query")
+	a := analyzeQuery(query)
+	page := explainView{
+		Sentences: a.Sentences(),
+		Warnings:  a.Warnings,
+		Assistant: config.LLM.Enabled,
+	}
+
+	if c.PostForm("mode") == "llm" && config.LLM.Enabled {
+		ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+		defer cancel()
+
+		system := "Explain in plain language what the following SQL statement does for a colleague " +
+			"reviewing it: which tables it reads or changes, how it filters, joins and aggregates, " +
+			"and anything risky. Be brief and do not rewrite the query."
+		text, err := newLLMClient(config.LLM).Complete(ctx, system, query)
+		if err != nil {
+			log.Printf("Query explanation failed: %v", err)
+			page.Error = fmt.Sprintf("Assistant error: %v", err)
+		} else {
+			page.Explanation = strings.TrimSpace(text)
+		}
+	}
+
+	render(c, http.StatusOK, page)
+}
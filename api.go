@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const apiQueryTimeout = 30 * time.Second
+
+// apiError writes the error envelope shared by every /api/v1 endpoint.
+func apiError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": gin.H{
+			"code":    code,
+			"message": tr(c, message),
+		},
+	})
+}
+
+// apiTarget names a saved connection or carries inline connection fields.
+type apiTarget struct {
+	Connection string `json:"connection"`
+	connParams
+}
+
+type apiQueryRequest struct {
+	apiTarget
+	Query string        `json:"query" binding:"required"`
+	Args  []interface{} `json:"args"`
+	// NoCache runs the query even when the result cache has it
+	NoCache bool `json:"no_cache"`
+	// Chart returns the rows shaped as labels and series instead
+	Chart *chartOptions `json:"chart"`
+}
+
+type apiQueryResponse struct {
+	Columns      []string        `json:"columns,omitempty"`
+	Types        []string        `json:"types,omitempty"`
+	Rows         [][]interface{} `json:"rows,omitempty"`
+	RowsAffected *int64          `json:"rows_affected,omitempty"`
+	Elapsed      float64         `json:"elapsed_ms"`
+	// Truncated is set when only the first max_rows rows are returned
+	Truncated bool `json:"truncated,omitempty"`
+	// CachedAt is when a result served from the result cache was fetched
+	CachedAt *time.Time `json:"cached_at,omitempty"`
+	// Annotations are notes added by query hooks
+	Annotations []string `json:"annotations,omitempty"`
+	// Chart replaces the rows when the request asked for one
+	Chart *chartData `json:"chart,omitempty"`
+}
+
+func (t apiTarget) resolve(ctx context.Context) (connParams, error) {
+	if t.Connection == "" {
+		return t.connParams, nil
+	}
+	sc, err := getConnection(ctx, t.Connection)
+	return sc.connParams, err
+}
+
+// openTarget resolves and connects, writing the API error itself on failure.
+func openTarget(ctx context.Context, c *gin.Context, t apiTarget) (*sql.DB, connParams, bool) {
+	p, ok := resolveTarget(ctx, c, t)
+	if !ok {
+		return nil, p, false
+	}
+	db, ok := connectTarget(ctx, c, p)
+	return db, p, ok
+}
+
+func resolveTarget(ctx context.Context, c *gin.Context, t apiTarget) (connParams, bool) {
+	p, err := t.resolve(ctx)
+	if errors.Is(err, errConnectionNotFound) {
+		apiError(c, http.StatusNotFound, "connection_not_found", err.Error())
+		return p, false
+	}
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "internal", err.Error())
+		return p, false
+	}
+	return p, true
+}
+
+func connectTarget(ctx context.Context, c *gin.Context, p connParams) (*sql.DB, bool) {
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		apiError(c, http.StatusBadGateway, "connection_failed", err.Error())
+		return nil, false
+	}
+	return db, true
+}
+
+func apiQuery(c *gin.Context) {
+	var req apiQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiQueryTimeout)
+	defer cancel()
+
+	p, ok := resolveTarget(ctx, c, req.apiTarget)
+	if !ok {
+		return
+	}
+	// wait for a slot before connecting, a queued query holds no connection
+	release, err := acquireQuerySlot(ctx, p, "")
+	if err != nil {
+		apiError(c, http.StatusServiceUnavailable, "queue_timeout", err.Error())
+		return
+	}
+	defer release()
+	db, ok := connectTarget(ctx, c, p)
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	ev := newQueryEvent(c, p, "api", req.Query)
+	annotations, err := beforeQuery(ctx, ev)
+	if err != nil {
+		apiError(c, http.StatusForbidden, "query_blocked", err.Error())
+		return
+	}
+	started := time.Now()
+	cacheKey := resultCacheKey(p, req.Query, req.Args)
+	var resp *apiQueryResponse
+	if rs, fetched, ok := lookupResult(cacheKey); ok && !req.NoCache {
+		resp = &apiQueryResponse{Columns: rs.Columns, Types: rs.Types, Rows: rs.Rows, Truncated: rs.Truncated, CachedAt: &fetched}
+	} else if resp, err = runAPIQuery(ctx, db, req.Query, req.Args); err == nil {
+		storeResult(cacheKey, &resultSet{Columns: resp.Columns, Types: resp.Types, Rows: resp.Rows, Truncated: resp.Truncated})
+	}
+	if err == nil {
+		err = p.transcodeRows(resp.Rows)
+	}
+	annotations = append(annotations, afterQuery(ctx, ev, started, err)...)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "query_failed", err.Error())
+		return
+	}
+	if req.Chart != nil {
+		if resp.Columns == nil {
+			apiError(c, http.StatusBadRequest, "chart_failed", "charts are drawn from queries that return rows")
+			return
+		}
+		chart, err := shapeChart(&resultSet{Columns: resp.Columns, Types: resp.Types, Rows: resp.Rows}, p.Driver, *req.Chart)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, "chart_failed", err.Error())
+			return
+		}
+		resp.Rows, resp.Chart = nil, &chart
+	}
+	resp.Annotations = annotations
+	c.JSON(http.StatusOK, resp)
+}
+
+// runAPIQuery runs one statement, returning its rows or affected row count.
+func runAPIQuery(ctx context.Context, db *sql.DB, query string, args []interface{}) (*apiQueryResponse, error) {
+	started := time.Now()
+	resp := &apiQueryResponse{}
+	if returnsRows(query) {
+		rs, err := fetchResultMax(ctx, db, config.MaxRows, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		resp.Columns, resp.Types, resp.Rows, resp.Truncated = rs.Columns, rs.Types, rs.Rows, rs.Truncated
+	} else {
+		res, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			resp.RowsAffected = &n
+		}
+	}
+	resp.Elapsed = float64(time.Since(started).Microseconds()) / 1000
+	return resp, nil
+}
+
+func apiListConnections(c *gin.Context) {
+	conns, err := listConnections(c.Request.Context())
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "internal", err.Error())
+		return
+	}
+	// Passwords never leave the server
+	for i := range conns {
+		conns[i].Password = ""
+	}
+	c.JSON(http.StatusOK, gin.H{"connections": conns})
+}
+
+func apiSaveConnection(c *gin.Context) {
+	var sc savedConnection
+	if err := c.ShouldBindJSON(&sc); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if sc.Name == "" || sc.Driver == "" {
+		apiError(c, http.StatusBadRequest, "invalid_request", "name and driver are required")
+		return
+	}
+	if err := sc.validateAddress(); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if sc.TLSFingerprint != "" {
+		fp, err := normalizeFingerprint(sc.TLSFingerprint)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		sc.TLSFingerprint = fp
+	}
+	if _, err := parseQueryTags(sc.QueryTags); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if _, err := sc.mysqlCharset(); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if _, err := sc.resultDecoder(); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if err := saveConnection(c.Request.Context(), sc); err != nil {
+		apiError(c, http.StatusInternalServerError, "internal", err.Error())
+		return
+	}
+	sc.Password = ""
+	c.JSON(http.StatusOK, sc)
+}
+
+func apiDeleteConnection(c *gin.Context) {
+	err := deleteConnection(c.Request.Context(), c.Param("name"))
+	if errors.Is(err, errConnectionNotFound) {
+		apiError(c, http.StatusNotFound, "connection_not_found", err.Error())
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "internal", err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiSchema accepts either ?connection=name or a JSON apiTarget body.
+func apiSchema(c *gin.Context) {
+	t := apiTarget{Connection: c.Query("connection")}
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&t); err != nil {
+			apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiQueryTimeout)
+	defer cancel()
+
+	db, p, ok := openTarget(ctx, c, t)
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	tables, err := schemaTables(ctx, db, p)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "schema_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tables": tables})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// queryAssertion is an expectation on the result of a saved query:
+//
+//	rows      the row count is within Min..Max
+//	not_null  Column holds no NULLs
+//	range     every non-NULL value of Column is a number within Min..Max
+//
+// Missing bounds are open.
+type queryAssertion struct {
+	Kind   string   `json:"kind"`
+	Column string   `json:"column,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+}
+
+// assertionResult is the outcome of one assertion in a check run.
+type assertionResult struct {
+	Assertion string `json:"assertion"`
+	Passed    bool   `json:"passed"`
+	Detail    string `json:"detail"`
+}
+
+// parseAssertions reads one assertion per line:
+//
+//	rows = 0
+//	rows >= 1
+//	rows between 1 and 500
+//	customer_id not null
+//	amount between 0 and 10000
+//	discount <= 0.5
+//
+// "rows" is the row count; any other subject is a result column.
+func parseAssertions(text string) ([]queryAssertion, error) {
+	var out []queryAssertion
+	for n, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		a, err := parseAssertion(fields)
+		if err != nil {
+			return nil, fmt.Errorf("assertion on line %d: %v", n+1, err)
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+func parseAssertion(fields []string) (queryAssertion, error) {
+	a := queryAssertion{Kind: "range", Column: fields[0]}
+	if strings.EqualFold(fields[0], "rows") {
+		a = queryAssertion{Kind: "rows"}
+	}
+	number := func(s string) (*float64, error) {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+		return &f, nil
+	}
+
+	var err error
+	switch {
+	case len(fields) == 3 && strings.EqualFold(fields[1], "not") && strings.EqualFold(fields[2], "null"):
+		if a.Kind == "rows" {
+			return a, fmt.Errorf("the row count is never NULL")
+		}
+		a.Kind = "not_null"
+	case len(fields) == 3 && (fields[1] == "=" || fields[1] == ">=" || fields[1] == "<="):
+		var v *float64
+		if v, err = number(fields[2]); err != nil {
+			return a, err
+		}
+		if fields[1] != "<=" {
+			a.Min = v
+		}
+		if fields[1] != ">=" {
+			a.Max = v
+		}
+	case len(fields) == 5 && strings.EqualFold(fields[1], "between") && strings.EqualFold(fields[3], "and"):
+		if a.Min, err = number(fields[2]); err != nil {
+			return a, err
+		}
+		if a.Max, err = number(fields[4]); err != nil {
+			return a, err
+		}
+		if *a.Min > *a.Max {
+			return a, fmt.Errorf("%s is more than %s", fields[2], fields[4])
+		}
+	default:
+		return a, fmt.Errorf("expected \"<column|rows> = N\", \">= N\", \"<= N\", \"between A and B\" or \"<column> not null\"")
+	}
+	return a, nil
+}
+
+// String renders the assertion in the syntax parseAssertions reads.
+func (a queryAssertion) String() string {
+	subject := a.Column
+	if a.Kind == "rows" {
+		subject = "rows"
+	}
+	num := func(f *float64) string { return strconv.FormatFloat(*f, 'f', -1, 64) }
+	switch {
+	case a.Kind == "not_null":
+		return subject + " not null"
+	case a.Min != nil && a.Max != nil && *a.Min == *a.Max:
+		return subject + " = " + num(a.Min)
+	case a.Min != nil && a.Max != nil:
+		return subject + " between " + num(a.Min) + " and " + num(a.Max)
+	case a.Min != nil:
+		return subject + " >= " + num(a.Min)
+	case a.Max != nil:
+		return subject + " <= " + num(a.Max)
+	}
+	return subject
+}
+
+func (a queryAssertion) within(f float64) bool {
+	return (a.Min == nil || f >= *a.Min) && (a.Max == nil || f <= *a.Max)
+}
+
+// numericValue reads a result value as a number; drivers return DECIMAL
+// as text.
+func numericValue(v interface{}) (float64, bool) {
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return f, err == nil
+	}
+	return toFloat(v)
+}
+
+// check evaluates the assertion against a result.
+func (a queryAssertion) check(rs *resultSet) assertionResult {
+	r := assertionResult{Assertion: a.String()}
+	if a.Kind == "rows" {
+		r.Passed = a.within(float64(len(rs.Rows)))
+		r.Detail = fmt.Sprintf("%d rows", len(rs.Rows))
+		return r
+	}
+
+	col := -1
+	for i, name := range rs.Columns {
+		if name == a.Column || col < 0 && strings.EqualFold(name, a.Column) {
+			col = i
+		}
+	}
+	if col < 0 {
+		r.Detail = fmt.Sprintf("the result has no column %s", a.Column)
+		return r
+	}
+
+	bad, nulls := 0, 0
+	var example interface{}
+	for _, row := range rs.Rows {
+		v := row[col]
+		if v == nil {
+			nulls++
+			continue
+		}
+		if a.Kind != "range" {
+			continue
+		}
+		if f, ok := numericValue(v); !ok || !a.within(f) {
+			if bad == 0 {
+				example = v
+			}
+			bad++
+		}
+	}
+	switch a.Kind {
+	case "not_null":
+		r.Passed = nulls == 0
+		r.Detail = fmt.Sprintf("%d of %d rows are NULL", nulls, len(rs.Rows))
+	default:
+		r.Passed = bad == 0
+		r.Detail = fmt.Sprintf("%d of %d values outside", bad, len(rs.Rows)-nulls)
+		if bad > 0 {
+			r.Detail += fmt.Sprintf(", e.g. %v", example)
+		}
+	}
+	return r
+}
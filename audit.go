@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditEntry is one row of the audit log. Ref ties related records
+// together, e.g. an export id embedded in the exported file.
+type auditEntry struct {
+	ID     int64     `json:"id"`
+	At     time.Time `json:"at"`
+	User   string    `json:"user"`
+	Action string    `json:"action"`
+	Target string    `json:"target"`
+	Query  string    `json:"query,omitempty"`
+	Ref    string    `json:"ref,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// recordAudit appends to the audit log. Failures are logged rather than
+// returned: a broken audit store must not hide what happened from the log.
+func recordAudit(ctx context.Context, e auditEntry) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	_, err := store.ExecContext(ctx, `
+		INSERT INTO audit_log (at, user, action, target, query, ref, detail)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.At.Unix(), e.User, e.Action, e.Target, e.Query, e.Ref, e.Detail)
+	if err != nil {
+		log.Printf("Failed to write audit entry %s by %s (%s): %v", e.Action, e.User, e.Ref, err)
+	}
+}
+
+// listAudit returns the newest entries first, optionally only those with ref.
+func listAudit(ctx context.Context, ref string, limit int) ([]auditEntry, error) {
+	rows, err := store.QueryContext(ctx, `
+		SELECT id, at, user, action, target, query, ref, detail
+		FROM audit_log
+		WHERE ? = '' OR ref = ?
+		ORDER BY id DESC
+		LIMIT ?`, ref, ref, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []auditEntry{}
+	for rows.Next() {
+		var e auditEntry
+		var at int64
+		if err := rows.Scan(&e.ID, &at, &e.User, &e.Action, &e.Target, &e.Query, &e.Ref, &e.Detail); err != nil {
+			return nil, err
+		}
+		e.At = time.Unix(at, 0)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func apiAudit(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		apiError(c, http.StatusBadRequest, "invalid_request", "limit must be between 1 and 1000")
+		return
+	}
+	entries, err := listAudit(c.Request.Context(), c.Query("ref"), limit)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "internal", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries})
+}
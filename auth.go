@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// identity is the normalized caller every provider produces; RBAC, audit and
+// quotas only ever look at this.
+type identity struct {
+	User     string   `json:"user"`
+	Groups   []string `json:"groups,omitempty"`
+	Provider string   `json:"provider"`
+}
+
+func (id *identity) InGroup(group string) bool {
+	for _, g := range id.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+var errUnauthenticated = errors.New("not authenticated")
+
+type authProvider interface {
+	Name() string
+	// Authenticate returns errUnauthenticated when the request carries no
+	// usable credentials.
+	Authenticate(c *gin.Context) (*identity, error)
+	// Challenge answers an unauthenticated request, e.g. 401 or a redirect.
+	Challenge(c *gin.Context)
+}
+
+// authRoutes is implemented by providers that need endpoints of their own,
+// such as the OIDC login callback.
+type authRoutes interface {
+	RegisterRoutes(r *gin.Engine)
+}
+
+type authConfig struct {
+	// Provider is one of "none" (default), "local", "oidc", "ldap", "header"
+	Provider string `json:"provider"`
+	// Secret signs session cookies; a random one is used when empty
+	Secret string           `json:"secret"`
+	Local  localAuthConfig  `json:"local"`
+	OIDC   oidcAuthConfig   `json:"oidc"`
+	LDAP   ldapAuthConfig   `json:"ldap"`
+	Header headerAuthConfig `json:"header"`
+}
+
+func newAuthProvider(cfg authConfig) (authProvider, error) {
+	if cfg.Secret == "" {
+		cfg.Secret = randomID(32)
+	}
+	switch cfg.Provider {
+	case "", "none":
+		return anonymousProvider{}, nil
+	case "local":
+		return newLocalProvider(cfg.Local)
+	case "oidc":
+		return newOIDCProvider(cfg.OIDC, cfg.Secret)
+	case "ldap":
+		return newLDAPProvider(cfg.LDAP)
+	case "header":
+		return newHeaderProvider(cfg.Header)
+	}
+	return nil, fmt.Errorf("unknown auth provider %q", cfg.Provider)
+}
+
+const identityKey = "identity"
+
+func authMiddleware(provider authProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, "/auth/") {
+			c.Next()
+			return
+		}
+		// a share link is its own credential
+		if strings.HasPrefix(path, "/share/") && !config.Share.RequireLogin {
+			c.Next()
+			return
+		}
+
+		// API tokens work with every provider
+		if token, ok := bearerToken(c); ok && strings.HasPrefix(path, "/api/") {
+			id, err := tokenIdentity(c.Request.Context(), token)
+			if err != nil {
+				if !errors.Is(err, errUnauthenticated) {
+					log.Printf("Token authentication failed: %v", err)
+				}
+				unauthorized(c, "Invalid or expired API token")
+				c.Abort()
+				return
+			}
+			c.Set(identityKey, id)
+			c.Next()
+			return
+		}
+
+		id, err := provider.Authenticate(c)
+		if err != nil {
+			if !errors.Is(err, errUnauthenticated) {
+				log.Printf("Authentication via %s failed: %v", provider.Name(), err)
+			}
+			provider.Challenge(c)
+			c.Abort()
+			return
+		}
+		c.Set(identityKey, id)
+		c.Next()
+	}
+}
+
+func currentIdentity(c *gin.Context) *identity {
+	if v, ok := c.Get(identityKey); ok {
+		return v.(*identity)
+	}
+	return &identity{User: "anonymous"}
+}
+
+// unauthorized answers in the API error envelope for /api and as text otherwise.
+func unauthorized(c *gin.Context, message string) {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		apiError(c, http.StatusUnauthorized, "unauthorized", message)
+		return
+	}
+	c.String(http.StatusUnauthorized, message)
+}
+
+type anonymousProvider struct{}
+
+func (anonymousProvider) Name() string { return "none" }
+
+func (anonymousProvider) Authenticate(c *gin.Context) (*identity, error) {
+	return &identity{User: "anonymous", Provider: "none"}, nil
+}
+
+func (anonymousProvider) Challenge(c *gin.Context) {}
+
+// signValue returns payload.mac, both base64url encoded.
+func signValue(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func verifyValue(secret, value string) ([]byte, bool) {
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	want, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return payload, hmac.Equal(mac.Sum(nil), want)
+}
+
+const identityCookie = "sa_identity"
+
+type identityClaims struct {
+	identity
+	Expires int64 `json:"exp"`
+}
+
+func setIdentityCookie(c *gin.Context, secret string, id *identity, ttl time.Duration) {
+	payload, _ := json.Marshal(identityClaims{identity: *id, Expires: time.Now().Add(ttl).Unix()})
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(identityCookie, signValue(secret, payload), int(ttl.Seconds()), "/", "", false, true)
+}
+
+func identityFromCookie(c *gin.Context, secret string) (*identity, bool) {
+	value, err := c.Cookie(identityCookie)
+	if err != nil {
+		return nil, false
+	}
+	payload, ok := verifyValue(secret, value)
+	if !ok {
+		return nil, false
+	}
+	var claims identityClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || time.Now().Unix() > claims.Expires {
+		return nil, false
+	}
+	return &claims.identity, true
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+)
+
+type headerAuthConfig struct {
+	// UserHeader defaults to X-Forwarded-User, GroupsHeader to
+	// X-Auth-Request-Groups (comma separated), as set by oauth2-proxy
+	UserHeader   string `json:"user_header"`
+	GroupsHeader string `json:"groups_header"`
+
+	// TrustedProxies lists the CIDRs allowed to assert identities
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// JWKSURL enables verification of a signed identity assertion such as
+	// Pomerium's X-Pomerium-Jwt-Assertion; claims then win over plain headers
+	JWKSURL     string `json:"jwks_url"`
+	JWTHeader   string `json:"jwt_header"`
+	Issuer      string `json:"issuer"`
+	Audience    string `json:"audience"`
+	UserClaim   string `json:"user_claim"`
+	GroupsClaim string `json:"groups_claim"`
+}
+
+// headerProvider trusts the identity set by an authenticating reverse proxy,
+// provided the request provably came through it: either from a trusted
+// network, or carrying an assertion signed by the proxy, or both.
+type headerProvider struct {
+	cfg      headerAuthConfig
+	trusted  []*net.IPNet
+	verifier *oidc.IDTokenVerifier
+}
+
+func newHeaderProvider(cfg headerAuthConfig) (*headerProvider, error) {
+	if cfg.UserHeader == "" {
+		cfg.UserHeader = "X-Forwarded-User"
+	}
+	if cfg.GroupsHeader == "" {
+		cfg.GroupsHeader = "X-Auth-Request-Groups"
+	}
+	if cfg.JWTHeader == "" {
+		cfg.JWTHeader = "X-Pomerium-Jwt-Assertion"
+	}
+	if cfg.UserClaim == "" {
+		cfg.UserClaim = "email"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	if len(cfg.TrustedProxies) == 0 && cfg.JWKSURL == "" {
+		return nil, fmt.Errorf("header auth needs trusted_proxies, jwks_url or both")
+	}
+
+	p := &headerProvider{cfg: cfg}
+	for _, cidr := range cfg.TrustedProxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		p.trusted = append(p.trusted, network)
+	}
+	if cfg.JWKSURL != "" {
+		keys := oidc.NewRemoteKeySet(context.Background(), cfg.JWKSURL)
+		p.verifier = oidc.NewVerifier(cfg.Issuer, keys, &oidc.Config{
+			ClientID:          cfg.Audience,
+			SkipClientIDCheck: cfg.Audience == "",
+			SkipIssuerCheck:   cfg.Issuer == "",
+		})
+	}
+	return p, nil
+}
+
+func (p *headerProvider) Name() string { return "header" }
+
+// fromTrustedProxy checks the socket peer, never X-Forwarded-For, which the
+// client controls.
+func (p *headerProvider) fromTrustedProxy(c *gin.Context) bool {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, network := range p.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *headerProvider) Authenticate(c *gin.Context) (*identity, error) {
+	if len(p.trusted) > 0 && !p.fromTrustedProxy(c) {
+		return nil, fmt.Errorf("request from untrusted address %s", c.Request.RemoteAddr)
+	}
+
+	user := c.GetHeader(p.cfg.UserHeader)
+	if p.verifier != nil {
+		assertion := c.GetHeader(p.cfg.JWTHeader)
+		if assertion == "" {
+			return nil, errUnauthenticated
+		}
+		token, err := p.verifier.Verify(c.Request.Context(), assertion)
+		if err != nil {
+			return nil, fmt.Errorf("identity assertion: %w", err)
+		}
+		id, err := identityFromToken(token, p.cfg.UserClaim, p.cfg.GroupsClaim, p.Name())
+		if err != nil {
+			return nil, err
+		}
+		// A plain header that disagrees with the signed claims was injected
+		if user != "" && user != id.User {
+			return nil, fmt.Errorf("%s %q does not match signed identity %q", p.cfg.UserHeader, user, id.User)
+		}
+		return id, nil
+	}
+
+	if user == "" {
+		return nil, errUnauthenticated
+	}
+	id := &identity{User: user, Provider: p.Name()}
+	for _, g := range strings.Split(c.GetHeader(p.cfg.GroupsHeader), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			id.Groups = append(id.Groups, g)
+		}
+	}
+	return id, nil
+}
+
+func (p *headerProvider) Challenge(c *gin.Context) {
+	unauthorized(c, "Missing identity from trusted proxy")
+}
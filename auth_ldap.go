@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-ldap/ldap/v3"
+)
+
+type ldapAuthConfig struct {
+	// URL is e.g. ldaps://ldap.example.com:636
+	URL          string `json:"url"`
+	StartTLS     bool   `json:"start_tls"`
+	BindDN       string `json:"bind_dn"`
+	BindPassword string `json:"bind_password"`
+	BaseDN       string `json:"base_dn"`
+	// UserFilter gets the escaped login substituted for %s, default "(uid=%s)"
+	UserFilter string `json:"user_filter"`
+	// GroupAttribute defaults to "memberOf"; group names are the first RDN value
+	GroupAttribute string `json:"group_attribute"`
+}
+
+const ldapCacheTTL = 5 * time.Minute
+
+type ldapCacheEntry struct {
+	id      *identity
+	expires time.Time
+}
+
+// ldapProvider verifies HTTP basic credentials with a search-then-bind against
+// the directory. Successful logins are cached briefly so that every htmx
+// request doesn't cost two binds.
+type ldapProvider struct {
+	cfg ldapAuthConfig
+
+	mu    sync.Mutex
+	cache map[[32]byte]ldapCacheEntry
+}
+
+func newLDAPProvider(cfg ldapAuthConfig) (*ldapProvider, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, fmt.Errorf("ldap auth needs url and base_dn")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	return &ldapProvider{cfg: cfg, cache: make(map[[32]byte]ldapCacheEntry)}, nil
+}
+
+func (p *ldapProvider) Name() string { return "ldap" }
+
+func (p *ldapProvider) Authenticate(c *gin.Context) (*identity, error) {
+	user, password, ok := c.Request.BasicAuth()
+	// An empty password would be an unauthenticated bind, which succeeds
+	if !ok || user == "" || password == "" {
+		return nil, errUnauthenticated
+	}
+
+	key := sha256.Sum256([]byte(user + "\x00" + password))
+	p.mu.Lock()
+	entry, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.id, nil
+	}
+
+	id, err := p.login(user, password)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.cache[key] = ldapCacheEntry{id: id, expires: time.Now().Add(ldapCacheTTL)}
+	p.mu.Unlock()
+	return id, nil
+}
+
+func (p *ldapProvider) login(user, password string) (*identity, error) {
+	conn, err := ldap.DialURL(p.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if p.cfg.StartTLS {
+		u, err := url.Parse(p.cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			return nil, err
+		}
+	}
+	if p.cfg.BindDN != "" {
+		if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("service bind: %w", err)
+		}
+	}
+
+	res, err := conn.Search(ldap.NewSearchRequest(
+		p.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(p.cfg.UserFilter, ldap.EscapeFilter(user)),
+		[]string{p.cfg.GroupAttribute}, nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Entries) != 1 {
+		return nil, errUnauthenticated
+	}
+	entry := res.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return nil, errUnauthenticated
+	}
+
+	id := &identity{User: user, Provider: p.Name()}
+	for _, group := range entry.GetAttributeValues(p.cfg.GroupAttribute) {
+		dn, err := ldap.ParseDN(group)
+		if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+			id.Groups = append(id.Groups, group)
+			continue
+		}
+		id.Groups = append(id.Groups, dn.RDNs[0].Attributes[0].Value)
+	}
+	return id, nil
+}
+
+func (p *ldapProvider) Challenge(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="SimpleAdmin1File"`)
+	unauthorized(c, "Authentication required")
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type localUser struct {
+	// Password is a bcrypt hash
+	Password string   `json:"password"`
+	Groups   []string `json:"groups"`
+}
+
+type localAuthConfig struct {
+	Users map[string]localUser `json:"users"`
+}
+
+// localProvider checks HTTP basic credentials against users from the config.
+type localProvider struct {
+	users map[string]localUser
+}
+
+func newLocalProvider(cfg localAuthConfig) (*localProvider, error) {
+	return &localProvider{users: cfg.Users}, nil
+}
+
+func (p *localProvider) Name() string { return "local" }
+
+func (p *localProvider) Authenticate(c *gin.Context) (*identity, error) {
+	user, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	u, ok := p.users[user]
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)); err != nil {
+		return nil, errUnauthenticated
+	}
+	return &identity{User: user, Groups: u.Groups, Provider: p.Name()}, nil
+}
+
+func (p *localProvider) Challenge(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="SimpleAdmin1File"`)
+	unauthorized(c, "Authentication required")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+type oidcAuthConfig struct {
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+	// UserClaim defaults to "email", GroupsClaim to "groups"
+	UserClaim   string `json:"user_claim"`
+	GroupsClaim string `json:"groups_claim"`
+}
+
+const oidcSessionTTL = 8 * time.Hour
+
+// oidcProvider runs the authorization code flow for browsers and accepts ID
+// tokens as bearer tokens for API clients.
+type oidcProvider struct {
+	cfg      oidcAuthConfig
+	secret   string
+	verifier *oidc.IDTokenVerifier
+	oauth    oauth2.Config
+}
+
+func newOIDCProvider(cfg oidcAuthConfig, secret string) (*oidcProvider, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if cfg.UserClaim == "" {
+		cfg.UserClaim = "email"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+
+	return &oidcProvider{
+		cfg:      cfg,
+		secret:   secret,
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+		},
+	}, nil
+}
+
+func (p *oidcProvider) Name() string { return "oidc" }
+
+func (p *oidcProvider) Authenticate(c *gin.Context) (*identity, error) {
+	if id, ok := identityFromCookie(c, p.secret); ok {
+		return id, nil
+	}
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return p.verify(c.Request.Context(), token)
+	}
+	return nil, errUnauthenticated
+}
+
+func (p *oidcProvider) verify(ctx context.Context, rawIDToken string) (*identity, error) {
+	token, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	return identityFromToken(token, p.cfg.UserClaim, p.cfg.GroupsClaim, p.Name())
+}
+
+// identityFromToken maps verified JWT claims onto an identity, falling back
+// to the subject when the user claim is missing.
+func identityFromToken(token *oidc.IDToken, userClaim, groupsClaim, provider string) (*identity, error) {
+	var claims map[string]interface{}
+	if err := token.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	id := &identity{User: token.Subject, Provider: provider}
+	if user, ok := claims[userClaim].(string); ok && user != "" {
+		id.User = user
+	}
+	if groups, ok := claims[groupsClaim].([]interface{}); ok {
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	}
+	return id, nil
+}
+
+func (p *oidcProvider) Challenge(c *gin.Context) {
+	switch {
+	case strings.HasPrefix(c.Request.URL.Path, "/api/"):
+		unauthorized(c, "Bearer ID token required")
+	case c.GetHeader("HX-Request") != "":
+		// htmx swaps fragments, so ask it to navigate instead
+		c.Header("HX-Redirect", "/auth/login")
+		c.Status(http.StatusUnauthorized)
+	default:
+		c.Redirect(http.StatusFound, "/auth/login")
+	}
+}
+
+const oidcStateCookie = "sa_oidc_state"
+
+func (p *oidcProvider) RegisterRoutes(r *gin.Engine) {
+	r.GET("/auth/login", func(c *gin.Context) {
+		state := randomID(16)
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(oidcStateCookie, state, 600, "/auth/", "", false, true)
+		c.Redirect(http.StatusFound, p.oauth.AuthCodeURL(state))
+	})
+
+	r.GET("/auth/callback", func(c *gin.Context) {
+		state, err := c.Cookie(oidcStateCookie)
+		if err != nil || state == "" || state != c.Query("state") {
+			c.String(http.StatusBadRequest, "Invalid login state")
+			return
+		}
+		c.SetCookie(oidcStateCookie, "", -1, "/auth/", "", false, true)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		token, err := p.oauth.Exchange(ctx, c.Query("code"))
+		if err != nil {
+			c.String(http.StatusUnauthorized, "Login failed: %v", err)
+			return
+		}
+		rawIDToken, ok := token.Extra("id_token").(string)
+		if !ok {
+			c.String(http.StatusUnauthorized, "Login failed: no id_token in response")
+			return
+		}
+		id, err := p.verify(ctx, rawIDToken)
+		if err != nil {
+			c.String(http.StatusUnauthorized, "Login failed: %v", err)
+			return
+		}
+
+		setIdentityCookie(c, p.secret, id, oidcSessionTTL)
+		c.Redirect(http.StatusFound, "/")
+	})
+}
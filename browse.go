@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// browseDatabases lists the databases on the connected server for the sidebar.
+func browseDatabases(c *gin.Context) {
+	p := connParamsFromForm(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		render(c, http.StatusServiceUnavailable, databasesView{Error: fmt.Sprintf("Failed to connect to database: %v", err)})
+		return
+	}
+	defer db.Close()
+
+	databases, err := listDatabases(ctx, db, p.Driver)
+	if err != nil {
+		render(c, http.StatusBadRequest, databasesView{Error: fmt.Sprintf("Failed to list databases: %v", err)})
+		return
+	}
+
+	render(c, http.StatusOK, databasesView{Databases: databases, Current: p.Database})
+}
+
+// browseTables lists the tables and views of the selected database.
+func browseTables(c *gin.Context) {
+	p := connParamsFromForm(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		render(c, http.StatusServiceUnavailable, schemaView{Error: fmt.Sprintf("Failed to connect to database: %v", err)})
+		return
+	}
+	defer db.Close()
+
+	tables, err := schemaSummaries(ctx, db, p)
+	if err != nil {
+		render(c, http.StatusBadRequest, schemaView{Error: fmt.Sprintf("Failed to list tables: %v", err)})
+		return
+	}
+
+	var age time.Duration
+	if at := schemaLoadedAt(p); !at.IsZero() {
+		age = time.Since(at).Round(time.Second)
+	}
+	render(c, http.StatusOK, schemaView{
+		Tables:      tables,
+		Destructive: !config.DisableDestructive,
+		Dump:        dumpDrivers[p.Driver],
+		CacheAge:    age,
+	})
+}
+
+// tableStructure shows the columns of a table: types, nullability, defaults.
+func tableStructure(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name := c.PostForm("table")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		render(c, http.StatusServiceUnavailable, structureView{Error: fmt.Sprintf("Failed to connect to database: %v", err)})
+		return
+	}
+	defer db.Close()
+
+	tables, err := schemaTables(ctx, db, p)
+	if err != nil {
+		render(c, http.StatusBadRequest, structureView{Error: fmt.Sprintf("Failed to read columns: %v", err)})
+		return
+	}
+	table, ok := findTable(tables, name)
+	if !ok {
+		render(c, http.StatusNotFound, structureView{Error: "Table not found: " + name})
+		return
+	}
+
+	render(c, http.StatusOK, structureView{Name: name, Table: table})
+}
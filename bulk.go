@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	bulkTimeout      = 10 * time.Minute
+	bulkMaxRows      = 100000
+	bulkDefaultBatch = 500
+	// failures listed on the page; the CSV report has all of them
+	bulkShownFailures = 100
+)
+
+const (
+	bulkOK         = "ok"
+	bulkFailed     = "failed"
+	bulkRolledBack = "rolled back"
+	bulkSkipped    = "skipped"
+)
+
+// bulkRow is one parameter set from the CSV and what happened to it. Line is
+// the 1-based line in the uploaded file.
+type bulkRow struct {
+	Line   int
+	Values []string
+	// Null marks values that are NULL whatever null_empty says
+	Null     []bool
+	Status   string
+	Affected int64
+	Error    string
+}
+
+type bulkSummary struct {
+	Rows       []bulkRow
+	Succeeded  int
+	Failed     int
+	RolledBack int
+	Skipped    int
+	Affected   int64
+}
+
+var pgPlaceholder = regexp.MustCompile(`^\$([0-9]+)$`)
+
+// countPlaceholders returns how many parameters a statement takes: the
+// highest $n for PostgreSQL, the number of ? marks otherwise.
+func countPlaceholders(driver, stmt string) int {
+	n := 0
+	for _, t := range lexSQL(stmt, driver, false) {
+		if driver == "postgres" {
+			if m := pgPlaceholder.FindStringSubmatch(t.Text); m != nil && t.Kind == tokWord {
+				i, _ := strconv.Atoi(m[1])
+				n = max(n, i)
+			}
+		} else if t.is("?") {
+			n++
+		}
+	}
+	return n
+}
+
+// runBulk executes stmt once per row in transactions of batch rows. A
+// failed row is recorded and skipped, unless stopOnError is set, in which
+// case the current batch is rolled back and the remaining rows are skipped.
+// PostgreSQL needs a savepoint per row for the transaction to survive an
+// error. ClickHouse has no transactions, and a prepared INSERT there turns
+// into a batch insert, so each row is a plain Exec of its own.
+func runBulk(ctx context.Context, db *sql.DB, driver, stmt string, rows []bulkRow, batch int, nullEmpty, stopOnError bool) bulkSummary {
+	params := countPlaceholders(driver, stmt)
+	args := func(r *bulkRow) ([]interface{}, error) {
+		if len(r.Values) != params {
+			return nil, fmt.Errorf("expected %d values, got %d", params, len(r.Values))
+		}
+		out := make([]interface{}, len(r.Values))
+		for i, v := range r.Values {
+			if (v == "" && nullEmpty) || (i < len(r.Null) && r.Null[i]) {
+				out[i] = nil
+			} else {
+				out[i] = v
+			}
+		}
+		return out, nil
+	}
+
+	transactional := driver != "clickhouse"
+	stopped := false
+	for start := 0; start < len(rows); start += batch {
+		end := min(start+batch, len(rows))
+		chunk := rows[start:end]
+		if stopped {
+			for i := range chunk {
+				chunk[i].Status = bulkSkipped
+			}
+			continue
+		}
+
+		var tx *sql.Tx
+		var prepared *sql.Stmt
+		var err error
+		exec := func(values []interface{}) (sql.Result, error) {
+			return db.ExecContext(ctx, stmt, values...)
+		}
+		if transactional {
+			tx, err = db.BeginTx(ctx, nil)
+			if err == nil {
+				prepared, err = tx.PrepareContext(ctx, stmt)
+				if err != nil {
+					tx.Rollback()
+				} else {
+					exec = func(values []interface{}) (sql.Result, error) {
+						return prepared.ExecContext(ctx, values...)
+					}
+				}
+			}
+		}
+		if err != nil {
+			for i := range chunk {
+				chunk[i].Status, chunk[i].Error = bulkFailed, err.Error()
+			}
+			stopped = stopOnError
+			continue
+		}
+
+		for i := range chunk {
+			r := &chunk[i]
+			if stopped {
+				r.Status = bulkSkipped
+				continue
+			}
+			values, err := args(r)
+			if err == nil {
+				if driver == "postgres" {
+					_, err = tx.ExecContext(ctx, "SAVEPOINT bulk_row")
+				}
+				if err == nil {
+					var res sql.Result
+					res, err = exec(values)
+					if err == nil {
+						r.Affected, _ = res.RowsAffected()
+					} else if driver == "postgres" {
+						tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT bulk_row")
+					}
+				}
+			}
+			if err != nil {
+				r.Status, r.Error = bulkFailed, err.Error()
+				stopped = stopOnError
+				continue
+			}
+			r.Status = bulkOK
+		}
+		if prepared != nil {
+			prepared.Close()
+		}
+		if !transactional {
+			continue
+		}
+		if stopped {
+			tx.Rollback()
+			for i := range chunk {
+				if chunk[i].Status == bulkOK {
+					chunk[i].Status, chunk[i].Affected = bulkRolledBack, 0
+				}
+			}
+			continue
+		}
+		if err := tx.Commit(); err != nil {
+			for i := range chunk {
+				if chunk[i].Status == bulkOK {
+					chunk[i].Status, chunk[i].Affected, chunk[i].Error = bulkFailed, 0, "commit: "+err.Error()
+				}
+			}
+			stopped = stopOnError
+		}
+	}
+
+	return summarizeBulk(rows)
+}
+
+func summarizeBulk(rows []bulkRow) bulkSummary {
+	s := bulkSummary{Rows: rows}
+	for _, r := range rows {
+		switch r.Status {
+		case bulkOK:
+			s.Succeeded++
+			s.Affected += r.Affected
+		case bulkFailed:
+			s.Failed++
+		case bulkRolledBack:
+			s.RolledBack++
+		case bulkSkipped:
+			s.Skipped++
+		}
+	}
+	return s
+}
+
+// readBulkCSV reads the uploaded parameter sets, dropping the header if asked.
+func readBulkCSV(r io.Reader, header bool, comma rune) ([]bulkRow, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	var rows []bulkRow
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header && line == 1 {
+			continue
+		}
+		if len(rows) == bulkMaxRows {
+			return nil, fmt.Errorf("more than %d rows, split the file", bulkMaxRows)
+		}
+		rows = append(rows, bulkRow{Line: line, Values: record})
+	}
+	return rows, nil
+}
+
+func writeBulkReport(w io.Writer, rows []bulkRow) error {
+	cw := csv.NewWriter(w)
+	for _, r := range rows {
+		record := append([]string{strconv.Itoa(r.Line), r.Status, strconv.FormatInt(r.Affected, 10), r.Error}, r.Values...)
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// bulkPage is the bulk.html view of a summary, listing the first failures.
+func bulkPage(summary bulkSummary) bulkView {
+	var failures []bulkRow
+	for _, r := range summary.Rows {
+		if r.Status == bulkFailed && len(failures) < bulkShownFailures {
+			failures = append(failures, r)
+		}
+	}
+	return bulkView{
+		Summary:  summary,
+		Total:    len(summary.Rows),
+		Failures: failures,
+		More:     summary.Failed - len(failures),
+	}
+}
+
+// bulkHandler runs a parameterized statement once per row of an uploaded
+// CSV. With report=csv the per-row outcome comes back as a CSV download
+// (line, status, affected, error, then the original values).
+func bulkHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	stmt := c.PostForm("statement")
+	fail := func(status int, msg string) {
+		if c.PostForm("report") == "csv" {
+			c.String(status, "%s", msg)
+			return
+		}
+		render(c, status, errorView{Template: "bulk.html", Error: msg})
+	}
+	if stmt == "" {
+		fail(http.StatusBadRequest, "Statement is required")
+		return
+	}
+	batch, err := strconv.Atoi(c.DefaultPostForm("batch", strconv.Itoa(bulkDefaultBatch)))
+	if err != nil || batch < 1 {
+		fail(http.StatusBadRequest, "Invalid batch size")
+		return
+	}
+	upload, err := c.FormFile("params")
+	if err != nil {
+		fail(http.StatusBadRequest, "Upload a CSV file with the parameter values")
+		return
+	}
+	f, err := upload.Open()
+	if err != nil {
+		fail(http.StatusBadRequest, fmt.Sprintf("Failed to read upload: %v", err))
+		return
+	}
+	defer f.Close()
+	rows, err := readBulkCSV(f, c.PostForm("header") != "", ',')
+	if err != nil {
+		fail(http.StatusBadRequest, fmt.Sprintf("Invalid CSV: %v", err))
+		return
+	}
+	// the statement is the same for every row, so the hooks see it once
+	guard, err := guardQuery(c.Request.Context(), newQueryEvent(c, p, "bulk", stmt))
+	if err != nil {
+		fail(http.StatusForbidden, err.Error())
+		return
+	}
+	defer guard.doneAfter(c)
+	release, err := acquireQuerySlot(c.Request.Context(), p, "")
+	if err != nil {
+		fail(http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), bulkTimeout)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, fmt.Sprintf("Failed to connect to database: %v", err))
+		return
+	}
+	defer db.Close()
+
+	user := currentIdentity(c).User
+	log.Printf("%s runs a bulk statement for %d rows on %s", user, len(rows), p.address())
+	summary := runBulk(ctx, db, p.Driver, stmt, rows, batch, c.PostForm("null_empty") != "", c.PostForm("stop") != "")
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "bulk_exec",
+		Target: p.auditTarget(),
+		Query:  stmt,
+		Detail: fmt.Sprintf("%s: %d ok, %d failed, %d rolled back, %d skipped, %d rows affected",
+			upload.Filename, summary.Succeeded, summary.Failed, summary.RolledBack, summary.Skipped, summary.Affected),
+	})
+
+	if c.PostForm("report") == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="bulk-report.csv"`)
+		if err := writeBulkReport(c.Writer, summary.Rows); err != nil {
+			log.Printf("Bulk report failed: %v", err)
+		}
+		return
+	}
+
+	page := bulkPage(summary)
+	page.Report = true
+	render(c, http.StatusOK, page)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// capabilities describes what the connected server version supports, so
+// the UI and generated SQL can adapt instead of failing at runtime.
+type capabilities struct {
+	Driver   string          `json:"driver"`
+	Version  string          `json:"version"`
+	Flavor   string          `json:"flavor,omitempty"`
+	Features map[string]bool `json:"features"`
+	Probed   time.Time       `json:"probed"`
+}
+
+const capabilitiesTTL = 10 * time.Minute
+
+var (
+	capabilitiesMu    sync.Mutex
+	capabilitiesCache = make(map[string]*capabilities)
+)
+
+func (p connParams) cacheKey() string {
+	return fmt.Sprintf("%s|%s|%s|%s", p.Driver, p.address(), p.Username, p.Database)
+}
+
+// parseVersion extracts the leading dotted number, e.g. "10.11.2-MariaDB" -> [10 11 2].
+func parseVersion(s string) []int {
+	var parts []int
+	for _, field := range strings.Split(s, ".") {
+		end := 0
+		for end < len(field) && field[end] >= '0' && field[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			break
+		}
+		n, _ := strconv.Atoi(field[:end])
+		parts = append(parts, n)
+		if end < len(field) {
+			break
+		}
+	}
+	return parts
+}
+
+func versionAtLeast(v []int, want ...int) bool {
+	for i, w := range want {
+		got := 0
+		if i < len(v) {
+			got = v[i]
+		}
+		if got != w {
+			return got > w
+		}
+	}
+	return true
+}
+
+func serverVersion(ctx context.Context, db *sql.DB, driver string) (string, error) {
+	var query string
+	switch driver {
+	case "postgres":
+		query = "SHOW server_version"
+	case "mysql":
+		query = "SELECT VERSION()"
+	case "sqlite":
+		query = "SELECT sqlite_version()"
+	case "clickhouse":
+		query = "SELECT version()"
+	default:
+		return "", fmt.Errorf("unsupported database driver %q", driver)
+	}
+	var version string
+	err := db.QueryRowContext(ctx, query).Scan(&version)
+	return version, err
+}
+
+func probeCapabilities(ctx context.Context, db *sql.DB, driver string) (*capabilities, error) {
+	version, err := serverVersion(ctx, db, driver)
+	if err != nil {
+		return nil, err
+	}
+	v := parseVersion(version)
+	caps := &capabilities{Driver: driver, Version: version, Probed: time.Now()}
+
+	switch driver {
+	case "postgres":
+		caps.Features = map[string]bool{
+			"returning":        true,
+			"cte":              true,
+			"window_functions": versionAtLeast(v, 8, 4),
+			"json_functions":   versionAtLeast(v, 9, 4),
+			"upsert":           versionAtLeast(v, 9, 5),
+			"transactions":     true,
+			"concurrent_index": true,
+			"ddl_progress":     false,
+			"temp_credentials": true,
+			"dump":             true,
+			"sessions":         true,
+			"query_stats":      true,
+			"accounts":         true,
+			"server_impact":    true,
+			"replication":      true,
+			"clusters":         false,
+			"query_settings":   false,
+			"explain_analyze":  true,
+		}
+	case "mysql":
+		if strings.Contains(strings.ToLower(version), "mariadb") {
+			caps.Flavor = "mariadb"
+			caps.Features = map[string]bool{
+				"returning":        versionAtLeast(v, 10, 5),
+				"cte":              versionAtLeast(v, 10, 2),
+				"window_functions": versionAtLeast(v, 10, 2),
+				"json_functions":   versionAtLeast(v, 10, 2),
+				"upsert":           true,
+				"transactions":     true,
+				"concurrent_index": false,
+				"ddl_progress":     false,
+				"temp_credentials": versionAtLeast(v, 10, 1),
+				"dump":             true,
+				"sessions":         true,
+				"query_stats":      true,
+				"accounts":         true,
+				"server_impact":    true,
+				"replication":      true,
+				"clusters":         false,
+				"query_settings":   false,
+				"explain_analyze":  false,
+			}
+		} else {
+			caps.Features = map[string]bool{
+				"returning":        false,
+				"cte":              versionAtLeast(v, 8),
+				"window_functions": versionAtLeast(v, 8),
+				"json_functions":   versionAtLeast(v, 5, 7, 8),
+				"upsert":           true,
+				"transactions":     true,
+				"concurrent_index": false,
+				"ddl_progress":     versionAtLeast(v, 5, 7),
+				"temp_credentials": versionAtLeast(v, 5, 7),
+				"dump":             true,
+				"sessions":         true,
+				"query_stats":      true,
+				"accounts":         true,
+				"server_impact":    true,
+				"replication":      true,
+				"clusters":         false,
+				"query_settings":   false,
+				"explain_analyze":  false,
+			}
+		}
+	case "sqlite":
+		caps.Features = map[string]bool{
+			"returning":        versionAtLeast(v, 3, 35),
+			"cte":              versionAtLeast(v, 3, 8, 3),
+			"window_functions": versionAtLeast(v, 3, 25),
+			"json_functions":   versionAtLeast(v, 3, 38),
+			"upsert":           versionAtLeast(v, 3, 24),
+			"transactions":     true,
+			"concurrent_index": false,
+			"ddl_progress":     false,
+			"temp_credentials": false,
+			"dump":             true,
+			"sessions":         false,
+			"query_stats":      false,
+			"accounts":         false,
+			"server_impact":    false,
+			"replication":      false,
+			"clusters":         false,
+			"query_settings":   false,
+			"explain_analyze":  false,
+		}
+	case "clickhouse":
+		caps.Features = map[string]bool{
+			"returning":        false,
+			"cte":              true,
+			"window_functions": versionAtLeast(v, 21, 3),
+			"json_functions":   true,
+			"upsert":           false,
+			"transactions":     false,
+			"concurrent_index": false,
+			"ddl_progress":     false,
+			"temp_credentials": false,
+			"dump":             false,
+			"sessions":         true,
+			"query_stats":      true,
+			"accounts":         false,
+			"server_impact":    true,
+			"replication":      true,
+			"clusters":         true,
+			"query_settings":   true,
+			"explain_analyze":  false,
+		}
+	}
+	return caps, nil
+}
+
+// capabilitiesFor returns cached capabilities for the target, probing on a miss.
+func capabilitiesFor(ctx context.Context, p connParams) (*capabilities, error) {
+	key := p.cacheKey()
+	capabilitiesMu.Lock()
+	caps, ok := capabilitiesCache[key]
+	capabilitiesMu.Unlock()
+	if ok && time.Since(caps.Probed) < capabilitiesTTL {
+		return caps, nil
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	caps, err = probeCapabilities(ctx, db, p.Driver)
+	if err != nil {
+		return nil, err
+	}
+	capabilitiesMu.Lock()
+	capabilitiesCache[key] = caps
+	capabilitiesMu.Unlock()
+	return caps, nil
+}
+
+func capabilitiesHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	caps, err := capabilitiesFor(ctx, p)
+	if err != nil {
+		log.Printf("Capability probe failed: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": fmt.Sprintf("Failed to probe server: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, caps)
+}
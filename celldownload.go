@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// isBinary tells the cells that get a download button.
+func isBinary(v interface{}) bool {
+	_, ok := v.([]byte)
+	return ok
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// cellFileName names a download after its column and row, with the
+// extension of the sniffed content type.
+func cellFileName(column, row, contentType string) string {
+	name := unsafeFileChars.ReplaceAllString(column+"-"+row, "_")
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		return name + exts[0]
+	}
+	return name + ".bin"
+}
+
+// cellDownloadHandler sends one binary cell as a file. A table row is
+// found again by its key (table, key, column); a cell of the query form's
+// result by its position (row, column), from the result cache when the
+// page just showed it, otherwise by running the query again.
+func cellDownloadHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	column := c.PostForm("column")
+	var value interface{}
+	var row, query string
+
+	if table := c.PostForm("table"); table != "" {
+		row = c.PostForm("key")
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		db, err := openDB(ctx, p)
+		if err != nil {
+			log.Printf("Database connection failed: %v", err)
+			c.String(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+			return
+		}
+		defer db.Close()
+		t, pk, err := rowTable(ctx, db, p.Driver, table)
+		if err != nil {
+			c.String(http.StatusBadRequest, "%v", err)
+			return
+		}
+		rs, err := fetchKeyRows(ctx, db, p.Driver, t, pk, row, false)
+		if err != nil {
+			c.String(http.StatusBadRequest, "Failed to load the row: %v", err)
+			return
+		}
+		found := false
+		for i, name := range rs.Columns {
+			if name == column && len(rs.Rows) > 0 {
+				value, found = rs.Rows[0][i], true
+			}
+		}
+		if !found {
+			c.String(http.StatusNotFound, "No column %s in the row", column)
+			return
+		}
+	} else {
+		query = c.PostForm("query")
+		index, err := strconv.Atoi(c.PostForm("row"))
+		col, colErr := strconv.Atoi(column)
+		if err != nil || colErr != nil || !returnsRows(query) {
+			c.String(http.StatusBadRequest, "Pick a cell of a query result")
+			return
+		}
+		ev := newQueryEvent(c, p, "query", query)
+		if _, err := beforeQuery(c.Request.Context(), ev); err != nil {
+			c.String(http.StatusForbidden, "%v", err)
+			return
+		}
+		started := time.Now()
+		rs, status, err := formResult(c, p, query)
+		afterQuery(c.Request.Context(), ev, started, err)
+		if err != nil {
+			c.String(status, "Query failed: %v", err)
+			return
+		}
+		if index < 0 || index >= len(rs.Rows) || col < 0 || col >= len(rs.Columns) {
+			c.String(http.StatusNotFound, "The result has no such cell; run the query again")
+			return
+		}
+		value, column, row = rs.Rows[index][col], rs.Columns[col], strconv.Itoa(index+1)
+	}
+
+	data, ok := value.([]byte)
+	if !ok {
+		c.String(http.StatusBadRequest, "The cell is not binary")
+		return
+	}
+	contentType := http.DetectContentType(data)
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   currentIdentity(c).User,
+		Action: "download_cell",
+		Target: p.auditTarget(),
+		Query:  query,
+		Detail: strings.TrimSpace(fmt.Sprintf("%s %s of row %s, %s", c.PostForm("table"), column, row, formatBytes(len(data)))),
+	})
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, cellFileName(column, row, contentType)))
+	c.Data(http.StatusOK, contentType, data)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+const defaultMySQLCharset = "utf8mb4"
+
+var mysqlCharsetName = regexp.MustCompile(`^[a-z0-9_]{2,32}$`)
+
+// mysqlCharset is the connection character set sent in the DSN. Legacy
+// latin1 columns holding bytes of another encoding come back unchanged
+// with "latin1", ready for transcoding.
+func (p connParams) mysqlCharset() (string, error) {
+	if p.Charset == "" {
+		return defaultMySQLCharset, nil
+	}
+	if !mysqlCharsetName.MatchString(p.Charset) {
+		return "", fmt.Errorf("invalid MySQL character set %q", p.Charset)
+	}
+	return p.Charset, nil
+}
+
+// resultDecoder decodes result strings from ResultEncoding, any WHATWG
+// label such as "windows-1251", "cp1251", "koi8-r", "latin1" or "gbk". It
+// is nil when results are UTF-8 already.
+func (p connParams) resultDecoder() (*encoding.Decoder, error) {
+	if p.ResultEncoding == "" {
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(p.ResultEncoding)
+	if err != nil {
+		return nil, fmt.Errorf("unknown result encoding %q", p.ResultEncoding)
+	}
+	return enc.NewDecoder(), nil
+}
+
+// transcodeRows converts the string values of rows to UTF-8 in place.
+// Binary values are left alone.
+func (p connParams) transcodeRows(rows [][]interface{}) error {
+	dec, err := p.resultDecoder()
+	if err != nil || dec == nil {
+		return err
+	}
+	for _, row := range rows {
+		for i, v := range row {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			if row[i], err = dec.String(s); err != nil {
+				return fmt.Errorf("failed to decode %s text: %v", p.ResultEncoding, err)
+			}
+		}
+	}
+	return nil
+}
+
+// transcodeText converts one string, such as a table definition, to UTF-8.
+func (p connParams) transcodeText(s string) (string, error) {
+	row := []interface{}{s}
+	if err := p.transcodeRows([][]interface{}{row}); err != nil {
+		return "", err
+	}
+	return row[0].(string), nil
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chartMaxSeries keeps a pivot on a high-cardinality column readable; the
+// rest are counted, not drawn.
+const chartMaxSeries = 20
+
+// chartOptions say how to read a result as a chart. Columns are named as
+// the result names them.
+type chartOptions struct {
+	// Label is the x axis column, the first column by default
+	Label string `json:"label"`
+	// Group pivots a long result, one series per distinct value of the
+	// column: (time, host, count) becomes a count line per host
+	Group string `json:"group"`
+	// Series are the value columns, every other numeric column by default
+	Series []string `json:"series"`
+}
+
+type chartSeries struct {
+	Name string `json:"name"`
+	// Values line up with the labels; null where the series has no value
+	Values []*float64 `json:"values"`
+}
+
+// chartData is a result shaped for charting libraries: one label per x
+// position, in the order the query returned them, and the series over them.
+type chartData struct {
+	Labels []string      `json:"labels"`
+	Series []chartSeries `json:"series"`
+	// OmittedSeries counts the series past chartMaxSeries
+	OmittedSeries int `json:"omitted_series,omitempty"`
+}
+
+// chartOptionsFromForm reads the query form's chart fields; series is a
+// comma-separated list.
+func chartOptionsFromForm(c *gin.Context) chartOptions {
+	opt := chartOptions{
+		Label: strings.TrimSpace(c.PostForm("chart_label")),
+		Group: strings.TrimSpace(c.PostForm("chart_group")),
+	}
+	for _, name := range strings.Split(c.PostForm("chart_series"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			opt.Series = append(opt.Series, name)
+		}
+	}
+	return opt
+}
+
+// chartValue reads a cell as a number. Text protocols return numbers and
+// decimals as strings.
+func chartValue(v interface{}) (float64, bool) {
+	if f, ok := toFloat(v); ok {
+		return f, true
+	}
+	var s string
+	switch t := v.(type) {
+	case string:
+		s = t
+	case fmt.Stringer:
+		s = t.String()
+	default:
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return f, err == nil
+}
+
+func chartLabel(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case time.Time:
+		if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+			return t.Format("2006-01-02")
+		}
+		return t.Format("2006-01-02 15:04:05")
+	case []byte:
+		return string(t)
+	}
+	return fmt.Sprint(v)
+}
+
+// shapeChart turns rows into labels and series. Rows sharing a label (and
+// group) are added up, so a result at finer grain than the chart still
+// draws one point per label.
+func shapeChart(rs *resultSet, driver string, opt chartOptions) (chartData, error) {
+	index := make(map[string]int, len(rs.Columns))
+	for i, name := range rs.Columns {
+		if _, dup := index[name]; !dup {
+			index[name] = i
+		}
+	}
+	column := func(name string) (int, error) {
+		i, ok := index[name]
+		if !ok {
+			return 0, fmt.Errorf("the result has no column %q", name)
+		}
+		return i, nil
+	}
+	if len(rs.Columns) == 0 {
+		return chartData{}, fmt.Errorf("the result has no columns")
+	}
+
+	label, group := 0, -1
+	var err error
+	if opt.Label != "" {
+		if label, err = column(opt.Label); err != nil {
+			return chartData{}, err
+		}
+	}
+	if opt.Group != "" {
+		if group, err = column(opt.Group); err != nil {
+			return chartData{}, err
+		}
+	}
+	var values []int
+	for _, name := range opt.Series {
+		i, err := column(name)
+		if err != nil {
+			return chartData{}, err
+		}
+		values = append(values, i)
+	}
+	if len(values) == 0 {
+		for i, t := range rs.Types {
+			switch kindOf(driver, t) {
+			case kindInt, kindUint, kindFloat, kindDecimal:
+				if i != label && i != group {
+					values = append(values, i)
+				}
+			}
+		}
+	}
+	if len(values) == 0 {
+		return chartData{}, fmt.Errorf("the result has no numeric columns to chart; name them as series")
+	}
+
+	data := chartData{Labels: []string{}, Series: []chartSeries{}}
+	labels := make(map[string]int)
+	series := make(map[string]int)
+	omitted := make(map[string]bool)
+	for _, row := range rs.Rows {
+		l := chartLabel(row[label])
+		at, ok := labels[l]
+		if !ok {
+			at = len(data.Labels)
+			labels[l] = at
+			data.Labels = append(data.Labels, l)
+		}
+		for _, col := range values {
+			name := rs.Columns[col]
+			if group >= 0 {
+				name = chartLabel(row[group])
+				if len(values) > 1 {
+					name += " " + rs.Columns[col]
+				}
+			}
+			s, ok := series[name]
+			if !ok {
+				if len(data.Series) == chartMaxSeries {
+					omitted[name] = true
+					continue
+				}
+				s = len(data.Series)
+				series[name] = s
+				data.Series = append(data.Series, chartSeries{Name: name})
+			}
+			v, ok := chartValue(row[col])
+			if !ok {
+				continue
+			}
+			vals := data.Series[s].Values
+			for len(vals) <= at {
+				vals = append(vals, nil)
+			}
+			if vals[at] == nil {
+				vals[at] = new(float64)
+			}
+			*vals[at] += v
+			data.Series[s].Values = vals
+		}
+	}
+	for i := range data.Series {
+		for len(data.Series[i].Values) < len(data.Labels) {
+			data.Series[i].Values = append(data.Series[i].Values, nil)
+		}
+	}
+	data.OmittedSeries = len(omitted)
+	return data, nil
+}
+
+// Chart layout, in SVG user units.
+const (
+	chartWidth  = 800
+	chartHeight = 320
+	chartLeft   = 70
+	chartRight  = 20
+	chartTop    = 10
+	chartBottom = 50
+	// chartXTicks and chartYTicks are how many axis labels to aim for
+	chartXTicks = 10
+	chartYTicks = 5
+	// above chartMaxDots labels the points are only lines
+	chartMaxDots = 100
+)
+
+var chartColors = []string{"#c4b550", "#88c0d0", "#d08770", "#a3be8c", "#b48ead", "#ebcb8b", "#bf616a", "#8fbcbb", "#dedfd6", "#5e81ac"}
+
+type chartTick struct {
+	X, Y float64
+	Text string
+}
+
+type chartPoint struct {
+	X, Y  float64
+	Title string
+}
+
+type chartLine struct {
+	Name  string
+	Color string
+	// Segments are polyline point lists, broken where values are null
+	Segments []string
+	Dots     []chartPoint
+}
+
+// niceStep rounds span/ticks up to 1, 2 or 5 times a power of ten.
+func niceStep(span float64, ticks int) float64 {
+	raw := span / float64(ticks)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*mag {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+// layoutChart draws the series as lines over evenly spaced labels, the y
+// axis starting at zero unless values go below it.
+func layoutChart(data chartData) (lines []chartLine, xTicks, yTicks []chartTick) {
+	lo, hi := 0.0, math.Inf(-1)
+	for _, s := range data.Series {
+		for _, v := range s.Values {
+			if v != nil {
+				lo, hi = math.Min(lo, *v), math.Max(hi, *v)
+			}
+		}
+	}
+	if math.IsInf(hi, -1) || hi <= lo {
+		hi = lo + 1
+	}
+	step := niceStep(hi-lo, chartYTicks)
+	lo, hi = math.Floor(lo/step)*step, math.Ceil(hi/step)*step
+	decimals := max(0, int(-math.Floor(math.Log10(step))))
+
+	plotW := float64(chartWidth - chartLeft - chartRight)
+	plotH := float64(chartHeight - chartTop - chartBottom)
+	x := func(i int) float64 {
+		if len(data.Labels) == 1 {
+			return chartLeft + plotW/2
+		}
+		return chartLeft + plotW*float64(i)/float64(len(data.Labels)-1)
+	}
+	y := func(v float64) float64 {
+		return chartTop + plotH*(hi-v)/(hi-lo)
+	}
+
+	for v := lo; v <= hi+step/2; v += step {
+		yTicks = append(yTicks, chartTick{X: chartLeft - 6, Y: y(v), Text: strconv.FormatFloat(v, 'f', decimals, 64)})
+	}
+	every := (len(data.Labels) + chartXTicks - 1) / chartXTicks
+	for i, l := range data.Labels {
+		if i%every == 0 {
+			xTicks = append(xTicks, chartTick{X: x(i), Y: chartHeight - chartBottom + 16, Text: truncate(20, l)})
+		}
+	}
+
+	for n, s := range data.Series {
+		line := chartLine{Name: s.Name, Color: chartColors[n%len(chartColors)]}
+		var segment []string
+		for i, v := range s.Values {
+			if v == nil {
+				if len(segment) > 0 {
+					line.Segments = append(line.Segments, strings.Join(segment, " "))
+				}
+				segment = nil
+				continue
+			}
+			segment = append(segment, fmt.Sprintf("%.1f,%.1f", x(i), y(*v)))
+			if len(data.Labels) <= chartMaxDots {
+				line.Dots = append(line.Dots, chartPoint{X: x(i), Y: y(*v), Title: fmt.Sprintf("%s, %s: %g", s.Name, data.Labels[i], *v)})
+			}
+		}
+		if len(segment) > 0 {
+			line.Segments = append(line.Segments, strings.Join(segment, " "))
+		}
+		lines = append(lines, line)
+	}
+	return lines, xTicks, yTicks
+}
+
+// chartHandler runs the query form's SELECT and draws the result as a line
+// chart, e.g. a ClickHouse time series grouped by minute.
+func chartHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	query := c.PostForm("query")
+	opt := chartOptionsFromForm(c)
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "chart.html", format, args...)
+	}
+	if !returnsRows(query) {
+		fail(http.StatusBadRequest, "Charts are drawn from queries that return rows")
+		return
+	}
+	if err := p.validateAddress(); err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	afterHooks, ok := pageQueryHooks(c, p, query)
+	if !ok {
+		return
+	}
+	defer afterHooks()
+
+	rs, status, err := formResult(c, p, query)
+	if err != nil {
+		fail(status, "Chart failed: %v", err)
+		return
+	}
+	data, err := shapeChart(rs, p.Driver, opt)
+	if err != nil {
+		fail(http.StatusBadRequest, "Cannot chart the result: %v", err)
+		return
+	}
+	lines, xTicks, yTicks := layoutChart(data)
+	render(c, http.StatusOK, chartView{
+		Width:         chartWidth,
+		Height:        chartHeight,
+		Left:          chartLeft,
+		Right:         chartWidth - chartRight,
+		Bottom:        chartHeight - chartBottom,
+		Top:           chartTop,
+		Lines:         lines,
+		XTicks:        xTicks,
+		YTicks:        yTicks,
+		Points:        len(data.Labels),
+		OmittedSeries: data.OmittedSeries,
+		Truncated:     rs.Truncated,
+	})
+}
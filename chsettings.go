@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+var clickhouseSettingName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,99}$`)
+
+// clickhouseFixedSettings can't be changed from the form: readonly would
+// let a query lift its own restriction where the profile allows changing
+// it, and send_logs_level carries the server log to the notices.
+var clickhouseFixedSettings = []string{"readonly", "send_logs_level"}
+
+// parseClickHouseSettings reads "max_execution_time=30" pairs, one per line
+// or separated by commas. Numbers are sent as numbers and anything else as
+// a string; the server checks names, values and its profile constraints.
+func parseClickHouseSettings(s string) (clickhouse.Settings, error) {
+	settings := clickhouse.Settings{}
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name, value = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)
+		if !ok || !clickhouseSettingName.MatchString(name) || value == "" {
+			return nil, fmt.Errorf("invalid ClickHouse setting %q, expected name=value", part)
+		}
+		if containsString(clickhouseFixedSettings, name) {
+			return nil, fmt.Errorf("the ClickHouse setting %s can't be changed here", name)
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			settings[name] = n
+		} else {
+			settings[name] = strings.Trim(value, `'"`)
+		}
+	}
+	return settings, nil
+}
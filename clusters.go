@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const clusterShownParts = 200
+
+// clusterNode is one replica of a shard as listed in system.clusters.
+type clusterNode struct {
+	Cluster string
+	Shard   int
+	Replica int
+	Host    string
+	Port    int
+	Local   bool
+	Errors  int64
+}
+
+// replicaParts is the active part count of a table on one host.
+type replicaParts struct {
+	Host     string
+	Database string
+	Table    string
+	Parts    int64
+	Rows     int64
+	Bytes    int64
+}
+
+// replicaMerge is a merge running on one host.
+type replicaMerge struct {
+	Host     string
+	Database string
+	Table    string
+	Elapsed  time.Duration
+	// Percent done, 0 to 100
+	Percent float64
+	Parts   int64
+	Result  string
+}
+
+func listClusterNodes(ctx context.Context, db *sql.DB) ([]clusterNode, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT cluster, shard_num, replica_num, host_name, port, is_local, errors_count
+		FROM system.clusters
+		ORDER BY cluster, shard_num, replica_num`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []clusterNode
+	for rows.Next() {
+		var n clusterNode
+		if err := rows.Scan(&n.Cluster, &n.Shard, &n.Replica, &n.Host, &n.Port, &n.Local, &n.Errors); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, rows.Err()
+}
+
+// clusterNames lists the distinct clusters in order.
+func clusterNames(nodes []clusterNode) []string {
+	var names []string
+	for _, n := range nodes {
+		if len(names) == 0 || names[len(names)-1] != n.Cluster {
+			names = append(names, n.Cluster)
+		}
+	}
+	return names
+}
+
+// clusterParts reads active parts of every replica of the cluster, most
+// fragmented tables first.
+func clusterParts(ctx context.Context, db *sql.DB, cluster string) ([]replicaParts, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT hostName() AS host, database, table, count(), sum(rows), sum(bytes_on_disk)
+		FROM clusterAllReplicas(%s, system.parts)
+		WHERE active
+		GROUP BY host, database, table
+		ORDER BY count() DESC, database, table, host
+		LIMIT %d`, quoteString("clickhouse", cluster), clusterShownParts))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parts []replicaParts
+	for rows.Next() {
+		var r replicaParts
+		if err := rows.Scan(&r.Host, &r.Database, &r.Table, &r.Parts, &r.Rows, &r.Bytes); err != nil {
+			return nil, err
+		}
+		parts = append(parts, r)
+	}
+	return parts, rows.Err()
+}
+
+func clusterMerges(ctx context.Context, db *sql.DB, cluster string) ([]replicaMerge, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT hostName(), database, table, elapsed, progress * 100, num_parts, result_part_name
+		FROM clusterAllReplicas(%s, system.merges)
+		ORDER BY elapsed DESC`, quoteString("clickhouse", cluster)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var merges []replicaMerge
+	for rows.Next() {
+		var m replicaMerge
+		var elapsed float64
+		if err := rows.Scan(&m.Host, &m.Database, &m.Table, &elapsed, &m.Percent, &m.Parts, &m.Result); err != nil {
+			return nil, err
+		}
+		m.Elapsed = time.Duration(elapsed * float64(time.Second)).Round(time.Second)
+		merges = append(merges, m)
+	}
+	return merges, rows.Err()
+}
+
+// ddlTarget matches the head of a DDL statement up to the name of its
+// object, where ClickHouse expects ON CLUSTER.
+var ddlTarget = regexp.MustCompile("(?is)^\\s*(?:" +
+	"(?:CREATE|ATTACH)(?:\\s+OR\\s+REPLACE)?\\s+(?:TABLE|DATABASE|VIEW|MATERIALIZED\\s+VIEW|DICTIONARY)(?:\\s+IF\\s+NOT\\s+EXISTS)?" +
+	"|(?:ALTER|DETACH|OPTIMIZE)\\s+(?:TABLE|DATABASE|DICTIONARY)" +
+	"|(?:DROP|TRUNCATE)\\s+(?:TABLE|DATABASE|VIEW|DICTIONARY)(?:\\s+IF\\s+EXISTS)?" +
+	")\\s+(?:`[^`]+`|\"[^\"]+\"|[\\w]+)(?:\\.(?:`[^`]+`|\"[^\"]+\"|[\\w]+))?")
+
+var onClusterClause = regexp.MustCompile(`(?i)\bON\s+CLUSTER\b`)
+
+// onCluster adds ON CLUSTER to a DDL statement. A statement that already
+// names a cluster is returned as is.
+func onCluster(stmt, cluster string) (string, error) {
+	stmt = strings.TrimRight(strings.TrimSpace(stmt), ";")
+	if onClusterClause.MatchString(stmt) {
+		return stmt, nil
+	}
+	head := ddlTarget.FindString(stmt)
+	if head == "" {
+		return "", fmt.Errorf("only CREATE, ALTER, DROP, TRUNCATE, ATTACH, DETACH and OPTIMIZE of a table, view, database or dictionary can run on a cluster")
+	}
+	return head + " ON CLUSTER " + quoteIdent("clickhouse", cluster) + stmt[len(head):], nil
+}
+
+// knownCluster checks the name against system.clusters, so the form can't
+// name anything else.
+func knownCluster(nodes []clusterNode, cluster string) bool {
+	return containsString(clusterNames(nodes), cluster)
+}
+
+// clustersHandler lists the clusters of the ClickHouse server and, for the
+// chosen one, the active parts and running merges of each replica.
+func clustersHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	cluster := c.PostForm("cluster")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "clusters.html", format, args...)
+	}
+	if p.Driver != "clickhouse" {
+		fail(http.StatusBadRequest, "Clusters are a ClickHouse feature")
+		return
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	nodes, err := listClusterNodes(ctx, db)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to read system.clusters: %v", err)
+		return
+	}
+	names := clusterNames(nodes)
+	if cluster == "" && len(names) > 0 {
+		cluster = names[0]
+	}
+	page := clustersView{Clusters: names, Cluster: cluster}
+	if !knownCluster(nodes, cluster) {
+		page.Nodes = nodes
+		render(c, http.StatusOK, page)
+		return
+	}
+
+	var shown []clusterNode
+	for _, n := range nodes {
+		if n.Cluster == cluster {
+			shown = append(shown, n)
+		}
+	}
+	page.Nodes = shown
+	// a replica that is down fails the whole query; show what we have
+	if page.Parts, err = clusterParts(ctx, db, cluster); err != nil {
+		page.Problem = fmt.Sprintf("Failed to read parts: %v", err)
+	} else if page.Merges, err = clusterMerges(ctx, db, cluster); err != nil {
+		page.Problem = fmt.Sprintf("Failed to read merges: %v", err)
+	}
+	render(c, http.StatusOK, page)
+}
+
+// clusterDDLHandler previews a statement with ON CLUSTER added and runs it
+// once confirmed, showing the status ClickHouse reports for every host.
+func clusterDDLHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	cluster := c.PostForm("cluster")
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "clusterddl.html", format, args...)
+	}
+	if p.Driver != "clickhouse" {
+		fail(http.StatusBadRequest, "Clusters are a ClickHouse feature")
+		return
+	}
+	stmt, err := onCluster(c.PostForm("statement"), cluster)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	st := rowStatement{Query: stmt}
+	if c.PostForm("confirm") != st.Digest() {
+		render(c, http.StatusOK, clusterDDLView{Statement: stmt, Digest: st.Digest()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	nodes, err := listClusterNodes(ctx, db)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to read system.clusters: %v", err)
+		return
+	}
+	if !knownCluster(nodes, cluster) {
+		fail(http.StatusBadRequest, "Unknown cluster %q", cluster)
+		return
+	}
+
+	// distributed DDL answers with one row per host
+	rs, err := fetchResult(ctx, db, stmt)
+	invalidateSchema(p)
+	if err != nil {
+		fail(http.StatusBadRequest, "Statement failed: %v", err)
+		return
+	}
+
+	user := currentIdentity(c).User
+	log.Printf("%s ran DDL on cluster %s via %s", user, cluster, p.address())
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "cluster_ddl",
+		Target: p.auditTarget(),
+		Query:  stmt,
+		Detail: "cluster " + cluster,
+	})
+	render(c, http.StatusOK, clusterDDLView{
+		Done:      true,
+		Statement: stmt,
+		Columns:   rs.Columns,
+		Rows:      rs.Rows,
+	})
+}
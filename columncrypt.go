@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const decryptMaxRows = 1000
+
+// columnKeyConfig is an application key for AES-GCM encrypted columns, as
+// apps store them: the 12-byte nonce followed by the sealed value.
+type columnKeyConfig struct {
+	// KeyEnv names the environment variable holding the base64 key of 16,
+	// 24 or 32 bytes; the key itself never reaches the browser
+	KeyEnv string `json:"key_env"`
+	// Encoding of the stored values: "base64" (default), "hex" or "raw"
+	Encoding string `json:"encoding"`
+	// Columns are the result column names to decrypt
+	Columns []string `json:"columns"`
+	// Groups may use the key; empty means every signed-in user
+	Groups []string `json:"groups"`
+}
+
+// columnKeyNames lists the configured keys for the index page.
+func columnKeyNames() []string {
+	names := make([]string, 0, len(config.Encryption))
+	for name := range config.Encryption {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// allowed reports whether id may use the key.
+func (k columnKeyConfig) allowed(id *identity) bool {
+	if len(k.Groups) == 0 {
+		return true
+	}
+	for _, g := range k.Groups {
+		if id.InGroup(g) {
+			return true
+		}
+	}
+	return false
+}
+
+func (k columnKeyConfig) aead() (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv(k.KeyEnv))
+	if err != nil {
+		return nil, fmt.Errorf("%s does not hold a base64 key: %v", k.KeyEnv, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", k.KeyEnv, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func (k columnKeyConfig) decode(v interface{}) ([]byte, error) {
+	var text string
+	switch t := v.(type) {
+	case []byte:
+		if k.Encoding == "raw" {
+			return t, nil
+		}
+		text = string(t)
+	case string:
+		text = t
+	default:
+		return nil, fmt.Errorf("not an encrypted value")
+	}
+	switch k.Encoding {
+	case "raw":
+		return []byte(text), nil
+	case "hex":
+		return hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(text), `\x`))
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+}
+
+func (k columnKeyConfig) encode(data []byte) string {
+	switch k.Encoding {
+	case "raw", "hex":
+		return hex.EncodeToString(data)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func decryptValue(aead cipher.AEAD, data []byte) (string, error) {
+	if len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("value too short")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	return string(plain), err
+}
+
+func encryptValue(aead cipher.AEAD, plain string) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, []byte(plain), nil), nil
+}
+
+// columnKey returns the key named in the form if the caller may use it,
+// rendering the error itself otherwise.
+func columnKey(c *gin.Context) (string, columnKeyConfig, cipher.AEAD, bool) {
+	name := c.PostForm("key")
+	k, ok := config.Encryption[name]
+	if !ok {
+		renderError(c, http.StatusBadRequest, "columncrypt.html", "Unknown key %q", name)
+		return "", k, nil, false
+	}
+	if !k.allowed(currentIdentity(c)) {
+		renderError(c, http.StatusForbidden, "columncrypt.html", "You may not use key %q", name)
+		return "", k, nil, false
+	}
+	aead, err := k.aead()
+	if err != nil {
+		log.Printf("Column key %s is unusable: %v", name, err)
+		renderError(c, http.StatusInternalServerError, "columncrypt.html", "Key %q is not set up correctly", name)
+		return "", k, nil, false
+	}
+	return name, k, aead, true
+}
+
+// decryptHandler runs the query of the form and shows the result with the
+// key's columns decrypted. Values that don't decrypt are marked, not fatal.
+func decryptHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	query := c.PostForm("query")
+
+	name, k, aead, ok := columnKey(c)
+	if !ok {
+		return
+	}
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "columncrypt.html", format, args...)
+	}
+	if !returnsRows(query) {
+		fail(http.StatusBadRequest, "Only queries that return rows can be decrypted")
+		return
+	}
+	guard, err := guardQuery(c.Request.Context(), newQueryEvent(c, p, "decrypt", query))
+	if err != nil {
+		fail(http.StatusForbidden, "%v", err)
+		return
+	}
+	defer guard.doneAfter(c)
+	release, err := acquireQuerySlot(c.Request.Context(), p, "")
+	if err != nil {
+		fail(http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	rs, err := fetchResultMax(ctx, db, decryptMaxRows, query)
+	if err != nil {
+		fail(http.StatusBadRequest, "Query failed: %v", err)
+		return
+	}
+
+	decrypted := make([]bool, len(rs.Columns))
+	var names []string
+	for i, col := range rs.Columns {
+		for _, want := range k.Columns {
+			if strings.EqualFold(col, want) {
+				decrypted[i] = true
+				names = append(names, col)
+			}
+		}
+	}
+	if len(names) == 0 {
+		fail(http.StatusBadRequest, "The result has none of the columns of key %q: %s", name, strings.Join(k.Columns, ", "))
+		return
+	}
+	failed := 0
+	for _, row := range rs.Rows {
+		for i, v := range row {
+			if !decrypted[i] || v == nil {
+				continue
+			}
+			data, err := k.decode(v)
+			if err == nil {
+				row[i], err = decryptValue(aead, data)
+			}
+			if err != nil {
+				row[i] = fmt.Sprintf("[cannot decrypt: %v]", err)
+				failed++
+			}
+		}
+	}
+
+	user := currentIdentity(c).User
+	log.Printf("%s decrypted %s in %d rows with key %s", user, strings.Join(names, ", "), len(rs.Rows), name)
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "decrypt",
+		Target: p.auditTarget(),
+		Query:  query,
+		Detail: fmt.Sprintf("key %s, columns %s, %d rows", name, strings.Join(names, ", "), len(rs.Rows)),
+	})
+	render(c, http.StatusOK, columnCryptView{
+		Columns:   rs.Columns,
+		Decrypted: decrypted,
+		Rows:      rs.Rows,
+		Truncated: rs.Truncated,
+		Failed:    failed,
+	})
+}
+
+// encryptHandler seals a value with a key, for writing it with an UPDATE.
+// The plaintext is not logged.
+func encryptHandler(c *gin.Context) {
+	name, k, aead, ok := columnKey(c)
+	if !ok {
+		return
+	}
+	data, err := encryptValue(aead, c.PostForm("plaintext"))
+	if err != nil {
+		renderError(c, http.StatusInternalServerError, "columncrypt.html", "Failed to encrypt: %v", err)
+		return
+	}
+	user := currentIdentity(c).User
+	recordAudit(c.Request.Context(), auditEntry{User: user, Action: "encrypt", Detail: "key " + name})
+	render(c, http.StatusOK, columnCryptView{
+		Ciphertext: k.encode(data),
+		Hex:        k.Encoding == "raw",
+	})
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compareMaxRows is how many differing rows the page lists; all of them
+// are counted.
+const compareMaxRows = 1000
+
+// diffCell is a compared column: Left is the first result's value, Right
+// the second's.
+type diffCell struct {
+	Left, Right string
+	Changed     bool
+}
+
+// diffRow is a row in one result and not the other ("removed" from the
+// first, "added" in the second), or a row both have under the same key
+// with other values ("changed").
+type diffRow struct {
+	Kind  string
+	Cells []diffCell
+}
+
+type resultDiff struct {
+	Columns []string
+	// Key are the columns rows are matched on; without them whole rows are
+	// compared and rows are only added or removed
+	Key                           []string
+	Rows                          []diffRow
+	Added, Removed, Changed, Same int
+	// OnlyLeft and OnlyRight are columns one result lacks; they aren't compared
+	OnlyLeft, OnlyRight []string
+}
+
+// Differences counts the rows that differ, listed or not.
+func (d *resultDiff) Differences() int { return d.Added + d.Removed + d.Changed }
+
+// diffKey makes values that print alike compare equal across drivers,
+// e.g. int64 from PostgreSQL and uint64 from ClickHouse, but keeps NULL
+// apart from the text "NULL".
+func diffKey(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "\x00"
+	case []byte:
+		return string(t)
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+func diffText(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.Format("2006-01-02 15:04:05.999999999 -07:00")
+	}
+	return truncate(cellMaxRunes, diffKey(v))
+}
+
+// diffResults compares two results column by column name. Rows with the
+// same key are paired in the order they come, so duplicates pair up one
+// to one.
+func diffResults(left, right *resultSet, key []string) (*resultDiff, error) {
+	rightIndex := make(map[string]int, len(right.Columns))
+	for i, name := range right.Columns {
+		if _, dup := rightIndex[name]; !dup {
+			rightIndex[name] = i
+		}
+	}
+	d := &resultDiff{Key: key}
+	var leftCols, rightCols []int
+	seen := make(map[string]bool)
+	for i, name := range left.Columns {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		j, ok := rightIndex[name]
+		if !ok {
+			d.OnlyLeft = append(d.OnlyLeft, name)
+			continue
+		}
+		d.Columns = append(d.Columns, name)
+		leftCols, rightCols = append(leftCols, i), append(rightCols, j)
+	}
+	for _, name := range right.Columns {
+		if !seen[name] {
+			seen[name] = true
+			d.OnlyRight = append(d.OnlyRight, name)
+		}
+	}
+	if len(d.Columns) == 0 {
+		return nil, fmt.Errorf("the results have no column names in common")
+	}
+
+	isKey := make([]bool, len(d.Columns))
+	for _, name := range key {
+		found := false
+		for i, col := range d.Columns {
+			if col == name {
+				isKey[i], found = true, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("key column %q is not in both results", name)
+		}
+	}
+	if len(key) == 0 {
+		for i := range isKey {
+			isKey[i] = true
+		}
+	}
+	rowKey := func(row []interface{}, cols []int) string {
+		var b strings.Builder
+		for n, col := range cols {
+			if isKey[n] {
+				b.WriteString(diffKey(row[col]))
+				b.WriteByte('\x1f')
+			}
+		}
+		return b.String()
+	}
+	cells := func(l, r []interface{}) ([]diffCell, bool) {
+		out := make([]diffCell, len(d.Columns))
+		changed := false
+		for n := range d.Columns {
+			var c diffCell
+			if l != nil {
+				c.Left = diffText(l[leftCols[n]])
+			}
+			if r != nil {
+				c.Right = diffText(r[rightCols[n]])
+			}
+			if l != nil && r != nil && diffKey(l[leftCols[n]]) != diffKey(r[rightCols[n]]) {
+				c.Changed, changed = true, true
+			}
+			out[n] = c
+		}
+		return out, changed
+	}
+	add := func(kind string, l, r []interface{}) {
+		if len(d.Rows) < compareMaxRows {
+			row, _ := cells(l, r)
+			d.Rows = append(d.Rows, diffRow{Kind: kind, Cells: row})
+		}
+	}
+
+	unpaired := make(map[string][]int)
+	for i, row := range left.Rows {
+		k := rowKey(row, leftCols)
+		unpaired[k] = append(unpaired[k], i)
+	}
+	paired := make(map[int]int, len(left.Rows))
+	var added [][]interface{}
+	for j, row := range right.Rows {
+		k := rowKey(row, rightCols)
+		if rows := unpaired[k]; len(rows) > 0 {
+			paired[rows[0]] = j
+			unpaired[k] = rows[1:]
+			continue
+		}
+		added = append(added, row)
+	}
+	for i, row := range left.Rows {
+		j, ok := paired[i]
+		if !ok {
+			d.Removed++
+			add("removed", row, nil)
+			continue
+		}
+		if _, changed := cells(row, right.Rows[j]); !changed {
+			d.Same++
+			continue
+		}
+		d.Changed++
+		add("changed", row, right.Rows[j])
+	}
+	for _, row := range added {
+		d.Added++
+		add("added", nil, row)
+	}
+	return d, nil
+}
+
+// compareHandler runs the query form's query and a second one, or the same
+// query on a second connection, and shows how the results differ, e.g. a
+// table before and after a migration or on a primary and its replica.
+func compareHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	query := c.PostForm("query")
+	other := strings.TrimSpace(c.PostForm("compare_query"))
+	if other == "" {
+		other = query
+	}
+	var key []string
+	for _, name := range strings.Split(c.PostForm("compare_key"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			key = append(key, name)
+		}
+	}
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "compare.html", format, args...)
+	}
+	if !returnsRows(query) || !returnsRows(other) {
+		fail(http.StatusBadRequest, "Only queries that return rows can be compared")
+		return
+	}
+	q, err := formTarget(c, "compare", p)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	for _, target := range []connParams{p, q} {
+		if err := target.validateAddress(); err != nil {
+			fail(http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
+
+	var results [2]*resultSet
+	for i, side := range []struct {
+		p     connParams
+		query string
+	}{{p, query}, {q, other}} {
+		afterHooks, ok := pageQueryHooks(c, side.p, side.query)
+		if !ok {
+			return
+		}
+		rs, status, err := formResult(c, side.p, side.query)
+		afterHooks()
+		if err != nil {
+			fail(status, "Query %d failed: %v", i+1, err)
+			return
+		}
+		results[i] = rs
+	}
+
+	d, err := diffResults(results[0], results[1], key)
+	if err != nil {
+		fail(http.StatusBadRequest, "Cannot compare the results: %v", err)
+		return
+	}
+	render(c, http.StatusOK, compareView{
+		Diff:      d,
+		Left:      p.auditTarget(),
+		Right:     q.auditTarget(),
+		Truncated: results[0].Truncated || results[1].Truncated,
+	})
+}
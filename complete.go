@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// completeLimit caps each list of suggestions
+const completeLimit = 500
+
+// sqlKeywords are offered on every driver; driverKeywords add dialect words.
+var sqlKeywords = []string{
+	"SELECT", "FROM", "WHERE", "AND", "OR", "NOT", "IN", "IS", "NULL", "LIKE", "BETWEEN", "EXISTS",
+	"JOIN", "INNER", "LEFT", "RIGHT", "FULL", "OUTER", "CROSS", "ON", "USING", "AS", "DISTINCT",
+	"GROUP BY", "HAVING", "ORDER BY", "ASC", "DESC", "LIMIT", "OFFSET", "UNION", "UNION ALL",
+	"INTERSECT", "EXCEPT", "WITH", "CASE", "WHEN", "THEN", "ELSE", "END", "CAST",
+	"INSERT INTO", "VALUES", "UPDATE", "SET", "DELETE FROM", "CREATE TABLE", "ALTER TABLE",
+	"DROP TABLE", "CREATE INDEX", "PRIMARY KEY", "FOREIGN KEY", "REFERENCES", "DEFAULT",
+	"COUNT", "SUM", "AVG", "MIN", "MAX", "COALESCE", "NULLIF", "BEGIN", "COMMIT", "ROLLBACK",
+}
+
+var driverKeywords = map[string][]string{
+	"postgres":   {"ILIKE", "RETURNING", "ON CONFLICT", "DO NOTHING", "LATERAL", "FILTER", "OVER", "PARTITION BY", "EXPLAIN ANALYZE", "VACUUM", "NOW()", "INTERVAL", "JSONB"},
+	"mysql":      {"ON DUPLICATE KEY UPDATE", "REPLACE INTO", "SHOW TABLES", "SHOW CREATE TABLE", "DESCRIBE", "EXPLAIN", "NOW()", "INTERVAL", "STRAIGHT_JOIN"},
+	"sqlite":     {"PRAGMA", "ON CONFLICT", "RETURNING", "EXPLAIN QUERY PLAN", "INSERT OR REPLACE", "WITHOUT ROWID"},
+	"clickhouse": {"PREWHERE", "FINAL", "SAMPLE", "ARRAY JOIN", "SETTINGS", "FORMAT", "ENGINE", "PARTITION BY", "TTL", "uniq", "groupArray", "toDate", "now()"},
+}
+
+type apiCompleteRequest struct {
+	apiTarget
+	// Prefix keeps the names starting with it, case-insensitively
+	Prefix string `json:"prefix"`
+	// Table limits the columns to one table, e.g. after "orders."
+	Table string `json:"table"`
+	// Refresh reloads the catalog instead of answering from the cache
+	Refresh bool `json:"refresh"`
+}
+
+type apiCompleteTable struct {
+	Schema string `json:"schema,omitempty"`
+	Name   string `json:"name"`
+}
+
+type apiCompleteColumn struct {
+	Table string `json:"table"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+}
+
+type apiCompleteResponse struct {
+	Tables   []apiCompleteTable  `json:"tables"`
+	Columns  []apiCompleteColumn `json:"columns"`
+	Keywords []string            `json:"keywords"`
+	// LoadedAt is when the catalog was read, the suggestions may lag
+	// behind schema changes made elsewhere until it is refreshed
+	LoadedAt time.Time `json:"loaded_at"`
+}
+
+// completionTables answers from the schema cache when it can, so an editor
+// asking on every keystroke doesn't open a connection each time.
+func completionTables(ctx context.Context, c *gin.Context, p connParams) ([]tableInfo, bool) {
+	if v, ok := usableSchema(p, "tables", loadTables); ok {
+		tables, _ := v.([]tableInfo)
+		return tables, true
+	}
+	db, ok := connectTarget(ctx, c, p)
+	if !ok {
+		return nil, false
+	}
+	defer db.Close()
+	tables, err := schemaTables(ctx, db, p)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "schema_failed", err.Error())
+		return nil, false
+	}
+	return tables, true
+}
+
+// apiComplete returns table, column and keyword suggestions for an editor.
+// GET takes ?connection=name&prefix=&table=&refresh=1, POST an
+// apiCompleteRequest body.
+func apiComplete(c *gin.Context) {
+	req := apiCompleteRequest{
+		apiTarget: apiTarget{Connection: c.Query("connection")},
+		Prefix:    c.Query("prefix"),
+		Table:     c.Query("table"),
+		Refresh:   c.Query("refresh") != "",
+	}
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiQueryTimeout)
+	defer cancel()
+
+	p, ok := resolveTarget(ctx, c, req.apiTarget)
+	if !ok {
+		return
+	}
+	if req.Refresh {
+		invalidateSchema(p)
+	}
+	tables, ok := completionTables(ctx, c, p)
+	if !ok {
+		return
+	}
+
+	prefix := strings.ToLower(req.Prefix)
+	matches := func(name string) bool { return strings.HasPrefix(strings.ToLower(name), prefix) }
+	resp := apiCompleteResponse{
+		Tables:   []apiCompleteTable{},
+		Columns:  []apiCompleteColumn{},
+		Keywords: []string{},
+		LoadedAt: schemaLoadedAt(p),
+	}
+	for _, t := range tables {
+		if req.Table != "" && !strings.EqualFold(t.Name, req.Table) && !strings.EqualFold(qualifiedName(t), req.Table) {
+			continue
+		}
+		if req.Table == "" && (matches(t.Name) || matches(qualifiedName(t))) && len(resp.Tables) < completeLimit {
+			resp.Tables = append(resp.Tables, apiCompleteTable{Schema: t.Schema, Name: t.Name})
+		}
+		for _, col := range t.Columns {
+			if matches(col.Name) && len(resp.Columns) < completeLimit {
+				resp.Columns = append(resp.Columns, apiCompleteColumn{Table: qualifiedName(t), Name: col.Name, Type: col.Type})
+			}
+		}
+	}
+	if req.Table == "" {
+		for _, kw := range append(append([]string{}, sqlKeywords...), driverKeywords[p.Driver]...) {
+			if matches(kw) {
+				resp.Keywords = append(resp.Keywords, kw)
+			}
+		}
+		sort.Strings(resp.Keywords)
+	}
+	c.JSON(http.StatusOK, resp)
+}
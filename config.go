@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+)
+
+// appConfig is read once at startup from SIMPLEADMIN_CONFIG (config.json by
+// default). Every field is optional.
+type appConfig struct {
+	// Store is the SQLite file holding saved connections and other app data
+	Store string     `json:"store"`
+	Auth  authConfig `json:"auth"`
+	// LLM configures the optional natural-language SQL assistant
+	LLM llmConfig `json:"llm"`
+	// ExportWatermark adds a visible "exported by" notice to every export;
+	// the export id is always embedded
+	ExportWatermark bool `json:"export_watermark"`
+	// DisableDestructive removes the DROP and TRUNCATE actions
+	DisableDestructive bool `json:"disable_destructive"`
+	// Tickets configures attaching results to Jira or GitLab issues
+	Tickets ticketConfig `json:"tickets"`
+	// Encryption holds application keys for encrypted columns by name
+	Encryption map[string]columnKeyConfig `json:"encryption"`
+	// Hooks are webhooks asked before and after every query
+	Hooks []webhookConfig `json:"hooks"`
+	// DriverPlugins are Go plugins adding database drivers, see pluginDriver
+	DriverPlugins []string `json:"driver_plugins"`
+	// MaxRows caps the rows a query returns to the page and the API;
+	// exports read everything. 0 or less is no cap
+	MaxRows int `json:"max_rows"`
+	// ResultCache serves repeated read-only queries from memory
+	ResultCache resultCacheConfig `json:"result_cache"`
+	// QueryLimit queues queries beyond a per-server concurrency limit
+	QueryLimit queryLimitConfig `json:"query_limit"`
+	// Notify announces finished scheduled queries and background jobs
+	Notify notifyConfig `json:"notify"`
+	// Share sets the expiry and access of result share links
+	Share shareConfig `json:"share"`
+	// I18n sets the language of messages to users
+	I18n i18nConfig `json:"i18n"`
+	// SchemaSnapshots records schema changes of saved connections over time
+	SchemaSnapshots schemaSnapshotConfig `json:"schema_snapshots"`
+	// Migrations are directories of versioned .sql files to apply
+	Migrations migrationsConfig `json:"migrations"`
+	// Display sets the time zone and layouts of values on the pages
+	Display displayConfig `json:"display"`
+	// BinaryUUIDs reads 16-byte MySQL BINARY values as UUIDs. Off by
+	// default: a BINARY(16) may as well hold an MD5 hash
+	BinaryUUIDs bool `json:"binary_uuids"`
+}
+
+var config = appConfig{
+	Store:   "simpleadmin.db",
+	MaxRows: 10000,
+	LLM: llmConfig{
+		Endpoint:       "https://api.openai.com/v1",
+		Model:          "gpt-4o-mini",
+		APIKeyEnv:      "OPENAI_API_KEY",
+		MaxSchemaChars: 16000,
+	},
+	ResultCache: resultCacheConfig{
+		MaxEntries: 256,
+		MaxRows:    10000,
+	},
+	QueryLimit: queryLimitConfig{QueueTimeout: 30},
+}
+
+func loadConfig() {
+	path := os.Getenv("SIMPLEADMIN_CONFIG")
+	if path == "" {
+		path = "config.json"
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to read config %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		log.Fatalf("Failed to parse config %s: %v", path, err)
+	}
+	log.Printf("Loaded config from %s", path)
+}
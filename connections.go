@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// savedConnection is a named set of connection parameters kept in the store.
+type savedConnection struct {
+	Name string `json:"name"`
+	connParams
+}
+
+var errConnectionNotFound = errors.New("connection not found")
+
+func listConnections(ctx context.Context) ([]savedConnection, error) {
+	rows, err := store.QueryContext(ctx,
+		`SELECT name, driver, server, username, password, database, tls_fingerprint, query_tags,
+			charset, result_encoding, dial_timeout, read_timeout, write_timeout, keepalive
+		FROM connections ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conns []savedConnection
+	for rows.Next() {
+		var sc savedConnection
+		if err := rows.Scan(&sc.Name, &sc.Driver, &sc.Server, &sc.Username, &sc.Password, &sc.Database,
+			&sc.TLSFingerprint, &sc.QueryTags, &sc.Charset, &sc.ResultEncoding,
+			&sc.DialTimeout, &sc.ReadTimeout, &sc.WriteTimeout, &sc.KeepAlive); err != nil {
+			return nil, err
+		}
+		conns = append(conns, sc)
+	}
+	return conns, rows.Err()
+}
+
+// connectionNames lists the saved connections for pickers; a store error
+// is logged and leaves the list empty.
+func connectionNames(ctx context.Context) []string {
+	conns, err := listConnections(ctx)
+	if err != nil {
+		log.Printf("Failed to read saved connections: %v", err)
+	}
+	names := make([]string, len(conns))
+	for i, sc := range conns {
+		names[i] = sc.Name
+	}
+	return names
+}
+
+func getConnection(ctx context.Context, name string) (savedConnection, error) {
+	sc := savedConnection{Name: name}
+	err := store.QueryRowContext(ctx,
+		`SELECT driver, server, username, password, database, tls_fingerprint, query_tags,
+			charset, result_encoding, dial_timeout, read_timeout, write_timeout, keepalive
+		FROM connections WHERE name = ?`, name,
+	).Scan(&sc.Driver, &sc.Server, &sc.Username, &sc.Password, &sc.Database, &sc.TLSFingerprint, &sc.QueryTags,
+		&sc.Charset, &sc.ResultEncoding, &sc.DialTimeout, &sc.ReadTimeout, &sc.WriteTimeout, &sc.KeepAlive)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sc, fmt.Errorf("%w: %s", errConnectionNotFound, name)
+	}
+	return sc, err
+}
+
+func saveConnection(ctx context.Context, sc savedConnection) error {
+	_, err := store.ExecContext(ctx, `
+		INSERT INTO connections (name, driver, server, username, password, database, tls_fingerprint, query_tags,
+			charset, result_encoding, dial_timeout, read_timeout, write_timeout, keepalive)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			driver = excluded.driver, server = excluded.server, username = excluded.username,
+			password = excluded.password, database = excluded.database,
+			tls_fingerprint = excluded.tls_fingerprint, query_tags = excluded.query_tags,
+			charset = excluded.charset, result_encoding = excluded.result_encoding, dial_timeout = excluded.dial_timeout,
+			read_timeout = excluded.read_timeout, write_timeout = excluded.write_timeout,
+			keepalive = excluded.keepalive`,
+		sc.Name, sc.Driver, sc.Server, sc.Username, sc.Password, sc.Database, sc.TLSFingerprint, sc.QueryTags,
+		sc.Charset, sc.ResultEncoding, sc.DialTimeout, sc.ReadTimeout, sc.WriteTimeout, sc.KeepAlive)
+	return err
+}
+
+func deleteConnection(ctx context.Context, name string) error {
+	res, err := store.ExecContext(ctx, "DELETE FROM connections WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", errConnectionNotFound, name)
+	}
+	return nil
+}
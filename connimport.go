@@ -0,0 +1,549 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// connImportMaxSize bounds each uploaded connection file
+const connImportMaxSize = 4 << 20
+
+// connectionImporters read the connection exports of other tools. Only
+// .pgpass and .my.cnf keep passwords in plain text; the others import
+// without one.
+var connectionImporters = map[string]func(data []byte) ([]savedConnection, []string, error){
+	"dbeaver":  importDBeaver,
+	"datagrip": importDataGrip,
+	"pgadmin":  importPgAdmin,
+	"pgpass":   importPgpass,
+	"mycnf":    importMyCnf,
+}
+
+// detectImportFormat guesses the format of an uploaded file from its name
+// and first bytes.
+func detectImportFormat(filename string, data []byte) string {
+	name := strings.ToLower(filepath.Base(filename))
+	head := bytes.TrimSpace(data)
+	switch {
+	case strings.Contains(name, "pgpass"):
+		return "pgpass"
+	case strings.HasSuffix(name, ".cnf") || strings.HasSuffix(name, ".ini") || bytes.HasPrefix(head, []byte("[")):
+		return "mycnf"
+	case bytes.HasPrefix(head, []byte("<")):
+		return "datagrip"
+	case bytes.HasPrefix(head, []byte("{")) && bytes.Contains(data, []byte(`"Servers"`)):
+		return "pgadmin"
+	case bytes.HasPrefix(head, []byte("{")):
+		return "dbeaver"
+	}
+	return "pgpass"
+}
+
+// importDriverName maps another tool's driver or provider id to ours, ""
+// when the database isn't supported.
+func importDriverName(id string) string {
+	id = strings.ToLower(id)
+	switch {
+	case strings.Contains(id, "postgres"), strings.Contains(id, "redshift"), strings.Contains(id, "cockroach"):
+		return "postgres"
+	case strings.Contains(id, "mysql"), strings.Contains(id, "maria"):
+		return "mysql"
+	case strings.Contains(id, "clickhouse"):
+		return "clickhouse"
+	case strings.Contains(id, "sqlite"):
+		return "sqlite"
+	}
+	return ""
+}
+
+// importServer joins host and port into the server field; ClickHouse JDBC
+// URLs name the HTTP port, which the native protocol doesn't speak.
+func importServer(driver, host, port string) string {
+	if driver == "clickhouse" && (port == "8123" || port == "8443") {
+		port = ""
+	}
+	if port == "" || strings.HasPrefix(host, "/") {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// parseJDBCURL reads jdbc:<driver>://host:port/database and jdbc:sqlite:path.
+func parseJDBCURL(raw string) (connParams, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(raw), "jdbc:")
+	if !ok {
+		return connParams{}, fmt.Errorf("not a JDBC URL: %q", raw)
+	}
+	if path, ok := strings.CutPrefix(rest, "sqlite:"); ok {
+		return connParams{Driver: "sqlite", Database: path}, nil
+	}
+	u, err := url.Parse(rest)
+	if err != nil {
+		return connParams{}, fmt.Errorf("invalid JDBC URL %q: %v", raw, err)
+	}
+	p := connParams{Driver: importDriverName(u.Scheme)}
+	if u.Scheme == "ch" {
+		p.Driver = "clickhouse"
+	}
+	if p.Driver == "" {
+		return p, fmt.Errorf("unsupported database %q", u.Scheme)
+	}
+	// MySQL URLs may list several hosts; the first one is the primary
+	host, _, _ := strings.Cut(u.Host, ",")
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		p.Server = importServer(p.Driver, h, port)
+	} else {
+		p.Server = host
+	}
+	p.Database = strings.TrimPrefix(u.Path, "/")
+	if u.User != nil {
+		p.Username = u.User.Username()
+		p.Password, _ = u.User.Password()
+	}
+	if user := u.Query().Get("user"); user != "" {
+		p.Username = user
+	}
+	return p, nil
+}
+
+// importDBeaver reads the data-sources.json of a DBeaver workspace.
+// Credentials saved in DBeaver are encrypted in a separate file and are not
+// imported.
+func importDBeaver(data []byte) ([]savedConnection, []string, error) {
+	var doc struct {
+		Connections map[string]struct {
+			Name          string `json:"name"`
+			Provider      string `json:"provider"`
+			Driver        string `json:"driver"`
+			Configuration struct {
+				Host     string `json:"host"`
+				Port     string `json:"port"`
+				Database string `json:"database"`
+				URL      string `json:"url"`
+				User     string `json:"user"`
+				Password string `json:"password"`
+			} `json:"configuration"`
+		} `json:"connections"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid DBeaver data-sources.json: %v", err)
+	}
+	var conns []savedConnection
+	var notes []string
+	for id, ds := range doc.Connections {
+		name := ds.Name
+		if name == "" {
+			name = id
+		}
+		cfg := ds.Configuration
+		driver := importDriverName(ds.Driver)
+		if driver == "" {
+			driver = importDriverName(ds.Provider)
+		}
+		var p connParams
+		switch {
+		case cfg.Host != "" && driver != "":
+			p = connParams{Driver: driver, Server: importServer(driver, cfg.Host, cfg.Port), Database: cfg.Database}
+		case cfg.URL != "":
+			var err error
+			if p, err = parseJDBCURL(cfg.URL); err != nil {
+				notes = append(notes, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+		case driver == "sqlite":
+			p = connParams{Driver: driver, Database: cfg.Database}
+		default:
+			notes = append(notes, fmt.Sprintf("%s: unsupported database %q", name, ds.Provider))
+			continue
+		}
+		if cfg.User != "" {
+			p.Username = cfg.User
+		}
+		if cfg.Password != "" {
+			p.Password = cfg.Password
+		}
+		conns = append(conns, savedConnection{Name: name, connParams: p})
+	}
+	// map order is random, keep the report stable
+	sort.Slice(conns, func(i, j int) bool { return conns[i].Name < conns[j].Name })
+	sort.Strings(notes)
+	return conns, notes, nil
+}
+
+// importDataGrip reads a DataGrip (or other JetBrains IDE) dataSources.xml.
+// User names live in dataSources.local.xml; uploaded together, the two
+// files arrive concatenated and are merged by data source.
+func importDataGrip(data []byte) ([]savedConnection, []string, error) {
+	type dataSource struct {
+		Name string `xml:"name,attr"`
+		UUID string `xml:"uuid,attr"`
+		URL  string `xml:"jdbc-url"`
+		User string `xml:"user-name"`
+	}
+	var sources []dataSource
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc struct {
+			DataSources []dataSource `xml:"component>data-source"`
+		}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid DataGrip dataSources.xml: %v", err)
+		}
+		sources = append(sources, doc.DataSources...)
+	}
+
+	users := map[string]string{}
+	for _, ds := range sources {
+		if ds.User != "" {
+			users[ds.UUID+"/"+ds.Name] = ds.User
+		}
+	}
+	var conns []savedConnection
+	var notes []string
+	for _, ds := range sources {
+		if ds.URL == "" {
+			continue
+		}
+		p, err := parseJDBCURL(ds.URL)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("%s: %v", ds.Name, err))
+			continue
+		}
+		if user := users[ds.UUID+"/"+ds.Name]; user != "" {
+			p.Username = user
+		}
+		conns = append(conns, savedConnection{Name: ds.Name, connParams: p})
+	}
+	if len(conns) == 0 && len(sources) > 0 {
+		return nil, nil, fmt.Errorf("no JDBC URLs found; upload dataSources.xml along with dataSources.local.xml")
+	}
+	return conns, notes, nil
+}
+
+// importPgAdmin reads a pgAdmin 4 servers.json export.
+func importPgAdmin(data []byte) ([]savedConnection, []string, error) {
+	var doc struct {
+		Servers map[string]struct {
+			Name          string      `json:"Name"`
+			Host          string      `json:"Host"`
+			Port          json.Number `json:"Port"`
+			MaintenanceDB string      `json:"MaintenanceDB"`
+			Username      string      `json:"Username"`
+		} `json:"Servers"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid pgAdmin servers.json: %v", err)
+	}
+	var conns []savedConnection
+	for _, s := range doc.Servers {
+		conns = append(conns, savedConnection{Name: s.Name, connParams: connParams{
+			Driver:   "postgres",
+			Server:   importServer("postgres", s.Host, s.Port.String()),
+			Username: s.Username,
+			Database: s.MaintenanceDB,
+		}})
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i].Name < conns[j].Name })
+	return conns, nil, nil
+}
+
+// splitPgpassLine splits hostname:port:database:username:password, where
+// "\:" and "\\" escape a colon and a backslash.
+func splitPgpassLine(line string) []string {
+	var fields []string
+	var field strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line):
+			i++
+			field.WriteByte(line[i])
+		case line[i] == ':' && len(fields) < 4:
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(line[i])
+		}
+	}
+	return append(fields, field.String())
+}
+
+// importPgpass reads a PostgreSQL password file. Lines with a wildcard host
+// can't be connected to and are skipped; a wildcard database or port is
+// left to the defaults.
+func importPgpass(data []byte) ([]savedConnection, []string, error) {
+	var conns []savedConnection
+	var notes []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := splitPgpassLine(line)
+		if len(f) != 5 {
+			notes = append(notes, fmt.Sprintf("line %d: expected hostname:port:database:username:password", n))
+			continue
+		}
+		host, port, database, user := f[0], f[1], f[2], f[3]
+		if host == "*" || user == "*" {
+			notes = append(notes, fmt.Sprintf("line %d: wildcard host or user", n))
+			continue
+		}
+		if port == "*" {
+			port = ""
+		}
+		if database == "*" {
+			database = ""
+		}
+		name := user + "@" + host
+		if database != "" {
+			name += "/" + database
+		}
+		conns = append(conns, savedConnection{Name: name, connParams: connParams{
+			Driver:   "postgres",
+			Server:   importServer("postgres", host, port),
+			Username: user,
+			Password: f[4],
+			Database: database,
+		}})
+	}
+	return conns, notes, sc.Err()
+}
+
+// importMyCnf reads the client sections of a MySQL option file. [client]
+// and [mysql] give the defaults; every other [client...] group (as used
+// with --defaults-group-suffix) becomes a connection of its own.
+func importMyCnf(data []byte) ([]savedConnection, []string, error) {
+	groups := map[string]map[string]string{}
+	var order []string
+	var group map[string]string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "!"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			group = nil
+			if strings.HasPrefix(name, "client") || name == "mysql" {
+				if groups[name] == nil {
+					groups[name] = map[string]string{}
+					order = append(order, name)
+				}
+				group = groups[name]
+			}
+			continue
+		}
+		if group == nil {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		key = strings.ReplaceAll(strings.TrimSpace(key), "-", "_")
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		group[key] = value
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	defaults := map[string]string{}
+	for _, name := range []string{"client", "mysql"} {
+		for k, v := range groups[name] {
+			defaults[k] = v
+		}
+	}
+	conn := func(name string, opts map[string]string) savedConnection {
+		get := func(key string) string {
+			if v, ok := opts[key]; ok {
+				return v
+			}
+			return defaults[key]
+		}
+		host := get("host")
+		if socket := get("socket"); socket != "" && (host == "" || host == "localhost") {
+			host = socket
+		}
+		if host == "" {
+			host = "localhost"
+		}
+		saved := savedConnection{Name: name, connParams: connParams{
+			Driver:   "mysql",
+			Server:   importServer("mysql", host, get("port")),
+			Username: get("user"),
+			Password: get("password"),
+			Database: get("database"),
+		}}
+		if saved.Name == "" {
+			saved.Name = saved.Username + "@" + host
+		}
+		return saved
+	}
+
+	var conns []savedConnection
+	for _, name := range order {
+		if name == "client" || name == "mysql" {
+			continue
+		}
+		conns = append(conns, conn(strings.TrimLeft(strings.TrimPrefix(name, "client"), "_-"), groups[name]))
+	}
+	if len(conns) == 0 && len(defaults) > 0 {
+		conns = append(conns, conn("", defaults))
+	}
+	if len(conns) == 0 {
+		return nil, nil, fmt.Errorf("no [client] section found")
+	}
+	return conns, nil, nil
+}
+
+// sameServer reports whether a saved connection points at the same
+// account and database as an imported one.
+func sameServer(a, b connParams) bool {
+	return a.Driver == b.Driver && a.address() == b.address() && a.Username == b.Username &&
+		(b.Database == "" || a.Database == b.Database)
+}
+
+// importConnections saves the connections read from an export. A
+// connection whose name is taken is skipped unless replace is set. An
+// imported password goes to the saved connections to the same account that
+// have none instead of a new entry, so a .pgpass completes an earlier
+// DBeaver or pgAdmin import.
+func importConnections(ctx context.Context, conns []savedConnection, replace bool) (imported, notes []string, err error) {
+	existing, err := listConnections(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	taken := map[string]bool{}
+	for _, sc := range existing {
+		taken[sc.Name] = true
+	}
+	for _, sc := range conns {
+		filled := false
+		for i, old := range existing {
+			if sc.Password == "" || old.Password != "" || !sameServer(old.connParams, sc.connParams) {
+				continue
+			}
+			old.Password = sc.Password
+			if err := saveConnection(ctx, old); err != nil {
+				return imported, notes, err
+			}
+			existing[i] = old
+			filled = true
+			notes = append(notes, fmt.Sprintf("%s: password filled in from %s", old.Name, sc.Name))
+		}
+		if filled {
+			continue
+		}
+		if err := sc.validateAddress(); err != nil {
+			notes = append(notes, fmt.Sprintf("%s: %v", sc.Name, err))
+			continue
+		}
+		if taken[sc.Name] && !replace {
+			notes = append(notes, fmt.Sprintf("%s: a connection with this name exists", sc.Name))
+			continue
+		}
+		if err := saveConnection(ctx, sc); err != nil {
+			return imported, notes, err
+		}
+		taken[sc.Name] = true
+		imported = append(imported, sc.Name)
+	}
+	return imported, notes, nil
+}
+
+// importConnectionsHandler saves the connections of an uploaded DBeaver,
+// DataGrip, pgAdmin, .pgpass or .my.cnf file.
+func importConnectionsHandler(c *gin.Context) {
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "connimport.html", format, args...)
+	}
+	form, err := c.MultipartForm()
+	if err != nil || len(form.File["file"]) == 0 {
+		fail(http.StatusBadRequest, "Upload a connection file")
+		return
+	}
+	var format string
+	var data []byte
+	for _, upload := range form.File["file"] {
+		if upload.Size > connImportMaxSize {
+			fail(http.StatusBadRequest, "%s is larger than %s", upload.Filename, formatBytes(connImportMaxSize))
+			return
+		}
+		f, err := upload.Open()
+		if err != nil {
+			fail(http.StatusBadRequest, "Failed to read upload: %v", err)
+			return
+		}
+		b, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			fail(http.StatusBadRequest, "Failed to read upload: %v", err)
+			return
+		}
+		// several files of one format are read as one, so DataGrip's two
+		// files merge; JSON exports can't be joined
+		detected := detectImportFormat(upload.Filename, b)
+		switch {
+		case format != "" && detected != format:
+			fail(http.StatusBadRequest, "Upload files of one format at a time")
+			return
+		case format == "dbeaver" || format == "pgadmin":
+			fail(http.StatusBadRequest, "Upload one %s file at a time", format)
+			return
+		}
+		format = detected
+		data = append(append(data, b...), '\n')
+	}
+	if f := c.PostForm("format"); f != "" && f != "auto" {
+		format = f
+	}
+	parse, ok := connectionImporters[format]
+	if !ok {
+		fail(http.StatusBadRequest, "Unknown connection file format %q", format)
+		return
+	}
+	conns, notes, err := parse(data)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	imported, saveNotes, err := importConnections(ctx, conns, c.PostForm("replace") != "")
+	if err != nil {
+		log.Printf("Connection import failed: %v", err)
+		fail(http.StatusInternalServerError, "Failed to save connections: %v", err)
+		return
+	}
+	recordAudit(ctx, auditEntry{
+		User:   currentIdentity(c).User,
+		Action: "connection_import",
+		Target: format,
+		Detail: strconv.Itoa(len(imported)) + " imported: " + strings.Join(imported, ", "),
+	})
+	render(c, http.StatusOK, connImportView{Format: format, Imported: imported, Notes: append(notes, saveNotes...)})
+}
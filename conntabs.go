@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// connTabIdleTimeout forgets a browser session's tabs, and the
+	// credentials in them, when it hasn't been used for a working day
+	connTabIdleTimeout = 8 * time.Hour
+	maxConnTabs        = 10
+	// connTabParamsKey holds the tab's connection for connParamsFromForm
+	connTabParamsKey = "conn_tab_params"
+)
+
+// connTab is a connection opened once and then picked by name, so its
+// credentials stay on the server and several can be used side by side.
+type connTab struct {
+	ID   string
+	Name string
+	// Label describes the connection without secrets
+	Label  string
+	params connParams
+}
+
+type connTabSession struct {
+	tabs     []*connTab
+	lastUsed time.Time
+}
+
+var (
+	connTabsMu      sync.Mutex
+	connTabSessions = make(map[string]*connTabSession)
+	connTabSweeper  sync.Once
+)
+
+// sweepConnTabs forgets idle sessions' tabs.
+func sweepConnTabs() {
+	for range time.Tick(time.Minute) {
+		connTabsMu.Lock()
+		for id, s := range connTabSessions {
+			if time.Since(s.lastUsed) > connTabIdleTimeout {
+				delete(connTabSessions, id)
+			}
+		}
+		connTabsMu.Unlock()
+	}
+}
+
+// tabSessionKey ties tabs to the browser and the user signed in on it, so
+// someone else signing in on the same browser doesn't get them.
+func tabSessionKey(c *gin.Context) string {
+	return sessionID(c) + "/" + currentIdentity(c).User
+}
+
+// sessionTabs returns a copy of the browser session's tabs.
+func sessionTabs(c *gin.Context) []connTab {
+	connTabsMu.Lock()
+	defer connTabsMu.Unlock()
+	var tabs []connTab
+	if s, ok := connTabSessions[tabSessionKey(c)]; ok {
+		s.lastUsed = time.Now()
+		for _, t := range s.tabs {
+			tabs = append(tabs, *t)
+		}
+	}
+	return tabs
+}
+
+func findConnTab(c *gin.Context, id string) (connTab, bool) {
+	for _, t := range sessionTabs(c) {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return connTab{}, false
+}
+
+// formTarget is a second connection picked in a form, by <prefix>_tab or
+// <prefix>_connection (a saved one), or by default the form's own.
+func formTarget(c *gin.Context, prefix string, p connParams) (connParams, error) {
+	if id := c.PostForm(prefix + "_tab"); id != "" {
+		t, ok := findConnTab(c, id)
+		if !ok {
+			return p, fmt.Errorf("the picked connection tab is closed or expired")
+		}
+		return t.params, nil
+	}
+	if name := c.PostForm(prefix + "_connection"); name != "" {
+		sc, err := getConnection(c.Request.Context(), name)
+		if err != nil {
+			return p, err
+		}
+		return sc.connParams, nil
+	}
+	return p, nil
+}
+
+// connTabMiddleware swaps in the connection of the tab a form names in
+// conn_tab. A tab that is gone fails the request: falling back to the form's
+// fields could run the query against another server.
+func connTabMiddleware(c *gin.Context) {
+	path := c.Request.URL.Path
+	if c.Request.Method != http.MethodPost || strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/tabs") {
+		c.Next()
+		return
+	}
+	id := c.PostForm("conn_tab")
+	if id == "" {
+		c.Next()
+		return
+	}
+	t, ok := findConnTab(c, id)
+	if !ok {
+		render(c, http.StatusConflict, resultError(nil, "This connection tab is closed or expired; open it again"))
+		c.Abort()
+		return
+	}
+	c.Set(connTabParamsKey, t.params)
+	c.Next()
+}
+
+// tabsHandler renders the tab bar.
+func tabsHandler(c *gin.Context) {
+	renderTabs(c, http.StatusOK, "", "")
+}
+
+func renderTabs(c *gin.Context, status int, active, message string) {
+	render(c, status, connTabsView{
+		Tabs:        sessionTabs(c),
+		Active:      active,
+		Message:     message,
+		Connections: connectionNames(c.Request.Context()),
+	})
+}
+
+// openTabHandler opens a tab on a saved connection, or on the query form's
+// connection fields, after checking it connects.
+func openTabHandler(c *gin.Context) {
+	fail := func(status int, format string, args ...interface{}) {
+		renderTabs(c, status, "", fmt.Sprintf(format, args...))
+	}
+
+	name := strings.TrimSpace(c.PostForm("tab_name"))
+	saved := c.PostForm("tab_connection")
+	var p connParams
+	if saved != "" {
+		sc, err := getConnection(c.Request.Context(), saved)
+		if err != nil {
+			fail(http.StatusBadRequest, "%v", err)
+			return
+		}
+		p = sc.connParams
+		if name == "" {
+			name = saved
+		}
+	} else {
+		p = connParamsFromFields(c)
+	}
+	if name == "" {
+		name = p.Server
+	}
+	if err := p.validateAddress(); err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	if _, ok := dbDrivers[p.Driver]; !ok {
+		fail(http.StatusBadRequest, "Unsupported database driver %q", p.Driver)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	db.Close()
+
+	t := &connTab{
+		ID:     randomID(8),
+		Name:   name,
+		Label:  p.Username + " on " + p.auditTarget(),
+		params: p,
+	}
+	connTabsMu.Lock()
+	s, ok := connTabSessions[tabSessionKey(c)]
+	if !ok {
+		s = &connTabSession{}
+		connTabSessions[tabSessionKey(c)] = s
+	}
+	full := len(s.tabs) >= maxConnTabs
+	if !full {
+		s.tabs = append(s.tabs, t)
+		s.lastUsed = time.Now()
+	}
+	connTabsMu.Unlock()
+	connTabSweeper.Do(func() { go sweepConnTabs() })
+	if full {
+		fail(http.StatusBadRequest, "At most %d tabs can be open; close one first", maxConnTabs)
+		return
+	}
+	renderTabs(c, http.StatusOK, t.ID, "")
+}
+
+// closeTabHandler forgets a tab and its credentials.
+func closeTabHandler(c *gin.Context) {
+	id := c.PostForm("tab")
+	connTabsMu.Lock()
+	if s, ok := connTabSessions[tabSessionKey(c)]; ok {
+		for i, t := range s.tabs {
+			if t.ID == id {
+				s.tabs = append(s.tabs[:i:i], s.tabs[i+1:]...)
+				break
+			}
+		}
+	}
+	connTabsMu.Unlock()
+	renderTabs(c, http.StatusOK, "", "")
+}
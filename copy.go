@@ -0,0 +1,610 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	copyTimeout      = 6 * time.Hour
+	copyDefaultBatch = 1000
+	copyMaxBatch     = 100000
+	// copyMaxParams keeps a multi-row INSERT under the bind parameter limit
+	// of every server (SQLite's 32766 is the lowest)
+	copyMaxParams = 30000
+)
+
+// copyTypes name a column of each value kind when a target table is
+// created on another kind of server.
+var copyTypes = map[string]map[string]string{
+	"postgres": {
+		kindString: "text", kindInt: "bigint", kindUint: "numeric(20)", kindFloat: "double precision",
+		kindDecimal: "numeric", kindBool: "boolean", kindTime: "timestamptz", kindBinary: "bytea",
+	},
+	"mysql": {
+		kindString: "LONGTEXT", kindInt: "BIGINT", kindUint: "BIGINT UNSIGNED", kindFloat: "DOUBLE",
+		kindDecimal: "DECIMAL(38,10)", kindBool: "BOOLEAN", kindTime: "DATETIME(6)", kindBinary: "LONGBLOB",
+	},
+	"clickhouse": {
+		kindString: "String", kindInt: "Int64", kindUint: "UInt64", kindFloat: "Float64",
+		kindDecimal: "Decimal(38,10)", kindBool: "Bool", kindTime: "DateTime64(6)", kindBinary: "String",
+	},
+	"sqlite": {
+		kindString: "TEXT", kindInt: "INTEGER", kindUint: "INTEGER", kindFloat: "REAL",
+		kindDecimal: "NUMERIC", kindBool: "INTEGER", kindTime: "TEXT", kindBinary: "BLOB",
+	},
+}
+
+var decimalArgs = regexp.MustCompile(`\(\s*\d+\s*(,\s*\d+\s*)?\)`)
+
+var copyDateTypes = map[string]string{"postgres": "date", "mysql": "DATE", "clickhouse": "Date32", "sqlite": "TEXT"}
+
+// copyColumnType is the target type of a source column. The same kind of
+// server keeps the type as it is, except PostgreSQL arrays and user-defined
+// types, which arrive as text.
+func copyColumnType(from, to string, col columnInfo) (string, error) {
+	if from == to && col.Type != "ARRAY" && col.Type != "USER-DEFINED" {
+		return col.Type, nil
+	}
+	types, ok := copyTypes[to]
+	if !ok {
+		return "", fmt.Errorf("tables can't be created on %s; create the target table first", to)
+	}
+	kind := kindOf(from, col.Type)
+	t := types[kind]
+	switch {
+	case kind == kindTime && baseType(col.Type) == "DATE":
+		t = copyDateTypes[to]
+	case kind == kindDecimal:
+		// keep the precision and scale of numeric(12,2)
+		if m := decimalArgs.FindString(col.Type); m != "" && to != "sqlite" {
+			t = strings.SplitN(t, "(", 2)[0] + m
+		}
+	}
+	if t == "" {
+		t = types[kindString]
+	}
+	return t, nil
+}
+
+// copyCreateTable builds the CREATE TABLE for a target table shaped like
+// the source. ClickHouse gets a MergeTree without a sorting key.
+func copyCreateTable(from, to, name string, columns []columnInfo) (string, error) {
+	var defs []string
+	for _, col := range columns {
+		t, err := copyColumnType(from, to, col)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case to == "clickhouse" && col.Nullable && !strings.HasPrefix(t, "Nullable("):
+			t = "Nullable(" + t + ")"
+		case to != "clickhouse" && !col.Nullable:
+			t += " NOT NULL"
+		}
+		defs = append(defs, quoteIdent(to, col.Name)+" "+t)
+	}
+	stmt := fmt.Sprintf("CREATE TABLE %s (\n\t%s\n)", quoteIdent(to, name), strings.Join(defs, ",\n\t"))
+	if to == "clickhouse" {
+		stmt += " ENGINE = MergeTree ORDER BY tuple()"
+	}
+	return stmt, nil
+}
+
+// copyValue readies a source value for the target column. Text that the
+// target keeps as a number or time is parsed, since ClickHouse doesn't
+// convert strings itself, and values database/sql can't send, like
+// ClickHouse arrays and maps, go as JSON.
+func copyValue(v interface{}, kind string) (interface{}, error) {
+	switch t := v.(type) {
+	case nil, []byte, time.Time, driver.Valuer:
+		return v, nil
+	case string:
+		switch kind {
+		case kindInt:
+			return strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+		case kindUint:
+			return strconv.ParseUint(strings.TrimSpace(t), 10, 64)
+		case kindFloat:
+			return strconv.ParseFloat(strings.TrimSpace(t), 64)
+		case kindBool:
+			switch strings.ToLower(strings.TrimSpace(t)) {
+			case "t", "true", "1", "yes", "y":
+				return true, nil
+			case "f", "false", "0", "no", "n":
+				return false, nil
+			}
+			return nil, fmt.Errorf("%q is not a boolean", t)
+		case kindTime:
+			for _, layout := range jsonTimeLayouts {
+				if ts, err := time.Parse(layout, strings.TrimSpace(t)); err == nil {
+					return ts, nil
+				}
+			}
+			return nil, fmt.Errorf("%q is not a time", t)
+		}
+		return t, nil
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+	return v, nil
+}
+
+// copyJob copies a table from one connection to another in the background,
+// a batch at a time, so the page can poll its progress. Only its starter
+// sees it.
+type copyJob struct {
+	ID          string
+	User        string
+	Source      string
+	Target      string
+	Table       string
+	TargetTable string
+	// Created is the CREATE TABLE run on the target, if any
+	Created string
+	// Skipped are source columns the target table lacks
+	Skipped []string
+	// Estimate is the server's row estimate for the source, 0 when unknown
+	Estimate int64
+	Batch    int
+	Started  time.Time
+
+	cancel context.CancelFunc
+	// copied counts the rows inserted so far
+	copied int64
+
+	mu       sync.Mutex
+	err      string
+	finished time.Time
+}
+
+var (
+	copyJobsMu sync.Mutex
+	copyJobs   = make(map[string]*copyJob)
+)
+
+// copyPlan is what run needs: the statements and the column kinds of the
+// target, in the order the SELECT returns them.
+type copyPlan struct {
+	selectStmt string
+	insertHead string
+	marks      int
+	kinds      []string
+}
+
+func (j *copyJob) run(ctx context.Context, src, dst connParams, plan copyPlan, ev queryEvent) {
+	defer j.cancel()
+	err := j.copy(ctx, src, dst, plan)
+	if j.Created != "" {
+		invalidateSchema(dst)
+	}
+	for _, a := range afterQuery(context.Background(), ev, j.Started, err) {
+		log.Printf("Query hook note for %s: %s", j.User, a)
+	}
+
+	j.mu.Lock()
+	if err != nil {
+		j.err = err.Error()
+	}
+	j.finished = time.Now()
+	j.mu.Unlock()
+	if err != nil {
+		log.Printf("Copy %s of %s failed after %d rows: %v", j.ID, j.Table, atomic.LoadInt64(&j.copied), err)
+	}
+
+	done := notifyEvent{
+		Kind:    "job",
+		Name:    j.ID,
+		User:    j.User,
+		Target:  j.Target,
+		Query:   plan.selectStmt,
+		Status:  "succeeded",
+		Rows:    int(atomic.LoadInt64(&j.copied)),
+		Elapsed: j.finished.Sub(j.Started),
+		At:      j.finished,
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		done.Status = "canceled"
+	case err != nil:
+		done.Status, done.Error = "failed", err.Error()
+	}
+	notify(done)
+
+	time.AfterFunc(jobRetention, func() {
+		copyJobsMu.Lock()
+		delete(copyJobs, j.ID)
+		copyJobsMu.Unlock()
+	})
+}
+
+// copy streams the source rows and inserts them a batch at a time. Each
+// batch commits on its own: a failed copy leaves the batches before it in
+// the target.
+func (j *copyJob) copy(ctx context.Context, src, dst connParams, plan copyPlan) error {
+	release, err := acquireQuerySlot(ctx, src, j.ID)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	from, err := openDB(ctx, src)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the source: %v", err)
+	}
+	defer from.Close()
+	to, err := openDB(ctx, dst)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the target: %v", err)
+	}
+	defer to.Close()
+
+	if j.Created != "" {
+		if _, err := to.ExecContext(ctx, j.Created); err != nil {
+			return fmt.Errorf("failed to create %s: %v", j.TargetTable, err)
+		}
+	}
+
+	rows, err := from.QueryContext(ctx, plan.selectStmt)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	types := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		types[i] = ct.DatabaseTypeName()
+	}
+	sc := newResultScanner(types)
+
+	batch := make([][]interface{}, 0, j.Batch)
+	flush := func() error {
+		if err := src.transcodeRows(batch); err != nil {
+			return err
+		}
+		err := j.insert(ctx, to, dst.Driver, plan, batch)
+		batch = batch[:0]
+		return err
+	}
+	for rows.Next() {
+		values := sc.newRow()
+		if err := sc.scan(rows, values); err != nil {
+			return err
+		}
+		batch = append(batch, values)
+		if len(batch) == j.Batch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// insert writes one batch. ClickHouse takes it as one prepared batch
+// insert; the others get multi-row INSERTs within the parameter limit, in
+// one transaction.
+func (j *copyJob) insert(ctx context.Context, db *sql.DB, driver string, plan copyPlan, batch [][]interface{}) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	for _, row := range batch {
+		for i, v := range row {
+			cv, err := copyValue(v, plan.kinds[i])
+			if err != nil {
+				return fmt.Errorf("row %d, column %d: %v", atomic.LoadInt64(&j.copied)+1, i+1, err)
+			}
+			row[i] = cv
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if driver == "clickhouse" {
+		stmt, err := tx.PrepareContext(ctx, plan.insertHead+" VALUES ("+strings.TrimSuffix(strings.Repeat("?, ", plan.marks), ", ")+")")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, row := range batch {
+			if _, err := stmt.ExecContext(ctx, row...); err != nil {
+				return err
+			}
+		}
+	} else {
+		per := max(1, copyMaxParams/plan.marks)
+		for start := 0; start < len(batch); start += per {
+			chunk := batch[start:min(start+per, len(batch))]
+			var groups []string
+			var args []interface{}
+			for _, row := range chunk {
+				marks := make([]string, len(row))
+				for i := range row {
+					marks[i] = placeholder(driver, len(args)+i+1)
+				}
+				groups = append(groups, "("+strings.Join(marks, ", ")+")")
+				args = append(args, row...)
+			}
+			if _, err := tx.ExecContext(ctx, plan.insertHead+" VALUES "+strings.Join(groups, ", "), args...); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	atomic.AddInt64(&j.copied, int64(len(batch)))
+	return nil
+}
+
+// view renders the copy's progress, or how it ended.
+func (j *copyJob) view() view {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	v := copyView{
+		ID:          j.ID,
+		Status:      "running",
+		Source:      j.Source,
+		Target:      j.Target,
+		Table:       j.Table,
+		TargetTable: j.TargetTable,
+		Created:     j.Created,
+		Skipped:     j.Skipped,
+		Copied:      atomic.LoadInt64(&j.copied),
+		Estimate:    j.Estimate,
+		Elapsed:     time.Since(j.Started),
+		Failure:     j.err,
+	}
+	switch {
+	case j.finished.IsZero():
+		if _, pos, ok := queryLimiter.position(j.ID); ok {
+			v.Status, v.Position = "queued", pos
+		}
+	case j.err == context.Canceled.Error():
+		v.Status, v.Elapsed = "canceled", j.finished.Sub(j.Started)
+	case j.err != "":
+		v.Status, v.Elapsed = "failed", j.finished.Sub(j.Started)
+	default:
+		v.Status, v.Elapsed = "done", j.finished.Sub(j.Started)
+	}
+	if v.Estimate > 0 {
+		v.Percent = min(100, float64(v.Copied)*100/float64(v.Estimate))
+	}
+	if secs := v.Elapsed.Seconds(); secs > 0 {
+		v.Rate = int64(float64(v.Copied) / secs)
+	}
+	return v
+}
+
+// copyJobFor returns the caller's copy named in the path.
+func copyJobFor(c *gin.Context) (*copyJob, bool) {
+	copyJobsMu.Lock()
+	j, ok := copyJobs[c.Param("id")]
+	copyJobsMu.Unlock()
+	if !ok || j.User != currentIdentity(c).User {
+		renderError(c, http.StatusNotFound, "copy.html", "No such copy: %s", c.Param("id"))
+		return nil, false
+	}
+	return j, true
+}
+
+// copyTableHandler starts copying a table of the query form's connection
+// to a table on another one, creating the target table when asked.
+// Columns are matched by name; the copy itself runs in the background.
+func copyTableHandler(c *gin.Context) {
+	src := connParamsFromForm(c)
+	table := strings.TrimSpace(c.PostForm("copy_table"))
+	targetTable := strings.TrimSpace(c.PostForm("copy_target_table"))
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "copy.html", format, args...)
+	}
+	if table == "" {
+		fail(http.StatusBadRequest, "Table is required")
+		return
+	}
+	if targetTable == "" {
+		_, targetTable = splitTableName(table)
+	}
+	batch := copyDefaultBatch
+	if s := c.PostForm("copy_batch"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > copyMaxBatch {
+			fail(http.StatusBadRequest, "Batch size must be between 1 and %d", copyMaxBatch)
+			return
+		}
+		batch = n
+	}
+	dst, err := formTarget(c, "copy", src)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	for _, p := range []connParams{src, dst} {
+		if err := p.validateAddress(); err != nil {
+			fail(http.StatusBadRequest, "%v", err)
+			return
+		}
+		if _, ok := dbDrivers[p.Driver]; !ok {
+			fail(http.StatusBadRequest, "Unsupported database driver %q", p.Driver)
+			return
+		}
+	}
+	if src.auditTarget() == dst.auditTarget() && strings.EqualFold(table, targetTable) {
+		fail(http.StatusBadRequest, "The target is the source table itself")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	describe := func(p connParams, name string) (tableInfo, bool, error) {
+		db, err := openDB(ctx, p)
+		if err != nil {
+			log.Printf("Database connection failed: %v", err)
+			return tableInfo{}, false, fmt.Errorf("failed to connect to %s: %v", p.auditTarget(), err)
+		}
+		defer db.Close()
+		tables, err := schemaTables(ctx, db, p)
+		if err != nil {
+			return tableInfo{}, false, err
+		}
+		t, ok := findTable(tables, name)
+		return t, ok, nil
+	}
+	source, ok, err := describe(src, table)
+	if err != nil {
+		fail(http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	if !ok {
+		fail(http.StatusBadRequest, "Table not found: %s", table)
+		return
+	}
+	target, exists, err := describe(dst, targetTable)
+	if err != nil {
+		fail(http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+
+	j := &copyJob{
+		ID:          randomID(8),
+		User:        currentIdentity(c).User,
+		Source:      src.auditTarget(),
+		Target:      dst.auditTarget(),
+		Table:       qualifiedName(source),
+		TargetTable: targetTable,
+		Batch:       batch,
+	}
+	var columns []columnInfo
+	switch {
+	case exists:
+		j.TargetTable = qualifiedName(target)
+		for _, col := range source.Columns {
+			name := matchColumn(target, col.Name)
+			if name == "" {
+				j.Skipped = append(j.Skipped, col.Name)
+				continue
+			}
+			for _, tc := range target.Columns {
+				if tc.Name == name {
+					columns = append(columns, columnInfo{Name: col.Name, Type: tc.Type})
+				}
+			}
+		}
+		if len(columns) == 0 {
+			fail(http.StatusBadRequest, "%s has none of the columns of %s", j.TargetTable, j.Table)
+			return
+		}
+	case c.PostForm("copy_create") != "":
+		if j.Created, err = copyCreateTable(src.Driver, dst.Driver, targetTable, source.Columns); err != nil {
+			fail(http.StatusBadRequest, "%v", err)
+			return
+		}
+		for _, col := range source.Columns {
+			t, _ := copyColumnType(src.Driver, dst.Driver, col)
+			columns = append(columns, columnInfo{Name: col.Name, Type: t})
+		}
+	default:
+		fail(http.StatusBadRequest, "%s has no table %s; tick \"Create it when missing\"", j.Target, targetTable)
+		return
+	}
+
+	plan := copyPlan{marks: len(columns)}
+	var srcNames, dstNames []string
+	for _, col := range columns {
+		srcNames = append(srcNames, quoteIdent(src.Driver, col.Name))
+		name := col.Name
+		if exists {
+			name = matchColumn(target, col.Name)
+		}
+		dstNames = append(dstNames, quoteIdent(dst.Driver, name))
+		plan.kinds = append(plan.kinds, kindOf(dst.Driver, col.Type))
+	}
+	plan.selectStmt = fmt.Sprintf("SELECT %s FROM %s", strings.Join(srcNames, ", "), quoteIdent(src.Driver, j.Table))
+	plan.insertHead = fmt.Sprintf("INSERT INTO %s (%s)", quoteIdent(dst.Driver, j.TargetTable), strings.Join(dstNames, ", "))
+
+	ev := newQueryEvent(c, src, "copy", plan.selectStmt)
+	for _, e := range []queryEvent{ev, newQueryEvent(c, dst, "copy", plan.insertHead)} {
+		if _, err := beforeQuery(c.Request.Context(), e); err != nil {
+			render(c, http.StatusForbidden, resultError(nil, "%v", err))
+			return
+		}
+	}
+
+	if db, err := openDB(ctx, src); err == nil {
+		if summaries, err := schemaSummaries(ctx, db, src); err == nil {
+			for _, s := range summaries {
+				if s.Name == source.Name && (s.Schema == "" || source.Schema == "" || s.Schema == source.Schema) && s.Rows != nil {
+					j.Estimate = *s.Rows
+				}
+			}
+		}
+		db.Close()
+	}
+
+	jobCtx, jobCancel := context.WithTimeout(context.Background(), copyTimeout)
+	j.cancel, j.Started = jobCancel, time.Now()
+	copyJobsMu.Lock()
+	copyJobs[j.ID] = j
+	copyJobsMu.Unlock()
+
+	log.Printf("%s started copy %s of %s on %s to %s on %s", j.User, j.ID, j.Table, j.Source, j.TargetTable, j.Target)
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   j.User,
+		Action: "copy_table",
+		Target: j.Target,
+		Query:  plan.insertHead,
+		Ref:    j.ID,
+		Detail: fmt.Sprintf("from %s on %s", j.Table, j.Source),
+	})
+	go j.run(jobCtx, src, dst, plan, ev)
+
+	render(c, http.StatusAccepted, j.view())
+}
+
+// copyStatusHandler is polled by the page until the copy ends.
+func copyStatusHandler(c *gin.Context) {
+	j, ok := copyJobFor(c)
+	if !ok {
+		return
+	}
+	render(c, http.StatusOK, j.view())
+}
+
+// cancelCopyHandler stops a copy; batches already inserted stay.
+func cancelCopyHandler(c *gin.Context) {
+	j, ok := copyJobFor(c)
+	if !ok {
+		return
+	}
+	j.cancel()
+	render(c, http.StatusOK, j.view())
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Temporary credentials are real database users created with the
+// connection's own (admin) rights. They are recorded in the store together
+// with the connection that made them, so the sweeper can drop them after
+// the TTL even across restarts. The record keeps the connection without its
+// password and names the saved connection the password is read from when
+// the user is dropped.
+
+const (
+	defaultCredentialTTL = time.Hour
+	maxCredentialTTL     = 24 * time.Hour
+)
+
+type tempCredential struct {
+	Username  string
+	Password  string
+	Access    string
+	Server    string
+	Database  string
+	CreatedBy string
+	ExpiresAt time.Time
+}
+
+// credentialGrants returns the statements creating a user for the given
+// access level ("read" or "write"). Names and passwords are generated here,
+// so inlining them is safe.
+func credentialGrants(p connParams, user, password, access string, expires time.Time) ([]string, error) {
+	if p.Database == "" {
+		return nil, fmt.Errorf("choose the database to grant access to")
+	}
+	privileges := "SELECT"
+	if access == "write" {
+		privileges = "SELECT, INSERT, UPDATE, DELETE"
+	}
+	switch p.Driver {
+	case "postgres":
+		role := quoteIdent(p.Driver, user)
+		stmts := []string{
+			// VALID UNTIL is a second line of defence should the sweeper never run
+			fmt.Sprintf("CREATE ROLE %s LOGIN PASSWORD %s VALID UNTIL %s",
+				role, quoteString(p.Driver, password), quoteString(p.Driver, expires.UTC().Format(time.RFC3339))),
+			fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s", quoteIdent(p.Driver, p.Database), role),
+		}
+		// every non-system schema of the current database
+		stmts = append(stmts, fmt.Sprintf(`DO $$
+DECLARE s text;
+BEGIN
+	FOR s IN SELECT nspname FROM pg_namespace
+		WHERE nspname NOT IN ('pg_catalog', 'information_schema') AND nspname NOT LIKE 'pg\_%%'
+	LOOP
+		EXECUTE format('GRANT USAGE ON SCHEMA %%I TO %s', s);
+		EXECUTE format('GRANT %s ON ALL TABLES IN SCHEMA %%I TO %s', s);
+	END LOOP;
+END $$`, role, privileges, role))
+		return stmts, nil
+	case "mysql":
+		account := quoteString(p.Driver, user) + "@'%'"
+		return []string{
+			fmt.Sprintf("CREATE USER %s IDENTIFIED BY %s", account, quoteString(p.Driver, password)),
+			fmt.Sprintf("GRANT %s ON %s.* TO %s", privileges, quoteIdent(p.Driver, p.Database), account),
+		}, nil
+	}
+	return nil, fmt.Errorf("temporary credentials are not supported for %q", p.Driver)
+}
+
+// revokeCredential disconnects and drops a temporary user.
+func revokeCredential(ctx context.Context, db *sql.DB, driver, user string) error {
+	switch driver {
+	case "postgres":
+		var exists bool
+		if err := db.QueryRowContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", user).Scan(&exists); err != nil || !exists {
+			return err
+		}
+		if _, err := db.ExecContext(ctx,
+			"SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE usename = $1", user); err != nil {
+			return err
+		}
+		role := quoteIdent(driver, user)
+		for _, stmt := range []string{"DROP OWNED BY " + role, "DROP ROLE IF EXISTS " + role} {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "mysql":
+		rows, err := db.QueryContext(ctx, "SELECT id FROM information_schema.processlist WHERE user = ?", user)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		for _, id := range ids {
+			// the session may already be gone
+			db.ExecContext(ctx, "KILL "+strconv.FormatInt(id, 10))
+		}
+		_, err = db.ExecContext(ctx, "DROP USER IF EXISTS "+quoteString(driver, user)+"@'%'")
+		return err
+	}
+	return fmt.Errorf("temporary credentials are not supported for %q", driver)
+}
+
+// credentialConnection names the saved connection with p's server, user
+// and password, the one the sweeper drops p's temporary users with.
+func credentialConnection(ctx context.Context, p connParams) (string, error) {
+	conns, err := listConnections(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, sc := range conns {
+		if sc.Driver == p.Driver && sc.Server == p.Server && sc.Username == p.Username && sc.Password == p.Password {
+			return sc.Name, nil
+		}
+	}
+	return "", fmt.Errorf("save the connection first: expired temporary users are dropped with its saved password")
+}
+
+// mintCredential creates the user and records it for the sweeper.
+func mintCredential(ctx context.Context, p connParams, access string, ttl time.Duration, createdBy string) (*tempCredential, error) {
+	cred := &tempCredential{
+		Username:  "sa_tmp_" + randomID(6),
+		Password:  randomID(18),
+		Access:    access,
+		Server:    p.address(),
+		Database:  p.Database,
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	stmts, err := credentialGrants(p, cred.Username, cred.Password, access, cred.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	connection, err := credentialConnection(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	stored := p
+	stored.Password = ""
+	params, err := json.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// Record first: a user that exists but isn't recorded would never expire
+	_, err = store.ExecContext(ctx, `
+		INSERT INTO temp_credentials (username, driver, params, connection, access, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		cred.Username, p.Driver, string(params), connection, access, createdBy, time.Now().Unix(), cred.ExpiresAt.Unix())
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			if rerr := revokeCredential(ctx, db, p.Driver, cred.Username); rerr != nil {
+				log.Printf("Failed to clean up %s: %v", cred.Username, rerr)
+			}
+			return nil, err
+		}
+	}
+	log.Printf("%s minted %s access user %s on %s until %s",
+		createdBy, access, cred.Username, cred.Server, cred.ExpiresAt.Format(time.RFC3339))
+	return cred, nil
+}
+
+// sweepCredentials drops expired temporary users once a minute.
+func sweepCredentials() {
+	for ; ; time.Sleep(time.Minute) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		dropExpiredCredentials(ctx)
+		cancel()
+	}
+}
+
+func dropExpiredCredentials(ctx context.Context) {
+	rows, err := store.QueryContext(ctx,
+		"SELECT username, params, connection FROM temp_credentials WHERE dropped_at IS NULL AND expires_at <= ?",
+		time.Now().Unix())
+	if err != nil {
+		log.Printf("Failed to read temporary credentials: %v", err)
+		return
+	}
+	type expired struct {
+		user       string
+		p          connParams
+		connection string
+	}
+	var due []expired
+	for rows.Next() {
+		var e expired
+		var params string
+		if err := rows.Scan(&e.user, &params, &e.connection); err != nil {
+			log.Printf("Failed to read temporary credentials: %v", err)
+			break
+		}
+		if err := json.Unmarshal([]byte(params), &e.p); err != nil {
+			log.Printf("Bad connection parameters for %s: %v", e.user, err)
+			continue
+		}
+		due = append(due, e)
+	}
+	rows.Close()
+
+	for _, e := range due {
+		// records from before the password was left out still carry it
+		if e.connection != "" {
+			var err error
+			if e.p.Password, err = credentialPassword(ctx, e.connection, e.p); err != nil {
+				log.Printf("Failed to drop temporary user %s: %v", e.user, err)
+				continue
+			}
+		}
+		db, err := openDB(ctx, e.p)
+		if err == nil {
+			err = revokeCredential(ctx, db, e.p.Driver, e.user)
+			db.Close()
+		}
+		if err != nil {
+			// retried on the next pass
+			log.Printf("Failed to drop temporary user %s: %v", e.user, err)
+			continue
+		}
+		e.p.Password = ""
+		params, _ := json.Marshal(e.p)
+		store.ExecContext(ctx, "UPDATE temp_credentials SET dropped_at = ?, params = ? WHERE username = ?",
+			time.Now().Unix(), string(params), e.user)
+		log.Printf("Dropped expired temporary user %s", e.user)
+	}
+}
+
+// credentialPassword reads the password of the saved connection a
+// temporary user was made with, as long as it still points at the same
+// server and user.
+func credentialPassword(ctx context.Context, name string, p connParams) (string, error) {
+	sc, err := getConnection(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if sc.Driver != p.Driver || sc.Server != p.Server || sc.Username != p.Username {
+		return "", fmt.Errorf("saved connection %s no longer points at %s", name, p.address())
+	}
+	return sc.Password, nil
+}
+
+// credentialHandler mints a temporary user for the connection in the form.
+func credentialHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	access := c.PostForm("access")
+	if access != "write" {
+		access = "read"
+	}
+	ttl := defaultCredentialTTL
+	if minutes, err := strconv.Atoi(c.PostForm("ttl")); err == nil && minutes > 0 {
+		ttl = time.Duration(minutes) * time.Minute
+	}
+	if ttl > maxCredentialTTL {
+		ttl = maxCredentialTTL
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cred, err := mintCredential(ctx, p, access, ttl, currentIdentity(c).User)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "credential.html", "Failed to create temporary user: %v", err)
+		return
+	}
+	render(c, http.StatusOK, credentialView{Credential: cred})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// a Wednesday
+	from := time.Date(2024, 1, 10, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 10, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 10, 10, 15, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 10, 10, 25, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, 1, 11, 9, 0, 0, 0, time.UTC)},
+		{"30 2 1,15 * *", time.Date(2024, 1, 15, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		// 7 is Sunday too
+		{"0 0 * * 7", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		// with both day fields set, either one matching is enough
+		{"0 0 13 * 5", time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{"@MONTHLY", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// never fires
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.next(from); !got.Equal(tt.want) {
+			t.Errorf("parseCron(%q).next(%v) = %v, want %v", tt.expr, from, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@often",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
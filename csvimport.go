@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rows shown next to each column on the mapping step
+const importSampleRows = 3
+
+var csvDelimiters = map[string]rune{
+	"comma":     ',',
+	"semicolon": ';',
+	"tab":       '\t',
+	"pipe":      '|',
+}
+
+// importColumn is one column of the uploaded file and the table column it
+// goes to; an empty Target skips it.
+type importColumn struct {
+	Index  int
+	Header string
+	Sample []string
+	Target string
+}
+
+// looksLikeHeader guesses whether the first record names columns: it does
+// when any of its fields is the name of a table column.
+func looksLikeHeader(record []string, table tableInfo) bool {
+	for _, v := range record {
+		if matchColumn(table, v) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchColumn finds a table column by name, ignoring case and surrounding
+// blanks.
+func matchColumn(table tableInfo, name string) string {
+	name = strings.TrimSpace(name)
+	for _, col := range table.Columns {
+		if strings.EqualFold(col.Name, name) {
+			return col.Name
+		}
+	}
+	return ""
+}
+
+// defaultMapping maps the file columns by header name, or by position when
+// the file has no header.
+func defaultMapping(table tableInfo, header []string, width int) []importColumn {
+	cols := make([]importColumn, width)
+	for i := range cols {
+		cols[i].Index = i
+		if header != nil {
+			cols[i].Header = header[i]
+			cols[i].Target = matchColumn(table, header[i])
+		} else if i < len(table.Columns) {
+			cols[i].Target = table.Columns[i].Name
+		}
+	}
+	return cols
+}
+
+// importInsert builds the INSERT for the mapped columns and projects every
+// row onto them. A row too short for the mapping keeps fewer values, which
+// runBulk reports as a failure of that row.
+func importInsert(driver string, table tableInfo, mapping []importColumn, rows []bulkRow) (string, []bulkRow, error) {
+	var names, marks []string
+	var index []int
+	seen := map[string]bool{}
+	for _, m := range mapping {
+		if m.Target == "" {
+			continue
+		}
+		if matchColumn(table, m.Target) != m.Target {
+			return "", nil, fmt.Errorf("%s has no column %s", qualifiedName(table), m.Target)
+		}
+		if seen[m.Target] {
+			return "", nil, fmt.Errorf("%s is mapped more than once", m.Target)
+		}
+		seen[m.Target] = true
+		names = append(names, quoteIdent(driver, m.Target))
+		marks = append(marks, placeholder(driver, len(names)))
+		index = append(index, m.Index)
+	}
+	if len(names) == 0 {
+		return "", nil, fmt.Errorf("map at least one column")
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdent(driver, qualifiedName(table)), strings.Join(names, ", "), strings.Join(marks, ", "))
+
+	out := make([]bulkRow, len(rows))
+	for r, row := range rows {
+		out[r].Line = row.Line
+		for _, i := range index {
+			if i < len(row.Values) {
+				out[r].Values = append(out[r].Values, row.Values[i])
+			}
+		}
+	}
+	return stmt, out, nil
+}
+
+// csvImportHandler loads an uploaded CSV into an existing table. The first
+// post reads the file and shows the column mapping; posting the mapping back
+// with the same file runs batched parameterized inserts through runBulk and
+// reports the rows that failed.
+func csvImportHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name := c.PostForm("table")
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "csvimport.html", format, args...)
+	}
+	if name == "" {
+		fail(http.StatusBadRequest, "Table is required")
+		return
+	}
+	comma, ok := csvDelimiters[c.DefaultPostForm("delimiter", "comma")]
+	if !ok {
+		fail(http.StatusBadRequest, "Unknown delimiter")
+		return
+	}
+	batch, err := strconv.Atoi(c.DefaultPostForm("batch", strconv.Itoa(bulkDefaultBatch)))
+	if err != nil || batch < 1 {
+		fail(http.StatusBadRequest, "Invalid batch size")
+		return
+	}
+	upload, err := c.FormFile("file")
+	if err != nil {
+		fail(http.StatusBadRequest, "Upload a CSV file")
+		return
+	}
+	f, err := upload.Open()
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to read upload: %v", err)
+		return
+	}
+	defer f.Close()
+	rows, err := readBulkCSV(f, false, comma)
+	if err != nil {
+		fail(http.StatusBadRequest, "Invalid CSV: %v", err)
+		return
+	}
+	if len(rows) == 0 {
+		fail(http.StatusBadRequest, "The file is empty")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bulkTimeout)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	table, err := lookupTable(ctx, db, p.Driver, name)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	var header []string
+	switch c.DefaultPostForm("header", "auto") {
+	case "yes":
+		header = rows[0].Values
+	case "auto":
+		if looksLikeHeader(rows[0].Values, table) {
+			header = rows[0].Values
+		}
+	}
+	data := rows
+	if header != nil {
+		data = rows[1:]
+	}
+	width := len(rows[0].Values)
+
+	mapping := defaultMapping(table, header, width)
+	mapped := c.PostForm("remap") == "" && c.PostForm("columns") == strconv.Itoa(width)
+	if mapped {
+		for i := range mapping {
+			mapping[i].Target = c.PostForm("map." + strconv.Itoa(i))
+		}
+	} else {
+		for i := range mapping {
+			for _, row := range data[:min(len(data), importSampleRows)] {
+				if i < len(row.Values) {
+					mapping[i].Sample = append(mapping[i].Sample, row.Values[i])
+				}
+			}
+		}
+	}
+	page := csvImportView{
+		Table:   qualifiedName(table),
+		Columns: table.Columns,
+		Mapping: mapping,
+		Width:   width,
+		Header:  header != nil,
+		Rows:    len(data),
+	}
+	stmt, params, err := importInsert(p.Driver, table, mapping, data)
+	if err != nil && mapped {
+		page.Problem = err.Error()
+	}
+	if !mapped || err != nil {
+		render(c, http.StatusOK, page)
+		return
+	}
+
+	user := currentIdentity(c).User
+	log.Printf("%s imports %d CSV rows into %s on %s", user, len(params), name, p.address())
+	summary := runBulk(ctx, db, p.Driver, stmt, params, batch, c.PostForm("null_empty") != "", c.PostForm("stop") != "")
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "csv_import",
+		Target: p.auditTarget(),
+		Query:  stmt,
+		Detail: fmt.Sprintf("%s into %s: %d ok, %d failed, %d rolled back, %d skipped",
+			upload.Filename, name, summary.Succeeded, summary.Failed, summary.RolledBack, summary.Skipped),
+	})
+
+	render(c, http.StatusOK, bulkPage(summary))
+}
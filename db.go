@@ -0,0 +1,598 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// connParams holds the connection fields posted by the index form.
+type connParams struct {
+	Driver   string `json:"driver"`
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	Database string `json:"database"`
+	// TLSFingerprint pins the server certificate (SHA-256) and turns TLS on
+	TLSFingerprint string `json:"tls_fingerprint,omitempty"`
+	// QueryTags are attached to every query, see parseQueryTags
+	QueryTags string `json:"query_tags,omitempty"`
+	// ClickHouseSettings are sent with every ClickHouse query, see
+	// parseClickHouseSettings
+	ClickHouseSettings string `json:"clickhouse_settings,omitempty"`
+	// Charset is the MySQL connection character set, utf8mb4 by default
+	Charset string `json:"charset,omitempty"`
+	// ResultEncoding transcodes result text to UTF-8, see resultDecoder
+	ResultEncoding string `json:"result_encoding,omitempty"`
+	netTuning
+}
+
+func connParamsFromForm(c *gin.Context) connParams {
+	if p, ok := c.Get(connTabParamsKey); ok {
+		return p.(connParams)
+	}
+	return connParamsFromFields(c)
+}
+
+// connParamsFromFields reads the connection fields themselves, whatever
+// tab is selected.
+func connParamsFromFields(c *gin.Context) connParams {
+	return connParams{
+		Driver:   c.PostForm("driver"),
+		Server:   c.PostForm("server"),
+		Username: c.PostForm("username"),
+		Password: c.PostForm("password"),
+		Database: c.PostForm("database"),
+
+		TLSFingerprint: c.PostForm("tls_fingerprint"),
+		QueryTags:      c.PostForm("query_tags"),
+
+		ClickHouseSettings: c.PostForm("clickhouse_settings"),
+		Charset:            c.PostForm("charset"),
+		ResultEncoding:     c.PostForm("result_encoding"),
+		netTuning:          netTuningFromForm(c),
+	}
+}
+
+func defaultPort(driver string) string {
+	switch driver {
+	case "postgres":
+		return "5432"
+	case "mysql":
+		return "3306"
+	case "clickhouse":
+		return "9000"
+	}
+	return ""
+}
+
+// splitServer parses the server field as "host", "host:port", "[v6]",
+// "[v6]:port" or a bare IPv6 literal, filling in defPort when no port is
+// given. A bare IPv6 literal can't carry a port: "::1:5432" is an address.
+func splitServer(server, defPort string) (host, port string, err error) {
+	server = strings.TrimSpace(server)
+	if server == "" {
+		return "", "", fmt.Errorf("server address is required")
+	}
+	switch {
+	case strings.HasPrefix(server, "["):
+		end := strings.IndexByte(server, ']')
+		if end < 0 {
+			return "", "", fmt.Errorf("invalid server address %q: missing ']'", server)
+		}
+		host, rest := server[1:end], server[end+1:]
+		if net.ParseIP(host) == nil || !strings.Contains(host, ":") {
+			return "", "", fmt.Errorf("invalid server address %q: brackets are for IPv6 addresses", server)
+		}
+		port = defPort
+		if rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return "", "", fmt.Errorf("invalid server address %q: unexpected %q after ']'", server, rest)
+			}
+			port = rest[1:]
+		}
+	case strings.Count(server, ":") > 1:
+		if net.ParseIP(server) == nil {
+			return "", "", fmt.Errorf("invalid server address %q: put IPv6 addresses in brackets, e.g. [::1]:5432", server)
+		}
+		host, port = server, defPort
+	case strings.Contains(server, ":"):
+		if host, port, err = net.SplitHostPort(server); err != nil {
+			return "", "", fmt.Errorf("invalid server address %q: %v", server, err)
+		}
+	default:
+		host, port = server, defPort
+	}
+
+	if host == "" {
+		return "", "", fmt.Errorf("invalid server address %q: missing host", server)
+	}
+	if strings.ContainsAny(host, " /\\@") {
+		return "", "", fmt.Errorf("invalid server address %q: bad host %q", server, host)
+	}
+	if port == "" {
+		return "", "", fmt.Errorf("invalid server address %q: missing port", server)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", "", fmt.Errorf("invalid server address %q: port must be a number from 1 to 65535", server)
+	}
+	return host, port, nil
+}
+
+// socketPath returns the unix socket path when the server field holds one,
+// written as an absolute path or with a "unix:" prefix.
+func (p connParams) socketPath() string {
+	server := strings.TrimSpace(p.Server)
+	if path, ok := strings.CutPrefix(server, "unix:"); ok {
+		return path
+	}
+	if strings.HasPrefix(server, "/") {
+		return server
+	}
+	return ""
+}
+
+// postgresSocket splits a PostgreSQL socket path into the directory libpq
+// style configs expect and the port in the socket name. Both the directory
+// and the full path of the socket file (.s.PGSQL.<port>) are accepted.
+func postgresSocket(path string) (dir, port string) {
+	dir, file := filepath.Split(path)
+	if p, ok := strings.CutPrefix(file, ".s.PGSQL."); ok {
+		return filepath.Clean(dir), p
+	}
+	return path, defaultPort("postgres")
+}
+
+// validateAddress reports a malformed server field; SQLite has none.
+func (p connParams) validateAddress() error {
+	if d, ok := dbDrivers[p.Driver].(localDriver); ok && d.Local() {
+		return nil
+	}
+	if path := p.socketPath(); path != "" {
+		switch {
+		case p.Driver != "postgres" && p.Driver != "mysql":
+			return fmt.Errorf("unix sockets are supported for PostgreSQL and MySQL only")
+		case !filepath.IsAbs(path):
+			return fmt.Errorf("invalid socket path %q: must be absolute", path)
+		case p.TLSFingerprint != "":
+			return fmt.Errorf("TLS pinning does not apply to unix socket connections")
+		}
+		return nil
+	}
+	_, _, err := splitServer(p.Server, defaultPort(p.Driver))
+	return err
+}
+
+// address returns the server address with the driver's default port
+// appended when none was given, IPv6 hosts in brackets, or the socket
+// path. A malformed field comes back unchanged; validateAddress reports it.
+func (p connParams) address() string {
+	if path := p.socketPath(); path != "" {
+		return path
+	}
+	host, port, err := splitServer(p.Server, defaultPort(p.Driver))
+	if err != nil {
+		return p.Server
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// auditTarget names the server and database for the audit log.
+func (p connParams) auditTarget() string {
+	return p.Driver + "://" + p.address() + "/" + p.Database
+}
+
+func (p connParams) postgresDSN() string {
+	sslmode := "disable"
+	if p.TLSFingerprint != "" {
+		sslmode = "require"
+	}
+	if path := p.socketPath(); path != "" {
+		dir, port := postgresSocket(path)
+		return fmt.Sprintf(
+			"postgres://%s:%s@/%s?host=%s&port=%s&sslmode=disable",
+			p.Username, url.QueryEscape(p.Password), p.Database, url.QueryEscape(dir), port,
+		)
+	}
+	return fmt.Sprintf(
+		"postgres://%s:%s@%s/%s?sslmode=%s",
+		p.Username, url.QueryEscape(p.Password), p.address(), p.Database, sslmode,
+	)
+}
+
+// postgresConfig parses the DSN and applies the connection settings.
+func (p connParams) postgresConfig() (*pgx.ConnConfig, error) {
+	cfg, err := pgx.ParseConfig(p.postgresDSN())
+	if err != nil {
+		return nil, err
+	}
+	if err := p.tunePostgres(&cfg.Config); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// tunePostgres applies certificate pinning and the network settings, which
+// the DSN can't express.
+func (p connParams) tunePostgres(cfg *pgconn.Config) error {
+	pinned, err := p.pinnedTLS()
+	if err != nil {
+		return err
+	}
+	if pinned != nil {
+		cfg.TLSConfig = pinned
+		cfg.Fallbacks = nil
+	}
+	p.netTuning.tunePostgres(cfg)
+	tags, err := p.queryTags()
+	if err != nil {
+		return err
+	}
+	if len(tags) > 0 {
+		cfg.RuntimeParams["application_name"] = postgresApplicationName(tags)
+	}
+	return nil
+}
+
+func (p connParams) mysqlDSN() (string, error) {
+	tags, err := p.queryTags()
+	if err != nil {
+		return "", err
+	}
+	charset, err := p.mysqlCharset()
+	if err != nil {
+		return "", err
+	}
+	if _, err := p.resultDecoder(); err != nil {
+		return "", err
+	}
+	params := "&charset=" + charset + p.mysqlParams()
+	if len(tags) > 0 {
+		params += "&connectionAttributes=" + url.QueryEscape(mysqlConnectionAttributes(tags))
+	}
+	if path := p.socketPath(); path != "" {
+		return fmt.Sprintf("%s:%s@unix(%s)/%s?parseTime=true",
+			p.Username, p.Password, path, p.Database) + params, nil
+	}
+	dsn := fmt.Sprintf("%s:%s@%s(%s)/%s?parseTime=true",
+		p.Username, p.Password, p.mysqlNet(), p.address(), p.Database) + params
+	pinned, err := p.pinnedTLS()
+	if err != nil || pinned == nil {
+		return dsn, err
+	}
+	fingerprint, _ := normalizeFingerprint(p.TLSFingerprint)
+	name, err := mysqlTLSName(pinned, p.address(), fingerprint)
+	if err != nil {
+		return "", err
+	}
+	return dsn + "&tls=" + name, nil
+}
+
+func (p connParams) clickhouseOptions() (*clickhouse.Options, error) {
+	pinned, err := p.pinnedTLS()
+	if err != nil {
+		return nil, err
+	}
+	tags, err := p.queryTags()
+	if err != nil {
+		return nil, err
+	}
+	settings, err := parseClickHouseSettings(p.ClickHouseSettings)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := settings["log_comment"]; !ok && len(tags) > 0 {
+		settings["log_comment"] = clickhouseLogComment(tags)
+	}
+	return &clickhouse.Options{
+		Addr: []string{p.address()},
+		Auth: clickhouse.Auth{
+			Database: p.Database,
+			Username: p.Username,
+			Password: p.Password,
+		},
+		Settings:    settings,
+		TLS:         pinned,
+		DialTimeout: p.dialTimeout(),
+		ReadTimeout: p.readTimeout(),
+		DialContext: func(ctx context.Context, addr string) (net.Conn, error) {
+			conn, err := p.dial(ctx, "tcp", addr)
+			if err != nil || pinned == nil {
+				return conn, err
+			}
+			// a custom dialer replaces the driver's own TLS handshake
+			tlsConn := tls.Client(conn, pinned)
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tlsConn, nil
+		},
+	}, nil
+}
+
+// openDB opens a database/sql handle for any supported driver and pings it.
+// SQLite takes the database file path from the Database field.
+func openDB(ctx context.Context, p connParams) (*sql.DB, error) {
+	var db *sql.DB
+	var err error
+	if err := p.validateAddress(); err != nil {
+		return nil, err
+	}
+
+	switch p.Driver {
+	case "postgres":
+		var cfg *pgx.ConnConfig
+		if cfg, err = p.postgresConfig(); err == nil {
+			db = stdlib.OpenDB(*cfg)
+		}
+	case "mysql":
+		var dsn string
+		if dsn, err = p.mysqlDSN(); err == nil {
+			db, err = sql.Open("mysql", dsn)
+		}
+	case "sqlite":
+		db, err = sql.Open("sqlite", p.Database)
+	case "clickhouse":
+		var opts *clickhouse.Options
+		if opts, err = p.clickhouseOptions(); err == nil {
+			db = clickhouse.OpenDB(opts)
+		}
+	default:
+		o, ok := dbDrivers[p.Driver].(sqlOpener)
+		if !ok {
+			return nil, fmt.Errorf("unsupported database driver %q", p.Driver)
+		}
+		db, err = o.OpenDB(p)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// resultSet is a fully materialised query result with values in select order.
+type resultSet struct {
+	Columns []string
+	Types   []string
+	Rows    [][]interface{}
+	// Truncated is set when reading stopped at a row limit
+	Truncated bool
+	// ServerZone is the time zone the server works in, when the query page
+	// asked because the rows hold times
+	ServerZone string
+	// Stats describe the run that fetched the rows, on the query page
+	Stats *queryStats
+}
+
+func fetchResult(ctx context.Context, db *sql.DB, query string, args ...interface{}) (*resultSet, error) {
+	return fetchResultMax(ctx, db, 0, query, args...)
+}
+
+// fetchResultMax reads at most max rows (all when max <= 0) and cancels the
+// rest of the query rather than draining it.
+func fetchResultMax(ctx context.Context, db *sql.DB, max int, query string, args ...interface{}) (*resultSet, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	defer func() {
+		cancel()
+		rows.Close()
+	}()
+	return scanResultMax(rows, max)
+}
+
+func scanResult(rows *sql.Rows) (*resultSet, error) {
+	return scanResultMax(rows, 0)
+}
+
+// scanResultMax scans at most max rows, all when max <= 0.
+func scanResultMax(rows *sql.Rows, max int) (*resultSet, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &resultSet{Columns: columns, Types: make([]string, len(columnTypes))}
+	for i, ct := range columnTypes {
+		rs.Types[i] = ct.DatabaseTypeName()
+	}
+
+	sc := newResultScanner(rs.Types)
+	for rows.Next() {
+		if max > 0 && len(rs.Rows) == max {
+			rs.Truncated = true
+			return rs, nil
+		}
+		values := sc.newRow()
+		if err := sc.scan(rows, values); err != nil {
+			return nil, err
+		}
+		rs.Rows = append(rs.Rows, values)
+	}
+	return rs, rows.Err()
+}
+
+// rowSlab is how many rows of values a rowArena allocates at once.
+const rowSlab = 256
+
+// rowArena hands out fixed-width rows carved from shared slabs, one
+// allocation per rowSlab rows instead of one per row. Rows are capped at
+// their width, so appending to one can't spill into the next.
+type rowArena struct {
+	width int
+	buf   []interface{}
+}
+
+func (a *rowArena) newRow() []interface{} {
+	if len(a.buf) < a.width {
+		a.buf = make([]interface{}, a.width*rowSlab)
+	}
+	row := a.buf[:a.width:a.width]
+	a.buf = a.buf[a.width:]
+	return row
+}
+
+// resultScanner scans the rows of one result, reusing the scan targets and
+// deciding once per column whether bytes are text.
+type resultScanner struct {
+	rowArena
+	text []bool
+	// array holds the element type of PostgreSQL array columns, whose text
+	// form is parsed into a sqlArray
+	array []string
+	// composite marks ClickHouse Nullable, Array, Map and Tuple columns,
+	// which the driver hands back as pointers, slices and maps
+	composite []bool
+	// uuid marks BINARY columns read as UUIDs
+	uuid     []bool
+	scanArgs []interface{}
+}
+
+func newResultScanner(types []string) *resultScanner {
+	sc := &resultScanner{
+		rowArena:  rowArena{width: len(types)},
+		text:      make([]bool, len(types)),
+		array:     make([]string, len(types)),
+		composite: make([]bool, len(types)),
+		uuid:      make([]bool, len(types)),
+		scanArgs:  make([]interface{}, len(types)),
+	}
+	for i, t := range types {
+		sc.text[i] = columnKind(t) != kindBinary
+		if isArrayType(t) {
+			sc.array[i] = strings.TrimPrefix(t, "_")
+		}
+		sc.composite[i] = isClickHouseComposite(t)
+		sc.uuid[i] = isBinaryUUID(t)
+	}
+	return sc
+}
+
+// scan reads the current row into values. Text protocols hand everything
+// back as bytes; raw bytes are kept only for genuinely binary columns.
+func (sc *resultScanner) scan(rows *sql.Rows, values []interface{}) error {
+	for i := range values {
+		sc.scanArgs[i] = &values[i]
+	}
+	if err := rows.Scan(sc.scanArgs...); err != nil {
+		return err
+	}
+	for i, v := range values {
+		if sc.composite[i] {
+			values[i] = clickhouseValue(reflect.ValueOf(v))
+		}
+		if b, ok := values[i].([]byte); ok && sc.uuid[i] && len(b) == 16 {
+			values[i] = uuidValue(b)
+		}
+		if b, ok := values[i].([]byte); ok && sc.text[i] {
+			values[i] = string(b)
+		}
+		if text, ok := values[i].(string); ok && sc.array[i] != "" {
+			if a, err := parseArrayText(text, sc.array[i]); err == nil {
+				values[i] = a
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	kindString  = "string"
+	kindInt     = "int"
+	kindUint    = "uint"
+	kindFloat   = "float"
+	kindDecimal = "decimal"
+	kindBool    = "bool"
+	kindTime    = "time"
+	kindBinary  = "binary"
+)
+
+// baseType strips ClickHouse wrappers and type parameters, so that
+// "Nullable(DateTime64(3))" and "timestamp" compare as DATETIME64 and TIMESTAMP.
+func baseType(dbType string) string {
+	t := strings.ToUpper(strings.TrimSpace(dbType))
+	for changed := true; changed; {
+		changed = false
+		for _, wrapper := range []string{"NULLABLE(", "LOWCARDINALITY("} {
+			if strings.HasPrefix(t, wrapper) && strings.HasSuffix(t, ")") {
+				t = t[len(wrapper) : len(t)-1]
+				changed = true
+			}
+		}
+	}
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = t[:i]
+	}
+	return strings.TrimSpace(t)
+}
+
+// columnKind classifies a driver type name into a coarse value kind.
+func columnKind(dbType string) string {
+	t := baseType(dbType)
+	switch t {
+	case "INT", "INTEGER", "BIGINT", "SMALLINT", "TINYINT", "MEDIUMINT",
+		"INT2", "INT4", "INT8", "INT16", "INT32", "INT64", "SERIAL", "BIGSERIAL", "YEAR":
+		return kindInt
+	case "UINT8", "UINT16", "UINT32", "UINT64",
+		"UNSIGNED INT", "UNSIGNED BIGINT", "UNSIGNED SMALLINT", "UNSIGNED TINYINT", "UNSIGNED MEDIUMINT":
+		return kindUint
+	case "FLOAT", "DOUBLE", "REAL", "FLOAT4", "FLOAT8", "FLOAT32", "FLOAT64", "DOUBLE PRECISION":
+		return kindFloat
+	case "DECIMAL", "NUMERIC", "DECIMAL32", "DECIMAL64", "DECIMAL128", "DECIMAL256":
+		return kindDecimal
+	case "BOOL", "BOOLEAN":
+		return kindBool
+	case "DATE", "DATE32", "DATETIME", "DATETIME64", "TIMESTAMP", "TIMESTAMPTZ":
+		return kindTime
+	case "BYTEA", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY":
+		return kindBinary
+	}
+	return kindString
+}
+
+// placeholder returns the n-th (1-based) bind parameter marker for the driver.
+func placeholder(driver string, n int) string {
+	if driver == "postgres" {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// quoteIdent quotes a possibly schema-qualified identifier for the driver.
+func quoteIdent(driver, name string) string {
+	quote := `"`
+	if driver == "mysql" || driver == "clickhouse" {
+		quote = "`"
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quote + strings.ReplaceAll(part, quote, quote+quote) + quote
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+// benchRows is the size of the table the scan benchmarks read.
+const benchRows = 10000
+
+// benchmarkDB opens an in-memory SQLite database holding benchRows rows of
+// integer, text, real, blob and NULL columns.
+func benchmarkDB(b *testing.B) *sql.DB {
+	b.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close() })
+	// every connection to :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT, amount REAL, payload BLOB, note TEXT)`); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := db.Exec(`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < ?)
+		INSERT INTO t SELECT i, 'name ' || i, i * 1.5, randomblob(16),
+			CASE WHEN i % 3 = 0 THEN NULL ELSE 'note' END FROM n`, benchRows); err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+func BenchmarkScanResult(b *testing.B) {
+	db := benchmarkDB(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rs, err := fetchResult(context.Background(), db, "SELECT * FROM t")
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(rs.Rows) != benchRows {
+			b.Fatalf("got %d rows, want %d", len(rs.Rows), benchRows)
+		}
+	}
+}
+
+// BenchmarkScanResultPerRow scans the way scanResultMax did before
+// resultScanner: a new row and new scan targets for every row, and the
+// column kind looked up for every cell. It is the baseline for
+// BenchmarkScanResult.
+func BenchmarkScanResultPerRow(b *testing.B) {
+	db := benchmarkDB(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows, err := db.Query("SELECT * FROM t")
+		if err != nil {
+			b.Fatal(err)
+		}
+		columnTypes, err := rows.ColumnTypes()
+		if err != nil {
+			b.Fatal(err)
+		}
+		types := make([]string, len(columnTypes))
+		for j, ct := range columnTypes {
+			types[j] = ct.DatabaseTypeName()
+		}
+		var result [][]interface{}
+		for rows.Next() {
+			values := make([]interface{}, len(types))
+			scanArgs := make([]interface{}, len(types))
+			for j := range values {
+				scanArgs[j] = &values[j]
+			}
+			if err := rows.Scan(scanArgs...); err != nil {
+				b.Fatal(err)
+			}
+			for j, v := range values {
+				if x, ok := v.([]byte); ok && columnKind(types[j]) != kindBinary {
+					values[j] = string(x)
+				}
+			}
+			result = append(result, values)
+		}
+		rows.Close()
+		if len(result) != benchRows {
+			b.Fatalf("got %d rows, want %d", len(result), benchRows)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ddlQueryer is a *sql.DB or, to read the definitions of a snapshot, a
+// *sql.Tx.
+type ddlQueryer interface {
+	rowQueryer
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+}
+
+// tableDDL returns the CREATE statement of a table or view. MySQL and
+// ClickHouse produce it themselves; SQLite keeps the original text of the
+// table and its indexes; for PostgreSQL it is assembled from the catalog.
+func tableDDL(ctx context.Context, db ddlQueryer, driver, schema, table string) (string, error) {
+	name := quoteIdent(driver, qualifiedName(tableInfo{Schema: schema, Name: table}))
+	switch driver {
+	case "mysql", "clickhouse":
+		rows, err := db.QueryContext(ctx, "SHOW CREATE TABLE "+name)
+		if err != nil {
+			return "", err
+		}
+		defer rows.Close()
+		rs, err := scanResult(rows)
+		if err != nil {
+			return "", err
+		}
+		if len(rs.Rows) == 0 {
+			return "", fmt.Errorf("no definition returned for %s", name)
+		}
+		// MySQL answers (Table, Create Table) or (View, Create View, ...),
+		// ClickHouse a single statement column
+		stmt := rs.Rows[0][0]
+		if driver == "mysql" {
+			stmt = rs.Rows[0][1]
+		}
+		return fmt.Sprint(stmt) + ";", nil
+	case "sqlite":
+		master := "sqlite_master"
+		if schema != "" {
+			master = quoteIdent(driver, schema) + ".sqlite_master"
+		}
+		rows, err := db.QueryContext(ctx, `
+			SELECT sql FROM `+master+`
+			WHERE tbl_name = ? AND sql IS NOT NULL
+			ORDER BY CASE type WHEN 'table' THEN 0 WHEN 'view' THEN 0 WHEN 'index' THEN 1 ELSE 2 END, name`, table)
+		if err != nil {
+			return "", err
+		}
+		defer rows.Close()
+		var stmts []string
+		for rows.Next() {
+			var stmt string
+			if err := rows.Scan(&stmt); err != nil {
+				return "", err
+			}
+			stmts = append(stmts, stmt+";")
+		}
+		if len(stmts) == 0 && rows.Err() == nil {
+			return "", fmt.Errorf("table not found: %s", table)
+		}
+		return strings.Join(stmts, "\n\n"), rows.Err()
+	case "postgres":
+		return postgresDDL(ctx, db, name)
+	}
+	return "", fmt.Errorf("DDL is not supported for %q", driver)
+}
+
+// postgresDDL assembles CREATE TABLE from pg_attribute, pg_constraint and
+// the indexes not backing a constraint, or CREATE VIEW from the view
+// definition. name is the quoted relation name, resolved via regclass.
+func postgresDDL(ctx context.Context, db ddlQueryer, name string) (string, error) {
+	var kind string
+	if err := db.QueryRowContext(ctx, "SELECT relkind::text FROM pg_class WHERE oid = $1::regclass", name).Scan(&kind); err != nil {
+		return "", err
+	}
+	switch kind {
+	case "v", "m":
+		var def string
+		if err := db.QueryRowContext(ctx, "SELECT pg_get_viewdef($1::regclass, true)", name).Scan(&def); err != nil {
+			return "", err
+		}
+		create := "CREATE OR REPLACE VIEW"
+		if kind == "m" {
+			create = "CREATE MATERIALIZED VIEW"
+		}
+		return fmt.Sprintf("%s %s AS\n%s", create, name, strings.TrimSpace(def)), nil
+	}
+
+	var lines []string
+	rows, err := db.QueryContext(ctx, `
+		SELECT a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+			COALESCE(pg_get_expr(d.adbin, d.adrelid), ''), a.attidentity::text, a.attgenerated::text
+		FROM pg_attribute a
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`, name)
+	if err != nil {
+		return "", err
+	}
+	for rows.Next() {
+		var col, typ, def, identity, generated string
+		var notNull bool
+		if err := rows.Scan(&col, &typ, &notNull, &def, &identity, &generated); err != nil {
+			rows.Close()
+			return "", err
+		}
+		line := quoteIdent("postgres", col) + " " + typ
+		switch {
+		case generated == "s":
+			line += " GENERATED ALWAYS AS (" + def + ") STORED"
+		case identity == "a":
+			line += " GENERATED ALWAYS AS IDENTITY"
+		case identity == "d":
+			line += " GENERATED BY DEFAULT AS IDENTITY"
+		case def != "":
+			line += " DEFAULT " + def
+		}
+		if notNull {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT conname, pg_get_constraintdef(oid, true)
+		FROM pg_constraint
+		WHERE conrelid = $1::regclass
+		ORDER BY contype <> 'p', conname`, name)
+	if err != nil {
+		return "", err
+	}
+	for rows.Next() {
+		var con, def string
+		if err := rows.Scan(&con, &def); err != nil {
+			rows.Close()
+			return "", err
+		}
+		lines = append(lines, "CONSTRAINT "+quoteIdent("postgres", con)+" "+def)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	ddl := fmt.Sprintf("CREATE TABLE %s (\n    %s\n);", name, strings.Join(lines, ",\n    "))
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT pg_get_indexdef(i.indexrelid)
+		FROM pg_index i
+		WHERE i.indrelid = $1::regclass
+			AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = i.indexrelid AND c.conrelid = i.indrelid)
+		ORDER BY 1`, name)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var def string
+		if err := rows.Scan(&def); err != nil {
+			return "", err
+		}
+		ddl += "\n\n" + def + ";"
+	}
+	return ddl, rows.Err()
+}
+
+// tableDDLHandler shows the CREATE statement of a table for copying.
+func tableDDLHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name := c.PostForm("table")
+	schema, table := splitTableName(name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		renderError(c, http.StatusServiceUnavailable, "ddl.html", "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	ddl, err := tableDDL(ctx, db, p.Driver, schema, table)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "ddl.html", "Failed to read definition: %v", err)
+		return
+	}
+	render(c, http.StatusOK, ddlView{Name: name, DDL: ddl})
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+// exactDecimal turns the decimal types drivers decode into into their exact
+// text, the form database/sql already gives NUMERIC and DECIMAL in: pgx's
+// Numeric, which would print as a struct, and ClickHouse's decimal.Decimal.
+// Going through float64 would round money. Other values are returned as
+// they are.
+func exactDecimal(v interface{}) interface{} {
+	switch d := v.(type) {
+	case pgtype.Numeric:
+		if text, err := d.Value(); err == nil {
+			return text
+		}
+	case decimal.Decimal:
+		// String drops trailing zeros; keep the column's scale
+		if d.Exponent() < 0 {
+			return d.StringFixed(-d.Exponent())
+		}
+		return d.String()
+	}
+	return v
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// destructiveSQL returns the DROP or TRUNCATE statement for a table or view.
+// SQLite has no TRUNCATE; an unqualified DELETE is its equivalent.
+func destructiveSQL(driver, action string, t tableSummary) (string, error) {
+	name := quoteIdent(driver, t.Qualified())
+	switch action {
+	case "drop":
+		if strings.Contains(t.Kind, "view") {
+			return "DROP " + strings.ToUpper(t.Kind) + " " + name, nil
+		}
+		return "DROP TABLE " + name, nil
+	case "truncate":
+		if t.Kind != "table" {
+			return "", fmt.Errorf("only tables can be truncated, %s is a %s", t.Qualified(), t.Kind)
+		}
+		if driver == "sqlite" {
+			return "DELETE FROM " + name, nil
+		}
+		return "TRUNCATE TABLE " + name, nil
+	}
+	return "", fmt.Errorf("unknown action %q", action)
+}
+
+// destructiveHandler drops or truncates a table. The first request shows
+// the statement and the estimated row count; it only runs when the name is
+// typed back exactly. config.DisableDestructive turns it off.
+func destructiveHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name, action := c.PostForm("table"), c.PostForm("action")
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "destructive.html", format, args...)
+	}
+	if config.DisableDestructive {
+		fail(http.StatusForbidden, "DROP and TRUNCATE are disabled in the configuration")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	tables, err := listTableSummaries(ctx, db, p.Driver)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to list tables: %v", err)
+		return
+	}
+	var target *tableSummary
+	for i := range tables {
+		if tables[i].Qualified() == name {
+			target = &tables[i]
+		}
+	}
+	if target == nil {
+		fail(http.StatusNotFound, "Table not found: %s", name)
+		return
+	}
+	query, err := destructiveSQL(p.Driver, action, *target)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	typed := c.PostForm("confirm_name")
+	if typed != name {
+		rows := target.Rows
+		// SQLite keeps no estimate; counting is cheap enough there
+		if rows == nil && p.Driver == "sqlite" && target.Kind == "table" {
+			var n int64
+			if err := db.QueryRowContext(ctx, "SELECT count(*) FROM "+quoteIdent(p.Driver, name)).Scan(&n); err == nil {
+				rows = &n
+			}
+		}
+		page := destructiveView{
+			Table:     name,
+			Kind:      target.Kind,
+			Action:    action,
+			Statement: query,
+			Rows:      rows,
+		}
+		if typed != "" {
+			page.Problem = "The name doesn't match, nothing was done."
+		}
+		render(c, http.StatusOK, page)
+		return
+	}
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		fail(http.StatusBadRequest, "%s failed: %v", strings.ToUpper(action), err)
+		return
+	}
+	invalidateSchema(p)
+
+	user := currentIdentity(c).User
+	log.Printf("%s ran %s on %s", user, query, p.address())
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: action + "_table",
+		Target: p.auditTarget(),
+		Query:  query,
+	})
+	render(c, http.StatusOK, destructiveView{
+		Done:      fmt.Sprintf("Done: %s", query),
+		Statement: query,
+	})
+}
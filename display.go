@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// displayBinaryBytes is how much of a binary value a cell shows in hex.
+const displayBinaryBytes = 32
+
+// displayConfig sets how result values look on the pages and in exports;
+// the API keeps the values as the server returned them.
+type displayConfig struct {
+	// TimeZone converts times, e.g. "Europe/Berlin" or "UTC", unless the
+	// user picks another; empty leaves them in the zone the driver returned
+	TimeZone string `json:"time_zone"`
+	// TimeFormat and DateFormat are Go layouts, by default
+	// "2006-01-02 15:04:05.999999999 -07:00" and "2006-01-02"
+	TimeFormat string `json:"time_format"`
+	DateFormat string `json:"date_format"`
+}
+
+// displayLocation is the configured zone, nil to keep each time's own.
+var displayLocation *time.Location
+
+// zoneCache holds every zone loaded for display by name. Times moved into
+// one of these are in the zone a reader chose, which displayTime keeps.
+var zoneCache sync.Map
+
+// loadZone loads a zone once, so all times shown in it share the location.
+func loadZone(name string) (*time.Location, error) {
+	if loc, ok := zoneCache.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := zoneCache.LoadOrStore(name, loc)
+	return actual.(*time.Location), nil
+}
+
+func chosenZone(loc *time.Location) bool {
+	cached, ok := zoneCache.Load(loc.String())
+	return ok && cached == loc
+}
+
+// setupDisplay loads the configured time zone; an unknown one stops the
+// server.
+func setupDisplay() {
+	if name := config.Display.TimeZone; name != "" {
+		loc, err := loadZone(name)
+		if err != nil {
+			log.Fatalf("Invalid display time zone %q: %v", name, err)
+		}
+		displayLocation = loc
+	}
+}
+
+// timeZonePreference is the user_preferences entry of the chosen zone.
+const timeZonePreference = "time_zone"
+
+// savedTimeZone is the zone the user keeps as their default, "" for none.
+func savedTimeZone(c *gin.Context) string {
+	var name string
+	err := store.QueryRowContext(c.Request.Context(),
+		"SELECT value FROM user_preferences WHERE owner = ? AND name = ?",
+		preferenceOwner(c), timeZonePreference).Scan(&name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to read the saved time zone: %v", err)
+	}
+	return name
+}
+
+// requestZone is the zone a request shows and exports times in: the form's
+// time_zone, else the user's saved one, else the configured one. nil keeps
+// each time in the zone the driver returned.
+func requestZone(c *gin.Context) (*time.Location, error) {
+	name, ok := c.GetPostForm("time_zone")
+	if !ok {
+		name = savedTimeZone(c)
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		return displayLocation, nil
+	}
+	loc, err := loadZone(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
+
+func zoneName(loc *time.Location) string {
+	if loc == nil {
+		return ""
+	}
+	return loc.String()
+}
+
+// inZone moves the times of rows, array elements included, into loc. Rows
+// are copied: cached results are shared.
+func inZone(rows [][]interface{}, loc *time.Location) [][]interface{} {
+	if loc == nil {
+		return rows
+	}
+	out := make([][]interface{}, len(rows))
+	for i, row := range rows {
+		out[i] = make([]interface{}, len(row))
+		for j, v := range row {
+			out[i][j] = zoneValue(v, loc)
+		}
+	}
+	return out
+}
+
+func zoneValue(v interface{}, loc *time.Location) interface{} {
+	switch t := v.(type) {
+	case time.Time:
+		if !isDate(t) {
+			return t.In(loc)
+		}
+	case sqlArray:
+		a := make(sqlArray, len(t))
+		for i, e := range t {
+			a[i] = zoneValue(e, loc)
+		}
+		return a
+	}
+	return v
+}
+
+// hasTimes tells a result with timestamps worth saying the zone of.
+func hasTimes(rows [][]interface{}) bool {
+	for _, row := range rows {
+		for _, v := range row {
+			if t, ok := v.(time.Time); ok && !isDate(t) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serverZoneQueries read the zone the server works in; SQLite has none.
+var serverZoneQueries = map[string]string{
+	"postgres":   "SHOW TimeZone",
+	"mysql":      "SELECT IF(@@session.time_zone = 'SYSTEM', @@system_time_zone, @@session.time_zone)",
+	"clickhouse": "SELECT timezone()",
+}
+
+// serverZone asks the server its time zone, "" when it can't say.
+func serverZone(ctx context.Context, conn dbConn, driver string) string {
+	query, ok := serverZoneQueries[driver]
+	if !ok {
+		return ""
+	}
+	rs, err := conn.Query(ctx, query, 1)
+	if err != nil || len(rs.Rows) == 0 || len(rs.Rows[0]) == 0 {
+		return ""
+	}
+	return fmt.Sprint(rs.Rows[0][0])
+}
+
+// timeZoneHandler saves the time zone field as the user's default; an
+// empty one goes back to the configured zone.
+func timeZoneHandler(c *gin.Context) {
+	name := strings.TrimSpace(c.PostForm("time_zone"))
+	if name != "" {
+		if _, err := loadZone(name); err != nil {
+			c.String(http.StatusBadRequest, "%s", tr(c, fmt.Sprintf("Unknown time zone %q", name)))
+			return
+		}
+	}
+	var err error
+	if name == "" {
+		_, err = store.ExecContext(c.Request.Context(),
+			"DELETE FROM user_preferences WHERE owner = ? AND name = ?", preferenceOwner(c), timeZonePreference)
+	} else {
+		_, err = store.ExecContext(c.Request.Context(), `
+			INSERT INTO user_preferences (owner, name, value) VALUES (?, ?, ?)
+			ON CONFLICT (owner, name) DO UPDATE SET value = excluded.value`,
+			preferenceOwner(c), timeZonePreference, name)
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "%s", tr(c, fmt.Sprintf("Failed to save the time zone: %v", err)))
+		return
+	}
+	if name == "" {
+		c.String(http.StatusOK, "%s", tr(c, "Times follow the server configuration again"))
+		return
+	}
+	c.String(http.StatusOK, "%s", tr(c, fmt.Sprintf("Times are shown in %s from now on", name)))
+}
+
+// isDate tells a DATE column's value, midnight with nothing finer, from a
+// timestamp. Dates aren't moved between zones: that would change the day.
+func isDate(t time.Time) bool {
+	return t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+}
+
+// displayTime formats a time for a page in the configured zone and layout;
+// a time already moved into the zone a reader chose stays there.
+func displayTime(t time.Time) string {
+	if isDate(t) {
+		layout := config.Display.DateFormat
+		if layout == "" {
+			layout = "2006-01-02"
+		}
+		return t.Format(layout)
+	}
+	if displayLocation != nil && !chosenZone(t.Location()) {
+		t = t.In(displayLocation)
+	}
+	layout := config.Display.TimeFormat
+	if layout == "" {
+		layout = "2006-01-02 15:04:05.999999999 -07:00"
+	}
+	return t.Format(layout)
+}
+
+// displayBinary is the start of a binary value in hex, the way PostgreSQL
+// writes bytea.
+func displayBinary(b []byte) string {
+	if len(b) > displayBinaryBytes {
+		return fmt.Sprintf(`\x%s…`, hex.EncodeToString(b[:displayBinaryBytes]))
+	}
+	return `\x` + hex.EncodeToString(b)
+}
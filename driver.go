@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+)
+
+// dbDriver is a database the query page can run statements on. Each lives
+// in its own driver_<name>.go and is listed in dbDrivers under the value of
+// the form's driver field.
+type dbDriver interface {
+	// Connect opens a connection for one request. Notices and warnings the
+	// server sends with a statement go to notices.
+	Connect(ctx context.Context, p connParams, notices *noticeLog) (dbConn, error)
+	// ListSchemas lists the databases on the server (attached files for SQLite)
+	ListSchemas(ctx context.Context, db *sql.DB) ([]string, error)
+	// TypeMap maps a column type name of the driver to a value kind
+	TypeMap(dbType string) string
+}
+
+// dbConn is a connection opened by a dbDriver.
+type dbConn interface {
+	// Query runs a statement that returns rows, reading at most maxRows of
+	// them (all when maxRows <= 0) and marking the result truncated
+	Query(ctx context.Context, query string, maxRows int) (*resultSet, error)
+	// Exec runs any other statement and describes what it did
+	Exec(ctx context.Context, query string) (string, error)
+	Close() error
+}
+
+// dbDrivers holds the registered drivers by form value.
+var dbDrivers = map[string]dbDriver{}
+
+var driverTitles = map[string]string{}
+
+// registerDriver adds a driver under the form value name, with the title
+// shown in the driver dropdown. Drivers register from an init func in their
+// own file, or are loaded from plugins, see loadDriverPlugins.
+func registerDriver(name, title string, d dbDriver) {
+	if _, dup := dbDrivers[name]; dup {
+		panic("registerDriver: driver " + name + " registered twice")
+	}
+	dbDrivers[name] = d
+	driverTitles[name] = title
+}
+
+// driverOption is an entry of the driver dropdown.
+type driverOption struct {
+	Name  string
+	Title string
+}
+
+// driverOptions lists the registered drivers by title.
+func driverOptions() []driverOption {
+	options := make([]driverOption, 0, len(driverTitles))
+	for name, title := range driverTitles {
+		options = append(options, driverOption{Name: name, Title: title})
+	}
+	sort.Slice(options, func(i, j int) bool { return options[i].Title < options[j].Title })
+	return options
+}
+
+// sqlOpener is implemented by drivers openDB doesn't know, so the pages
+// built on database/sql work with them too.
+type sqlOpener interface {
+	OpenDB(p connParams) (*sql.DB, error)
+}
+
+// localDriver is implemented by drivers of database files on this host,
+// named in the Database field instead of a server address.
+type localDriver interface {
+	Local() bool
+}
+
+// kindOf maps a column type with the driver's type map.
+func kindOf(driver, dbType string) string {
+	if d, ok := dbDrivers[driver]; ok {
+		return d.TypeMap(dbType)
+	}
+	return columnKind(dbType)
+}
+
+// queryNames runs a query returning one name per row.
+func queryNames(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// sqlConn is a dbConn over database/sql, for drivers that need nothing
+// more.
+type sqlConn struct {
+	db *sql.DB
+}
+
+func (c sqlConn) Query(ctx context.Context, query string, maxRows int) (*resultSet, error) {
+	return fetchResultMax(ctx, c.db, maxRows, query)
+}
+
+func (c sqlConn) Exec(ctx context.Context, query string) (string, error) {
+	res, err := c.db.ExecContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		affected = -1
+	}
+	recordAffected(ctx, affected)
+	return execSummary(affected), nil
+}
+
+func (c sqlConn) Close() error { return c.db.Close() }
+
+// queryFailure is result.html for a failed statement; ClickHouse failures
+// keep their query_id for the system.query_log lookup.
+func queryFailure(err error, notices *noticeLog) resultView {
+	var ch *clickhouseQueryError
+	if errors.As(err, &ch) {
+		return clickhouseFailure(ch.err, ch.queryID, notices)
+	}
+	return resultError(notices, "Query error: %v", err)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// clickhouseDriver uses the native ClickHouse protocol, which carries the
+// server log and query_id of each statement.
+type clickhouseDriver struct{}
+
+func init() {
+	registerDriver("clickhouse", "ClickHouse", clickhouseDriver{})
+}
+
+func (clickhouseDriver) Connect(ctx context.Context, p connParams, notices *noticeLog) (dbConn, error) {
+	opts, err := p.clickhouseOptions()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := clickhouse.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ClickHouse: %v", err)
+	}
+	return clickhouseConn{conn: conn, notices: notices}, nil
+}
+
+func (clickhouseDriver) ListSchemas(ctx context.Context, db *sql.DB) ([]string, error) {
+	return queryNames(ctx, db, "SELECT name FROM system.databases ORDER BY name")
+}
+
+func (clickhouseDriver) TypeMap(dbType string) string { return columnKind(dbType) }
+
+// clickhouseQueryError is a failed statement with the query_id it ran under,
+// so it can be looked up in system.query_log.
+type clickhouseQueryError struct {
+	queryID string
+	err     error
+}
+
+func (e *clickhouseQueryError) Error() string { return e.err.Error() }
+func (e *clickhouseQueryError) Unwrap() error { return e.err }
+
+type clickhouseConn struct {
+	conn    driver.Conn
+	notices *noticeLog
+}
+
+// statement gives the statement a known query_id, streams its server log
+// to the notices and counts what it read when stats are collected.
+func (c clickhouseConn) statement(ctx context.Context) (context.Context, string) {
+	queryID := randomID(16)
+	options := []clickhouse.QueryOption{clickhouse.WithQueryID(queryID)}
+	if s := statsFrom(ctx); s != nil {
+		options = append(options, clickhouseProfileEvents(s))
+	}
+	return clickhouseLogs(ctx, c.notices, options...), queryID
+}
+
+// Exec can't say how many rows changed: ClickHouse doesn't report affected
+// rows for DDL/INSERT.
+func (c clickhouseConn) Exec(ctx context.Context, query string) (string, error) {
+	ctx, queryID := c.statement(ctx)
+	if err := c.conn.Exec(ctx, query); err != nil {
+		return "", &clickhouseQueryError{queryID: queryID, err: err}
+	}
+	return execSummary(-1), nil
+}
+
+// clickhouseScanTarget returns a scan destination of the column's Go type,
+// as the driver reports it: a pointer for Nullable, a slice for Array, a
+// map for Map and named Tuple, a slice for other Tuples. LowCardinality
+// scans as the type it wraps.
+func clickhouseScanTarget(ct driver.ColumnType) interface{} {
+	if t := ct.ScanType(); t != nil {
+		return reflect.New(t).Interface()
+	}
+	// Nullable(Nothing) has no Go type
+	return new(interface{})
+}
+
+// clickhouseValue turns a scanned composite into what the pages, exports
+// and API handle: NULL for an empty Nullable, sqlArray for Array and
+// unnamed Tuple, string-keyed maps for Map and named Tuple, recursively.
+// Decimals become exact text, UUIDs uuidValue; other scalars, IPs among
+// them, are kept as they are.
+func clickhouseValue(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if _, ok := v.Interface().(json.Marshaler); ok && v.Kind() == reflect.Pointer {
+			return v.Interface()
+		}
+		return clickhouseValue(v.Elem())
+	}
+	switch v.Interface().(type) {
+	case decimal.Decimal:
+		return exactDecimal(v.Interface())
+	case uuid.UUID:
+		return canonicalUUID(v.Interface())
+	case fmt.Stringer, json.Marshaler, time.Time:
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return sqlArray{}
+		}
+		a := make(sqlArray, v.Len())
+		for i := range a {
+			a[i] = clickhouseValue(v.Index(i))
+		}
+		return a
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(clickhouseValue(iter.Key()))] = clickhouseValue(iter.Value())
+		}
+		return m
+	}
+	return v.Interface()
+}
+
+// isClickHouseComposite tells the types whose values need clickhouseValue.
+func isClickHouseComposite(dbType string) bool {
+	t := strings.ToUpper(strings.TrimSpace(dbType))
+	for _, prefix := range []string{"NULLABLE(", "ARRAY(", "MAP(", "TUPLE(", "NESTED(", "LOWCARDINALITY(NULLABLE("} {
+		if strings.HasPrefix(t, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c clickhouseConn) Query(ctx context.Context, query string, maxRows int) (*resultSet, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx, queryID := c.statement(ctx)
+	rows, err := c.conn.Query(ctx, query)
+	if err != nil {
+		return nil, &clickhouseQueryError{queryID: queryID, err: err}
+	}
+	// cancel before closing, so a truncated query isn't read to the end
+	defer func() {
+		cancel()
+		rows.Close()
+	}()
+
+	// Get column names and types
+	rs := &resultSet{Columns: rows.Columns()}
+	columnTypes := rows.ColumnTypes()
+	// the targets are reused, every row copies its values out of them
+	scanArgs := make([]interface{}, len(columnTypes))
+	for i, ct := range columnTypes {
+		rs.Types = append(rs.Types, ct.DatabaseTypeName())
+		scanArgs[i] = clickhouseScanTarget(ct)
+	}
+	arena := rowArena{width: len(scanArgs)}
+	for rows.Next() {
+		if maxRows > 0 && len(rs.Rows) == maxRows {
+			rs.Truncated = true
+			return rs, nil
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, &clickhouseQueryError{queryID: queryID, err: fmt.Errorf("failed to scan row: %v", err)}
+		}
+		row := arena.newRow()
+		for i, arg := range scanArgs {
+			row[i] = clickhouseValue(reflect.ValueOf(arg).Elem())
+		}
+		rs.Rows = append(rs.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &clickhouseQueryError{queryID: queryID, err: err}
+	}
+	return rs, nil
+}
+
+func (c clickhouseConn) Close() error { return c.conn.Close() }
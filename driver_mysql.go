@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+)
+
+// mysqlDriver keeps one connection per request, since SHOW WARNINGS only
+// sees statements of its own connection.
+type mysqlDriver struct{}
+
+func init() {
+	registerDriver("mysql", "MySQL", mysqlDriver{})
+}
+
+func (mysqlDriver) Connect(ctx context.Context, p connParams, notices *noticeLog) (dbConn, error) {
+	db, err := openDB(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return mysqlConn{db: db, conn: conn, notices: notices}, nil
+}
+
+func (mysqlDriver) ListSchemas(ctx context.Context, db *sql.DB) ([]string, error) {
+	return queryNames(ctx, db, "SHOW DATABASES")
+}
+
+func (mysqlDriver) TypeMap(dbType string) string { return columnKind(dbType) }
+
+type mysqlConn struct {
+	db      *sql.DB
+	conn    *sql.Conn
+	notices *noticeLog
+}
+
+func (c mysqlConn) warnings(ctx context.Context) {
+	if err := mysqlWarnings(ctx, c.conn, c.notices); err != nil {
+		log.Printf("Failed to read warnings: %v", err)
+	}
+}
+
+func (c mysqlConn) Exec(ctx context.Context, query string) (string, error) {
+	res, err := c.conn.ExecContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		affected = -1
+	}
+	recordAffected(ctx, affected)
+	c.warnings(ctx)
+	return execSummary(affected), nil
+}
+
+func (c mysqlConn) Query(ctx context.Context, query string, maxRows int) (*resultSet, error) {
+	qctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rows, err := c.conn.QueryContext(qctx, query)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := scanResultMax(rows, maxRows)
+	if err == nil && rs.Truncated {
+		// the server stops sending the rest, at the cost of the connection
+		// and with it the warnings
+		cancel()
+		rows.Close()
+		return rs, nil
+	}
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	c.warnings(ctx)
+	return rs, nil
+}
+
+func (c mysqlConn) Close() error {
+	c.conn.Close()
+	return c.db.Close()
+}
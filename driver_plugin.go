@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"plugin"
+)
+
+// pluginDriver is a database/sql driver loaded from a Go plugin listed in
+// "driver_plugins" in config.json. The plugin imports the driver package,
+// which registers itself with database/sql, and exports:
+//
+//	var DriverName = "duckdb"           // the database/sql driver name, required
+//	func DSN(server, username, password, database string) string // required
+//	var Title = "DuckDB"                // dropdown title, DriverName if missing
+//	var SchemasQuery = "SELECT ..."     // one name per row, for the browser
+//	var Local = true                    // the Database field is a local file
+//
+// Build it with go build -buildmode=plugin against the same Go version and
+// module versions as simpleadmin.
+type pluginDriver struct {
+	sqlName      string
+	dsn          func(server, username, password, database string) string
+	schemasQuery string
+	local        bool
+}
+
+func (d pluginDriver) OpenDB(p connParams) (*sql.DB, error) {
+	return sql.Open(d.sqlName, d.dsn(p.Server, p.Username, p.Password, p.Database))
+}
+
+func (d pluginDriver) Connect(ctx context.Context, p connParams, _ *noticeLog) (dbConn, error) {
+	db, err := openDB(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return sqlConn{db: db}, nil
+}
+
+func (d pluginDriver) ListSchemas(ctx context.Context, db *sql.DB) ([]string, error) {
+	if d.schemasQuery == "" {
+		return nil, fmt.Errorf("listing databases is not supported for %q", d.sqlName)
+	}
+	return queryNames(ctx, db, d.schemasQuery)
+}
+
+func (d pluginDriver) TypeMap(dbType string) string { return columnKind(dbType) }
+
+func (d pluginDriver) Local() bool { return d.local }
+
+// openDriverPlugin loads one plugin and registers its driver.
+func openDriverPlugin(path string) error {
+	plug, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	sym, err := plug.Lookup("DriverName")
+	if err != nil {
+		return err
+	}
+	name, ok := sym.(*string)
+	if !ok || *name == "" {
+		return fmt.Errorf("DriverName must be a non-empty string")
+	}
+	if _, dup := dbDrivers[*name]; dup {
+		return fmt.Errorf("driver %q is already registered", *name)
+	}
+	d := pluginDriver{sqlName: *name}
+
+	sym, err = plug.Lookup("DSN")
+	if err != nil {
+		return err
+	}
+	if d.dsn, ok = sym.(func(server, username, password, database string) string); !ok {
+		return fmt.Errorf("DSN must be a func(server, username, password, database string) string")
+	}
+
+	title := *name
+	if sym, err := plug.Lookup("Title"); err == nil {
+		if s, ok := sym.(*string); ok && *s != "" {
+			title = *s
+		}
+	}
+	if sym, err := plug.Lookup("SchemasQuery"); err == nil {
+		if s, ok := sym.(*string); ok {
+			d.schemasQuery = *s
+		}
+	}
+	if sym, err := plug.Lookup("Local"); err == nil {
+		if b, ok := sym.(*bool); ok {
+			d.local = *b
+		}
+	}
+
+	registerDriver(*name, title, d)
+	return nil
+}
+
+// loadDriverPlugins registers the drivers of the configured plugins after
+// the drivers compiled in.
+func loadDriverPlugins() {
+	for _, path := range config.DriverPlugins {
+		if err := openDriverPlugin(path); err != nil {
+			log.Fatalf("Failed to load driver plugin %s: %v", path, err)
+		}
+		log.Printf("Loaded driver plugin %s", path)
+	}
+}
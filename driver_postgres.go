@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const postgresConnectAttempts = 3
+
+// postgresDriver talks to PostgreSQL through a pgx pool, which reports
+// command tags and NOTICEs that database/sql hides.
+type postgresDriver struct{}
+
+func init() {
+	registerDriver("postgres", "PostgreSQL", postgresDriver{})
+}
+
+func (postgresDriver) Connect(ctx context.Context, p connParams, notices *noticeLog) (dbConn, error) {
+	connConfig, err := pgxpool.ParseConfig(p.postgresDSN())
+	if err != nil {
+		log.Printf("Failed to parse pgx config: %v", err)
+		return nil, fmt.Errorf("invalid connection configuration: %v", err)
+	}
+	if err := p.tunePostgres(&connConfig.ConnConfig.Config); err != nil {
+		return nil, err
+	}
+	connConfig.ConnConfig.OnNotice = pgNoticeHandler(notices)
+
+	// Configure the connection pool
+	connConfig.MaxConns = 25
+	connConfig.MaxConnLifetime = 5 * time.Minute
+	connConfig.MaxConnIdleTime = 30 * time.Second
+
+	// Create connection pool with retries
+	var pool *pgxpool.Pool
+	for i := 0; i < postgresConnectAttempts; i++ {
+		log.Printf("Attempting database connection (attempt %d of %d)", i+1, postgresConnectAttempts)
+
+		pool, err = pgxpool.NewWithConfig(ctx, connConfig)
+		if err == nil {
+			// Test the connection
+			if err = pool.Ping(ctx); err == nil {
+				return postgresConn{pool: pool}, nil
+			}
+		}
+
+		log.Printf("Database connection failed (attempt %d): %v", i+1, err)
+		if pool != nil {
+			pool.Close()
+		}
+		if i < postgresConnectAttempts-1 {
+			time.Sleep(time.Second * time.Duration(i+1))
+		}
+	}
+	return nil, fmt.Errorf("%d attempts failed: %v", postgresConnectAttempts, err)
+}
+
+func (postgresDriver) ListSchemas(ctx context.Context, db *sql.DB) ([]string, error) {
+	return queryNames(ctx, db, "SELECT datname FROM pg_database WHERE NOT datistemplate ORDER BY datname")
+}
+
+func (postgresDriver) TypeMap(dbType string) string { return columnKind(dbType) }
+
+type postgresConn struct {
+	pool *pgxpool.Pool
+}
+
+// Exec reports the command tag, e.g. "UPDATE 3".
+func (c postgresConn) Exec(ctx context.Context, query string) (string, error) {
+	tag, err := c.pool.Exec(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	recordAffected(ctx, tag.RowsAffected())
+	return fmt.Sprintf("%s: %s", tag.String(), execSummary(tag.RowsAffected())), nil
+}
+
+func (c postgresConn) Query(ctx context.Context, query string, maxRows int) (*resultSet, error) {
+	rs, err := c.query(ctx, query, maxRows)
+	if err == nil {
+		postgisToGeoJSON(ctx, poolGeoQueryer(c.pool), rs)
+	}
+	return rs, err
+}
+
+func (c postgresConn) query(ctx context.Context, query string, maxRows int) (*resultSet, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rows, err := c.pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	// cancel before closing, so a truncated query isn't read to the end
+	defer func() {
+		cancel()
+		rows.Close()
+	}()
+
+	// Get column descriptions
+	fields := rows.FieldDescriptions()
+	rs := &resultSet{Columns: make([]string, len(fields)), Types: make([]string, len(fields))}
+	types := rows.Conn().TypeMap()
+	arrays := make([]bool, len(fields))
+	for i, field := range fields {
+		rs.Columns[i] = string(field.Name)
+		if t, ok := types.TypeForOID(field.DataTypeOID); ok {
+			rs.Types[i] = t.Name
+			_, arrays[i] = t.Codec.(*pgtype.ArrayCodec)
+		} else {
+			// by OID, as database/sql names them, e.g. for PostGIS
+			rs.Types[i] = fmt.Sprint(field.DataTypeOID)
+		}
+	}
+
+	for rows.Next() {
+		if maxRows > 0 && len(rs.Rows) == maxRows {
+			rs.Truncated = true
+			return rs, nil
+		}
+		values, err := rows.Values()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get row values: %v", err)
+		}
+		for i, isArray := range arrays {
+			values[i] = canonicalUUID(exactDecimal(values[i]))
+			// Values flattens multidimensional arrays
+			if isArray {
+				if values[i], err = decodePoolArray(types, fields[i].DataTypeOID, fields[i].Format, rows.RawValues()[i]); err != nil {
+					return nil, fmt.Errorf("failed to decode array column %s: %v", rs.Columns[i], err)
+				}
+			}
+		}
+		rs.Rows = append(rs.Rows, values)
+	}
+	return rs, rows.Err()
+}
+
+func (c postgresConn) Close() error {
+	c.pool.Close()
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// sqliteDriver opens the database file named in the Database field.
+type sqliteDriver struct{}
+
+func init() {
+	registerDriver("sqlite", "SQLite", sqliteDriver{})
+}
+
+func (sqliteDriver) Connect(ctx context.Context, p connParams, _ *noticeLog) (dbConn, error) {
+	db, err := openDB(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return sqlConn{db: db}, nil
+}
+
+func (sqliteDriver) Local() bool { return true }
+
+func (sqliteDriver) ListSchemas(ctx context.Context, db *sql.DB) ([]string, error) {
+	return queryNames(ctx, db, "SELECT name FROM pragma_database_list ORDER BY seq")
+}
+
+// TypeMap follows SQLite's type affinity rules, since declared types are
+// free text such as "VARCHAR(20)" or "UNSIGNED BIG INT".
+func (sqliteDriver) TypeMap(dbType string) string {
+	t := strings.ToUpper(dbType)
+	switch {
+	case strings.Contains(t, "INT"):
+		return kindInt
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return kindString
+	case strings.Contains(t, "BLOB"):
+		return kindBinary
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return kindFloat
+	}
+	return columnKind(dbType)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	dumpTimeout      = 30 * time.Minute
+	dumpDefaultBatch = 500
+)
+
+// dumpDrivers are the backends a dump can be restored into with the plain
+// statements it contains.
+var dumpDrivers = map[string]bool{"postgres": true, "mysql": true, "sqlite": true}
+
+// dumpOrder puts tables before the views, and every table after the tables
+// it references so that the dump restores with foreign keys in place.
+// Reference cycles are broken in listing order.
+func dumpOrder(tables []tableSummary, fks []foreignKey) []tableSummary {
+	key := func(schema, name string) string { return schema + "." + name }
+	refs := map[string][]string{}
+	for _, fk := range fks {
+		from, to := key(fk.Schema, fk.Table), key(fk.RefSchema, fk.RefTable)
+		if from != to {
+			refs[from] = append(refs[from], to)
+		}
+	}
+	byKey := map[string]tableSummary{}
+	for _, t := range tables {
+		byKey[key(t.Schema, t.Name)] = t
+	}
+
+	var ordered, views []tableSummary
+	state := map[string]int{} // 1 visiting, 2 done
+	var visit func(k string)
+	visit = func(k string) {
+		t, ok := byKey[k]
+		if !ok || state[k] != 0 {
+			return
+		}
+		state[k] = 1
+		for _, ref := range refs[k] {
+			visit(ref)
+		}
+		state[k] = 2
+		ordered = append(ordered, t)
+	}
+	for _, t := range tables {
+		if t.Kind == "table" {
+			visit(key(t.Schema, t.Name))
+		} else {
+			views = append(views, t)
+		}
+	}
+	return append(ordered, views...)
+}
+
+// dumpTarget is how a dumped table is named in the INSERTs: PostgreSQL keeps
+// the schema, MySQL and SQLite restore into whatever database is current.
+func dumpTarget(driver string, t tableSummary) string {
+	if driver == "postgres" {
+		return quoteIdent(driver, t.Qualified())
+	}
+	return quoteIdent(driver, t.Name)
+}
+
+// sqlComment renders text as one "-- " comment line. Names and error
+// messages can hold line breaks, which would end the comment and let the
+// rest run as SQL when the dump is restored.
+func sqlComment(text string) string {
+	return "-- " + strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(text) + "\n"
+}
+
+// dumpTable writes the definition of t and, for tables, its rows as INSERTs
+// of up to batch rows, all read through the snapshot q as they are written
+// and decoded from the connection's result encoding.
+func dumpTable(ctx context.Context, w *bufio.Writer, q *sql.Tx, p connParams, t tableSummary, batch int) (int, error) {
+	driver := p.Driver
+	schema, name := splitTableName(t.Qualified())
+	w.WriteString("\n" + sqlComment(t.Kind+" "+t.Qualified()))
+	if t.Kind != "table" && t.Kind != "view" {
+		w.WriteString("-- skipped, only tables and views are dumped\n")
+		return 0, nil
+	}
+	ddl, err := tableDDL(ctx, q, driver, schema, name)
+	if err == nil {
+		ddl, err = p.transcodeText(ddl)
+	}
+	if err != nil {
+		return 0, err
+	}
+	w.WriteString(ddl + "\n")
+	if t.Kind != "table" {
+		return 0, nil
+	}
+
+	rows, err := q.QueryContext(ctx, "SELECT * FROM "+quoteIdent(driver, t.Qualified()))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	types := make([]string, len(columnTypes))
+	quoted := make([]string, len(columns))
+	for i, ct := range columnTypes {
+		types[i] = ct.DatabaseTypeName()
+		quoted[i] = quoteIdent(driver, columns[i])
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", dumpTarget(driver, t), strings.Join(quoted, ", "))
+
+	// each row is written out before the next is read, so one buffer does
+	sc := newResultScanner(types)
+	values := make([]interface{}, len(types))
+	row := [][]interface{}{values}
+	n := 0
+	for rows.Next() {
+		if err = sc.scan(rows, values); err == nil {
+			err = p.transcodeRows(row)
+		}
+		if err != nil {
+			break
+		}
+		if n%batch == 0 {
+			if n > 0 {
+				w.WriteString(";\n")
+			}
+			w.WriteString(insert)
+		} else {
+			w.WriteString(",\n")
+		}
+		w.WriteString("  " + rowLiteral(driver, types, values))
+		n++
+	}
+	// the open INSERT ends even when a row failed, so that the ROLLBACK
+	// after the error is a statement of its own
+	if n > 0 {
+		w.WriteString(";\n")
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, rows.Err()
+}
+
+// writeDump streams the dump of tables. Definitions and data are read in
+// one transaction, so they are a consistent snapshot on PostgreSQL, InnoDB
+// and SQLite. Once streaming has begun an error can only be reported
+// inside the file, which then ends rolling back what it restored so far.
+func writeDump(ctx context.Context, out io.Writer, db *sql.DB, p connParams, tables []tableSummary, batch int, mark exportMark) (int, error) {
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "-- dump of %d tables and views, %s\n", len(tables), mark.At.Format(time.RFC3339))
+	fmt.Fprintf(w, "-- export id: %s\n", mark.ID)
+	if mark.Visible {
+		w.WriteString(sqlComment(mark.notice()))
+	}
+	switch p.Driver {
+	case "mysql":
+		w.WriteString("SET FOREIGN_KEY_CHECKS = 0;\n")
+	case "sqlite":
+		w.WriteString("PRAGMA foreign_keys = OFF;\nBEGIN;\n")
+	case "postgres":
+		w.WriteString("BEGIN;\n")
+	}
+	fail := func(message string) {
+		w.WriteString("\n" + sqlComment("ERROR: "+message))
+		switch p.Driver {
+		case "mysql":
+			w.WriteString("SET FOREIGN_KEY_CHECKS = 1;\n")
+		case "sqlite", "postgres":
+			w.WriteString("ROLLBACK;\n")
+		}
+	}
+
+	// SQLite reads from one snapshot inside any transaction
+	var opts *sql.TxOptions
+	if p.Driver != "sqlite" {
+		opts = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		fail(err.Error())
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	total := 0
+	for _, t := range tables {
+		n, err := dumpTable(ctx, w, tx, p, t, batch)
+		total += n
+		if err != nil {
+			fail(fmt.Sprintf("dump of %s failed: %v", t.Qualified(), err))
+			return total, err
+		}
+	}
+
+	switch p.Driver {
+	case "mysql":
+		w.WriteString("\nSET FOREIGN_KEY_CHECKS = 1;\n")
+	case "sqlite", "postgres":
+		w.WriteString("\nCOMMIT;\n")
+	}
+	return total, nil
+}
+
+// dumpHandler downloads a logical dump, schema and data, of one table or of
+// every table and view in the database.
+func dumpHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name := c.PostForm("table")
+	if !dumpDrivers[p.Driver] {
+		c.String(http.StatusBadRequest, "Dumps support PostgreSQL, MySQL and SQLite")
+		return
+	}
+	batch, err := strconv.Atoi(c.DefaultPostForm("batch", strconv.Itoa(dumpDefaultBatch)))
+	if err != nil || batch < 1 {
+		c.String(http.StatusBadRequest, "Invalid batch size")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dumpTimeout)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		c.String(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	tables, err := listTableSummaries(ctx, db, p.Driver)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to list tables: %v", err)
+		return
+	}
+	if name != "" {
+		var found []tableSummary
+		for _, t := range tables {
+			if t.Qualified() == name || t.Name == name {
+				found = append(found, t)
+			}
+		}
+		if len(found) != 1 {
+			c.String(http.StatusNotFound, "Table not found: %s", name)
+			return
+		}
+		tables = found
+	} else {
+		fks, err := listForeignKeys(ctx, db, p.Driver)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Failed to read foreign keys: %v", err)
+			return
+		}
+		tables = dumpOrder(tables, fks)
+	}
+
+	mark := exportMark{
+		ID:      randomID(8),
+		User:    currentIdentity(c).User,
+		At:      time.Now(),
+		Visible: config.ExportWatermark,
+	}
+	file := p.Database
+	if name != "" {
+		file = name
+	}
+	c.Header("Content-Type", "application/sql; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="dump-%s-%s.sql"`,
+		strings.NewReplacer(`"`, "", "/", "_", `\`, "_").Replace(file), mark.ID))
+	rows, err := writeDump(ctx, c.Writer, db, p, tables, batch, mark)
+	if err != nil {
+		log.Printf("Dump failed: %v", err)
+	}
+
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.Qualified()
+	}
+	auditExport(c, mark, p, "dump", "dump of "+strings.Join(names, ", "), rows)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	editorRunTimeout = 10 * time.Minute
+	// editorMaxWait caps how long a poll may wait for a run to finish
+	editorMaxWait = 30 * time.Second
+)
+
+// editorRun is a statement pushed by an external editor. It runs in the
+// background so the editor can poll, or wait on, the result instead of
+// holding one request open for the whole query; only its submitter sees it.
+type editorRun struct {
+	ID      string
+	User    string
+	Target  string
+	Query   string
+	Started time.Time
+	// event and annotations of the query hooks
+	event       queryEvent
+	annotations []string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	result   *apiQueryResponse
+	err      string
+	finished time.Time
+}
+
+// apiEditorRun is the state of a run as editors poll it.
+type apiEditorRun struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Target   string     `json:"target"`
+	Query    string     `json:"query"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// QueuePosition is set while the run waits for a slot on the server
+	QueuePosition int               `json:"queue_position,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Result        *apiQueryResponse `json:"result,omitempty"`
+}
+
+var (
+	editorRunsMu sync.Mutex
+	editorRuns   = make(map[string]*editorRun)
+)
+
+func (r *editorRun) run(ctx context.Context, db *sql.DB, p connParams, args []interface{}) {
+	defer db.Close()
+	defer r.cancel()
+
+	var result *apiQueryResponse
+	release, err := acquireQuerySlot(ctx, p, r.ID)
+	if err == nil {
+		result, err = runAPIQuery(ctx, db, r.Query, args)
+		release()
+	}
+	if err == nil {
+		err = p.transcodeRows(result.Rows)
+	}
+	if changesSchema(r.Query) {
+		invalidateSchema(p)
+	}
+	annotations := append(r.annotations, afterQuery(context.Background(), r.event, r.Started, err)...)
+	if result != nil {
+		result.Annotations = annotations
+	}
+	r.mu.Lock()
+	r.result = result
+	if err != nil {
+		r.err = err.Error()
+	}
+	r.finished = time.Now()
+	r.mu.Unlock()
+	close(r.done)
+
+	time.AfterFunc(time.Hour, func() {
+		editorRunsMu.Lock()
+		delete(editorRuns, r.ID)
+		editorRunsMu.Unlock()
+	})
+}
+
+func (r *editorRun) view() apiEditorRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v := apiEditorRun{ID: r.ID, Status: "running", Target: r.Target, Query: r.Query, Started: r.Started}
+	if _, pos, ok := queryLimiter.position(r.ID); ok {
+		v.Status, v.QueuePosition = "queued", pos
+	}
+	if !r.finished.IsZero() {
+		finished := r.finished
+		v.Finished, v.Result = &finished, r.result
+		v.Status = "done"
+		if r.err != "" {
+			v.Status, v.Error = "failed", r.err
+		}
+	}
+	return v
+}
+
+// editorRunFor returns the caller's run named in the path.
+func editorRunFor(c *gin.Context) (*editorRun, bool) {
+	editorRunsMu.Lock()
+	r, ok := editorRuns[c.Param("id")]
+	editorRunsMu.Unlock()
+	if !ok || r.User != currentIdentity(c).User {
+		apiError(c, http.StatusNotFound, "run_not_found", "no such run: "+c.Param("id"))
+		return nil, false
+	}
+	return r, true
+}
+
+// apiEditorSubmit connects and starts the statement, answering 202 with the
+// run to poll. Connection errors are reported right away.
+func apiEditorSubmit(c *gin.Context) {
+	var req apiQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), editorRunTimeout)
+	db, p, ok := openTarget(ctx, c, req.apiTarget)
+	if !ok {
+		cancel()
+		return
+	}
+
+	ev := newQueryEvent(c, p, "editor", req.Query)
+	annotations, err := beforeQuery(ctx, ev)
+	if err != nil {
+		db.Close()
+		cancel()
+		apiError(c, http.StatusForbidden, "query_blocked", err.Error())
+		return
+	}
+
+	user := currentIdentity(c).User
+	r := &editorRun{
+		ID:          randomID(8),
+		User:        user,
+		Target:      p.auditTarget(),
+		Query:       req.Query,
+		Started:     time.Now(),
+		event:       ev,
+		annotations: annotations,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	editorRunsMu.Lock()
+	editorRuns[r.ID] = r
+	editorRunsMu.Unlock()
+
+	log.Printf("%s submitted editor run %s on %s", user, r.ID, p.address())
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "editor_query",
+		Target: r.Target,
+		Query:  req.Query,
+		Ref:    r.ID,
+	})
+	go r.run(ctx, db, p, req.Args)
+
+	c.Header("Location", "/api/v1/editor/runs/"+r.ID)
+	c.JSON(http.StatusAccepted, r.view())
+}
+
+// apiEditorStatus returns a run; ?wait=N waits up to N seconds for it to
+// finish first, so editors can long-poll instead of polling in a loop.
+func apiEditorStatus(c *gin.Context) {
+	r, ok := editorRunFor(c)
+	if !ok {
+		return
+	}
+	if s := c.Query("wait"); s != "" {
+		seconds, err := strconv.Atoi(s)
+		if err != nil || seconds < 0 {
+			apiError(c, http.StatusBadRequest, "invalid_request", fmt.Sprintf("invalid wait %q", s))
+			return
+		}
+		wait := time.Duration(seconds) * time.Second
+		if wait > editorMaxWait {
+			wait = editorMaxWait
+		}
+		select {
+		case <-r.done:
+		case <-time.After(wait):
+		case <-c.Request.Context().Done():
+		}
+	}
+	c.JSON(http.StatusOK, r.view())
+}
+
+// apiEditorCancel cancels a running statement; the run stays pollable and
+// ends as failed.
+func apiEditorCancel(c *gin.Context) {
+	r, ok := editorRunFor(c)
+	if !ok {
+		return
+	}
+	r.cancel()
+	select {
+	case <-r.done:
+	case <-time.After(5 * time.Second):
+	}
+	c.JSON(http.StatusOK, r.view())
+}
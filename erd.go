@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type graphNode struct {
+	ID      string   `json:"id"`
+	Schema  string   `json:"schema,omitempty"`
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
+type graphEdge struct {
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	RefColumns []string `json:"ref_columns"`
+}
+
+type schemaGraph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+// buildSchemaGraph turns tables and foreign keys into nodes and edges keyed
+// by qualified table name. With onlyRelated, tables without any foreign key
+// in either direction are left out.
+func buildSchemaGraph(tables []tableInfo, fks []foreignKey, onlyRelated bool) schemaGraph {
+	id := func(schema, name string) string {
+		return qualifiedName(tableInfo{Schema: schema, Name: name})
+	}
+	g := schemaGraph{Nodes: []graphNode{}, Edges: []graphEdge{}}
+	related := make(map[string]bool)
+	for _, fk := range fks {
+		e := graphEdge{
+			From:       id(fk.Schema, fk.Table),
+			To:         id(fk.RefSchema, fk.RefTable),
+			Name:       fk.Name,
+			Columns:    fk.Columns,
+			RefColumns: fk.RefColumns,
+		}
+		related[e.From], related[e.To] = true, true
+		g.Edges = append(g.Edges, e)
+	}
+	for _, t := range tables {
+		n := graphNode{ID: qualifiedName(t), Schema: t.Schema, Name: t.Name}
+		if onlyRelated && !related[n.ID] {
+			continue
+		}
+		for _, col := range t.Columns {
+			n.Columns = append(n.Columns, col.Name)
+		}
+		g.Nodes = append(g.Nodes, n)
+	}
+	return g
+}
+
+func loadSchemaGraph(ctx context.Context, p connParams, onlyRelated bool) (schemaGraph, error) {
+	db, err := openDB(ctx, p)
+	if err != nil {
+		return schemaGraph{}, err
+	}
+	defer db.Close()
+
+	tables, err := schemaTables(ctx, db, p)
+	if err != nil {
+		return schemaGraph{}, err
+	}
+	fks, err := schemaForeignKeys(ctx, db, p)
+	if err != nil {
+		return schemaGraph{}, err
+	}
+	return buildSchemaGraph(tables, fks, onlyRelated), nil
+}
+
+type apiGraphRequest struct {
+	apiTarget
+	OnlyRelated bool `json:"only_related"`
+}
+
+func apiGraph(c *gin.Context) {
+	var req apiGraphRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiQueryTimeout)
+	defer cancel()
+
+	db, p, ok := openTarget(ctx, c, req.apiTarget)
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	tables, err := schemaTables(ctx, db, p)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "schema_failed", err.Error())
+		return
+	}
+	fks, err := schemaForeignKeys(ctx, db, p)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "schema_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, buildSchemaGraph(tables, fks, req.OnlyRelated))
+}
+
+// Diagram layout, in SVG user units.
+const (
+	erdBoxWidth   = 200
+	erdHeader     = 24
+	erdLine       = 16
+	erdGap        = 60
+	erdMaxColumns = 12
+)
+
+type erdText struct {
+	X, Y int
+	Text string
+}
+
+type erdBox struct {
+	X, Y, W, H int
+	Title      erdText
+	Lines      []erdText
+}
+
+type erdLink struct {
+	X1, Y1, X2, Y2 int
+	Label          string
+}
+
+// edgePoint is where the line from the box centre towards (x, y) leaves the box.
+func (b erdBox) edgePoint(x, y int) (int, int) {
+	cx, cy := float64(b.X)+float64(b.W)/2, float64(b.Y)+float64(b.H)/2
+	dx, dy := float64(x)-cx, float64(y)-cy
+	t := math.Inf(1)
+	if dx != 0 {
+		t = float64(b.W) / 2 / math.Abs(dx)
+	}
+	if dy != 0 {
+		t = math.Min(t, float64(b.H)/2/math.Abs(dy))
+	}
+	if math.IsInf(t, 1) {
+		return int(cx), int(cy)
+	}
+	return int(cx + t*dx), int(cy + t*dy)
+}
+
+// layoutDiagram places the tables on a square-ish grid and connects them
+// centre to centre. It is deliberately simple; the JSON graph is there for
+// anyone who needs a real layout engine.
+func layoutDiagram(g schemaGraph) ([]erdBox, []erdLink, int, int) {
+	cols := int(math.Ceil(math.Sqrt(float64(len(g.Nodes)))))
+	if cols == 0 {
+		return nil, nil, 0, 0
+	}
+	boxes := make([]erdBox, len(g.Nodes))
+	index := make(map[string]int, len(g.Nodes))
+	y, rowHeight, width := erdGap/2, 0, 0
+	for i, n := range g.Nodes {
+		if i > 0 && i%cols == 0 {
+			y += rowHeight + erdGap
+			rowHeight = 0
+		}
+		x := erdGap/2 + (i%cols)*(erdBoxWidth+erdGap)
+		b := erdBox{X: x, Y: y, W: erdBoxWidth, Title: erdText{x + 8, y + 17, n.ID}}
+		for j, col := range n.Columns {
+			if j == erdMaxColumns {
+				col = fmt.Sprintf("… %d more", len(n.Columns)-erdMaxColumns)
+			}
+			b.Lines = append(b.Lines, erdText{x + 8, y + erdHeader + (j+1)*erdLine, col})
+			if j == erdMaxColumns {
+				break
+			}
+		}
+		b.H = erdHeader + len(b.Lines)*erdLine + 8
+		rowHeight = max(rowHeight, b.H)
+		width = max(width, b.X+b.W+erdGap/2)
+		boxes[i] = b
+		index[n.ID] = i
+	}
+	height := y + rowHeight + erdGap/2
+
+	var links []erdLink
+	for _, e := range g.Edges {
+		from, ok1 := index[e.From]
+		to, ok2 := index[e.To]
+		if !ok1 || !ok2 {
+			continue
+		}
+		if from == to {
+			// self-references would be a zero-length line
+			continue
+		}
+		a, b := boxes[from], boxes[to]
+		x1, y1 := a.edgePoint(b.X+b.W/2, b.Y+b.H/2)
+		x2, y2 := b.edgePoint(a.X+a.W/2, a.Y+a.H/2)
+		links = append(links, erdLink{
+			X1: x1, Y1: y1, X2: x2, Y2: y2,
+			Label: fmt.Sprintf("%s: %s → %s", e.Name, strings.Join(e.Columns, ", "), strings.Join(e.RefColumns, ", ")),
+		})
+	}
+	return boxes, links, width, height
+}
+
+// diagramHandler renders the foreign key graph of the connection as SVG.
+func diagramHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	g, err := loadSchemaGraph(ctx, p, c.PostForm("all") == "")
+	if err != nil {
+		log.Printf("Schema graph failed: %v", err)
+		renderError(c, http.StatusBadRequest, "erd.html", "Failed to read schema: %v", err)
+		return
+	}
+
+	boxes, links, width, height := layoutDiagram(g)
+	render(c, http.StatusOK, erdView{
+		Boxes:  boxes,
+		Links:  links,
+		Width:  width,
+		Height: height,
+		Tables: len(g.Nodes),
+		Keys:   len(g.Edges),
+	})
+}
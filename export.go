@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parquet-go/parquet-go"
+)
+
+const exportTimeout = 5 * time.Minute
+
+// exportMark identifies one export. The id is embedded in every file and
+// recorded in the audit log, so a leaked extract can be traced back to who
+// ran which query. Visible adds a human-readable watermark as well.
+type exportMark struct {
+	ID      string
+	User    string
+	At      time.Time
+	Visible bool
+}
+
+func (m exportMark) notice() string {
+	return fmt.Sprintf("Exported by %s at %s (export %s). Confidential.", m.User, m.At.Format(time.RFC3339), m.ID)
+}
+
+func exportHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	query := c.PostForm("query")
+	format := c.PostForm("format")
+
+	guard, err := guardQuery(c.Request.Context(), newQueryEvent(c, p, "export", query))
+	if err != nil {
+		c.String(http.StatusForbidden, "%v", err)
+		return
+	}
+	defer guard.doneAfter(c)
+	release, err := acquireQuerySlot(c.Request.Context(), p, "")
+	if err != nil {
+		c.String(http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		c.String(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	rs, err := fetchResult(ctx, db, query)
+	if err == nil {
+		if p.Driver == "postgres" {
+			postgisToGeoJSON(ctx, sqlGeoQueryer(db), rs)
+		}
+		err = p.transcodeRows(rs.Rows)
+	}
+	if err == nil {
+		var loc *time.Location
+		if loc, err = requestZone(c); err == nil {
+			rs.Rows = inZone(rs.Rows, loc)
+		}
+	}
+	if err != nil {
+		log.Printf("Query execution failed: %v", err)
+		c.String(http.StatusBadRequest, "Query error: %v", err)
+		return
+	}
+
+	mark := exportMark{
+		ID:      randomID(8),
+		User:    currentIdentity(c).User,
+		At:      time.Now(),
+		Visible: config.ExportWatermark,
+	}
+
+	switch format {
+	case "parquet":
+		auditExport(c, mark, p, format, query, len(rs.Rows))
+		c.Header("Content-Type", "application/vnd.apache.parquet")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="result-%s.parquet"`, mark.ID))
+		if err := writeParquet(c.Writer, p.Driver, rs, mark); err != nil {
+			log.Printf("Parquet export failed: %v", err)
+			if c.Writer.Written() {
+				abortResponse(c)
+				return
+			}
+			c.String(http.StatusInternalServerError, "Export error: %v", err)
+		}
+	case "sql":
+		table := c.PostForm("table")
+		if table == "" {
+			c.String(http.StatusBadRequest, "Target table name is required")
+			return
+		}
+		batch, err := strconv.Atoi(c.DefaultPostForm("batch", "100"))
+		if err != nil || batch < 1 {
+			c.String(http.StatusBadRequest, "Invalid batch size")
+			return
+		}
+		auditExport(c, mark, p, format, query, len(rs.Rows))
+		c.Header("Content-Type", "application/sql; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="result-%s.sql"`, mark.ID))
+		if err := writeInserts(c.Writer, p.Driver, table, batch, rs, mark); err != nil {
+			log.Printf("SQL export failed: %v", err)
+			if c.Writer.Written() {
+				abortResponse(c)
+				return
+			}
+			c.String(http.StatusInternalServerError, "Export error: %v", err)
+		}
+	case "geojson", "map":
+		auditExport(c, mark, p, format, query, len(rs.Rows))
+		writeGeoExport(c, format, rs, mark)
+	default:
+		c.String(http.StatusBadRequest, "Unsupported export format %q", format)
+	}
+}
+
+// abortResponse ends a download that failed after its first bytes went
+// out. Closing the connection mid-body tells the client the file is
+// incomplete, where an error message would be written into the file.
+func abortResponse(c *gin.Context) {
+	c.Abort()
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		log.Printf("Failed to abort the response: %v", err)
+		return
+	}
+	conn.Close()
+}
+
+func auditExport(c *gin.Context, mark exportMark, p connParams, format, query string, rows int) {
+	recordAudit(c.Request.Context(), auditEntry{
+		At:     mark.At,
+		User:   mark.User,
+		Action: "export",
+		Target: p.auditTarget(),
+		Query:  query,
+		Ref:    mark.ID,
+		Detail: fmt.Sprintf("%s, %d rows", format, rows),
+	})
+}
+
+// writeInserts renders the result as INSERT statements of up to batch rows each.
+func writeInserts(w io.Writer, driver, table string, batch int, rs *resultSet, mark exportMark) error {
+	bw := bufio.NewWriter(w)
+
+	columns := make([]string, len(rs.Columns))
+	for i, col := range rs.Columns {
+		columns[i] = quoteIdent(driver, col)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", quoteIdent(driver, table), strings.Join(columns, ", "))
+
+	fmt.Fprintf(bw, "-- %d rows exported %s\n", len(rs.Rows), mark.At.Format(time.RFC3339))
+	fmt.Fprintf(bw, "-- export id: %s\n", mark.ID)
+	for start := 0; start < len(rs.Rows); start += batch {
+		end := start + batch
+		if end > len(rs.Rows) {
+			end = len(rs.Rows)
+		}
+		bw.WriteString(insert)
+		for i, values := range rs.Rows[start:end] {
+			bw.WriteString("  " + rowLiteral(driver, rs.Types, values))
+			if start+i < end-1 {
+				bw.WriteString(",\n")
+			}
+		}
+		bw.WriteString(";\n")
+	}
+	if mark.Visible {
+		bw.WriteString(sqlComment(mark.notice()))
+	}
+	return bw.Flush()
+}
+
+// rowLiteral renders one row as a parenthesized list of literals.
+func rowLiteral(driver string, types []string, values []interface{}) string {
+	literals := make([]string, len(values))
+	for j, v := range values {
+		literals[j] = sqlLiteral(driver, kindOf(driver, types[j]), v)
+	}
+	return "(" + strings.Join(literals, ", ") + ")"
+}
+
+// sqlLiteral formats a scanned value as a literal the driver will accept back.
+func sqlLiteral(driver, kind string, v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		if driver == "postgres" {
+			return "'" + x.Format("2006-01-02 15:04:05.999999-07:00") + "'"
+		}
+		return "'" + x.Format("2006-01-02 15:04:05.999999") + "'"
+	case uuidValue:
+		// a MySQL BINARY(16) gets its bytes back as they were stored
+		if driver == "mysql" {
+			return "X'" + hex.EncodeToString(x[:]) + "'"
+		}
+		return quoteString(driver, x.String())
+	case sqlArray:
+		switch driver {
+		case "postgres":
+			return quoteString(driver, x.literal())
+		case "clickhouse":
+			items := make([]string, len(x))
+			for i, item := range x {
+				kind := kindString
+				if _, ok := toFloat(item); ok {
+					kind = kindFloat
+				}
+				items[i] = sqlLiteral(driver, kind, item)
+			}
+			return "[" + strings.Join(items, ", ") + "]"
+		}
+		data, _ := json.Marshal(x)
+		return quoteString(driver, string(data))
+	case []byte:
+		h := hex.EncodeToString(x)
+		switch driver {
+		case "postgres":
+			return `'\x` + h + "'"
+		case "clickhouse":
+			return "unhex('" + h + "')"
+		}
+		return "X'" + h + "'"
+	}
+
+	s := fmt.Sprint(v)
+	switch kind {
+	case kindInt, kindUint, kindFloat, kindDecimal:
+		f, err := strconv.ParseFloat(s, 64)
+		switch {
+		case err != nil:
+		case !math.IsNaN(f) && !math.IsInf(f, 0):
+			return s
+		case driver != "postgres":
+			// NaN and infinities have no SQL literal, and only
+			// PostgreSQL can read them back from text
+			return "NULL"
+		case math.IsNaN(f):
+			return "'NaN'"
+		case f > 0:
+			return "'Infinity'"
+		default:
+			return "'-Infinity'"
+		}
+	case kindBool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return sqlLiteral(driver, kind, b)
+		}
+	}
+	return quoteString(driver, s)
+}
+
+func quoteString(driver, s string) string {
+	// MySQL and ClickHouse treat backslash as an escape inside literals
+	if driver == "mysql" || driver == "clickhouse" {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func parquetNode(kind string) parquet.Node {
+	switch kind {
+	case kindInt:
+		return parquet.Int(64)
+	case kindUint:
+		return parquet.Uint(64)
+	case kindFloat:
+		return parquet.Leaf(parquet.DoubleType)
+	case kindBool:
+		return parquet.Leaf(parquet.BooleanType)
+	case kindTime:
+		return parquet.Timestamp(parquet.Microsecond)
+	case kindBinary:
+		return parquet.Leaf(parquet.ByteArrayType)
+	}
+	// Decimals are kept as text so no precision is lost on the way out
+	return parquet.String()
+}
+
+// uniqueNames suffixes repeated column names (e.g. "id" from both sides of a
+// join), since parquet group fields are keyed by name.
+func uniqueNames(columns []string) []string {
+	seen := make(map[string]int)
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		seen[col]++
+		if seen[col] > 1 {
+			names[i] = fmt.Sprintf("%s_%d", col, seen[col])
+		} else {
+			names[i] = col
+		}
+	}
+	return names
+}
+
+// writeParquet converts every row before writing any, so that a value
+// that doesn't fit its column fails the export before the file starts.
+func writeParquet(w io.Writer, driver string, rs *resultSet, mark exportMark) error {
+	names := uniqueNames(rs.Columns)
+	kinds := make([]string, len(names))
+	group := parquet.Group{}
+	for i, name := range names {
+		kinds[i] = kindOf(driver, rs.Types[i])
+		group[name] = parquet.Optional(parquetNode(kinds[i]))
+	}
+	schema := parquet.NewSchema("result", group)
+
+	// Group fields are ordered by name, so map select order to leaf index
+	index := make([]int, len(names))
+	for i, name := range names {
+		leaf, _ := schema.Lookup(name)
+		index[i] = leaf.ColumnIndex
+	}
+
+	rows := make([]parquet.Row, len(rs.Rows))
+	for r, values := range rs.Rows {
+		row := make(parquet.Row, len(names))
+		for i, v := range values {
+			pv, err := parquetValue(kinds[i], v)
+			if err != nil {
+				return fmt.Errorf("row %d, column %s: %w", r+1, names[i], err)
+			}
+			definition := 1
+			if pv.IsNull() {
+				definition = 0
+			}
+			row[index[i]] = pv.Level(0, definition, index[i])
+		}
+		rows[r] = row
+	}
+
+	options := []parquet.WriterOption{schema, parquet.KeyValueMetadata("simpleadmin.export_id", mark.ID)}
+	if mark.Visible {
+		options = append(options, parquet.KeyValueMetadata("simpleadmin.watermark", mark.notice()))
+	}
+	writer := parquet.NewWriter(w, options...)
+	if _, err := writer.WriteRows(rows); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func parquetValue(kind string, v interface{}) (parquet.Value, error) {
+	if v == nil {
+		return parquet.NullValue(), nil
+	}
+	switch kind {
+	case kindInt:
+		n, err := toInt64(v)
+		return parquet.Int64Value(n), err
+	case kindUint:
+		n, err := toUint64(v)
+		return parquet.ValueOf(n), err
+	case kindFloat:
+		f, err := toFloat64(v)
+		return parquet.DoubleValue(f), err
+	case kindBool:
+		b, err := toBool(v)
+		return parquet.BooleanValue(b), err
+	case kindTime:
+		t, err := toTime(v)
+		return parquet.Int64Value(t.UnixMicro()), err
+	case kindBinary:
+		switch b := v.(type) {
+		case []byte:
+			return parquet.ByteArrayValue(b), nil
+		case uuidValue:
+			return parquet.ByteArrayValue(b[:]), nil
+		}
+	}
+	return parquet.ByteArrayValue([]byte(fmt.Sprint(v))), nil
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case string:
+		return strconv.ParseInt(x, 10, 64)
+	case []byte:
+		return strconv.ParseInt(string(x), 10, 64)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to integer", v)
+}
+
+func toUint64(v interface{}) (uint64, error) {
+	switch x := v.(type) {
+	case string:
+		return strconv.ParseUint(x, 10, 64)
+	case []byte:
+		return strconv.ParseUint(string(x), 10, 64)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(rv.Int()), nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to unsigned integer", v)
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case string:
+		return strconv.ParseFloat(x, 64)
+	case []byte:
+		return strconv.ParseFloat(string(x), 64)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	}
+	return 0, fmt.Errorf("cannot convert %T to float", v)
+}
+
+func toBool(v interface{}) (bool, error) {
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case string:
+		return strconv.ParseBool(x)
+	case []byte:
+		return strconv.ParseBool(string(x))
+	}
+	n, err := toInt64(v)
+	return n != 0, err
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+func toTime(v interface{}) (time.Time, error) {
+	var s string
+	switch x := v.(type) {
+	case time.Time:
+		return x, nil
+	case string:
+		s = x
+	case []byte:
+		s = string(x)
+	default:
+		return time.Time{}, fmt.Errorf("cannot convert %T to time", v)
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as time", s)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	findValueTimeout = time.Minute
+	// findColumnTimeout bounds each column, so one unindexed giant table
+	// doesn't use up the whole search
+	findColumnTimeout = 5 * time.Second
+	findMaxColumns    = 500
+	// findMaxCount is where counting matches stops
+	findMaxCount = 100
+)
+
+// valueMatch is a column holding the searched value.
+type valueMatch struct {
+	Table  string
+	Column string
+	Type   string
+	// Count is the number of matching rows up to findMaxCount
+	Count int64
+	Link  rowLink
+}
+
+// findArg converts the searched text to a bind value comparable with a
+// column of the kind, or returns false when the column can't hold it.
+func findArg(kind, text string, partial bool) (interface{}, bool) {
+	if partial {
+		return "%" + text + "%", kind == kindString
+	}
+	switch kind {
+	case kindString:
+		return text, true
+	case kindInt:
+		n, err := strconv.ParseInt(text, 10, 64)
+		return n, err == nil
+	case kindUint:
+		n, err := strconv.ParseUint(text, 10, 64)
+		return n, err == nil
+	case kindFloat, kindDecimal:
+		f, err := strconv.ParseFloat(text, 64)
+		return f, err == nil
+	}
+	return nil, false
+}
+
+// nameMatches reports whether name matches a glob like "*order*"; an empty
+// pattern matches everything.
+func nameMatches(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return err == nil && ok
+}
+
+// countValue counts the rows of one column holding the value, stopping at
+// findMaxCount so an index lookup stays cheap.
+func countValue(ctx context.Context, q rowQueryer, driver string, table tableInfo, column string, arg interface{}, partial bool) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, findColumnTimeout)
+	defer cancel()
+	op := " = "
+	if partial {
+		op = " LIKE "
+	}
+	query := fmt.Sprintf("SELECT COUNT(*) FROM (SELECT 1 FROM %s WHERE %s%s%s LIMIT %d) found",
+		quoteIdent(driver, qualifiedName(table)), quoteIdent(driver, column), op, placeholder(driver, 1), findMaxCount)
+	rows, err := q.QueryContext(ctx, query, arg)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var n int64
+	if rows.Next() {
+		if err := rows.Scan(&n); err != nil {
+			return 0, err
+		}
+	}
+	return n, rows.Err()
+}
+
+// findValueHandler searches every type-compatible column of the connected
+// database for a value and lists where it occurs.
+func findValueHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	value := strings.TrimSpace(c.PostForm("value"))
+	tablePattern := strings.TrimSpace(c.PostForm("table_pattern"))
+	columnPattern := strings.TrimSpace(c.PostForm("column_pattern"))
+	partial := c.PostForm("partial") != ""
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "findvalue.html", format, args...)
+	}
+	if value == "" {
+		fail(http.StatusBadRequest, "Enter a value to look for")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), findValueTimeout)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	tables, err := schemaTables(ctx, db, p)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Failed to read columns: %v", err)
+		return
+	}
+
+	v := findValueView{Value: value, Partial: partial}
+	started := time.Now()
+	for _, table := range tables {
+		if !nameMatches(tablePattern, table.Name) && !nameMatches(tablePattern, qualifiedName(table)) {
+			continue
+		}
+		for _, col := range table.Columns {
+			if !nameMatches(columnPattern, col.Name) {
+				continue
+			}
+			arg, ok := findArg(kindOf(p.Driver, col.Type), value, partial)
+			if !ok {
+				continue
+			}
+			if v.Searched == findMaxColumns || ctx.Err() != nil {
+				v.Incomplete = true
+				break
+			}
+			v.Searched++
+			n, err := countValue(ctx, db, p.Driver, table, col.Name, arg, partial)
+			if err != nil {
+				v.Failed = append(v.Failed, fmt.Sprintf("%s.%s: %v", qualifiedName(table), col.Name, err))
+				continue
+			}
+			if n == 0 {
+				continue
+			}
+			m := valueMatch{Table: qualifiedName(table), Column: col.Name, Type: col.Type, Count: n}
+			if !partial {
+				m.Link, _ = newRowLink(table, []string{col.Name}, []interface{}{value}, p.Driver)
+			}
+			v.Matches = append(v.Matches, m)
+		}
+	}
+	v.Elapsed = time.Since(started)
+	render(c, http.StatusOK, v)
+}
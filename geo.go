@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// geoJSONType marks a column rewritten to GeoJSON text.
+const geoJSONType = "geojson"
+
+// postgisTypesQuery picks the PostGIS types out of a result's unknown type
+// OIDs; the OIDs are assigned when the extension is created, so they differ
+// between databases.
+const postgisTypesQuery = `SELECT oid::text, typname FROM pg_type
+	WHERE typname IN ('geometry', 'geography') AND oid::text = ANY($1::text[])`
+
+// geoJSONValuesQuery converts hex EWKB values to GeoJSON, keeping their order.
+const geoJSONValuesQuery = `SELECT ST_AsGeoJSON(g::%s) FROM unnest($1::text[]) WITH ORDINALITY AS t(g, n) ORDER BY n`
+
+// geoQueryer runs one of the queries above and returns its rows as text,
+// NULL as nil.
+type geoQueryer func(ctx context.Context, query string, args ...interface{}) ([][]*string, error)
+
+func sqlGeoQueryer(db rowQueryer) geoQueryer {
+	return func(ctx context.Context, query string, args ...interface{}) ([][]*string, error) {
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		columns, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		var out [][]*string
+		for rows.Next() {
+			values := make([]sql.NullString, len(columns))
+			dest := make([]interface{}, len(columns))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				return nil, err
+			}
+			row := make([]*string, len(columns))
+			for i, v := range values {
+				if v.Valid {
+					row[i] = &v.String
+				}
+			}
+			out = append(out, row)
+		}
+		return out, rows.Err()
+	}
+}
+
+func poolGeoQueryer(pool *pgxpool.Pool) geoQueryer {
+	return func(ctx context.Context, query string, args ...interface{}) ([][]*string, error) {
+		rows, err := pool.Query(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var out [][]*string
+		for rows.Next() {
+			row := make([]*string, len(rows.FieldDescriptions()))
+			dest := make([]interface{}, len(row))
+			for i := range row {
+				dest[i] = &row[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				return nil, err
+			}
+			out = append(out, row)
+		}
+		return out, rows.Err()
+	}
+}
+
+// postgisToGeoJSON rewrites the PostGIS columns of a PostgreSQL result to
+// GeoJSON and marks them. The query itself runs as written, so its ORDER BY
+// holds. pgx names the types it doesn't know by their OID and PostGIS types
+// are never known, so a result without such a column costs no round-trip;
+// otherwise one finds the PostGIS types and one per PostGIS column converts
+// its values. Any failure leaves the values as the server sent them.
+func postgisToGeoJSON(ctx context.Context, q geoQueryer, rs *resultSet) {
+	var unknown []string
+	for _, t := range rs.Types {
+		if t != "" && strings.Trim(t, "0123456789") == "" {
+			unknown = append(unknown, t)
+		}
+	}
+	if len(unknown) == 0 {
+		return
+	}
+	found, err := q(ctx, postgisTypesQuery, unknown)
+	if err != nil {
+		return
+	}
+	postgis := make(map[string]string)
+	for _, row := range found {
+		if row[0] != nil && row[1] != nil {
+			postgis[*row[0]] = *row[1]
+		}
+	}
+	for i, t := range rs.Types {
+		typname, ok := postgis[t]
+		if !ok {
+			continue
+		}
+		// NULLs stay out of the conversion and in place
+		var at []int
+		var values []string
+		for r, row := range rs.Rows {
+			switch x := row[i].(type) {
+			case string:
+				at, values = append(at, r), append(values, x)
+			case []byte:
+				at, values = append(at, r), append(values, string(x))
+			}
+		}
+		converted, err := q(ctx, fmt.Sprintf(geoJSONValuesQuery, typname), values)
+		if err != nil || len(converted) != len(values) {
+			continue
+		}
+		for j, r := range at {
+			rs.Rows[r][i] = nil
+			if g := converted[j][0]; g != nil {
+				rs.Rows[r][i] = *g
+			}
+		}
+		rs.Types[i] = geoJSONType
+	}
+}
+
+// geoJSONTypes are the geometry types a GeoJSON geometry object can have.
+var geoJSONTypes = map[string]bool{
+	"Point": true, "MultiPoint": true, "LineString": true, "MultiLineString": true,
+	"Polygon": true, "MultiPolygon": true, "GeometryCollection": true,
+}
+
+// asGeometry returns a cell as a GeoJSON geometry object, whether PostGIS
+// was rewritten or the query called ST_AsGeoJSON itself.
+func asGeometry(v interface{}) (json.RawMessage, bool) {
+	var data []byte
+	switch x := v.(type) {
+	case string:
+		data = []byte(x)
+	case []byte:
+		data = x
+	default:
+		return nil, false
+	}
+	if !looksLikeJSON(string(data)) {
+		return nil, false
+	}
+	var g struct {
+		Type string `json:"type"`
+	}
+	if json.Unmarshal(data, &g) != nil || !geoJSONTypes[g.Type] {
+		return nil, false
+	}
+	return json.RawMessage(data), true
+}
+
+// geoFeature is one GeoJSON feature: the first geometry of a row with the
+// other columns as properties.
+type geoFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// geoFeatureCollection carries the export id, and the watermark when
+// configured, as foreign members that GeoJSON readers ignore.
+type geoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []geoFeature `json:"features"`
+	Export   string       `json:"export,omitempty"`
+	Notice   string       `json:"notice,omitempty"`
+}
+
+// geoFeatures turns the rows that have a geometry into features; the rest
+// are skipped, since a map can't place them.
+func geoFeatures(rs *resultSet) geoFeatureCollection {
+	fc := geoFeatureCollection{Type: "FeatureCollection", Features: []geoFeature{}}
+	for _, row := range rs.Rows {
+		f := geoFeature{Type: "Feature", Properties: make(map[string]interface{}, len(row))}
+		for i, v := range row {
+			if f.Geometry == nil {
+				if g, ok := asGeometry(v); ok {
+					f.Geometry = g
+					continue
+				}
+			}
+			switch x := v.(type) {
+			case time.Time:
+				v = x.Format(time.RFC3339Nano)
+			case []byte:
+				v = displayBinary(x)
+			}
+			f.Properties[rs.Columns[i]] = v
+		}
+		if f.Geometry != nil {
+			fc.Features = append(fc.Features, f)
+		}
+	}
+	return fc
+}
+
+// writeGeoExport answers the "geojson" and "map" export formats: the
+// features as a file, or a page drawing them over OpenStreetMap.
+func writeGeoExport(c *gin.Context, format string, rs *resultSet, mark exportMark) {
+	fc := geoFeatures(rs)
+	if len(fc.Features) == 0 {
+		c.String(http.StatusBadRequest, "The result has no geometry column; select a PostGIS column or ST_AsGeoJSON(...)")
+		return
+	}
+	fc.Export = mark.ID
+	if mark.Visible {
+		fc.Notice = mark.notice()
+	}
+	data, err := json.Marshal(fc)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Export error: %v", err)
+		return
+	}
+	if format == "map" {
+		render(c, http.StatusOK, mapView{
+			Features: json.RawMessage(data),
+			Count:    len(fc.Features),
+			Skipped:  len(rs.Rows) - len(fc.Features),
+			Notice:   fc.Notice,
+		})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="result-%s.geojson"`, mark.ID))
+	c.Data(http.StatusOK, "application/geo+json", data)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dbAccount is a user or role with its privileges, one grant per line.
+type dbAccount struct {
+	Name   string
+	Host   string
+	Login  bool
+	Super  bool
+	Member string
+	Grants []string
+}
+
+// grantPrivileges are the privileges the form offers.
+var grantPrivileges = []string{"SELECT", "INSERT", "UPDATE", "DELETE", "ALL PRIVILEGES"}
+
+func listAccounts(ctx context.Context, db *sql.DB, driver string) ([]dbAccount, error) {
+	switch driver {
+	case "postgres":
+		return listPostgresRoles(ctx, db)
+	case "mysql":
+		return listMySQLUsers(ctx, db)
+	}
+	return nil, fmt.Errorf("user management is not supported for %q", driver)
+}
+
+func listPostgresRoles(ctx context.Context, db *sql.DB) ([]dbAccount, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT r.rolname, r.rolcanlogin, r.rolsuper,
+		       COALESCE((SELECT string_agg(g.rolname, ', ' ORDER BY g.rolname)
+		                 FROM pg_auth_members m JOIN pg_roles g ON g.oid = m.roleid
+		                 WHERE m.member = r.oid), '')
+		FROM pg_roles r
+		WHERE r.rolname NOT LIKE 'pg\_%'
+		ORDER BY r.rolname`)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []dbAccount
+	index := make(map[string]int)
+	for rows.Next() {
+		var a dbAccount
+		if err := rows.Scan(&a.Name, &a.Login, &a.Super, &a.Member); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[a.Name] = len(accounts)
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT grantee, table_schema, table_name, string_agg(privilege_type, ', ' ORDER BY privilege_type)
+		FROM information_schema.role_table_grants
+		WHERE table_schema NOT IN ('pg_catalog', 'information_schema')
+		GROUP BY grantee, table_schema, table_name
+		ORDER BY grantee, table_schema, table_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var grantee, schema, table, privileges string
+		if err := rows.Scan(&grantee, &schema, &table, &privileges); err != nil {
+			return nil, err
+		}
+		if i, ok := index[grantee]; ok {
+			accounts[i].Grants = append(accounts[i].Grants, fmt.Sprintf("%s ON %s.%s", privileges, schema, table))
+		}
+	}
+	return accounts, rows.Err()
+}
+
+func listMySQLUsers(ctx context.Context, db *sql.DB) ([]dbAccount, error) {
+	rows, err := db.QueryContext(ctx, "SELECT user, host, super_priv = 'Y' FROM mysql.user ORDER BY user, host")
+	if err != nil {
+		return nil, err
+	}
+	var accounts []dbAccount
+	for rows.Next() {
+		a := dbAccount{Login: true}
+		if err := rows.Scan(&a.Name, &a.Host, &a.Super); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, a := range accounts {
+		grants, err := db.QueryContext(ctx, "SHOW GRANTS FOR "+mysqlAccount(a.Name, a.Host))
+		if err != nil {
+			return nil, err
+		}
+		for grants.Next() {
+			var line string
+			if err := grants.Scan(&line); err != nil {
+				grants.Close()
+				return nil, err
+			}
+			accounts[i].Grants = append(accounts[i].Grants, line)
+		}
+		grants.Close()
+	}
+	return accounts, nil
+}
+
+func mysqlAccount(user, host string) string {
+	if host == "" {
+		host = "%"
+	}
+	return quoteString("mysql", user) + "@" + quoteString("mysql", host)
+}
+
+// quoteRole quotes a PostgreSQL role name, which may contain dots.
+func quoteRole(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// grantRequest is what the form asks for. Table empty means every table
+// of the database (MySQL) or of Schema (PostgreSQL).
+type grantRequest struct {
+	Action     string
+	User       string
+	Host       string
+	Password   string
+	Privileges []string
+	Schema     string
+	Table      string
+}
+
+// grantStatements generates the statements for the request. Every name is
+// quoted and the privileges come from grantPrivileges, so nothing typed
+// into the form reaches the server unquoted.
+func grantStatements(driver, database string, req grantRequest) ([]string, error) {
+	if req.User == "" {
+		return nil, fmt.Errorf("enter a user name")
+	}
+	var account string
+	switch driver {
+	case "postgres":
+		account = quoteRole(req.User)
+	case "mysql":
+		account = mysqlAccount(req.User, req.Host)
+	default:
+		return nil, fmt.Errorf("user management is not supported for %q", driver)
+	}
+
+	if req.Action == "create" {
+		if req.Password == "" {
+			return nil, fmt.Errorf("enter a password for the new user")
+		}
+		if driver == "postgres" {
+			return []string{fmt.Sprintf("CREATE ROLE %s LOGIN PASSWORD %s", account, quoteString(driver, req.Password))}, nil
+		}
+		return []string{fmt.Sprintf("CREATE USER %s IDENTIFIED BY %s", account, quoteString(driver, req.Password))}, nil
+	}
+
+	if len(req.Privileges) == 0 {
+		return nil, fmt.Errorf("choose at least one privilege")
+	}
+	for _, priv := range req.Privileges {
+		if !containsString(grantPrivileges, priv) {
+			return nil, fmt.Errorf("unknown privilege %q", priv)
+		}
+	}
+	privileges := strings.Join(req.Privileges, ", ")
+	if containsString(req.Privileges, "ALL PRIVILEGES") {
+		privileges = "ALL PRIVILEGES"
+	}
+
+	schema := req.Schema
+	if schema == "" {
+		schema = "public"
+	}
+	var object string
+	switch {
+	case req.Table != "":
+		object = quoteIdent(driver, req.Table)
+		if driver == "postgres" {
+			object = "TABLE " + object
+		} else if !strings.Contains(req.Table, ".") {
+			object = quoteIdent(driver, database) + "." + object
+		}
+	case driver == "postgres":
+		object = "ALL TABLES IN SCHEMA " + quoteIdent(driver, schema)
+	default:
+		if database == "" {
+			return nil, fmt.Errorf("choose a database or a table")
+		}
+		object = quoteIdent(driver, database) + ".*"
+	}
+
+	switch req.Action {
+	case "grant":
+		var stmts []string
+		if driver == "postgres" && req.Table == "" {
+			stmts = append(stmts, fmt.Sprintf("GRANT USAGE ON SCHEMA %s TO %s", quoteIdent(driver, schema), account))
+		}
+		return append(stmts, fmt.Sprintf("GRANT %s ON %s TO %s", privileges, object, account)), nil
+	case "revoke":
+		return []string{fmt.Sprintf("REVOKE %s ON %s FROM %s", privileges, object, account)}, nil
+	}
+	return nil, fmt.Errorf("unknown action %q", req.Action)
+}
+
+// accountsHandler lists users and their privileges with the form to
+// change them.
+func accountsHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "accounts.html", format, args...)
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	accounts, err := listAccounts(ctx, db, p.Driver)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to list users: %v", err)
+		return
+	}
+	render(c, http.StatusOK, accountsView{
+		Accounts:   accounts,
+		Privileges: grantPrivileges,
+		MySQL:      p.Driver == "mysql",
+	})
+}
+
+// grantHandler previews the generated statements and runs them once the
+// previewed statements are confirmed. The password is masked on the page
+// and in the audit log.
+func grantHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	req := grantRequest{
+		Action:     c.PostForm("action"),
+		User:       strings.TrimSpace(c.PostForm("user")),
+		Host:       strings.TrimSpace(c.PostForm("host")),
+		Password:   c.PostForm("password"),
+		Privileges: c.PostFormArray("privilege"),
+		Schema:     strings.TrimSpace(c.PostForm("schema")),
+		Table:      strings.TrimSpace(c.PostForm("object")),
+	}
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "grantplan.html", format, args...)
+	}
+
+	stmts, err := grantStatements(p.Driver, p.Database, req)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	st := rowStatement{Query: strings.Join(stmts, ";\n")}
+	shown := st.Query
+	if req.Password != "" {
+		shown = strings.ReplaceAll(shown, quoteString(p.Driver, req.Password), "'********'")
+	}
+	if c.PostForm("confirm") != st.Digest() {
+		render(c, http.StatusOK, grantPlanView{Statements: shown, Digest: st.Digest()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	// MySQL commits account statements implicitly; on PostgreSQL they are
+	// all or nothing
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		fail(http.StatusServiceUnavailable, "Failed to start a transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+	for i, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			fail(http.StatusBadRequest, "Statement %d of %d failed: %v", i+1, len(stmts), err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		fail(http.StatusBadRequest, "Commit failed: %v", err)
+		return
+	}
+
+	user := currentIdentity(c).User
+	log.Printf("%s ran %s for %s on %s", user, req.Action, req.User, p.address())
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "account_" + req.Action,
+		Target: p.auditTarget(),
+		Query:  shown,
+		Detail: req.User,
+	})
+	render(c, http.StatusOK, grantPlanView{Done: true, Statements: shown})
+}
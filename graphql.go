@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// jsonScalar passes result values through untouched, since a column can hold
+// anything from integers to nested arrays.
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:         "JSON",
+	Description:  "Any JSON value",
+	Serialize:    func(v interface{}) interface{} { return v },
+	ParseValue:   func(v interface{}) interface{} { return v },
+	ParseLiteral: func(v ast.Value) interface{} { return v.GetValue() },
+})
+
+var (
+	graphqlOnce   sync.Once
+	graphqlSchema graphql.Schema
+	graphqlErr    error
+)
+
+// graphqlIdentityKey carries the caller's identity to the resolvers, which
+// only see the context.
+type graphqlIdentityKey struct{}
+
+func graphqlIdentity(ctx context.Context) *identity {
+	if id, ok := ctx.Value(graphqlIdentityKey{}).(*identity); ok {
+		return id
+	}
+	return &identity{User: "anonymous"}
+}
+
+// withConnection opens the saved connection named by the "connection" argument.
+func withConnection(p graphql.ResolveParams, fn func(ctx context.Context, db *sql.DB, cp connParams) (interface{}, error)) (interface{}, error) {
+	ctx := p.Context
+	sc, err := getConnection(ctx, p.Args["connection"].(string))
+	if err != nil {
+		return nil, err
+	}
+	db, err := openDB(ctx, sc.connParams)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return fn(ctx, db, sc.connParams)
+}
+
+func tableToMap(t tableInfo) map[string]interface{} {
+	columns := make([]map[string]interface{}, len(t.Columns))
+	for i, col := range t.Columns {
+		columns[i] = map[string]interface{}{
+			"name":     col.Name,
+			"type":     col.Type,
+			"nullable": col.Nullable,
+			"default":  col.Default,
+		}
+	}
+	return map[string]interface{}{
+		"schema":  t.Schema,
+		"name":    t.Name,
+		"columns": columns,
+	}
+}
+
+func buildGraphQLSchema() (graphql.Schema, error) {
+	connectionArg := graphql.FieldConfigArgument{
+		"connection": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+	}
+
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Connection",
+		Fields: graphql.Fields{
+			"name":     &graphql.Field{Type: graphql.String},
+			"driver":   &graphql.Field{Type: graphql.String},
+			"server":   &graphql.Field{Type: graphql.String},
+			"username": &graphql.Field{Type: graphql.String},
+			"database": &graphql.Field{Type: graphql.String},
+		},
+	})
+	columnType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Column",
+		Fields: graphql.Fields{
+			"name":     &graphql.Field{Type: graphql.String},
+			"type":     &graphql.Field{Type: graphql.String},
+			"nullable": &graphql.Field{Type: graphql.Boolean},
+			"default":  &graphql.Field{Type: graphql.String},
+		},
+	})
+	tableType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Table",
+		Fields: graphql.Fields{
+			"schema":  &graphql.Field{Type: graphql.String},
+			"name":    &graphql.Field{Type: graphql.String},
+			"columns": &graphql.Field{Type: graphql.NewList(columnType)},
+		},
+	})
+	resultType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "QueryResult",
+		Fields: graphql.Fields{
+			"columns":      &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"types":        &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"rows":         &graphql.Field{Type: graphql.NewList(graphql.NewList(jsonScalar))},
+			"rowsAffected": &graphql.Field{Type: jsonScalar},
+			// truncated is set when the rows stop at the max_rows cap
+			"truncated": &graphql.Field{Type: graphql.Boolean},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"connections": &graphql.Field{
+				Type: graphql.NewList(connectionType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					conns, err := listConnections(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					out := make([]map[string]interface{}, len(conns))
+					for i, sc := range conns {
+						out[i] = map[string]interface{}{
+							"name":     sc.Name,
+							"driver":   sc.Driver,
+							"server":   sc.Server,
+							"username": sc.Username,
+							"database": sc.Database,
+						}
+					}
+					return out, nil
+				},
+			},
+			"databases": &graphql.Field{
+				Type: graphql.NewList(graphql.String),
+				Args: connectionArg,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return withConnection(p, func(ctx context.Context, db *sql.DB, cp connParams) (interface{}, error) {
+						return listDatabases(ctx, db, cp.Driver)
+					})
+				},
+			},
+			"tables": &graphql.Field{
+				Type: graphql.NewList(tableType),
+				Args: connectionArg,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return withConnection(p, func(ctx context.Context, db *sql.DB, cp connParams) (interface{}, error) {
+						tables, err := schemaTables(ctx, db, cp)
+						if err != nil {
+							return nil, err
+						}
+						out := make([]map[string]interface{}, len(tables))
+						for i, t := range tables {
+							out[i] = tableToMap(t)
+						}
+						return out, nil
+					})
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"query": &graphql.Field{
+				Type: resultType,
+				Args: graphql.FieldConfigArgument{
+					"connection": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"sql":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return withConnection(p, func(ctx context.Context, db *sql.DB, cp connParams) (interface{}, error) {
+						stmt := p.Args["sql"].(string)
+						guard, err := guardQuery(ctx, identityQueryEvent(graphqlIdentity(ctx), cp, "graphql", stmt))
+						if err != nil {
+							return nil, err
+						}
+						release, err := acquireQuerySlot(ctx, cp, "")
+						if err != nil {
+							return nil, err
+						}
+						defer release()
+						if !returnsRows(stmt) {
+							res, err := db.ExecContext(ctx, stmt)
+							guard.done(err)
+							if err != nil {
+								return nil, err
+							}
+							affected, _ := res.RowsAffected()
+							return map[string]interface{}{"rowsAffected": affected}, nil
+						}
+						rs, err := fetchResultMax(ctx, db, config.MaxRows, stmt)
+						guard.done(err)
+						if err != nil {
+							return nil, err
+						}
+						return map[string]interface{}{
+							"columns":   rs.Columns,
+							"types":     rs.Types,
+							"rows":      rs.Rows,
+							"truncated": rs.Truncated,
+						}, nil
+					})
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func graphqlHandler(c *gin.Context) {
+	graphqlOnce.Do(func() { graphqlSchema, graphqlErr = buildGraphQLSchema() })
+	if graphqlErr != nil {
+		log.Printf("GraphQL schema error: %v", graphqlErr)
+		apiError(c, http.StatusInternalServerError, "internal", graphqlErr.Error())
+		return
+	}
+
+	var req struct {
+		Query         string                 `json:"query"`
+		Variables     map[string]interface{} `json:"variables"`
+		OperationName string                 `json:"operationName"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), apiQueryTimeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, graphqlIdentityKey{}, currentIdentity(c))
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        ctx,
+	})
+	c.JSON(http.StatusOK, result)
+}
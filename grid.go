@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const gridPageSize = 50
+
+// gridFilter is one column filter typed into the grid header. The text is
+// a value to match, optionally prefixed with an operator (=, !=, <, <=, >,
+// >=); a value containing % is a LIKE pattern, "null" / "!null" test for
+// NULL, and "now" or "today", optionally minus an amount like "-7d", is a
+// time relative to when the filter runs.
+type gridFilter struct {
+	Column string `json:"column"`
+	Text   string `json:"text"`
+}
+
+// relativeTime parses "now", "today", "now-12h" or "today-7d"; units are
+// s, m, h, d and w.
+func relativeTime(text string, now time.Time) (time.Time, bool) {
+	lower := strings.ToLower(text)
+	var base time.Time
+	switch {
+	case strings.HasPrefix(lower, "now"):
+		base, lower = now, lower[len("now"):]
+	case strings.HasPrefix(lower, "today"):
+		y, m, d := now.Date()
+		base, lower = time.Date(y, m, d, 0, 0, 0, 0, now.Location()), lower[len("today"):]
+	default:
+		return time.Time{}, false
+	}
+	if lower == "" {
+		return base, true
+	}
+	if len(lower) < 3 || lower[0] != '-' {
+		return time.Time{}, false
+	}
+	n, err := strconv.Atoi(lower[1 : len(lower)-1])
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	unit := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	d, ok := unit[lower[len(lower)-1]]
+	if !ok {
+		return time.Time{}, false
+	}
+	if d >= 24*time.Hour {
+		return base.AddDate(0, 0, -n*int(d/(24*time.Hour))), true
+	}
+	return base.Add(-time.Duration(n) * d), true
+}
+
+// condition renders the filter against a quoted column, appending its
+// argument to args.
+func (f gridFilter) condition(driver, column string, args []interface{}) (string, []interface{}) {
+	text := strings.TrimSpace(f.Text)
+	switch strings.ToLower(text) {
+	case "null":
+		return column + " IS NULL", args
+	case "!null":
+		return column + " IS NOT NULL", args
+	}
+	op := "="
+	for _, prefix := range []string{">=", "<=", "!=", "<>", "=", ">", "<"} {
+		if strings.HasPrefix(text, prefix) {
+			op, text = prefix, strings.TrimSpace(text[len(prefix):])
+			break
+		}
+	}
+	if op == "=" && strings.Contains(text, "%") {
+		op = "LIKE"
+	}
+	if t, ok := relativeTime(text, time.Now()); ok {
+		args = append(args, keyValue(driver, t))
+		return fmt.Sprintf("%s %s %s", column, op, placeholder(driver, len(args))), args
+	}
+	args = append(args, text)
+	return fmt.Sprintf("%s %s %s", column, op, placeholder(driver, len(args))), args
+}
+
+// gridState is everything needed to render one page; it round-trips
+// through hidden fields of the grid form.
+type gridState struct {
+	Table   string
+	Sort    string
+	Desc    bool
+	Filters []gridFilter
+	// Cursor is where the page starts: encoded key values in keyset mode,
+	// an offset otherwise. History holds the cursors of earlier pages.
+	Cursor  string
+	History []string
+}
+
+func encodeCursor(values []string) string {
+	data, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) ([]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var values []string
+	err = json.Unmarshal(data, &values)
+	return values, err
+}
+
+// keyValue turns a scanned key value into a bind argument that compares
+// the same way on the server.
+func keyValue(driver string, v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		if driver == "postgres" {
+			return t.Format("2006-01-02 15:04:05.999999-07:00")
+		}
+		return t.Format("2006-01-02 15:04:05.999999")
+	}
+	return fmt.Sprint(v)
+}
+
+// gridQuery builds the page query. Keyset pagination continues after the
+// cursor's key with a row-value comparison on (sort column, primary key...),
+// which needs every key column to be non-null; otherwise it pages by offset.
+func gridQuery(driver string, table tableInfo, pk []string, st gridState) (query string, args []interface{}, key []string, err error) {
+	nullable := make(map[string]bool, len(table.Columns))
+	for _, col := range table.Columns {
+		nullable[col.Name] = col.Nullable
+	}
+
+	if len(pk) > 0 {
+		key = append(key, pk...)
+		if st.Sort != "" && !containsString(pk, st.Sort) {
+			key = append([]string{st.Sort}, key...)
+		}
+		for _, col := range key {
+			if nullable[col] {
+				key = nil
+				break
+			}
+		}
+	}
+
+	var where []string
+	for _, f := range st.Filters {
+		var cond string
+		cond, args = f.condition(driver, quoteIdent(driver, f.Column), args)
+		where = append(where, cond)
+	}
+
+	dir, cmp := "ASC", ">"
+	if st.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	var order []string
+	if key == nil && st.Sort != "" {
+		order = append(order, quoteIdent(driver, st.Sort)+" "+dir)
+	}
+	quotedKey := make([]string, len(key))
+	for i, col := range key {
+		quotedKey[i] = quoteIdent(driver, col)
+		order = append(order, quotedKey[i]+" "+dir)
+	}
+
+	offset := 0
+	if st.Cursor != "" {
+		if key != nil {
+			values, err := decodeCursor(st.Cursor)
+			if err != nil || len(values) != len(key) {
+				return "", nil, nil, fmt.Errorf("invalid page cursor")
+			}
+			marks := make([]string, len(values))
+			for i, v := range values {
+				args = append(args, v)
+				marks[i] = placeholder(driver, len(args))
+			}
+			where = append(where, fmt.Sprintf("(%s) %s (%s)",
+				strings.Join(quotedKey, ", "), cmp, strings.Join(marks, ", ")))
+		} else if offset, err = strconv.Atoi(st.Cursor); err != nil || offset < 0 {
+			return "", nil, nil, fmt.Errorf("invalid page cursor")
+		}
+	}
+
+	query = "SELECT * FROM " + quoteIdent(driver, qualifiedName(table))
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if len(order) > 0 {
+		query += " ORDER BY " + strings.Join(order, ", ")
+	}
+	// one extra row tells whether there is a next page
+	query += fmt.Sprintf(" LIMIT %d", gridPageSize+1)
+	if offset > 0 {
+		query += fmt.Sprintf(" OFFSET %d", offset)
+	}
+	return query, args, key, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// gridStateFromForm reads the grid form and applies the clicked action:
+// resort=<column> sorts (toggling direction on the current column), and
+// nav=first|next|prev moves between pages.
+func gridStateFromForm(c *gin.Context, table tableInfo) gridState {
+	st := gridState{
+		Table:  c.PostForm("table"),
+		Sort:   c.PostForm("sort"),
+		Desc:   c.PostForm("desc") != "",
+		Cursor: c.PostForm("cursor"),
+	}
+	if h := c.PostForm("history"); h != "" {
+		st.History = strings.Split(h, " ")
+		for i, cursor := range st.History {
+			if cursor == "." {
+				st.History[i] = ""
+			}
+		}
+	}
+	for _, col := range table.Columns {
+		if text := c.PostForm("filter." + col.Name); strings.TrimSpace(text) != "" {
+			st.Filters = append(st.Filters, gridFilter{Column: col.Name, Text: text})
+		}
+	}
+	if st.Sort != "" {
+		if _, ok := findColumn(table, st.Sort); !ok {
+			st.Sort = ""
+		}
+	}
+
+	if col := c.PostForm("resort"); col != "" {
+		if _, ok := findColumn(table, col); ok {
+			st.Desc = col == st.Sort && !st.Desc
+			st.Sort = col
+		}
+		st.Cursor, st.History = "", nil
+	}
+	switch c.PostForm("nav") {
+	case "first":
+		st.Cursor, st.History = "", nil
+	case "next":
+		st.History = append(st.History, st.Cursor)
+		st.Cursor = c.PostForm("next")
+	case "prev":
+		if n := len(st.History); n > 0 {
+			st.Cursor, st.History = st.History[n-1], st.History[:n-1]
+		}
+	}
+	return st
+}
+
+func findColumn(t tableInfo, name string) (columnInfo, bool) {
+	for _, col := range t.Columns {
+		if col.Name == name {
+			return col, true
+		}
+	}
+	return columnInfo{}, false
+}
+
+type gridHeader struct {
+	Name   string
+	Filter string
+	Sorted string
+}
+
+// browseTableHandler shows a page of a table with sorting and filtering.
+func browseTableHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name := c.PostForm("table")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "grid.html", format, args...)
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	tables, err := schemaTables(ctx, db, p)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to read columns: %v", err)
+		return
+	}
+	table, ok := findTable(tables, name)
+	if !ok {
+		fail(http.StatusNotFound, "Table not found: %s", name)
+		return
+	}
+	schema, _ := splitTableName(name)
+	pk, err := primaryKey(ctx, db, p.Driver, schema, table.Name)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to read primary key: %v", err)
+		return
+	}
+
+	st := gridStateFromForm(c, table)
+	presetNote, err := applyPresetAction(ctx, c, p, table, &st)
+	if err != nil {
+		presetNote = "Preset: " + err.Error()
+	}
+	presets, err := listPresets(ctx, p.auditTarget(), st.Table, currentIdentity(c).User)
+	if err != nil {
+		log.Printf("Failed to list filter presets: %v", err)
+	}
+	query, args, key, err := gridQuery(p.Driver, table, pk, st)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	rs, err := fetchResult(ctx, db, query, args...)
+	if err == nil {
+		err = p.transcodeRows(rs.Rows)
+	}
+	if err != nil {
+		fail(http.StatusBadRequest, "Query failed: %v", err)
+		return
+	}
+
+	next := ""
+	if len(rs.Rows) > gridPageSize {
+		rs.Rows = rs.Rows[:gridPageSize]
+		if key != nil {
+			last := rs.Rows[len(rs.Rows)-1]
+			values := make([]string, len(key))
+			for i, col := range key {
+				for j, colName := range rs.Columns {
+					if colName == col {
+						values[i] = keyValue(p.Driver, last[j])
+					}
+				}
+			}
+			next = encodeCursor(values)
+		} else {
+			offset, _ := strconv.Atoi(st.Cursor)
+			next = strconv.Itoa(offset + gridPageSize)
+		}
+	}
+
+	filters := make(map[string]string, len(st.Filters))
+	for _, f := range st.Filters {
+		filters[f.Column] = f.Text
+	}
+	headers := make([]gridHeader, len(rs.Columns))
+	for i, col := range rs.Columns {
+		headers[i] = gridHeader{Name: col, Filter: filters[col]}
+		if col == st.Sort {
+			headers[i].Sorted = "▲"
+			if st.Desc {
+				headers[i].Sorted = "▼"
+			}
+		}
+	}
+
+	// "." stands for the first page, whose cursor is empty
+	history := make([]string, len(st.History))
+	for i, cursor := range st.History {
+		history[i] = cursor
+		if cursor == "" {
+			history[i] = "."
+		}
+	}
+	render(c, http.StatusOK, gridView{
+		State:   st,
+		History: strings.Join(history, " "),
+		Headers: headers,
+		Rows:    rs.Rows,
+		Next:    next,
+		Page:    len(st.History) + 1,
+		Keyset:  key != nil,
+		Keys:    rowKeys(p.Driver, pk, rs),
+		Presets: presets,
+		Notice:  presetNote,
+		User:    currentIdentity(c).User,
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGridQuery(t *testing.T) {
+	orders := tableInfo{Schema: "public", Name: "orders", Columns: []columnInfo{
+		{Name: "id"},
+		{Name: "created"},
+		{Name: "note", Nullable: true},
+	}}
+	after := encodeCursor([]string{"2024-01-01", "42"})
+	tests := []struct {
+		name     string
+		driver   string
+		pk       []string
+		st       gridState
+		wantSQL  string
+		wantArgs []interface{}
+		wantKey  []string
+	}{
+		{"first page by key", "postgres", []string{"id"}, gridState{},
+			`SELECT * FROM "public"."orders" ORDER BY "id" ASC LIMIT 51`, nil, []string{"id"}},
+		{"next page by key", "postgres", []string{"id"}, gridState{Cursor: encodeCursor([]string{"42"})},
+			`SELECT * FROM "public"."orders" WHERE ("id") > ($1) ORDER BY "id" ASC LIMIT 51`,
+			[]interface{}{"42"}, []string{"id"}},
+		{"sorted descending", "postgres", []string{"id"}, gridState{Sort: "created", Desc: true, Cursor: after},
+			`SELECT * FROM "public"."orders" WHERE ("created", "id") < ($1, $2) ORDER BY "created" DESC, "id" DESC LIMIT 51`,
+			[]interface{}{"2024-01-01", "42"}, []string{"created", "id"}},
+		{"filter before the cursor", "mysql", []string{"id"},
+			gridState{Filters: []gridFilter{{Column: "note", Text: "a%"}}, Cursor: encodeCursor([]string{"7"})},
+			"SELECT * FROM `public`.`orders` WHERE `note` LIKE ? AND (`id`) > (?) ORDER BY `id` ASC LIMIT 51",
+			[]interface{}{"a%", "7"}, []string{"id"}},
+		// a nullable sort column can't be compared as a row value
+		{"nullable sort pages by offset", "postgres", []string{"id"}, gridState{Sort: "note", Cursor: "50"},
+			`SELECT * FROM "public"."orders" ORDER BY "note" ASC LIMIT 51 OFFSET 50`, nil, nil},
+		{"no primary key", "sqlite", nil, gridState{Cursor: "100"},
+			`SELECT * FROM "public"."orders" LIMIT 51 OFFSET 100`, nil, nil},
+	}
+	for _, tt := range tests {
+		query, args, key, err := gridQuery(tt.driver, orders, tt.pk, tt.st)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if query != tt.wantSQL {
+			t.Errorf("%s: query\n%s\nwant\n%s", tt.name, query, tt.wantSQL)
+		}
+		if !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("%s: args = %v, want %v", tt.name, args, tt.wantArgs)
+		}
+		if !reflect.DeepEqual(key, tt.wantKey) {
+			t.Errorf("%s: key = %v, want %v", tt.name, key, tt.wantKey)
+		}
+	}
+}
+
+func TestGridQueryInvalidCursor(t *testing.T) {
+	orders := tableInfo{Name: "orders", Columns: []columnInfo{{Name: "id"}, {Name: "note", Nullable: true}}}
+	tests := []struct {
+		pk     []string
+		cursor string
+	}{
+		{[]string{"id"}, "not base64!"},
+		{[]string{"id"}, encodeCursor([]string{"1", "2"})},
+		{nil, "-50"},
+		{nil, "ten"},
+	}
+	for _, tt := range tests {
+		if _, _, _, err := gridQuery("postgres", orders, tt.pk, gridState{Cursor: tt.cursor}); err == nil {
+			t.Errorf("gridQuery with pk %v and cursor %q succeeded, want an error", tt.pk, tt.cursor)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, values := range [][]string{{"1"}, {"2024-01-01 10:00:00", "a,b"}, {""}} {
+		got, err := decodeCursor(encodeCursor(values))
+		if err != nil || !reflect.DeepEqual(got, values) {
+			t.Errorf("decodeCursor(encodeCursor(%q)) = %q, %v", values, got, err)
+		}
+	}
+}
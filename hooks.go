@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryEvent is what hooks learn about a query. The outcome fields are set
+// for the after phase only.
+type queryEvent struct {
+	Phase      string   `json:"phase"`
+	Source     string   `json:"source"`
+	User       string   `json:"user"`
+	Groups     []string `json:"groups,omitempty"`
+	Connection string   `json:"connection"`
+	Driver     string   `json:"driver"`
+	Database   string   `json:"database,omitempty"`
+	Query      string   `json:"query"`
+
+	Error   string  `json:"error,omitempty"`
+	Elapsed float64 `json:"elapsed_ms,omitempty"`
+}
+
+// hookVerdict is a hook's answer. Block only counts before the query;
+// annotations are shown with the result where it hasn't been sent yet.
+type hookVerdict struct {
+	Block       bool     `json:"block"`
+	Reason      string   `json:"reason,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// queryHook lets an organization enforce its own policy on the SQL users
+// run, from whichever page, API or editor it comes. A hook is
+// registered from an init func in its own file; an error before the query
+// blocks it.
+type queryHook interface {
+	BeforeQuery(ctx context.Context, ev queryEvent) (hookVerdict, error)
+	AfterQuery(ctx context.Context, ev queryEvent) (hookVerdict, error)
+}
+
+var queryHooks []queryHook
+
+func registerQueryHook(h queryHook) {
+	queryHooks = append(queryHooks, h)
+}
+
+// queryBlockedError is returned when a hook refuses a query.
+type queryBlockedError struct {
+	Reason string
+}
+
+func (e *queryBlockedError) Error() string {
+	if e.Reason == "" {
+		return "the query was blocked by policy"
+	}
+	return "the query was blocked by policy: " + e.Reason
+}
+
+func newQueryEvent(c *gin.Context, p connParams, source, query string) queryEvent {
+	return identityQueryEvent(currentIdentity(c), p, source, query)
+}
+
+// identityQueryEvent is newQueryEvent where there is no request at hand,
+// e.g. in a GraphQL resolver.
+func identityQueryEvent(id *identity, p connParams, source, query string) queryEvent {
+	return queryEvent{
+		Source:     source,
+		User:       id.User,
+		Groups:     id.Groups,
+		Connection: p.auditTarget(),
+		Driver:     p.Driver,
+		Database:   p.Database,
+		Query:      query,
+	}
+}
+
+// beforeQuery runs every hook in order and stops at the first refusal.
+func beforeQuery(ctx context.Context, ev queryEvent) ([]string, error) {
+	ev.Phase = "before"
+	var annotations []string
+	for _, h := range queryHooks {
+		v, err := h.BeforeQuery(ctx, ev)
+		if err != nil {
+			log.Printf("Query hook failed, blocking the query of %s: %v", ev.User, err)
+			return nil, &queryBlockedError{Reason: "a policy hook is unavailable"}
+		}
+		if v.Block {
+			log.Printf("Query hook blocked the query of %s on %s: %s", ev.User, ev.Connection, v.Reason)
+			return nil, &queryBlockedError{Reason: v.Reason}
+		}
+		annotations = append(annotations, v.Annotations...)
+	}
+	return annotations, nil
+}
+
+// afterQuery tells every hook how the query went. The query has run, so
+// failures are only logged.
+func afterQuery(ctx context.Context, ev queryEvent, started time.Time, err error) []string {
+	ev.Phase = "after"
+	ev.Elapsed = float64(time.Since(started).Microseconds()) / 1000
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	var annotations []string
+	for _, h := range queryHooks {
+		v, err := h.AfterQuery(ctx, ev)
+		if err != nil {
+			log.Printf("Query hook failed after the query of %s: %v", ev.User, err)
+			continue
+		}
+		annotations = append(annotations, v.Annotations...)
+	}
+	return annotations
+}
+
+// guardedQuery is a query the before hooks let through.
+type guardedQuery struct {
+	ev      queryEvent
+	started time.Time
+	// Annotations are what the before hooks had to say about it
+	Annotations []string
+}
+
+// guardQuery runs the before hooks for SQL a user supplied; a refusal comes
+// back as a *queryBlockedError. Every handler that runs such SQL goes
+// through it before connecting, so a statement a policy blocks on the query
+// page is blocked on every other page and API too.
+func guardQuery(ctx context.Context, ev queryEvent) (*guardedQuery, error) {
+	annotations, err := beforeQuery(ctx, ev)
+	if err != nil {
+		return nil, err
+	}
+	return &guardedQuery{ev: ev, started: time.Now(), Annotations: annotations}, nil
+}
+
+// done runs the after hooks with the outcome. By then the response is
+// usually written, so their annotations are logged.
+func (g *guardedQuery) done(err error) {
+	for _, a := range afterQuery(context.Background(), g.ev, g.started, err) {
+		log.Printf("Query hook note for %s: %s", g.ev.User, a)
+	}
+}
+
+// doneAfter runs the after hooks once c is answered, taking an error
+// status for a failed query. Handlers defer it.
+func (g *guardedQuery) doneAfter(c *gin.Context) {
+	var failed error
+	if c.Writer.Status() >= http.StatusBadRequest {
+		failed = fmt.Errorf("failed with status %d", c.Writer.Status())
+	}
+	g.done(failed)
+}
+
+// pageQueryHooks runs the before hooks for a query from the page, rendering
+// the refusal itself. Annotations become notices of the result. The
+// returned func runs the after hooks once the page is written.
+func pageQueryHooks(c *gin.Context, p connParams, query string) (func(), bool) {
+	if len(queryHooks) == 0 {
+		return func() {}, true
+	}
+	g, err := guardQuery(c.Request.Context(), newQueryEvent(c, p, "query", query))
+	if err != nil {
+		render(c, http.StatusForbidden, resultError(nil, "%v", err))
+		return nil, false
+	}
+	notices := requestNotices(c)
+	for _, a := range g.Annotations {
+		notices.add("POLICY", a)
+	}
+	return func() { g.doneAfter(c) }, true
+}
+
+// webhookConfig posts every query event as JSON to an external service,
+// which answers with a hookVerdict.
+type webhookConfig struct {
+	URL string `json:"url"`
+	// TokenEnv names the environment variable with a bearer token to send
+	TokenEnv string `json:"token_env"`
+	// Timeout in seconds, 5 by default
+	Timeout int `json:"timeout"`
+	// After also posts the outcome of every query
+	After bool `json:"after"`
+	// FailOpen lets queries run while the hook is unreachable; by default
+	// they are blocked
+	FailOpen bool `json:"fail_open"`
+}
+
+type webhookHook struct {
+	config webhookConfig
+	http   *http.Client
+}
+
+func newWebhookHook(wc webhookConfig) *webhookHook {
+	timeout := time.Duration(wc.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &webhookHook{config: wc, http: &http.Client{Timeout: timeout}}
+}
+
+func (w *webhookHook) post(ctx context.Context, ev queryEvent) (hookVerdict, error) {
+	var v hookVerdict
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return v, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return v, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.config.TokenEnv != "" {
+		req.Header.Set("Authorization", "Bearer "+os.Getenv(w.config.TokenEnv))
+	}
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return v, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return v, fmt.Errorf("%s answered %s", w.config.URL, resp.Status)
+	}
+	// an empty body allows the query
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil && !errors.Is(err, io.EOF) {
+		return v, fmt.Errorf("%s answered with invalid JSON: %v", w.config.URL, err)
+	}
+	return v, nil
+}
+
+func (w *webhookHook) BeforeQuery(ctx context.Context, ev queryEvent) (hookVerdict, error) {
+	v, err := w.post(ctx, ev)
+	if err != nil && w.config.FailOpen {
+		log.Printf("Query webhook %s failed, letting the query run: %v", w.config.URL, err)
+		return hookVerdict{}, nil
+	}
+	return v, err
+}
+
+func (w *webhookHook) AfterQuery(ctx context.Context, ev queryEvent) (hookVerdict, error) {
+	if !w.config.After {
+		return hookVerdict{}, nil
+	}
+	return w.post(ctx, ev)
+}
+
+// setupQueryHooks registers the webhooks of the configuration after the
+// hooks compiled in.
+func setupQueryHooks() {
+	for _, wc := range config.Hooks {
+		if wc.URL == "" {
+			log.Fatalf("A query hook in the configuration has no url")
+		}
+		registerQueryHook(newWebhookHook(wc))
+	}
+}
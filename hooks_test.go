@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dropBlocker refuses every statement that mentions DROP.
+type dropBlocker struct{}
+
+func (dropBlocker) BeforeQuery(ctx context.Context, ev queryEvent) (hookVerdict, error) {
+	if strings.Contains(strings.ToUpper(ev.Query), "DROP") {
+		return hookVerdict{Block: true, Reason: "no DROP from " + ev.Source}, nil
+	}
+	return hookVerdict{}, nil
+}
+
+func (dropBlocker) AfterQuery(ctx context.Context, ev queryEvent) (hookVerdict, error) {
+	return hookVerdict{}, nil
+}
+
+func withBlockingHook(t *testing.T) *gin.Engine {
+	t.Helper()
+	saved := queryHooks
+	queryHooks = []queryHook{dropBlocker{}}
+	t.Cleanup(func() { queryHooks = saved })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.SetFuncMap(templateFuncs)
+	r.LoadHTMLGlob("templates/*")
+	r.POST("/api/v1/query", apiQuery)
+	r.POST("/export", exportHandler)
+	r.POST("/script", runScriptHandler)
+	return r
+}
+
+func TestHookBlocksAPIQuery(t *testing.T) {
+	r := withBlockingHook(t)
+	body := `{"driver": "sqlite", "database": ":memory:", "query": "DROP TABLE t"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/query", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "no DROP from api") {
+		t.Errorf("body = %q, want the hook's reason", w.Body)
+	}
+}
+
+func TestHookBlocksExport(t *testing.T) {
+	r := withBlockingHook(t)
+	form := url.Values{
+		"driver":   {"sqlite"},
+		"database": {":memory:"},
+		"format":   {"csv"},
+		"query":    {"DROP TABLE t"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/export", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "no DROP from export") {
+		t.Errorf("body = %q, want the hook's reason", w.Body)
+	}
+}
+
+func TestHookBlocksScript(t *testing.T) {
+	r := withBlockingHook(t)
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("driver", "sqlite")
+	mw.WriteField("database", ":memory:")
+	fw, err := mw.CreateFormFile("script", "cleanup.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte("CREATE TABLE t (id int);\nDROP TABLE t;\n"))
+	mw.Close()
+
+	scriptRunsMu.Lock()
+	runs := len(scriptRuns)
+	scriptRunsMu.Unlock()
+
+	req := httptest.NewRequest(http.MethodPost, "/script", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "Line 2") {
+		t.Errorf("body does not name the blocked line: %s", w.Body)
+	}
+	// nothing of the script runs, not even the statements before the blocked one
+	scriptRunsMu.Lock()
+	defer scriptRunsMu.Unlock()
+	if len(scriptRuns) != runs {
+		t.Errorf("a script run was started")
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// i18nConfig picks the language of messages sent to users: errors and
+// notes rendered into pages and the API's error messages. Page labels and
+// the server log stay as they are.
+type i18nConfig struct {
+	// Language fixes the language, e.g. "ru"; empty follows each request's
+	// Accept-Language, falling back to English
+	Language string `json:"language"`
+	// Catalogs is a directory of <language>.json files, each an object from
+	// the English message to its translation; they add to or override the
+	// built-in ones
+	Catalogs string `json:"catalogs"`
+}
+
+// A catalog translates messages by their English format: the key is the
+// format string a handler passes to fmt, with %v, %s, %d and %q for the
+// variable parts, and the value uses the same verbs in its own order, or
+// indexed ones (%[2]v) to move them.
+type catalog struct {
+	exact    map[string]string
+	patterns []messagePattern
+}
+
+type messagePattern struct {
+	match *regexp.Regexp
+	// literal is how much of the key is fixed text; longer keys are tried
+	// first so "Query failed: %v" wins over "%v: %v"
+	literal     int
+	translation string
+}
+
+var catalogs = map[string]*catalog{}
+
+var formatVerb = regexp.MustCompile(`%(\[\d+\])?[vsdq]`)
+
+// newCatalog compiles the formats with variable parts into patterns that
+// match the formatted message.
+func newCatalog(messages map[string]string) *catalog {
+	cat := &catalog{exact: make(map[string]string)}
+	for key, translation := range messages {
+		if !formatVerb.MatchString(key) {
+			cat.exact[strings.ReplaceAll(key, "%%", "%")] = translation
+			continue
+		}
+		literal := formatVerb.ReplaceAllString(key, "")
+		if strings.TrimSpace(literal) == "" {
+			continue
+		}
+		var expr strings.Builder
+		expr.WriteString("^")
+		last := 0
+		for _, loc := range formatVerb.FindAllStringIndex(key, -1) {
+			expr.WriteString(regexp.QuoteMeta(strings.ReplaceAll(key[last:loc[0]], "%%", "%")))
+			expr.WriteString("(.*?)")
+			last = loc[1]
+		}
+		expr.WriteString(regexp.QuoteMeta(strings.ReplaceAll(key[last:], "%%", "%")))
+		expr.WriteString("$")
+		cat.patterns = append(cat.patterns, messagePattern{
+			match:       regexp.MustCompile("(?s)" + expr.String()),
+			literal:     len(literal),
+			translation: translation,
+		})
+	}
+	sort.SliceStable(cat.patterns, func(i, j int) bool {
+		return cat.patterns[i].literal > cat.patterns[j].literal
+	})
+	return cat
+}
+
+// translate returns the message in the catalog's language, or unchanged
+// when the catalog doesn't know it. Parts filled into a known format are
+// translated in turn.
+func (cat *catalog) translate(message string) string {
+	if t, ok := cat.exact[message]; ok {
+		return t
+	}
+	for _, p := range cat.patterns {
+		args := p.match.FindStringSubmatch(message)
+		if args == nil {
+			continue
+		}
+		n := 0
+		translated := formatVerb.ReplaceAllStringFunc(strings.ReplaceAll(p.translation, "%%", "\x00"), func(verb string) string {
+			i := n
+			if strings.HasPrefix(verb, "%[") {
+				i, _ = strconv.Atoi(verb[2 : len(verb)-2])
+				i--
+			}
+			n = i + 1
+			if i < 0 || i+1 >= len(args) {
+				return verb
+			}
+			// the parts may be messages too, "Query failed: %v" around an
+			// address error
+			return cat.translate(args[i+1])
+		})
+		return strings.ReplaceAll(translated, "\x00", "%")
+	}
+	return message
+}
+
+// setupI18n loads the built-in catalogs and the configured directory; a
+// catalog that doesn't parse stops the server.
+func setupI18n() {
+	for lang, messages := range builtinCatalogs {
+		catalogs[lang] = newCatalog(messages)
+	}
+	if dir := config.I18n.Catalogs; dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			log.Fatalf("Invalid catalog directory %s: %v", dir, err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				log.Fatalf("Failed to read catalog %s: %v", file, err)
+			}
+			var messages map[string]string
+			if err := json.Unmarshal(data, &messages); err != nil {
+				log.Fatalf("Failed to parse catalog %s: %v", file, err)
+			}
+			lang := strings.ToLower(strings.TrimSuffix(filepath.Base(file), ".json"))
+			if builtin, ok := builtinCatalogs[lang]; ok {
+				for key, t := range builtin {
+					if _, set := messages[key]; !set {
+						messages[key] = t
+					}
+				}
+			}
+			catalogs[lang] = newCatalog(messages)
+		}
+	}
+	if lang := config.I18n.Language; lang != "" && lang != "en" && catalogs[strings.ToLower(lang)] == nil {
+		log.Fatalf("No catalog for the configured language %q", lang)
+	}
+}
+
+// requestLanguage is the configured language, or the first one in the
+// request's Accept-Language that has a catalog.
+func requestLanguage(c *gin.Context) string {
+	if config.I18n.Language != "" {
+		return strings.ToLower(config.I18n.Language)
+	}
+	type choice struct {
+		lang string
+		q    float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		// en-GB falls back to en, pt-BR to pt
+		base, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if q > 0 && base != "" {
+			choices = append(choices, choice{strings.ToLower(tag), q}, choice{base, q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+	for _, ch := range choices {
+		if ch.lang == "en" || catalogs[ch.lang] != nil {
+			return ch.lang
+		}
+	}
+	return "en"
+}
+
+// tr translates a message into the request's language.
+func tr(c *gin.Context, message string) string {
+	if message == "" {
+		return message
+	}
+	cat := catalogs[requestLanguage(c)]
+	if cat == nil {
+		return message
+	}
+	return cat.translate(message)
+}
+
+// A localizedView has messages to translate before it is rendered.
+type localizedView interface {
+	view
+	localize(c *gin.Context) view
+}
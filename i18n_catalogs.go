@@ -0,0 +1,137 @@
+package main
+
+// builtinCatalogs are the translations that ship with the app. Messages
+// missing here stay in English; a catalog file can fill them in.
+var builtinCatalogs = map[string]map[string]string{
+	"ru": {
+		// connecting
+		"Failed to connect to database: %v":                                          "Не удалось подключиться к базе данных: %v",
+		"Unsupported database driver %q":                                             "Неподдерживаемый драйвер базы данных %q",
+		"unsupported database driver %q":                                             "неподдерживаемый драйвер базы данных %q",
+		"server address is required":                                                 "нужно указать адрес сервера",
+		"invalid server address %q: %v":                                              "неверный адрес сервера %q: %v",
+		"invalid server address %q: missing host":                                    "неверный адрес сервера %q: не указан хост",
+		"invalid server address %q: missing port":                                    "неверный адрес сервера %q: не указан порт",
+		"invalid server address %q: port must be a number from 1 to 65535":           "неверный адрес сервера %q: порт должен быть числом от 1 до 65535",
+		"invalid server address %q: put IPv6 addresses in brackets, e.g. [::1]:5432": "неверный адрес сервера %q: IPv6-адрес нужно взять в скобки, например [::1]:5432",
+		"unix sockets are supported for PostgreSQL and MySQL only":                   "unix-сокеты поддерживаются только для PostgreSQL и MySQL",
+		"invalid socket path %q: must be absolute":                                   "неверный путь к сокету %q: нужен абсолютный путь",
+		"TLS pinning does not apply to unix socket connections":                      "привязка TLS-сертификата не применяется к подключениям через unix-сокет",
+		"This connection tab is closed or expired; open it again":                    "Эта вкладка подключения закрыта или истекла; откройте её заново",
+		"At most %d tabs can be open; close one first":                               "Можно открыть не больше %d вкладок; сначала закройте одну",
+
+		// queries
+		"Query error: %v":                                   "Ошибка запроса: %v",
+		"Query failed: %v":                                  "Запрос не выполнен: %v",
+		"Statement failed: %v":                              "Оператор не выполнен: %v",
+		"Statement %d of %d failed: %v":                     "Оператор %d из %d не выполнен: %v",
+		"Statement is required":                             "Нужно указать оператор",
+		"Statement executed successfully":                   "Оператор выполнен успешно",
+		"Statement executed successfully, %d rows affected": "Оператор выполнен успешно, затронуто строк: %d",
+		"%v (not committed yet)":                            "%v (ещё не зафиксировано)",
+		"Failed to start a transaction: %v":                 "Не удалось начать транзакцию: %v",
+		"Nothing to validate":                               "Нечего проверять",
+		"Charts are drawn from queries that return rows":    "Графики строятся по запросам, которые возвращают строки",
+		"charts are drawn from queries that return rows":    "графики строятся по запросам, которые возвращают строки",
+		"Chart failed: %v":                                  "Не удалось построить график: %v",
+		"Cannot chart the result: %v":                       "Результат нельзя показать графиком: %v",
+		"Only queries that return rows can be compared":     "Сравнивать можно только запросы, которые возвращают строки",
+		"Query %d failed: %v":                               "Запрос %d не выполнен: %v",
+		"Cannot compare the results: %v":                    "Результаты нельзя сравнить: %v",
+		"Reports are built from queries that return rows":   "Отчёты строятся по запросам, которые возвращают строки",
+
+		// tables and rows
+		"Table is required":                 "Нужно указать таблицу",
+		"Table not found: %s":               "Таблица не найдена: %s",
+		"Failed to read columns: %v":        "Не удалось прочитать столбцы: %v",
+		"Failed to load the row: %v":        "Не удалось загрузить строку: %v",
+		"Clusters are a ClickHouse feature": "Кластеры есть только в ClickHouse",
+		"Unknown cluster %q":                "Неизвестный кластер %q",
+
+		// uploads
+		"Failed to read upload: %v":       "Не удалось прочитать загруженный файл: %v",
+		"Upload a CSV file":               "Загрузите CSV-файл",
+		"Upload a JSON file":              "Загрузите JSON-файл",
+		"Upload a .sql file":              "Загрузите .sql-файл",
+		"Upload a connection file":        "Загрузите файл с подключениями",
+		"Invalid CSV: %v":                 "Неверный CSV: %v",
+		"Invalid JSON: %v":                "Неверный JSON: %v",
+		"Invalid batch size":              "Неверный размер пакета",
+		"The file is empty":               "Файл пустой",
+		"The file is larger than %s":      "Файл больше %s",
+		"The file has no records":         "В файле нет записей",
+		"The file contains no statements": "В файле нет операторов",
+
+		// saved queries, jobs and sharing
+		"Only queries returning rows can be saved": "Сохранять можно только запросы, которые возвращают строки",
+		"Failed to save the query: %v":             "Не удалось сохранить запрос: %v",
+		"Failed to read saved queries: %v":         "Не удалось прочитать сохранённые запросы: %v",
+		"Scheduled queries run unattended: give every variable a default, like {{day:date=2024-01-01}}": "Запросы по расписанию выполняются без участия человека: задайте каждой переменной значение по умолчанию, например {{day:date=2024-01-01}}",
+		"%s needs a value":                                         "Нужно указать %s",
+		"%s must be a whole number, not %q":                        "%s должно быть целым числом, а не %q",
+		"%s must be a number, not %q":                              "%s должно быть числом, а не %q",
+		"%s must be a date like 2024-01-31, not %q":                "%s должно быть датой вида 2024-01-31, а не %q",
+		"%s must be a date and time like 2024-01-31 09:30, not %q": "%s должно быть датой и временем вида 2024-01-31 09:30, а не %q",
+		"%s must be true or false, not %q":                         "%s должно быть true или false, а не %q",
+		"Invalid interval %q":                                      "Неверный интервал %q",
+		"Give either an interval or a schedule, not both":          "Укажите интервал или расписание, но не оба сразу",
+		"The schedule %q never fires":                              "Расписание %q никогда не срабатывает",
+		"No such job: %s":                                          "Нет такой задачи: %s",
+		"Only results of queries that return rows can be shared":   "Поделиться можно только результатом запроса, который возвращает строки",
+		"Invalid expiry %q":                                        "Неверный срок действия %q",
+		"Links can be valid for at most %s":                        "Ссылка может действовать не дольше %s",
+		"Share failed: %v":                                         "Не удалось поделиться: %v",
+		"Failed to save the snapshot: %v":                          "Не удалось сохранить снимок: %v",
+		"Failed to read the snapshot":                              "Не удалось прочитать снимок",
+		"this link is invalid or has expired":                      "ссылка неверна или истекла",
+
+		// copying tables
+		"Batch size must be between 1 and %d":                 "Размер пакета должен быть от 1 до %d",
+		"The target is the source table itself":               "Целевая таблица совпадает с исходной",
+		"%s has none of the columns of %s":                    "В %s нет ни одного столбца из %s",
+		"%s has no table %s; tick \"Create it when missing\"": "На %s нет таблицы %s; отметьте «Create it when missing»",
+		"No such copy: %s":                                    "Нет такого копирования: %s",
+		"the picked connection tab is closed or expired":      "выбранная вкладка подключения закрыта или истекла",
+
+		"Failed to read recent connections: %v":   "Не удалось прочитать недавние подключения: %v",
+		"Failed to forget recent connections: %v": "Не удалось забыть недавние подключения: %v",
+
+		// schema history
+		"Pick a saved connection":                            "Выберите сохранённое подключение",
+		"Failed to read schema snapshots: %v":                "Не удалось прочитать снимки схемы: %v",
+		"Schema snapshot failed: %v":                         "Не удалось снять схему: %v",
+		"The schema has not changed since the last snapshot": "Схема не изменилась с последнего снимка",
+		"Snapshot taken, %d changes":                         "Снимок сохранён, изменений: %d",
+		"Snapshot taken":                                     "Снимок сохранён",
+
+		// migrations
+		"Pick a migrations directory":                                                                    "Выберите каталог миграций",
+		"no migrations directory named %q":                                                               "нет каталога миграций %q",
+		"failed to read migrations: %v":                                                                  "не удалось прочитать миграции: %v",
+		"failed to read applied migrations: %v":                                                          "не удалось прочитать применённые миграции: %v",
+		"Migrations are already being applied to this database":                                          "К этой базе уже применяются миграции",
+		"Dry run failed: %v":                                                                             "Пробный запуск не удался: %v",
+		"Dry run succeeded and was rolled back":                                                          "Пробный запуск прошёл успешно и был откачен",
+		"The migrations changed since the preview; check them and apply again":                           "Миграции изменились после предпросмотра; проверьте их и примените снова",
+		"Failed to create the migrations table: %v":                                                      "Не удалось создать таблицу миграций: %v",
+		"%d of %d migrations applied; %s was blocked: %v":                                                "Применено миграций: %d из %d; %s заблокирована: %v",
+		"%d of %d migrations applied; %s failed and was rolled back: %v":                                 "Применено миграций: %d из %d; %s не выполнена и откачена: %v",
+		"%d of %d migrations applied; %s failed, its statements before the failing one stay applied: %v": "Применено миграций: %d из %d; %s не выполнена, её операторы до ошибочного остались применены: %v",
+		"%d migrations applied":                                                                          "Применено миграций: %d",
+
+		// display time zone
+		"unknown time zone %q":                        "неизвестный часовой пояс %q",
+		"Unknown time zone %q":                        "Неизвестный часовой пояс %q",
+		"Failed to save the time zone: %v":            "Не удалось сохранить часовой пояс: %v",
+		"Times follow the server configuration again": "Время снова показывается по настройке сервера",
+		"Times are shown in %s from now on":           "Теперь время показывается в поясе %s",
+
+		// API
+		"Invalid or expired API token":     "Неверный или просроченный API-токен",
+		"name and driver are required":     "нужно указать имя и драйвер",
+		"limit must be between 1 and 1000": "limit должен быть от 1 до 1000",
+		"no such run: %s":                  "нет такого запуска: %s",
+		"invalid wait %q":                  "неверное значение wait %q",
+		"token not found":                  "токен не найден",
+	},
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const impactShownRows = 200
+
+// serverCounter is a server-wide statistic read before and after a query.
+type serverCounter struct {
+	Name   string
+	Before float64
+	After  float64
+}
+
+func (s serverCounter) Delta() float64 { return s.After - s.Before }
+
+// Each query returns counter names and values. The counters are global, so
+// a delta includes whatever else ran on the server at the same time.
+var impactQueries = map[string]string{
+	"postgres": `
+		SELECT c.name, c.value
+		FROM pg_stat_database d,
+		     LATERAL (VALUES ('blks_read', d.blks_read::float8), ('blks_hit', d.blks_hit::float8),
+		                     ('tup_returned', d.tup_returned::float8), ('tup_fetched', d.tup_fetched::float8),
+		                     ('tup_inserted', d.tup_inserted::float8), ('tup_updated', d.tup_updated::float8),
+		                     ('tup_deleted', d.tup_deleted::float8), ('temp_files', d.temp_files::float8),
+		                     ('temp_bytes', d.temp_bytes::float8), ('xact_commit', d.xact_commit::float8)) AS c(name, value)
+		WHERE d.datname = current_database()
+		UNION ALL SELECT 'bgwriter buffers_alloc', buffers_alloc::float8 FROM pg_stat_bgwriter
+		UNION ALL SELECT 'bgwriter buffers_clean', buffers_clean::float8 FROM pg_stat_bgwriter`,
+	"mysql": `
+		SHOW GLOBAL STATUS WHERE Variable_name IN (
+			'Innodb_buffer_pool_read_requests', 'Innodb_buffer_pool_reads', 'Innodb_data_read',
+			'Innodb_data_written', 'Innodb_rows_read', 'Innodb_rows_inserted', 'Innodb_rows_updated',
+			'Innodb_rows_deleted', 'Created_tmp_tables', 'Created_tmp_disk_tables', 'Sort_merge_passes',
+			'Handler_read_rnd_next', 'Select_full_join', 'Select_scan', 'Bytes_sent', 'Bytes_received')`,
+	"clickhouse": `
+		SELECT event, toString(value) FROM system.events
+		WHERE event IN ('SelectedRows', 'SelectedBytes', 'SelectedParts', 'SelectedMarks',
+		                'ReadCompressedBytes', 'CompressedReadBufferBytes', 'OSReadBytes', 'OSWriteBytes',
+		                'NetworkSendBytes', 'UserTimeMicroseconds', 'SystemTimeMicroseconds')
+		UNION ALL
+		SELECT concat('metric ', metric), toString(value) FROM system.metrics
+		WHERE metric IN ('MemoryTracking', 'Query')`,
+}
+
+// impactSettle is how long to wait before the second snapshot: PostgreSQL
+// publishes its statistics up to a second after a transaction ends.
+var impactSettle = map[string]time.Duration{"postgres": time.Second}
+
+func readCounters(ctx context.Context, db *sql.DB, driver string) (map[string]float64, []string, error) {
+	query, ok := impactQueries[driver]
+	if !ok {
+		return nil, nil, fmt.Errorf("server impact is not supported for %q", driver)
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]float64)
+	var order []string
+	for rows.Next() {
+		// SHOW GLOBAL STATUS has text values, so every driver is read as text
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, nil, err
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		values[name] = v
+		order = append(order, name)
+	}
+	return values, order, rows.Err()
+}
+
+// impactHandler runs the query of the form between two snapshots of the
+// server's counters and shows the result next to what changed.
+func impactHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	query := c.PostForm("query")
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "impact.html", format, args...)
+	}
+	guard, err := guardQuery(c.Request.Context(), newQueryEvent(c, p, "impact", query))
+	if err != nil {
+		fail(http.StatusForbidden, "%v", err)
+		return
+	}
+	defer guard.doneAfter(c)
+	release, err := acquireQuerySlot(c.Request.Context(), p, "")
+	if err != nil {
+		fail(http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	defer release()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	before, order, err := readCounters(ctx, db, p.Driver)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to read server counters: %v", err)
+		return
+	}
+
+	var page impactView
+	started := time.Now()
+	if returnsRows(query) {
+		rs, err := fetchResult(ctx, db, query)
+		if err != nil {
+			fail(http.StatusBadRequest, "Query error: %v", err)
+			return
+		}
+		page.Columns, page.Total = rs.Columns, len(rs.Rows)
+		if len(rs.Rows) > impactShownRows {
+			rs.Rows = rs.Rows[:impactShownRows]
+		}
+		page.Rows = rs.Rows
+	} else {
+		res, err := db.ExecContext(ctx, query)
+		if err != nil {
+			fail(http.StatusBadRequest, "Query error: %v", err)
+			return
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			affected = -1
+		}
+		page.Message = execSummary(affected)
+		if changesSchema(query) {
+			invalidateSchema(p)
+		}
+	}
+	page.Elapsed = time.Since(started)
+
+	time.Sleep(impactSettle[p.Driver])
+	after, _, err := readCounters(ctx, db, p.Driver)
+	if err != nil {
+		fail(http.StatusBadRequest, "The query ran, but reading server counters afterwards failed: %v", err)
+		return
+	}
+
+	counters := make([]serverCounter, 0, len(order))
+	for _, name := range order {
+		counters = append(counters, serverCounter{Name: name, Before: before[name], After: after[name]})
+	}
+	// biggest changes first, unchanged counters last in their original order
+	sort.SliceStable(counters, func(i, j int) bool {
+		return math.Abs(counters[i].Delta()) > math.Abs(counters[j].Delta())
+	})
+	page.Counters = counters
+	render(c, http.StatusOK, page)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// indexBuild tracks a CREATE INDEX running in the background on its own
+// connection, so progress can be polled from pg_stat_progress_create_index.
+type indexBuild struct {
+	ID        string
+	Statement string
+	Index     string
+	Started   time.Time
+
+	mu       sync.Mutex
+	db       *sql.DB
+	pid      int
+	finished time.Time
+	err      error
+	cleanup  string
+}
+
+type indexProgress struct {
+	Phase   string
+	Done    int64
+	Total   int64
+	Percent float64
+}
+
+var (
+	indexBuildsMu sync.Mutex
+	indexBuilds   = make(map[string]*indexBuild)
+)
+
+const indexProgressQuery = `
+SELECT phase,
+       blocks_done, blocks_total,
+       tuples_done, tuples_total,
+       lockers_done, lockers_total
+FROM pg_stat_progress_create_index
+WHERE pid = $1`
+
+func indexName(table string, columns []string) string {
+	name := table
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	name = fmt.Sprintf("%s_%s_idx", name, strings.Join(columns, "_"))
+	// Postgres truncates identifiers to NAMEDATALEN-1 bytes
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return name
+}
+
+// qualifiedIndex places the index in the table's schema, which is where
+// Postgres creates it.
+func qualifiedIndex(table, index string) string {
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		return quoteIdent("postgres", table[:i]) + "." + quoteIdent("postgres", index)
+	}
+	return quoteIdent("postgres", index)
+}
+
+func createIndexHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	if p.Driver != "postgres" {
+		renderError(c, http.StatusBadRequest, "index_build.html", "The index helper is only available for PostgreSQL")
+		return
+	}
+
+	table := strings.TrimSpace(c.PostForm("table"))
+	var columns []string
+	for _, col := range strings.Split(c.PostForm("columns"), ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			columns = append(columns, col)
+		}
+	}
+	if table == "" || len(columns) == 0 {
+		renderError(c, http.StatusBadRequest, "index_build.html", "Table and at least one column are required")
+		return
+	}
+
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" {
+		name = indexName(table, columns)
+	}
+	method := c.DefaultPostForm("method", "btree")
+	switch method {
+	case "btree", "hash", "gin", "gist", "brin":
+	default:
+		renderError(c, http.StatusBadRequest, "index_build.html", "Unsupported index method %q", method)
+		return
+	}
+
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdent("postgres", col)
+	}
+	var stmt strings.Builder
+	stmt.WriteString("CREATE ")
+	if c.PostForm("unique") != "" {
+		stmt.WriteString("UNIQUE ")
+	}
+	stmt.WriteString("INDEX ")
+	concurrently := c.DefaultPostForm("concurrently", "on") != "off"
+	if concurrently {
+		stmt.WriteString("CONCURRENTLY ")
+	}
+	fmt.Fprintf(&stmt, "%s ON %s USING %s (%s)",
+		quoteIdent("postgres", name), quoteIdent("postgres", table), method, strings.Join(quoted, ", "))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		renderError(c, http.StatusServiceUnavailable, "index_build.html", "Failed to connect to database: %v", err)
+		return
+	}
+
+	build := &indexBuild{
+		ID:        randomID(8),
+		Statement: stmt.String(),
+		Index:     qualifiedIndex(table, name),
+		Started:   time.Now(),
+		db:        db,
+	}
+	indexBuildsMu.Lock()
+	indexBuilds[build.ID] = build
+	indexBuildsMu.Unlock()
+
+	go build.run(concurrently)
+
+	render(c, http.StatusOK, build.view(ctx))
+}
+
+func (b *indexBuild) run(concurrently bool) {
+	defer b.db.Close()
+	ctx := context.Background()
+
+	// The build has to run on a known backend so its progress row can be found
+	conn, err := b.db.Conn(ctx)
+	if err == nil {
+		var pid int
+		if err = conn.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&pid); err == nil {
+			b.mu.Lock()
+			b.pid = pid
+			b.mu.Unlock()
+			log.Printf("Building index: %s", b.Statement)
+			_, err = conn.ExecContext(ctx, b.Statement)
+		}
+		conn.Close()
+	}
+
+	// A failed CONCURRENTLY build leaves an INVALID index behind that still
+	// slows down writes; drop it so the build can simply be retried.
+	var cleanup string
+	if err != nil && concurrently {
+		var valid bool
+		lookup := b.db.QueryRowContext(ctx,
+			"SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1)", b.Index).Scan(&valid)
+		if lookup == nil && !valid {
+			drop := "DROP INDEX CONCURRENTLY IF EXISTS " + b.Index
+			if _, dropErr := b.db.ExecContext(ctx, drop); dropErr != nil {
+				cleanup = fmt.Sprintf("Invalid index left behind, drop it manually: %v", dropErr)
+			} else {
+				cleanup = "Invalid index dropped: " + drop
+			}
+		}
+	}
+
+	b.mu.Lock()
+	b.err = err
+	b.cleanup = cleanup
+	b.finished = time.Now()
+	b.mu.Unlock()
+	if err != nil {
+		log.Printf("Index build %s failed: %v", b.ID, err)
+	}
+
+	time.AfterFunc(time.Hour, func() {
+		indexBuildsMu.Lock()
+		delete(indexBuilds, b.ID)
+		indexBuildsMu.Unlock()
+	})
+}
+
+func (b *indexBuild) view(ctx context.Context) indexBuildView {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	v := indexBuildView{
+		ID:        b.ID,
+		Statement: b.Statement,
+		Elapsed:   time.Since(b.Started).Round(time.Second),
+		Running:   b.finished.IsZero(),
+		Cleanup:   b.cleanup,
+	}
+	if b.err != nil {
+		v.Failed = b.err.Error()
+	}
+	if !b.finished.IsZero() {
+		v.Elapsed = b.finished.Sub(b.Started).Round(time.Second)
+		return v
+	}
+	if b.pid == 0 {
+		return v
+	}
+
+	var pr indexProgress
+	var blocksDone, blocksTotal, tuplesDone, tuplesTotal, lockersDone, lockersTotal int64
+	err := b.db.QueryRowContext(ctx, indexProgressQuery, b.pid).Scan(
+		&pr.Phase, &blocksDone, &blocksTotal, &tuplesDone, &tuplesTotal, &lockersDone, &lockersTotal)
+	if err != nil {
+		return v
+	}
+	// Each phase advances a different counter
+	switch {
+	case blocksTotal > 0:
+		pr.Done, pr.Total = blocksDone, blocksTotal
+	case tuplesTotal > 0:
+		pr.Done, pr.Total = tuplesDone, tuplesTotal
+	case lockersTotal > 0:
+		pr.Done, pr.Total = lockersDone, lockersTotal
+	}
+	if pr.Total > 0 {
+		pr.Percent = float64(pr.Done) * 100 / float64(pr.Total)
+	}
+	v.Progress = &pr
+	return v
+}
+
+func indexBuildStatusHandler(c *gin.Context) {
+	indexBuildsMu.Lock()
+	build, ok := indexBuilds[c.Query("id")]
+	indexBuildsMu.Unlock()
+	if !ok {
+		renderError(c, http.StatusNotFound, "index_build.html", "Unknown index build")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	render(c, http.StatusOK, build.view(ctx))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const insightsLimit = 50
+
+// queryStat is one normalized statement with its accumulated cost.
+type queryStat struct {
+	Query   string
+	Calls   int64
+	TotalMs float64
+	MeanMs  float64
+	Rows    int64
+	Percent float64
+}
+
+// Each query returns statement text, calls, total and mean milliseconds and
+// rows, ordered by the column the %s stands for. PostgreSQL needs the
+// pg_stat_statements extension, MySQL the statement digest consumer of
+// performance_schema; ClickHouse aggregates the last day of system.query_log.
+var queryStatQueries = map[string]string{
+	"postgres": `
+		SELECT query, calls, total_exec_time, mean_exec_time, rows
+		FROM pg_stat_statements
+		WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())
+		ORDER BY %s DESC
+		LIMIT %d`,
+	"mysql": `
+		SELECT COALESCE(digest_text, ''), count_star,
+		       sum_timer_wait / 1000000000, avg_timer_wait / 1000000000, sum_rows_sent
+		FROM performance_schema.events_statements_summary_by_digest
+		WHERE schema_name = DATABASE()
+		ORDER BY %s DESC
+		LIMIT %d`,
+	"clickhouse": `
+		SELECT any(query), toInt64(count()), toFloat64(sum(query_duration_ms)),
+		       avg(query_duration_ms), toInt64(sum(read_rows))
+		FROM system.query_log
+		WHERE type = 'QueryFinish' AND event_time >= now() - INTERVAL 1 DAY
+		  AND current_database = currentDatabase()
+		GROUP BY normalized_query_hash
+		ORDER BY %s DESC
+		LIMIT %d`,
+}
+
+// queryStatOrder maps the sort choice to each server's column.
+var queryStatOrder = map[string]map[string]string{
+	"total": {"postgres": "total_exec_time", "mysql": "sum_timer_wait", "clickhouse": "3"},
+	"calls": {"postgres": "calls", "mysql": "count_star", "clickhouse": "2"},
+	"mean":  {"postgres": "mean_exec_time", "mysql": "avg_timer_wait", "clickhouse": "4"},
+}
+
+func listQueryStats(ctx context.Context, db *sql.DB, driver, order string) ([]queryStat, error) {
+	query, ok := queryStatQueries[driver]
+	if !ok {
+		return nil, fmt.Errorf("query statistics are not supported for %q", driver)
+	}
+	column := queryStatOrder[order][driver]
+	if driver == "postgres" {
+		// the columns were called total_time and mean_time before 13
+		var num int
+		if err := db.QueryRowContext(ctx, "SELECT current_setting('server_version_num')::int").Scan(&num); err != nil {
+			return nil, err
+		}
+		if num < 130000 {
+			query = strings.NewReplacer("total_exec_time", "total_time", "mean_exec_time", "mean_time").Replace(query)
+			column = strings.Replace(column, "_exec", "", 1)
+		}
+	}
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(query, column, insightsLimit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []queryStat
+	for rows.Next() {
+		var s queryStat
+		if err := rows.Scan(&s.Query, &s.Calls, &s.TotalMs, &s.MeanMs, &s.Rows); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+// insightsHint explains the usual reason the statistics can't be read.
+func insightsHint(driver string, err error) string {
+	msg := err.Error()
+	switch {
+	case driver == "postgres" && strings.Contains(msg, "pg_stat_statements"):
+		return "Add pg_stat_statements to shared_preload_libraries and run CREATE EXTENSION pg_stat_statements."
+	case driver == "mysql" && strings.Contains(strings.ToLower(msg), "performance_schema"):
+		return "Start the server with performance_schema=ON and the statements_digest consumer enabled."
+	case driver == "clickhouse" && strings.Contains(msg, "query_log"):
+		return "Enable log_queries so that system.query_log is written."
+	}
+	return ""
+}
+
+// insightsHandler lists the most expensive statements of the database by
+// total time, calls or mean time.
+func insightsHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	order := c.PostForm("order")
+	if _, ok := queryStatOrder[order]; !ok {
+		order = "total"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		render(c, http.StatusServiceUnavailable, insightsView{
+			Error: fmt.Sprintf("Failed to connect to database: %v", err),
+		})
+		return
+	}
+	defer db.Close()
+
+	stats, err := listQueryStats(ctx, db, p.Driver, order)
+	if err != nil {
+		render(c, http.StatusBadRequest, insightsView{
+			Error: fmt.Sprintf("Failed to read query statistics: %v", err),
+			Hint:  insightsHint(p.Driver, err),
+		})
+		return
+	}
+
+	var total float64
+	for _, s := range stats {
+		total += s.TotalMs
+	}
+	for i := range stats {
+		if total > 0 {
+			stats[i].Percent = stats[i].TotalMs * 100 / total
+		}
+	}
+	render(c, http.StatusOK, insightsView{
+		Stats:      stats,
+		Order:      order,
+		ClickHouse: p.Driver == "clickhouse",
+	})
+}
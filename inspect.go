@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type indexInfo struct {
+	Name    string `json:"name"`
+	Columns string `json:"columns"`
+	Unique  bool   `json:"unique"`
+	Primary bool   `json:"primary"`
+	Method  string `json:"method"`
+	// Statistics are nil where the server doesn't expose them
+	SizeBytes   *int64 `json:"size_bytes,omitempty"`
+	Scans       *int64 `json:"scans,omitempty"`
+	Cardinality *int64 `json:"cardinality,omitempty"`
+}
+
+type constraintInfo struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Definition string `json:"definition"`
+}
+
+// Index queries take the schema (empty for the current one) and table and
+// return name, columns, unique, primary, method, size, scans, cardinality.
+var indexQueries = map[string]string{
+	"postgres": `
+		SELECT i.relname,
+		       (SELECT string_agg(pg_get_indexdef(ix.indexrelid, k, true), ', ' ORDER BY k)
+		        FROM generate_series(1, ix.indnatts) k),
+		       ix.indisunique, ix.indisprimary, am.amname,
+		       pg_relation_size(ix.indexrelid), s.idx_scan, NULL::bigint
+		FROM pg_index ix
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_am am ON am.oid = i.relam
+		LEFT JOIN pg_stat_user_indexes s ON s.indexrelid = ix.indexrelid
+		WHERE n.nspname = COALESCE(NULLIF($1, ''), current_schema()) AND t.relname = $2
+		ORDER BY ix.indisprimary DESC, i.relname`,
+	"mysql": `
+		SELECT index_name,
+		       GROUP_CONCAT(column_name ORDER BY seq_in_index SEPARATOR ', '),
+		       MIN(non_unique) = 0, index_name = 'PRIMARY', MIN(index_type),
+		       NULL, NULL, MAX(cardinality)
+		FROM information_schema.statistics
+		WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?
+		GROUP BY index_name
+		ORDER BY index_name = 'PRIMARY' DESC, index_name`,
+	// The sorting key plus data skipping indices; ClickHouse has no unique indexes
+	"clickhouse": `
+		SELECT 'PRIMARY KEY', primary_key, false, true, 'sparse',
+		       toInt64OrNull(toString(primary_key_bytes_in_memory)), NULL, NULL
+		FROM system.tables
+		WHERE database = COALESCE(NULLIF(?, ''), currentDatabase()) AND name = ? AND primary_key != ''
+		UNION ALL
+		SELECT name, expr, false, false, type,
+		       toInt64OrNull(toString(data_compressed_bytes)), NULL, NULL
+		FROM system.data_skipping_indices
+		WHERE database = COALESCE(NULLIF(?, ''), currentDatabase()) AND table = ?`,
+	"sqlite": `
+		SELECT il.name,
+		       (SELECT group_concat(ii.name, ', ') FROM pragma_index_info(il.name) ii),
+		       il."unique", il.origin = 'pk', 'btree', NULL, NULL, NULL
+		FROM pragma_index_list(?2, COALESCE(NULLIF(?1, ''), 'main')) il
+		ORDER BY il.origin = 'pk' DESC, il.name`,
+}
+
+// Constraint queries take the same arguments and return name, kind,
+// definition. ClickHouse constraints only show up in SHOW CREATE TABLE.
+var constraintQueries = map[string]string{
+	"postgres": `
+		SELECT c.conname,
+		       CASE c.contype WHEN 'p' THEN 'PRIMARY KEY' WHEN 'u' THEN 'UNIQUE' WHEN 'c' THEN 'CHECK'
+		                      WHEN 'f' THEN 'FOREIGN KEY' WHEN 'x' THEN 'EXCLUDE' ELSE c.contype::text END,
+		       pg_get_constraintdef(c.oid, true)
+		FROM pg_constraint c
+		JOIN pg_class t ON t.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = COALESCE(NULLIF($1, ''), current_schema()) AND t.relname = $2
+		ORDER BY c.contype, c.conname`,
+	"mysql": `
+		SELECT tc.constraint_name, tc.constraint_type,
+		       COALESCE(GROUP_CONCAT(k.column_name ORDER BY k.ordinal_position SEPARATOR ', '), '')
+		FROM information_schema.table_constraints tc
+		LEFT JOIN information_schema.key_column_usage k
+		       ON k.constraint_schema = tc.constraint_schema
+		      AND k.constraint_name = tc.constraint_name
+		      AND k.table_name = tc.table_name
+		WHERE tc.table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND tc.table_name = ?
+		GROUP BY tc.constraint_name, tc.constraint_type
+		ORDER BY tc.constraint_type = 'PRIMARY KEY' DESC, tc.constraint_name`,
+	"sqlite": `
+		SELECT * FROM (
+			SELECT 'primary key' AS name, 'PRIMARY KEY' AS kind, group_concat(name, ', ') AS def
+			FROM pragma_table_info(?2, COALESCE(NULLIF(?1, ''), 'main')) WHERE pk > 0
+			UNION ALL
+			SELECT il.name, 'UNIQUE', (SELECT group_concat(ii.name, ', ') FROM pragma_index_info(il.name) ii)
+			FROM pragma_index_list(?2, COALESCE(NULLIF(?1, ''), 'main')) il WHERE il.origin = 'u'
+			UNION ALL
+			SELECT 'fk_' || id, 'FOREIGN KEY', group_concat("from", ', ') || ' REFERENCES ' || "table"
+			FROM pragma_foreign_key_list(?2, COALESCE(NULLIF(?1, ''), 'main')) GROUP BY id
+		) WHERE def IS NOT NULL`,
+}
+
+// Primary key queries take the same arguments and return the key columns in
+// key order. ClickHouse reports its sorting key, which is not unique.
+var primaryKeyQueries = map[string]string{
+	"postgres": `
+		SELECT a.attname
+		FROM pg_index ix
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = ANY (ix.indkey)
+		WHERE ix.indisprimary
+		  AND n.nspname = COALESCE(NULLIF($1, ''), current_schema()) AND t.relname = $2
+		ORDER BY array_position(ix.indkey::int2[], a.attnum)`,
+	"mysql": `
+		SELECT column_name
+		FROM information_schema.key_column_usage
+		WHERE table_schema = COALESCE(NULLIF(?, ''), DATABASE()) AND table_name = ?
+		  AND constraint_name = 'PRIMARY'
+		ORDER BY ordinal_position`,
+	"sqlite": `
+		SELECT name
+		FROM pragma_table_info(?2, COALESCE(NULLIF(?1, ''), 'main'))
+		WHERE pk > 0
+		ORDER BY pk`,
+}
+
+// primaryKey returns the primary key columns of a table, or none if it has
+// no (unique) primary key.
+func primaryKey(ctx context.Context, db *sql.DB, driver, schema, table string) ([]string, error) {
+	query, ok := primaryKeyQueries[driver]
+	if !ok {
+		return nil, nil
+	}
+	rows, err := db.QueryContext(ctx, query, tableArgs(driver, schema, table)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		columns = append(columns, col)
+	}
+	return columns, rows.Err()
+}
+
+// tableArgs binds schema and table for the queries above. The ClickHouse
+// query has two parts that each need them.
+func tableArgs(driver, schema, table string) []interface{} {
+	if driver == "clickhouse" {
+		return []interface{}{schema, table, schema, table}
+	}
+	return []interface{}{schema, table}
+}
+
+func listIndexes(ctx context.Context, db *sql.DB, driver, schema, table string) ([]indexInfo, error) {
+	query, ok := indexQueries[driver]
+	if !ok {
+		return nil, fmt.Errorf("index inspection is not supported for %q", driver)
+	}
+	rows, err := db.QueryContext(ctx, query, tableArgs(driver, schema, table)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []indexInfo
+	for rows.Next() {
+		var ix indexInfo
+		var size, scans, cardinality sql.NullInt64
+		if err := rows.Scan(&ix.Name, &ix.Columns, &ix.Unique, &ix.Primary, &ix.Method, &size, &scans, &cardinality); err != nil {
+			return nil, err
+		}
+		if size.Valid {
+			ix.SizeBytes = &size.Int64
+		}
+		if scans.Valid {
+			ix.Scans = &scans.Int64
+		}
+		if cardinality.Valid {
+			ix.Cardinality = &cardinality.Int64
+		}
+		indexes = append(indexes, ix)
+	}
+	return indexes, rows.Err()
+}
+
+func listConstraints(ctx context.Context, db *sql.DB, driver, schema, table string) ([]constraintInfo, error) {
+	query, ok := constraintQueries[driver]
+	if !ok {
+		return nil, nil
+	}
+	rows, err := db.QueryContext(ctx, query, tableArgs(driver, schema, table)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var constraints []constraintInfo
+	for rows.Next() {
+		var con constraintInfo
+		if err := rows.Scan(&con.Name, &con.Kind, &con.Definition); err != nil {
+			return nil, err
+		}
+		constraints = append(constraints, con)
+	}
+	return constraints, rows.Err()
+}
+
+// tableIndexes shows the indexes and constraints of a table.
+func tableIndexes(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name := c.PostForm("table")
+	schema, table := splitTableName(name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		renderError(c, http.StatusServiceUnavailable, "indexes.html", "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	indexes, err := listIndexes(ctx, db, p.Driver, schema, table)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "indexes.html", "Failed to read indexes: %v", err)
+		return
+	}
+	constraints, err := listConstraints(ctx, db, p.Driver, schema, table)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "indexes.html", "Failed to read constraints: %v", err)
+		return
+	}
+
+	render(c, http.StatusOK, indexesView{
+		Name:        name,
+		Indexes:     indexes,
+		Constraints: constraints,
+	})
+}
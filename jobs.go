@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	jobTimeout = time.Hour
+	// jobRetention is how long a finished job's result is kept
+	jobRetention = time.Hour
+)
+
+// queryJob is a query from the page run in the background: browsers and
+// proxies give up on requests long before a multi-minute query finishes,
+// so the page polls /jobs/{id} instead. Only its submitter sees it.
+type queryJob struct {
+	ID      string
+	User    string
+	Target  string
+	Query   string
+	Started time.Time
+
+	cancel context.CancelFunc
+	// rows counts the rows read so far
+	rows int64
+	// export is set when the result goes to a file instead of the page
+	export *jobExport
+
+	mu       sync.Mutex
+	result   *resultSet
+	message  string
+	err      string
+	finished time.Time
+}
+
+// jobExport is a job that exports its whole result: no MaxRows cap as on
+// the page and no exportTimeout as on /export. The file is written once
+// the rows are read and kept as long as the job.
+type jobExport struct {
+	Format string
+	// Table and Batch are the INSERT target and size of the "sql" format
+	Table string
+	Batch int
+	zone  *time.Location
+	mark  exportMark
+	// path is the finished file
+	path string
+}
+
+var (
+	queryJobsMu sync.Mutex
+	queryJobs   = make(map[string]*queryJob)
+)
+
+func (j *queryJob) run(ctx context.Context, p connParams, ev queryEvent) {
+	defer j.cancel()
+
+	var rs *resultSet
+	var message string
+	release, err := acquireQuerySlot(ctx, p, j.ID)
+	if err == nil {
+		rs, message, err = j.execute(ctx, p)
+		release()
+	}
+	if err == nil && rs != nil {
+		err = p.transcodeRows(rs.Rows)
+	}
+	if err == nil && j.export != nil {
+		// the file holds the result now, the rows needn't stay in memory
+		err = j.writeExport(p, rs)
+		rs = nil
+	}
+	if changesSchema(j.Query) {
+		invalidateSchema(p)
+	}
+	for _, a := range afterQuery(context.Background(), ev, j.Started, err) {
+		log.Printf("Query hook note for %s: %s", j.User, a)
+	}
+
+	j.mu.Lock()
+	j.result, j.message = rs, message
+	if err != nil {
+		j.err = err.Error()
+	}
+	j.finished = time.Now()
+	j.mu.Unlock()
+
+	done := notifyEvent{
+		Kind:    "job",
+		Name:    j.ID,
+		User:    j.User,
+		Target:  j.Target,
+		Query:   j.Query,
+		Status:  "succeeded",
+		Rows:    int(atomic.LoadInt64(&j.rows)),
+		Elapsed: j.finished.Sub(j.Started),
+		At:      j.finished,
+		Link:    resultLink("/jobs/" + j.ID),
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		done.Status = "canceled"
+	case err != nil:
+		done.Status, done.Error = "failed", err.Error()
+	}
+	notify(done)
+
+	time.AfterFunc(jobRetention, func() {
+		queryJobsMu.Lock()
+		delete(queryJobs, j.ID)
+		queryJobsMu.Unlock()
+		if j.export != nil && j.export.path != "" {
+			os.Remove(j.export.path)
+		}
+	})
+}
+
+// writeExport writes the result of an export job to a temporary file.
+func (j *queryJob) writeExport(p connParams, rs *resultSet) error {
+	e := j.export
+	if rs == nil {
+		return errors.New("the statement returned no rows to export")
+	}
+	rs.Rows = inZone(rs.Rows, e.zone)
+	f, err := os.CreateTemp("", "export-"+e.mark.ID+"-*."+e.Format)
+	if err != nil {
+		return err
+	}
+	switch e.Format {
+	case "parquet":
+		err = writeParquet(f, p.Driver, rs, e.mark)
+	case "sql":
+		err = writeInserts(f, p.Driver, e.Table, e.Batch, rs, e.mark)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	e.path = f.Name()
+	recordAudit(context.Background(), auditEntry{
+		At:     e.mark.At,
+		User:   e.mark.User,
+		Action: "export",
+		Target: j.Target,
+		Query:  j.Query,
+		Ref:    e.mark.ID,
+		Detail: fmt.Sprintf("%s, %d rows, background job %s", e.Format, len(rs.Rows), j.ID),
+	})
+	return nil
+}
+
+// execute runs the statement, counting rows as they arrive so the page can
+// show progress.
+func (j *queryJob) execute(ctx context.Context, p connParams) (*resultSet, string, error) {
+	db, err := openDB(ctx, p)
+	if err != nil {
+		return nil, "", err
+	}
+	defer db.Close()
+
+	if !returnsRows(j.Query) {
+		res, err := db.ExecContext(ctx, j.Query)
+		if err != nil {
+			return nil, "", err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			n = -1
+		}
+		return nil, execSummary(n), nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	rows, err := db.QueryContext(ctx, j.Query)
+	if err != nil {
+		cancel()
+		return nil, "", err
+	}
+	defer func() {
+		cancel()
+		rows.Close()
+	}()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, "", err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, "", err
+	}
+	rs := &resultSet{Columns: columns, Types: make([]string, len(columnTypes))}
+	for i, ct := range columnTypes {
+		rs.Types[i] = ct.DatabaseTypeName()
+	}
+	// an export wants every row, the page only as many as it shows
+	maxRows := config.MaxRows
+	if j.export != nil {
+		maxRows = 0
+	}
+	sc := newResultScanner(rs.Types)
+	for rows.Next() {
+		if maxRows > 0 && len(rs.Rows) == maxRows {
+			rs.Truncated = true
+			return rs, "", nil
+		}
+		values := sc.newRow()
+		if err := sc.scan(rows, values); err != nil {
+			return nil, "", err
+		}
+		rs.Rows = append(rs.Rows, values)
+		atomic.AddInt64(&j.rows, 1)
+	}
+	return rs, "", rows.Err()
+}
+
+// view renders the job: its progress while it runs, the result once done.
+func (j *queryJob) view() view {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	v := jobView{
+		ID:      j.ID,
+		Status:  "running",
+		Target:  j.Target,
+		Query:   j.Query,
+		Elapsed: time.Since(j.Started),
+		Rows:    atomic.LoadInt64(&j.rows),
+	}
+	if j.export != nil {
+		v.Export = j.export.Format
+	}
+	switch {
+	case j.finished.IsZero():
+		if _, pos, ok := queryLimiter.position(j.ID); ok {
+			v.Status, v.Position = "queued", pos
+		}
+		return v
+	case j.err != "":
+		return resultError(nil, "%s", j.err)
+	case j.export != nil:
+		v.Status, v.Elapsed = "done", j.finished.Sub(j.Started)
+		v.Download = "/jobs/" + j.ID + "/download"
+		return v
+	case j.result == nil:
+		return resultMessage(nil, j.message)
+	}
+	rows, _ := dedupeRows(j.result.Rows, false, false)
+	rv := resultView{Columns: j.result.Columns, Rows: rows}
+	if j.result.Truncated {
+		rv.TruncatedAt = len(j.result.Rows)
+	}
+	return rv
+}
+
+// queryJobFor returns the caller's job named in the path.
+func queryJobFor(c *gin.Context) (*queryJob, bool) {
+	queryJobsMu.Lock()
+	j, ok := queryJobs[c.Param("id")]
+	queryJobsMu.Unlock()
+	if !ok || j.User != currentIdentity(c).User {
+		render(c, http.StatusNotFound, resultError(nil, "No such job: %s", c.Param("id")))
+		return nil, false
+	}
+	return j, true
+}
+
+// submitJobHandler starts the query from the form in the background and
+// answers right away with the job to poll.
+func submitJobHandler(c *gin.Context) {
+	startJob(c, "job", nil)
+}
+
+// submitExportHandler exports the whole result of the form's query in the
+// background, for results the page truncates or /export can't read in time.
+func submitExportHandler(c *gin.Context) {
+	e := &jobExport{Format: c.PostForm("format")}
+	switch e.Format {
+	case "parquet":
+	case "sql":
+		e.Table = c.PostForm("table")
+		if e.Table == "" {
+			render(c, http.StatusBadRequest, resultError(nil, "Target table name is required"))
+			return
+		}
+		batch, err := strconv.Atoi(c.DefaultPostForm("batch", "100"))
+		if err != nil || batch < 1 {
+			render(c, http.StatusBadRequest, resultError(nil, "Invalid batch size"))
+			return
+		}
+		e.Batch = batch
+	default:
+		render(c, http.StatusBadRequest, resultError(nil, "Unsupported background export format %q", e.Format))
+		return
+	}
+	zone, err := requestZone(c)
+	if err != nil {
+		render(c, http.StatusBadRequest, resultError(nil, "%v", err))
+		return
+	}
+	e.zone = zone
+	startJob(c, "export", e)
+}
+
+// startJob runs the form's query as a job of the hook source kind and
+// answers right away with the job to poll.
+func startJob(c *gin.Context, kind string, export *jobExport) {
+	p := connParamsFromForm(c)
+	query := c.PostForm("query")
+	if err := p.validateAddress(); err != nil {
+		render(c, http.StatusBadRequest, resultError(nil, "%v", err))
+		return
+	}
+	if _, ok := dbDrivers[p.Driver]; !ok {
+		render(c, http.StatusBadRequest, resultError(nil, "Unsupported database driver %q", p.Driver))
+		return
+	}
+	ev := newQueryEvent(c, p, kind, query)
+	if _, err := beforeQuery(c.Request.Context(), ev); err != nil {
+		render(c, http.StatusForbidden, resultError(nil, "%v", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	user := currentIdentity(c).User
+	j := &queryJob{
+		ID:      randomID(8),
+		User:    user,
+		Target:  p.auditTarget(),
+		Query:   query,
+		Started: time.Now(),
+		cancel:  cancel,
+		export:  export,
+	}
+	if export != nil {
+		export.mark = exportMark{
+			ID:      randomID(8),
+			User:    user,
+			At:      j.Started,
+			Visible: config.ExportWatermark,
+		}
+	}
+	queryJobsMu.Lock()
+	queryJobs[j.ID] = j
+	queryJobsMu.Unlock()
+
+	log.Printf("%s started background %s %s on %s", user, kind, j.ID, p.address())
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "background_query",
+		Target: j.Target,
+		Query:  query,
+		Ref:    j.ID,
+	})
+	go j.run(ctx, p, ev)
+
+	render(c, http.StatusAccepted, j.view())
+}
+
+// jobStatusHandler is polled by the page until the job is done.
+func jobStatusHandler(c *gin.Context) {
+	j, ok := queryJobFor(c)
+	if !ok {
+		return
+	}
+	render(c, http.StatusOK, j.view())
+}
+
+// jobDownloadHandler serves the file of a finished export job.
+func jobDownloadHandler(c *gin.Context) {
+	j, ok := queryJobFor(c)
+	if !ok {
+		return
+	}
+	j.mu.Lock()
+	done := !j.finished.IsZero() && j.err == ""
+	j.mu.Unlock()
+	if j.export == nil || !done {
+		render(c, http.StatusNotFound, resultError(nil, "Job %s has no file to download", j.ID))
+		return
+	}
+	c.FileAttachment(j.export.path, fmt.Sprintf("result-%s.%s", j.export.mark.ID, j.export.Format))
+}
+
+// cancelJobHandler stops a running job; what it read so far is discarded.
+func cancelJobHandler(c *gin.Context) {
+	j, ok := queryJobFor(c)
+	if !ok {
+		return
+	}
+	j.cancel()
+	render(c, http.StatusOK, j.view())
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type joinSuggestion struct {
+	Condition string `json:"condition"`
+	Reason    string `json:"reason"`
+	Score     int    `json:"score"`
+}
+
+type apiJoinRequest struct {
+	apiTarget
+	Left  string `json:"left" binding:"required"`
+	Right string `json:"right" binding:"required"`
+}
+
+type apiJoinResponse struct {
+	Suggestions []joinSuggestion `json:"suggestions"`
+	SQL         string           `json:"sql"`
+}
+
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies"):
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "ses"), strings.HasSuffix(name, "xes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "s"):
+		return strings.TrimSuffix(name, "s")
+	}
+	return name
+}
+
+func qualifiedName(t tableInfo) string {
+	if t.Schema == "" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
+
+func sameTable(t tableInfo, schema, name string) bool {
+	return t.Name == name && (schema == "" || t.Schema == "" || t.Schema == schema)
+}
+
+// suggestJoins ranks candidate join conditions between two tables aliased
+// a and b: declared foreign keys first, then <table>_id naming conventions,
+// then same-named columns of the same kind.
+func suggestJoins(driver string, left, right tableInfo, fks []foreignKey) []joinSuggestion {
+	q := func(alias, col string) string { return alias + "." + quoteIdent(driver, col) }
+	var out []joinSuggestion
+	seen := make(map[string]bool)
+	add := func(conds []string, reason string, score int) {
+		cond := strings.Join(conds, " AND ")
+		if !seen[cond] {
+			seen[cond] = true
+			out = append(out, joinSuggestion{Condition: cond, Reason: reason, Score: score})
+		}
+	}
+
+	for _, fk := range fks {
+		// SQLite leaves the target column empty for keys on an implicit rowid
+		if strings.Join(fk.RefColumns, "") == "" {
+			continue
+		}
+		var conds []string
+		switch {
+		case sameTable(left, fk.Schema, fk.Table) && sameTable(right, fk.RefSchema, fk.RefTable):
+			for i, col := range fk.Columns {
+				conds = append(conds, q("a", col)+" = "+q("b", fk.RefColumns[i]))
+			}
+		case sameTable(right, fk.Schema, fk.Table) && sameTable(left, fk.RefSchema, fk.RefTable):
+			for i, col := range fk.Columns {
+				conds = append(conds, q("a", fk.RefColumns[i])+" = "+q("b", col))
+			}
+		default:
+			continue
+		}
+		add(conds, "foreign key "+fk.Name, 100)
+	}
+
+	kinds := func(t tableInfo) map[string]string {
+		m := make(map[string]string, len(t.Columns))
+		for _, col := range t.Columns {
+			m[col.Name] = columnKind(col.Type)
+		}
+		return m
+	}
+	leftKinds, rightKinds := kinds(left), kinds(right)
+
+	// orders.customer_id = customers.id
+	for _, pair := range []struct {
+		from, to           tableInfo
+		fromKinds, toKinds map[string]string
+		fromAlias, toAlias string
+	}{
+		{left, right, leftKinds, rightKinds, "a", "b"},
+		{right, left, rightKinds, leftKinds, "b", "a"},
+	} {
+		ref := singular(pair.to.Name) + "_id"
+		if kind, ok := pair.fromKinds[ref]; ok && pair.toKinds["id"] == kind {
+			cond := q(pair.fromAlias, ref) + " = " + q(pair.toAlias, "id")
+			add([]string{cond}, fmt.Sprintf("column %s.%s names table %s", pair.from.Name, ref, pair.to.Name), 80)
+		}
+	}
+
+	for _, col := range left.Columns {
+		kind := leftKinds[col.Name]
+		if rightKinds[col.Name] != kind || kind == kindTime || kind == kindBool {
+			continue
+		}
+		// Every table has an id, matching them is rarely what's wanted
+		score := 50
+		if col.Name == "id" {
+			score = 10
+		}
+		add([]string{q("a", col.Name) + " = " + q("b", col.Name)}, "same column name and type", score)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	return out
+}
+
+func apiJoin(c *gin.Context) {
+	var req apiJoinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), apiQueryTimeout)
+	defer cancel()
+
+	db, p, ok := openTarget(ctx, c, req.apiTarget)
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	tables, err := schemaTables(ctx, db, p)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "schema_failed", err.Error())
+		return
+	}
+	left, ok := findTable(tables, req.Left)
+	if !ok {
+		apiError(c, http.StatusNotFound, "table_not_found", "table not found: "+req.Left)
+		return
+	}
+	right, ok := findTable(tables, req.Right)
+	if !ok {
+		apiError(c, http.StatusNotFound, "table_not_found", "table not found: "+req.Right)
+		return
+	}
+	fks, err := schemaForeignKeys(ctx, db, p)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, "schema_failed", err.Error())
+		return
+	}
+
+	resp := apiJoinResponse{Suggestions: suggestJoins(p.Driver, left, right, fks)}
+	join := "CROSS JOIN " + quoteIdent(p.Driver, qualifiedName(right)) + " AS b"
+	if len(resp.Suggestions) > 0 {
+		join = "JOIN " + quoteIdent(p.Driver, qualifiedName(right)) + " AS b ON " + resp.Suggestions[0].Condition
+	}
+	resp.SQL = fmt.Sprintf("SELECT a.*, b.*\nFROM %s AS a\n%s\nLIMIT 100", quoteIdent(p.Driver, qualifiedName(left)), join)
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// jsonRecord is one object of an uploaded JSON file. Line is where it starts;
+// Err is set when the record couldn't be parsed.
+type jsonRecord struct {
+	Line   int
+	Object map[string]interface{}
+	Err    error
+}
+
+// readJSONRecords reads either a JSON array of objects or NDJSON, one object
+// per line; format "auto" picks by the first character. A broken NDJSON line
+// fails on its own, a broken array fails the whole file.
+func readJSONRecords(r io.Reader, format string) ([]jsonRecord, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if format == "auto" {
+		format = "ndjson"
+		if len(trimmed) > 0 && trimmed[0] == '[' {
+			format = "array"
+		}
+	}
+
+	var records []jsonRecord
+	add := func(rec jsonRecord) error {
+		if len(records) == bulkMaxRows {
+			return fmt.Errorf("more than %d records, split the file", bulkMaxRows)
+		}
+		records = append(records, rec)
+		return nil
+	}
+	decodeObject := func(dec *json.Decoder) (map[string]interface{}, error) {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object, got %s", jsonKind(v))
+		}
+		return obj, nil
+	}
+
+	if format == "ndjson" {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			dec := json.NewDecoder(bytes.NewReader(text))
+			dec.UseNumber()
+			obj, err := decodeObject(dec)
+			if err := add(jsonRecord{Line: line, Object: obj, Err: err}); err != nil {
+				return nil, err
+			}
+		}
+		return records, scanner.Err()
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return nil, fmt.Errorf("expected a JSON array")
+	}
+	for dec.More() {
+		start := int(dec.InputOffset())
+		for start < len(data) && strings.IndexByte(" \t\r\n,", data[start]) >= 0 {
+			start++
+		}
+		line := 1 + bytes.Count(data[:start], []byte("\n"))
+		obj, err := decodeObject(dec)
+		if _, syntax := err.(*json.SyntaxError); syntax {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := add(jsonRecord{Line: line, Object: obj, Err: err}); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case string:
+		return "a string"
+	case []interface{}:
+		return "an array"
+	}
+	return "an object"
+}
+
+// jsonTimeLayouts are the date and time strings accepted for time columns.
+var jsonTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05", "2006-01-02"}
+
+// coerceJSON turns a JSON value into the text bound for a column of the
+// given kind, or reports why it doesn't fit. MySQL and ClickHouse don't
+// take RFC 3339 timestamps, so those are rewritten in UTC for them.
+func coerceJSON(driver string, col columnInfo, v interface{}) (string, bool, error) {
+	kind := columnKind(col.Type)
+	mismatch := func() error {
+		return fmt.Errorf("%s: %s doesn't fit %s", col.Name, jsonKind(v), col.Type)
+	}
+	switch v := v.(type) {
+	case nil:
+		if !col.Nullable {
+			return "", false, fmt.Errorf("%s can't be NULL", col.Name)
+		}
+		return "", true, nil
+	case bool:
+		switch kind {
+		case kindBool, kindString:
+			return strconv.FormatBool(v), false, nil
+		case kindInt, kindUint:
+			if v {
+				return "1", false, nil
+			}
+			return "0", false, nil
+		}
+		return "", false, mismatch()
+	case json.Number:
+		switch kind {
+		case kindInt, kindUint, kindFloat, kindDecimal, kindString:
+			return coerceText(driver, col, kind, v.String())
+		case kindBool:
+			if s := v.String(); s == "0" || s == "1" {
+				return strconv.FormatBool(s == "1"), false, nil
+			}
+		}
+		return "", false, mismatch()
+	case string:
+		return coerceText(driver, col, kind, v)
+	}
+	// arrays and objects are stored as JSON text
+	if kind != kindString {
+		return "", false, mismatch()
+	}
+	b, err := json.Marshal(v)
+	return string(b), false, err
+}
+
+func coerceText(driver string, col columnInfo, kind, s string) (string, bool, error) {
+	invalid := func() error {
+		return fmt.Errorf("%s: %q is not a valid %s", col.Name, s, col.Type)
+	}
+	t := strings.TrimSpace(s)
+	switch kind {
+	case kindInt:
+		if _, err := strconv.ParseInt(t, 10, 64); err != nil {
+			return "", false, invalid()
+		}
+		return t, false, nil
+	case kindUint:
+		if _, err := strconv.ParseUint(t, 10, 64); err != nil {
+			return "", false, invalid()
+		}
+		return t, false, nil
+	case kindFloat, kindDecimal:
+		// decimals keep their digits, the parse only checks the syntax
+		if _, err := strconv.ParseFloat(t, 64); err != nil {
+			return "", false, invalid()
+		}
+		return t, false, nil
+	case kindBool:
+		b, err := strconv.ParseBool(t)
+		if err != nil {
+			return "", false, invalid()
+		}
+		return strconv.FormatBool(b), false, nil
+	case kindTime:
+		for _, layout := range jsonTimeLayouts {
+			ts, err := time.Parse(layout, t)
+			if err != nil {
+				continue
+			}
+			if driver != "postgres" && layout == time.RFC3339Nano {
+				return ts.UTC().Format("2006-01-02 15:04:05.999999"), false, nil
+			}
+			return t, false, nil
+		}
+		return "", false, invalid()
+	}
+	return s, false, nil
+}
+
+// jsonImportRows maps object keys to table columns and coerces every value.
+// Columns are those named by any record, in table order; a record without
+// one of them inserts NULL there. Records that don't fit come back failed,
+// with the keys no column matched.
+func jsonImportRows(driver string, table tableInfo, records []jsonRecord) ([]columnInfo, []bulkRow, []string) {
+	used := map[string]bool{}
+	unknown := map[string]bool{}
+	for _, rec := range records {
+		for key := range rec.Object {
+			if name := matchColumn(table, key); name != "" {
+				used[name] = true
+			} else {
+				unknown[key] = true
+			}
+		}
+	}
+	var cols []columnInfo
+	for _, col := range table.Columns {
+		if used[col.Name] {
+			cols = append(cols, col)
+		}
+	}
+	var ignored []string
+	for key := range unknown {
+		ignored = append(ignored, key)
+	}
+	sort.Strings(ignored)
+
+	rows := make([]bulkRow, len(records))
+	for r, rec := range records {
+		row := &rows[r]
+		row.Line = rec.Line
+		if rec.Err != nil {
+			row.Status, row.Error = bulkFailed, rec.Err.Error()
+			continue
+		}
+		values := map[string]interface{}{}
+		for key, v := range rec.Object {
+			if name := matchColumn(table, key); name != "" {
+				values[name] = v
+			}
+		}
+		var problems []string
+		for _, col := range cols {
+			text, null, err := coerceJSON(driver, col, values[col.Name])
+			if err != nil {
+				problems = append(problems, err.Error())
+			}
+			row.Values, row.Null = append(row.Values, text), append(row.Null, null)
+		}
+		if len(problems) > 0 {
+			row.Status, row.Error = bulkFailed, strings.Join(problems, "; ")
+		}
+	}
+	return cols, rows, ignored
+}
+
+// jsonImportHandler loads a JSON array or NDJSON file into an existing
+// table. Every record is checked against the column types first; a dry run
+// stops there and writes nothing. Otherwise the valid records are inserted
+// through runBulk, unless stop is set and some record is invalid, in which
+// case nothing is written either.
+func jsonImportHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name := c.PostForm("table")
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "bulk.html", format, args...)
+	}
+	if name == "" {
+		fail(http.StatusBadRequest, "Table is required")
+		return
+	}
+	format := c.DefaultPostForm("format", "auto")
+	if format != "auto" && format != "array" && format != "ndjson" {
+		fail(http.StatusBadRequest, "Unknown format")
+		return
+	}
+	batch, err := strconv.Atoi(c.DefaultPostForm("batch", strconv.Itoa(bulkDefaultBatch)))
+	if err != nil || batch < 1 {
+		fail(http.StatusBadRequest, "Invalid batch size")
+		return
+	}
+	upload, err := c.FormFile("file")
+	if err != nil {
+		fail(http.StatusBadRequest, "Upload a JSON file")
+		return
+	}
+	f, err := upload.Open()
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to read upload: %v", err)
+		return
+	}
+	defer f.Close()
+	records, err := readJSONRecords(f, format)
+	if err != nil {
+		fail(http.StatusBadRequest, "Invalid JSON: %v", err)
+		return
+	}
+	if len(records) == 0 {
+		fail(http.StatusBadRequest, "The file has no records")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bulkTimeout)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	table, err := lookupTable(ctx, db, p.Driver, name)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	cols, rows, ignored := jsonImportRows(p.Driver, table, records)
+	if len(cols) == 0 {
+		fail(http.StatusBadRequest, "No key matches a column of %s", qualifiedName(table))
+		return
+	}
+
+	var valid []bulkRow
+	for _, r := range rows {
+		if r.Status == "" {
+			valid = append(valid, r)
+		}
+	}
+	dryRun := c.PostForm("dry_run") != ""
+	halted := !dryRun && c.PostForm("stop") != "" && len(valid) < len(rows)
+	if dryRun || halted {
+		for i := range rows {
+			if rows[i].Status == "" {
+				rows[i].Status = bulkOK
+			}
+		}
+		page := bulkPage(summarizeBulk(rows))
+		page.DryRun = true
+		page.Ignored = ignored
+		if halted {
+			page.Halted = "Some records are invalid, so nothing was imported."
+		}
+		render(c, http.StatusOK, page)
+		return
+	}
+
+	names := make([]string, len(cols))
+	marks := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = quoteIdent(p.Driver, col.Name)
+		marks[i] = placeholder(p.Driver, i+1)
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdent(p.Driver, qualifiedName(table)), strings.Join(names, ", "), strings.Join(marks, ", "))
+
+	user := currentIdentity(c).User
+	log.Printf("%s imports %d JSON records into %s on %s", user, len(valid), name, p.address())
+	runBulk(ctx, db, p.Driver, stmt, valid, batch, false, false)
+	for i, j := 0, 0; i < len(rows); i++ {
+		if rows[i].Status == "" {
+			rows[i] = valid[j]
+			j++
+		}
+	}
+	summary := summarizeBulk(rows)
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "json_import",
+		Target: p.auditTarget(),
+		Query:  stmt,
+		Detail: fmt.Sprintf("%s into %s: %d ok, %d failed",
+			upload.Filename, name, summary.Succeeded, summary.Failed),
+	})
+	page := bulkPage(summary)
+	page.Ignored = ignored
+	render(c, http.StatusOK, page)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPreviewRunes is how much of a JSON document its collapsed cell shows.
+const jsonPreviewRunes = 60
+
+// isJSONType tells the column types holding JSON documents: PostgreSQL
+// json and jsonb, MySQL JSON, ClickHouse JSON and Object('json'), and the
+// GeoJSON of rewritten PostGIS columns.
+func isJSONType(dbType string) bool {
+	switch baseType(dbType) {
+	case "JSON", "JSONB", "OBJECT", strings.ToUpper(geoJSONType):
+		return true
+	}
+	return false
+}
+
+// jsonColumns marks the result's JSON-typed columns.
+func jsonColumns(rs *resultSet) []bool {
+	marks := make([]bool, len(rs.Columns))
+	for i, t := range rs.Types {
+		if i < len(marks) {
+			marks[i] = isJSONType(t)
+		}
+	}
+	return marks
+}
+
+// decodeJSON returns a cell as a decoded document. Drivers give JSON as
+// text, bytes or already decoded maps and slices; numbers are kept as
+// json.Number so big ids don't lose digits.
+func decodeJSON(v interface{}) (interface{}, bool) {
+	var raw []byte
+	switch t := v.(type) {
+	case nil:
+		return nil, false
+	case string:
+		raw = []byte(t)
+	case []byte:
+		raw = t
+	default:
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return nil, false
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// renderJSONCell renders a JSON column's value as a collapsed one-line
+// preview that opens into a tree whose objects and arrays fold on their
+// own. Values that don't decode render as any other cell.
+func renderJSONCell(v interface{}) template.HTML {
+	doc, ok := decodeJSON(v)
+	if !ok {
+		return renderCell(v)
+	}
+	// the page escapes it; json's own escaping of <, > and & would show
+	var compact bytes.Buffer
+	enc := json.NewEncoder(&compact)
+	enc.SetEscapeHTML(false)
+	enc.Encode(doc)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<details class="json-value"><summary>%s</summary>`,
+		template.HTMLEscapeString(truncate(jsonPreviewRunes, strings.TrimSpace(compact.String()))))
+	writeJSONNode(&b, doc)
+	b.WriteString(`</details>`)
+	return template.HTML(b.String())
+}
+
+func writeJSONNode(b *strings.Builder, doc interface{}) {
+	switch t := doc.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(b, `<details open class="json-node"><summary>{%d}</summary><ul>`, len(keys))
+		for _, k := range keys {
+			fmt.Fprintf(b, `<li><span class="json-key">%s</span>: `, template.HTMLEscapeString(strconv.Quote(k)))
+			writeJSONNode(b, t[k])
+			b.WriteString(`</li>`)
+		}
+		b.WriteString(`</ul></details>`)
+	case []interface{}:
+		fmt.Fprintf(b, `<details open class="json-node"><summary>[%d]</summary><ol start="0">`, len(t))
+		for _, item := range t {
+			b.WriteString(`<li>`)
+			writeJSONNode(b, item)
+			b.WriteString(`</li>`)
+		}
+		b.WriteString(`</ol></details>`)
+	case nil:
+		b.WriteString(`<span class="null-value">null</span>`)
+	case string:
+		b.WriteString(template.HTMLEscapeString(strconv.Quote(t)))
+	default:
+		b.WriteString(template.HTMLEscapeString(fmt.Sprint(t)))
+	}
+}
+
+// jsonKeyPath is one key expanded into a virtual column: column is the
+// JSON column, path the keys and array indexes below it.
+type jsonKeyPath struct {
+	Spec   string
+	Column int
+	Path   []string
+}
+
+// parseJSONKeys reads the comma-separated keys the result form asks to
+// expand, each the column name followed by a dotted path, e.g.
+// "payload.user.id" or "tags.0". Column names may contain dots; the
+// longest one that matches wins.
+func parseJSONKeys(specs string, columns []string) ([]jsonKeyPath, error) {
+	var keys []jsonKeyPath
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		key := jsonKeyPath{Spec: spec, Column: -1}
+		for i, name := range columns {
+			if strings.HasPrefix(spec, name+".") && (key.Column < 0 || len(name) > len(columns[key.Column])) {
+				key.Column = i
+			}
+		}
+		if key.Column < 0 {
+			return nil, fmt.Errorf("no column for JSON key %s; write it as column.key", spec)
+		}
+		key.Path = strings.Split(strings.TrimPrefix(spec, columns[key.Column]+"."), ".")
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// jsonLookup walks path down a decoded document; a missing key is NULL.
+func jsonLookup(doc interface{}, path []string) interface{} {
+	for _, key := range path {
+		switch t := doc.(type) {
+		case map[string]interface{}:
+			doc = t[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil
+			}
+			doc = t[i]
+		default:
+			return nil
+		}
+	}
+	return doc
+}
+
+// expandJSONKeys appends a virtual column per key, after the real ones so
+// cell positions stay those of the fetched result. The rows are copied:
+// cached results are shared.
+func expandJSONKeys(columns []string, rows [][]interface{}, keys []jsonKeyPath) ([]string, [][]interface{}) {
+	if len(keys) == 0 {
+		return columns, rows
+	}
+	expanded := append(append([]string(nil), columns...), make([]string, len(keys))...)
+	for i, key := range keys {
+		expanded[len(columns)+i] = key.Spec
+	}
+	out := make([][]interface{}, len(rows))
+	for r, row := range rows {
+		values := append(make([]interface{}, 0, len(row)+len(keys)), row...)
+		for _, key := range keys {
+			var v interface{}
+			if doc, ok := decodeJSON(row[key.Column]); ok {
+				v = jsonLookup(doc, key.Path)
+			}
+			values = append(values, v)
+		}
+		out[r] = values
+	}
+	return expanded, out
+}
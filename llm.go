@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type llmConfig struct {
+	// Enabled is the feature flag; nothing is sent anywhere while it's off
+	Enabled bool `json:"enabled"`
+	// Endpoint is an OpenAI-compatible base URL, e.g. https://api.openai.com/v1
+	Endpoint string `json:"endpoint"`
+	Model    string `json:"model"`
+	// APIKeyEnv names the environment variable holding the key
+	APIKeyEnv string `json:"api_key_env"`
+	// MaxSchemaChars caps the schema description sent as context
+	MaxSchemaChars int `json:"max_schema_chars"`
+}
+
+// llmClient is the integration point for language models; swap the
+// implementation to target a different API.
+type llmClient interface {
+	Complete(ctx context.Context, system, prompt string) (string, error)
+}
+
+type openAIClient struct {
+	endpoint string
+	model    string
+	apiKey   string
+	http     *http.Client
+}
+
+func newLLMClient(cfg llmConfig) llmClient {
+	return &openAIClient{
+		endpoint: strings.TrimRight(cfg.Endpoint, "/"),
+		model:    cfg.Model,
+		apiKey:   os.Getenv(cfg.APIKeyEnv),
+		http:     &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (o *openAIClient) Complete(ctx context.Context, system, prompt string) (string, error) {
+	body, err := json.Marshal(gin.H{
+		"model":       o.model,
+		"temperature": 0,
+		"messages": []gin.H{
+			{"role": "system", "content": system},
+			{"role": "user", "content": prompt},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("model endpoint returned %s: %s", resp.Status, msg)
+	}
+
+	var out struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if len(out.Choices) == 0 {
+		return "", fmt.Errorf("model returned no choices")
+	}
+	return out.Choices[0].Message.Content, nil
+}
+
+// describeSchema renders tables as "table(col type, ...)" lines for prompts.
+func describeSchema(tables []tableInfo, limit int) string {
+	var b strings.Builder
+	for _, t := range tables {
+		cols := make([]string, len(t.Columns))
+		for i, col := range t.Columns {
+			cols[i] = col.Name + " " + col.Type
+		}
+		line := fmt.Sprintf("%s(%s)\n", qualifiedName(t), strings.Join(cols, ", "))
+		if limit > 0 && b.Len()+len(line) > limit {
+			b.WriteString("-- schema truncated\n")
+			break
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+func schemaContext(ctx context.Context, db *sql.DB, p connParams) (string, error) {
+	tables, err := schemaTables(ctx, db, p)
+	if err != nil {
+		return "", err
+	}
+	return describeSchema(tables, config.LLM.MaxSchemaChars), nil
+}
+
+// stripCodeFence removes the ```sql ... ``` wrapper models like to add.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+}
+
+// assistSQLHandler drafts a statement from a natural-language prompt. The
+// draft is only shown for review; it is never executed here.
+func assistSQLHandler(c *gin.Context) {
+	if !config.LLM.Enabled {
+		renderError(c, http.StatusNotFound, "assist.html", "The SQL assistant is disabled")
+		return
+	}
+	p := connParamsFromForm(c)
+	prompt := strings.TrimSpace(c.PostForm("prompt"))
+	if prompt == "" {
+		renderError(c, http.StatusBadRequest, "assist.html", "Describe what you want to query")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		renderError(c, http.StatusServiceUnavailable, "assist.html", "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	schema, err := schemaContext(ctx, db, p)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "assist.html", "Failed to read schema: %v", err)
+		return
+	}
+
+	system := fmt.Sprintf("You write a single %s SQL statement answering the user's request. "+
+		"Reply with SQL only, no explanation. Use only these tables:\n%s", p.Driver, schema)
+	draft, err := newLLMClient(config.LLM).Complete(ctx, system, prompt)
+	if err != nil {
+		log.Printf("SQL assistant failed: %v", err)
+		renderError(c, http.StatusBadGateway, "assist.html", "Assistant error: %v", err)
+		return
+	}
+
+	render(c, http.StatusOK, assistView{Draft: stripCodeFence(draft)})
+}
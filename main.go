@@ -1,401 +1,246 @@
 package main
 
 import (
-	"context"
-	"database/sql"
-	"fmt"
-	"html/template"
 	"log"
 	"net/http"
-	"net/url"
-	"strings"
-	"time"
 
-	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql" // MySQL
-	"github.com/jackc/pgx/v5/pgxpool"
-	_ "modernc.org/sqlite" // SQLite
+	_ "modernc.org/sqlite"             // SQLite
 )
 
 func main() {
+	loadConfig()
+	setupDisplay()
+	if err := openStore(config.Store); err != nil {
+		log.Fatalf("Failed to open store %s: %v", config.Store, err)
+	}
+	go sweepCredentials()
+	setupNotifiers()
+	setupI18n()
+	go runDueChecks()
+	go runSchemaSnapshots()
+	setupQueryHooks()
+	loadDriverPlugins()
+
+	auth, err := newAuthProvider(config.Auth)
+	if err != nil {
+		log.Fatalf("Failed to set up %q authentication: %v", config.Auth.Provider, err)
+	}
+
 	r := gin.Default()
+	r.Use(authMiddleware(auth))
+	r.Use(connTabMiddleware)
+	if routes, ok := auth.(authRoutes); ok {
+		routes.RegisterRoutes(r)
+	}
+	r.SetFuncMap(templateFuncs)
 	r.LoadHTMLGlob("templates/*")
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
 
 	// Роут для главной страницы
 	r.GET("/", func(c *gin.Context) {
-		tmpl, err := template.ParseFiles("templates/index.html")
-		if err != nil {
-			c.String(http.StatusInternalServerError, "Error load template")
-			return
-		}
-		tmpl.Execute(c.Writer, nil)
+		render(c, http.StatusOK, homeView{
+			Assistant:   config.LLM.Enabled,
+			Jira:        config.Tickets.Jira != nil && config.Tickets.Jira.URL != "",
+			GitLab:      config.Tickets.GitLab != nil && config.Tickets.GitLab.URL != "",
+			Keys:        columnKeyNames(),
+			Drivers:     driverOptions(),
+			Connections: connectionNames(c.Request.Context()),
+			Migrations:  migrationDirectories(),
+			TimeZone:    savedTimeZone(c),
+		})
 	})
 	r.POST("/test", func(c *gin.Context) {
-		c.HTML(http.StatusInternalServerError, "result.html", gin.H{
-			"Error": "test",
-		})
+		render(c, http.StatusInternalServerError, resultError(nil, "test"))
 	})
 	// Роут для обработки SQL-запроса
-	r.POST("/query", func(c *gin.Context) {
-		driver := c.PostForm("driver")
-		server := c.PostForm("server")
-		username := c.PostForm("username")
-		password := c.PostForm("password")
-		database := c.PostForm("database")
-		query := c.PostForm("query")
-
-		// Обработка адреса сервера и порта
-		serverAddress := server
-		defaultPort := ""
-
-		switch driver {
-		case "postgres":
-			defaultPort = "5432"
-		case "mysql":
-			defaultPort = "3306"
-		case "clickhouse":
-			defaultPort = "9000"
-		}
-
-		// Проверяем, содержит ли адрес порт
-		if !strings.Contains(serverAddress, ":") && defaultPort != "" {
-			serverAddress = fmt.Sprintf("%s:%s", serverAddress, defaultPort)
-		}
-
-		log.Printf("Attempting to connect to %s database at %s", driver, serverAddress)
-
-		// Создаем контекст с таймаутом
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		var dsn string
-		var db *sql.DB
-		var err error
-
-		switch driver {
-		case "postgres":
-			// Construct connection string for pgx
-			connConfig := &pgxpool.Config{}
-			connConfig, err := pgxpool.ParseConfig(fmt.Sprintf(
-				"postgres://%s:%s@%s/%s?sslmode=disable",
-				username, url.QueryEscape(password), serverAddress, database,
-			))
-			if err != nil {
-				log.Printf("Failed to parse pgx config: %v", err)
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf("Invalid connection configuration: %v", err),
-				})
-				return
-			}
-
-			// Configure the connection pool
-			connConfig.MaxConns = 25
-			connConfig.MaxConnLifetime = 5 * time.Minute
-			connConfig.MaxConnIdleTime = 30 * time.Second
-
-			// Create connection pool with retries
-			var pool *pgxpool.Pool
-			maxRetries := 3
-			for i := 0; i < maxRetries; i++ {
-				log.Printf("Attempting database connection (attempt %d of %d)", i+1, maxRetries)
-
-				pool, err = pgxpool.NewWithConfig(ctx, connConfig)
-				if err == nil {
-					// Test the connection
-					err = pool.Ping(ctx)
-					if err == nil {
-						break // Successfully connected
-					}
-				}
-
-				log.Printf("Database connection failed (attempt %d): %v", i+1, err)
-				if pool != nil {
-					pool.Close()
-				}
-
-				if i < maxRetries-1 {
-					time.Sleep(time.Second * time.Duration(i+1))
-				}
-			}
-
-			if err != nil {
-				log.Printf("All connection attempts failed: %v", err)
-				c.JSON(http.StatusServiceUnavailable, gin.H{
-					"error": fmt.Sprintf("Failed to connect to database after %d attempts: %v", maxRetries, err),
-				})
-				return
-			}
-			defer pool.Close()
-
-			// Execute query
-			rows, err := pool.Query(ctx, query)
-
-			if err != nil {
-				log.Printf("Query execution failed: %v", err)
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf("Query error: %v", err),
-				})
-				return
-			}
-			defer rows.Close()
-
-			// Get column descriptions
-			fields := rows.FieldDescriptions()
-			cols := make([]string, len(fields))
-			for i, field := range fields {
-				cols[i] = string(field.Name)
-			}
-
-			// Process rows
-			var rowsData []map[string]interface{}
-			for rows.Next() {
-				values, err := rows.Values()
-				if err != nil {
-					c.HTML(http.StatusInternalServerError, "result.html", gin.H{
-						"Error": fmt.Sprintf("Failed to get row values: %v", err),
-					})
-					return
-				}
-
-				row := make(map[string]interface{})
-				for i, col := range cols {
-					row[col] = values[i]
-				}
-				rowsData = append(rowsData, row)
-			}
-
-			if err := rows.Err(); err != nil {
-				c.HTML(http.StatusInternalServerError, "result.html", gin.H{
-					"Error": fmt.Sprintf("Error during row iteration: %v", err),
-				})
-				return
-			}
-			// Send JSON response instead of HTML for better data handling
-			// c.JSON(http.StatusOK, gin.H{
-			// 	"columns": cols,
-			// 	"rows":    rowsData,
-			// 	"status":  "success",
-			// })
-			c.HTML(
-				http.StatusOK,
-				"result.html",
-				gin.H{
-					"Columns": cols,
-					"Rows":    rowsData,
-					"status":  "success",
-				},
-			)
-		case "mysql":
-			dsn = fmt.Sprintf("%s:%s@tcp(%s)/%s?parseTime=true",
-				username, password, serverAddress, database)
-			db, err = sql.Open("mysql", dsn)
-			if err != nil {
-				log.Printf("Failed to open database connection: %v", err)
-				c.JSON(500, gin.H{"error": "Database connection error"})
-				return
-			}
-			defer db.Close()
-
-			// Test connection
-			err = db.Ping()
-			if err != nil {
-				log.Printf("Database connection failed: %v", err)
-				c.JSON(500, gin.H{"error": "Failed to connect to database"})
-				return
-			}
-
-			// Execute query
-			rows, err := db.QueryContext(ctx, query)
-			if err != nil {
-				log.Printf("Query execution failed: %v", err)
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf("Query error: %v", err),
-				})
-				return
-			}
-			defer rows.Close()
-
-			// Get column names
-			columns, err := rows.Columns()
-			if err != nil {
-				log.Printf("Failed to get column names: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": "Failed to retrieve column names",
-				})
-				return
-			}
-
-			// Process rows
-			var rowsData []map[string]interface{}
-			for rows.Next() {
-				values := make([]interface{}, len(columns))
-				scanArgs := make([]interface{}, len(columns))
-				for i := range values {
-					scanArgs[i] = &values[i]
-				}
-
-				if err := rows.Scan(scanArgs...); err != nil {
-					log.Printf("Failed to scan row: %v", err)
-					c.JSON(http.StatusInternalServerError, gin.H{
-						"error": "Failed to scan row",
-					})
-					return
-				}
-
-				row := make(map[string]interface{})
-				for i, col := range columns {
-					if b, ok := values[i].([]byte); ok {
-						row[col] = string(b)
-					} else {
-						row[col] = values[i]
-					}
-				}
-				rowsData = append(rowsData, row)
-			}
-
-			if err := rows.Err(); err != nil {
-				log.Printf("Error during row iteration: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": "Error processing rows",
-				})
-				return
-			}
-
-			c.HTML(
-				http.StatusOK,
-				"result.html",
-				gin.H{
-					"Columns": columns,
-					"Rows":    rowsData,
-					"status":  "success",
-				},
-			)
-		case "clickhouse":
-			conn, err := clickhouse.Open(&clickhouse.Options{
-				Addr: []string{serverAddress},
-				Auth: clickhouse.Auth{
-					Database: database,
-					Username: username,
-					Password: password,
-				},
-				DialTimeout: 5 * time.Second,
-			})
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf("failed to connect to ClickHouse: %v", err),
-				})
-				return
-			}
-			defer conn.Close()
-
-			rows, err := conn.Query(ctx, query)
-			fmt.Println("TEST", err)
-			if err != nil && err.Error() != "EOF" {
-				log.Printf("Query execution failed: %v", err)
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error": fmt.Sprintf("Query error: %v", err),
-				})
-				return
-			}
-			defer rows.Close()
-
-			// Get column names and types
-			columns := rows.Columns()
-			columnTypes := rows.ColumnTypes()
-
-			// Process rows
-			var rowsData []map[string]interface{}
-			for rows.Next() {
-				// Create properly typed scan destinations
-				scanArgs := make([]interface{}, len(columns))
-				for i, ct := range columnTypes {
-					switch ct.DatabaseTypeName() {
-					case "String":
-						scanArgs[i] = new(string)
-					case "UInt8", "UInt16", "UInt32":
-						scanArgs[i] = new(uint32)
-					case "UInt64":
-						scanArgs[i] = new(uint64)
-					case "Int8", "Int16", "Int32":
-						scanArgs[i] = new(int32)
-					case "Int64":
-						scanArgs[i] = new(int64)
-					case "Float32":
-						scanArgs[i] = new(float32)
-					case "Float64":
-						scanArgs[i] = new(float64)
-					case "DateTime":
-						scanArgs[i] = new(time.Time)
-					case "Date":
-						scanArgs[i] = new(time.Time)
-					default:
-						scanArgs[i] = new(interface{})
-					}
-				}
-
-				if err := rows.Scan(scanArgs...); err != nil {
-					log.Printf("Failed to scan row: %v", err)
-					c.JSON(http.StatusInternalServerError, gin.H{
-						"error": fmt.Sprintf("Failed to scan row: %v", err),
-					})
-					return
-				}
-
-				// Convert scanned values to map
-				row := make(map[string]interface{})
-				for i, col := range columns {
-					switch v := scanArgs[i].(type) {
-					case *string:
-						row[col] = *v
-					case *uint32:
-						row[col] = *v
-					case *uint64:
-						row[col] = *v
-					case *int32:
-						row[col] = *v
-					case *int64:
-						row[col] = *v
-					case *float32:
-						row[col] = *v
-					case *float64:
-						row[col] = *v
-					case *time.Time:
-						row[col] = *v
-					case *interface{}:
-						row[col] = *v
-					default:
-						row[col] = v
-					}
-				}
-				rowsData = append(rowsData, row)
-			}
-
-			if err := rows.Err(); err != nil {
-				log.Printf("Error during row iteration: %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": "Error processing rows",
-				})
-				return
-			}
-
-			c.HTML(
-				http.StatusOK,
-				"result.html",
-				gin.H{
-					"Columns": columns,
-					"Rows":    rowsData,
-					"status":  "success",
-				},
-			)
-		default:
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "Unsupported database driver",
-			})
-			return
-		}
+	r.POST("/query", queryHandler)
+
+	// Запрос со снимком счётчиков сервера до и после
+	r.POST("/query/impact", impactHandler)
+
+	// Поиск упавшего запроса ClickHouse в system.query_log
+	r.POST("/query/log", queryLogHandler)
+
+	// Прогресс ALTER/OPTIMIZE для MySQL
+	r.POST("/progress", mysqlProgressHandler)
+
+	// Выгрузка результата запроса в файл
+	r.POST("/export", exportHandler)
+	r.POST("/cell/download", cellDownloadHandler)
+
+	// Часовой пояс, в котором пользователь видит время
+	r.POST("/display/timezone", timeZoneHandler)
+
+	// Прикрепление результата к задаче в Jira или GitLab
+	r.POST("/ticket", ticketHandler)
+
+	// Расшифровка и шифрование прикладных колонок
+	r.POST("/decrypt", decryptHandler)
+	r.POST("/encrypt", encryptHandler)
+
+	// Отчёт для печати / PDF
+	r.POST("/report", reportHandler)
+
+	// Логический дамп таблицы или базы
+	r.POST("/dump", dumpHandler)
+
+	// Построение индексов PostgreSQL с CONCURRENTLY
+	r.POST("/index/create", createIndexHandler)
+	r.GET("/index/status", indexBuildStatusHandler)
+
+	// Выполнение загруженного .sql файла
+	r.POST("/script/run", runScriptHandler)
+	r.GET("/script/status", scriptStatusHandler)
+	r.POST("/script/cancel", scriptCancelHandler)
+
+	// Активные сессии и их завершение
+	r.POST("/sessions", sessionsHandler)
 
-	})
+	// Состояние репликации и отставание
+	r.POST("/replication", replicationHandler)
+
+	// Кластеры ClickHouse: реплики, парты, слияния и DDL ON CLUSTER
+	r.POST("/clusters", clustersHandler)
+	r.POST("/clusters/ddl", clusterDDLHandler)
+
+	// Пользователи и привилегии
+	r.POST("/accounts", accountsHandler)
+	r.POST("/accounts/grant", grantHandler)
+
+	// Настройки сервера (только чтение)
+	r.POST("/settings", settingsHandler)
+
+	// Самые затратные запросы по статистике сервера
+	r.POST("/insights", insightsHandler)
+
+	// Возможности сервера в зависимости от версии
+	r.POST("/capabilities", capabilitiesHandler)
+
+	// Интерактивные транзакции
+	r.POST("/tx/begin", beginTx)
+	r.POST("/tx/commit", commitTx)
+	r.POST("/tx/rollback", rollbackTx)
+
+	// Обзор баз данных и таблиц на сервере
+	r.POST("/browse", browseDatabases)
+	r.POST("/browse/tables", browseTables)
+	r.POST("/schema/refresh", schemaRefreshHandler)
+	r.POST("/browse/table", browseTableHandler)
+	r.POST("/browse/row/view", rowDetailHandler)
+	r.POST("/browse/row", editRowHandler)
+	r.POST("/browse/row/update", updateRowHandler)
+	r.POST("/browse/row/insert", insertRowHandler)
+	r.POST("/browse/row/delete", deleteRowHandler)
+	r.POST("/browse/structure", tableStructure)
+	r.POST("/browse/indexes", tableIndexes)
+	r.POST("/browse/sizes", tableSizesHandler)
+	r.POST("/browse/ddl", tableDDLHandler)
+	r.POST("/schema/table", createTableHandler)
+	r.POST("/schema/alter", alterTableHandler)
+	r.POST("/schema/destroy", destructiveHandler)
+	r.POST("/browse/diagram", diagramHandler)
+
+	// Снимки схемы и история её изменений
+	r.POST("/schema/history", schemaHistoryHandler)
+	r.GET("/schema/history", schemaHistoryHandler)
+	r.POST("/schema/snapshot", schemaSnapshotHandler)
+
+	// Миграции из каталога .sql файлов с предпросмотром
+	r.POST("/migrations", migrationsHandler)
+
+	// Сохранённые запросы и проверки качества данных
+	r.POST("/queries", savedQueriesHandler)
+	r.POST("/queries/save", saveQueryHandler)
+	r.POST("/queries/delete", deleteSavedQueryHandler)
+	r.POST("/queries/run", runSavedQueryHandler)
+	r.POST("/queries/history", checkHistoryHandler)
+	r.GET("/queries/history", checkHistoryHandler)
+
+	// Импорт подключений из DBeaver, DataGrip, pgAdmin, .pgpass и .my.cnf
+	r.POST("/connections/import", importConnectionsHandler)
+
+	// Долгие запросы в фоне: страница опрашивает состояние задания
+	r.POST("/jobs", submitJobHandler)
+	r.GET("/jobs/:id", jobStatusHandler)
+	r.POST("/jobs/:id/cancel", cancelJobHandler)
+	r.POST("/jobs/export", submitExportHandler)
+	r.GET("/jobs/:id/download", jobDownloadHandler)
+
+	// Копирование таблицы между подключениями
+	r.POST("/copy", copyTableHandler)
+	r.GET("/copy/:id", copyStatusHandler)
+	r.POST("/copy/:id/cancel", cancelCopyHandler)
+
+	// Место запроса в очереди к серверу
+	r.GET("/queue", queuePositionHandler)
+
+	// Поиск значения по всем подходящим столбцам
+	r.POST("/find", findValueHandler)
+
+	// Массовое выполнение запроса с параметрами из CSV
+	r.POST("/bulk", bulkHandler)
+
+	// Импорт CSV в существующую таблицу
+	r.POST("/import/csv", csvImportHandler)
+	r.POST("/import/json", jsonImportHandler)
+
+	// Временные учетные данные для прямого подключения
+	r.POST("/credentials", credentialHandler)
+
+	// Черновик SQL по описанию на естественном языке (включается в конфиге)
+	r.POST("/assist/sql", assistSQLHandler)
+
+	// Проверка синтаксиса без выполнения
+	r.POST("/query/validate", validateHandler)
+
+	// Форматирование SQL
+	r.POST("/query/format", formatHandler)
+
+	// График по результату запроса
+	r.POST("/query/chart", chartHandler)
+	r.POST("/query/compare", compareHandler)
+
+	// Вкладки с открытыми подключениями
+	r.GET("/tabs", tabsHandler)
+	r.POST("/tabs/open", openTabHandler)
+	r.POST("/tabs/close", closeTabHandler)
+
+	// Недавние подключения без паролей
+	r.GET("/recent", recentConnectionsHandler)
+	r.POST("/recent/forget", forgetRecentHandler)
+
+	// Ссылки на снимок результата
+	r.POST("/share", shareHandler)
+	r.GET("/share/:token", sharedResultHandler)
+
+	// Объяснение запроса простыми словами
+	r.POST("/query/explain", explainQueryHandler)
+
+	// JSON API
+	api := r.Group("/api/v1")
+	api.POST("/query", apiQuery)
+	api.POST("/validate", apiValidate)
+	api.POST("/format", apiFormat)
+	api.GET("/connections", apiListConnections)
+	api.POST("/connections", apiSaveConnection)
+	api.DELETE("/connections/:name", apiDeleteConnection)
+	api.GET("/schema", apiSchema)
+	api.POST("/schema", apiSchema)
+	api.GET("/complete", apiComplete)
+	api.POST("/complete", apiComplete)
+	api.POST("/join", apiJoin)
+	api.POST("/graph", apiGraph)
+	api.GET("/audit", apiAudit)
+	api.GET("/tokens", apiListTokens)
+	api.POST("/tokens", apiCreateToken)
+	api.DELETE("/tokens/:id", apiRevokeToken)
+	api.POST("/editor/runs", apiEditorSubmit)
+	api.GET("/editor/runs/:id", apiEditorStatus)
+	api.DELETE("/editor/runs/:id", apiEditorCancel)
+	r.GET("/api/openapi.json", openAPIHandler)
+	r.POST("/api/graphql", graphqlHandler)
 
 	log.Println("Сервер запущен на http://localhost:8081")
 	r.Run(":8081")
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const migrationTimeout = 30 * time.Minute
+
+// migrationsConfig names the directories of versioned .sql files the
+// migrations page applies. Only configured directories can be picked, so
+// the page never reads arbitrary paths on the server.
+type migrationsConfig struct {
+	// Directories are paths by the name the page shows, e.g.
+	// {"billing": "/srv/billing/migrations"}
+	Directories map[string]string `json:"directories"`
+	// Table records the applied versions in the target database,
+	// schema_migrations by default
+	Table string `json:"table"`
+}
+
+func (m migrationsConfig) table() string {
+	if m.Table != "" {
+		return m.Table
+	}
+	return "schema_migrations"
+}
+
+// migrationDirectories lists the configured directory names for the page.
+func migrationDirectories() []string {
+	names := make([]string, 0, len(config.Migrations.Directories))
+	for name := range config.Migrations.Directories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// migrationFile matches 0001_create_users.sql, 20240131093000-add-email.up.sql
+// and Flyway's V3__orders.sql; .down.sql files are left alone.
+var migrationFile = regexp.MustCompile(`^[Vv]?(\d+)(?:[_-]+(.*?))?(\.up)?\.sql$`)
+
+// migration is one file of a migrations directory.
+type migration struct {
+	Version    int64
+	Name       string
+	File       string
+	Checksum   string
+	Statements []scriptStatement
+}
+
+// appliedMigration is a row of the tracking table.
+type appliedMigration struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+	AppliedBy string
+}
+
+// migrationStatus is a version as the page lists it.
+type migrationStatus struct {
+	Version int64
+	Name    string
+	// State is "applied", "pending", "modified" (applied, but the file
+	// changed since) or "missing" (applied, but the file is gone)
+	State     string
+	AppliedAt time.Time
+	AppliedBy string
+	// Late marks a pending version older than the newest applied one,
+	// e.g. from a merged branch; it is applied like the others
+	Late       bool
+	Statements []scriptStatement
+}
+
+// migrationPlan is what applying a directory would do to a database.
+type migrationPlan struct {
+	Directory string
+	Versions  []migrationStatus
+	Pending   []migration
+}
+
+// Digest identifies the pending migrations and their contents, so that
+// applying runs what the preview showed and nothing else.
+func (plan *migrationPlan) Digest() string {
+	h := sha256.New()
+	for _, m := range plan.Pending {
+		fmt.Fprintf(h, "%d %s\n", m.Version, m.Checksum)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readMigrations reads the migration files of dir in version order,
+// splitting them into statements of driver.
+func readMigrations(dir, driver string) ([]migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []migration
+	files := make(map[int64]string)
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil || strings.HasSuffix(e.Name(), ".down.sql") {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: version %s is too large", e.Name(), m[1])
+		}
+		if other, dup := files[version]; dup {
+			return nil, fmt.Errorf("%s and %s have the same version %d", other, e.Name(), version)
+		}
+		files[version] = e.Name()
+		text, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(text)
+		out = append(out, migration{
+			Version:    version,
+			Name:       strings.NewReplacer("_", " ", "-", " ").Replace(m[2]),
+			File:       e.Name(),
+			Checksum:   hex.EncodeToString(sum[:]),
+			Statements: splitStatements(strings.TrimPrefix(string(text), "\ufeff"), driver),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// createMigrationsTable makes the tracking table; applied_at is Unix
+// seconds so one definition fits every driver.
+func createMigrationsTable(ctx context.Context, db *sql.DB, driver string) error {
+	table := quoteIdent(driver, config.Migrations.table())
+	query := `CREATE TABLE IF NOT EXISTS %s (
+		version    BIGINT PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		checksum   VARCHAR(64) NOT NULL,
+		applied_at BIGINT NOT NULL,
+		applied_by VARCHAR(255) NOT NULL
+	)`
+	if driver == "clickhouse" {
+		query = `CREATE TABLE IF NOT EXISTS %s (
+			version    Int64,
+			name       String,
+			checksum   String,
+			applied_at Int64,
+			applied_by String
+		) ENGINE = MergeTree ORDER BY version`
+	}
+	_, err := db.ExecContext(ctx, fmt.Sprintf(query, table))
+	return err
+}
+
+// appliedMigrations reads the tracking table; before the first migration
+// there is none, and nothing is applied.
+func appliedMigrations(ctx context.Context, db *sql.DB, driver string) ([]appliedMigration, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT version, name, checksum, applied_at, applied_by FROM %s ORDER BY version",
+		quoteIdent(driver, config.Migrations.table())))
+	if err != nil {
+		tables, listErr := listTables(ctx, db, driver)
+		if listErr == nil {
+			if _, exists := findTable(tables, config.Migrations.table()); !exists {
+				return nil, nil
+			}
+		}
+		return nil, err
+	}
+	defer rows.Close()
+	var applied []appliedMigration
+	for rows.Next() {
+		var a appliedMigration
+		var at int64
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &at, &a.AppliedBy); err != nil {
+			return nil, err
+		}
+		a.AppliedAt = time.Unix(at, 0)
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// planMigrations compares the files of a directory with the versions the
+// database has applied.
+func planMigrations(ctx context.Context, db *sql.DB, driver, directory string) (*migrationPlan, error) {
+	dir, ok := config.Migrations.Directories[directory]
+	if !ok {
+		return nil, fmt.Errorf("no migrations directory named %q", directory)
+	}
+	files, err := readMigrations(dir, driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %v", err)
+	}
+	applied, err := appliedMigrations(ctx, db, driver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %v", err)
+	}
+
+	plan := &migrationPlan{Directory: directory}
+	done := make(map[int64]appliedMigration, len(applied))
+	var newest int64
+	for _, a := range applied {
+		done[a.Version] = a
+		if a.Version > newest {
+			newest = a.Version
+		}
+	}
+	for _, m := range files {
+		st := migrationStatus{Version: m.Version, Name: m.Name, State: "pending", Statements: m.Statements}
+		if a, ok := done[m.Version]; ok {
+			delete(done, m.Version)
+			st.State, st.AppliedAt, st.AppliedBy, st.Statements = "applied", a.AppliedAt, a.AppliedBy, nil
+			if a.Checksum != m.Checksum {
+				st.State = "modified"
+			}
+		} else {
+			st.Late = m.Version < newest
+			plan.Pending = append(plan.Pending, m)
+		}
+		plan.Versions = append(plan.Versions, st)
+	}
+	for _, a := range done {
+		plan.Versions = append(plan.Versions, migrationStatus{
+			Version: a.Version, Name: a.Name, State: "missing", AppliedAt: a.AppliedAt, AppliedBy: a.AppliedBy,
+		})
+	}
+	sort.SliceStable(plan.Versions, func(i, j int) bool { return plan.Versions[i].Version < plan.Versions[j].Version })
+	return plan, nil
+}
+
+// execer is a transaction or a connection, whichever a migration runs on.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// applyMigration runs the statements of m and records its version. Where
+// DDL is transactional both happen in one transaction, so a failed
+// migration leaves nothing behind; elsewhere the statements before the
+// failing one stay applied.
+func applyMigration(ctx context.Context, db *sql.DB, driver string, m migration, user string) error {
+	var ex execer
+	var tx *sql.Tx
+	if transactionalDDL(driver) {
+		var err error
+		if tx, err = db.BeginTx(ctx, nil); err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		ex = tx
+	} else {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		ex = conn
+	}
+	for _, st := range m.Statements {
+		if _, err := ex.ExecContext(ctx, st.Text); err != nil {
+			return fmt.Errorf("line %d: %v", st.Line, err)
+		}
+	}
+	args := make([]string, 5)
+	for i := range args {
+		args[i] = placeholder(driver, i+1)
+	}
+	_, err := ex.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (version, name, checksum, applied_at, applied_by) VALUES (%s)",
+		quoteIdent(driver, config.Migrations.table()), strings.Join(args, ", ")),
+		m.Version, m.Name, m.Checksum, time.Now().Unix(), user)
+	if err != nil {
+		return fmt.Errorf("recording version %d: %v", m.Version, err)
+	}
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
+
+// dryRunMigrations runs every pending migration in one transaction and
+// rolls it back, where DDL is transactional.
+func dryRunMigrations(ctx context.Context, db *sql.DB, driver string, plan *migrationPlan) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if driver == "postgres" {
+		// don't queue behind other sessions' locks for the trial
+		if _, err := tx.ExecContext(ctx, "SET LOCAL lock_timeout = '2s'"); err != nil {
+			return err
+		}
+	}
+	for _, m := range plan.Pending {
+		for _, st := range m.Statements {
+			if _, err := tx.ExecContext(ctx, st.Text); err != nil {
+				return fmt.Errorf("%s, line %d: %v", m.File, st.Line, err)
+			}
+		}
+	}
+	return nil
+}
+
+// migrationLocks keeps two requests of this server from applying to the
+// same database at once.
+var migrationLocks sync.Map
+
+// migrationsHandler previews the migrations of a directory against the
+// form's connection, dry-runs them where DDL is transactional, and applies
+// the pending ones once the previewed plan is confirmed.
+func migrationsHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	directory := c.PostForm("migration_dir")
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "migrations.html", format, args...)
+	}
+	if directory == "" {
+		fail(http.StatusBadRequest, "Pick a migrations directory")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	lockKey := p.cacheKey() + "|" + config.Migrations.table()
+	lock, _ := migrationLocks.LoadOrStore(lockKey, &sync.Mutex{})
+	if !lock.(*sync.Mutex).TryLock() {
+		fail(http.StatusConflict, "Migrations are already being applied to this database")
+		return
+	}
+	defer lock.(*sync.Mutex).Unlock()
+
+	plan, err := planMigrations(ctx, db, p.Driver, directory)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	page := migrationsView{Plan: plan, Target: p.auditTarget(), DryRun: transactionalDDL(p.Driver)}
+
+	switch {
+	case c.PostForm("dryrun") != "" && page.DryRun && len(plan.Pending) > 0:
+		if err := dryRunMigrations(ctx, db, p.Driver, plan); err != nil {
+			page.Problem = fmt.Sprintf("Dry run failed: %v", err)
+		} else {
+			page.Message = "Dry run succeeded and was rolled back"
+		}
+	case c.PostForm("confirm") == "":
+	case c.PostForm("confirm") != plan.Digest():
+		page.Problem = "The migrations changed since the preview; check them and apply again"
+	default:
+		page.Message, page.Problem = runMigrations(c, ctx, db, p, plan)
+		invalidateSchema(p)
+		if page.Plan, err = planMigrations(ctx, db, p.Driver, directory); err != nil {
+			fail(http.StatusInternalServerError, "%v", err)
+			return
+		}
+	}
+	render(c, http.StatusOK, page)
+}
+
+// runMigrations applies the pending migrations in order, stopping at the
+// first that fails, and says how far it got: as the message when all
+// went in, as the problem otherwise.
+func runMigrations(c *gin.Context, ctx context.Context, db *sql.DB, p connParams, plan *migrationPlan) (message, problem string) {
+	if err := createMigrationsTable(ctx, db, p.Driver); err != nil {
+		return "", fmt.Sprintf("Failed to create the migrations table: %v", err)
+	}
+	user := currentIdentity(c).User
+	for i, m := range plan.Pending {
+		var text strings.Builder
+		for _, st := range m.Statements {
+			text.WriteString(st.Text + ";\n")
+		}
+		ev := newQueryEvent(c, p, "migration", text.String())
+		if _, err := beforeQuery(ctx, ev); err != nil {
+			return "", fmt.Sprintf("%d of %d migrations applied; %s was blocked: %v", i, len(plan.Pending), m.File, err)
+		}
+		started := time.Now()
+		err := applyMigration(ctx, db, p.Driver, m, user)
+		afterQuery(ctx, ev, started, err)
+		detail := "applied"
+		if err != nil {
+			detail = err.Error()
+		}
+		recordAudit(c.Request.Context(), auditEntry{
+			User:   user,
+			Action: "migrate",
+			Target: p.auditTarget(),
+			Query:  text.String(),
+			Ref:    plan.Directory + ":" + strconv.FormatInt(m.Version, 10),
+			Detail: detail,
+		})
+		if err != nil {
+			log.Printf("%s: migration %s failed on %s: %v", user, m.File, p.address(), err)
+			if transactionalDDL(p.Driver) {
+				return "", fmt.Sprintf("%d of %d migrations applied; %s failed and was rolled back: %v", i, len(plan.Pending), m.File, err)
+			}
+			return "", fmt.Sprintf("%d of %d migrations applied; %s failed, its statements before the failing one stay applied: %v", i, len(plan.Pending), m.File, err)
+		}
+		log.Printf("%s applied migration %s on %s", user, m.File, p.address())
+	}
+	return fmt.Sprintf("%d migrations applied", len(plan.Pending)), ""
+}
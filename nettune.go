@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// netTuning holds the network settings of a connection, in seconds. Zero
+// means the default below; a negative keep-alive turns keep-alives off.
+// Read and write timeouts bound each network read or write, so a read
+// timeout also caps how long a query may go without sending data back.
+type netTuning struct {
+	DialTimeout  int `json:"dial_timeout,omitempty"`
+	ReadTimeout  int `json:"read_timeout,omitempty"`
+	WriteTimeout int `json:"write_timeout,omitempty"`
+	KeepAlive    int `json:"keepalive,omitempty"`
+}
+
+const (
+	defaultDialTimeout = 5 * time.Second
+	defaultKeepAlive   = 30 * time.Second
+)
+
+func netTuningFromForm(c *gin.Context) netTuning {
+	seconds := func(name string) int {
+		n, _ := strconv.Atoi(c.PostForm(name))
+		return n
+	}
+	return netTuning{
+		DialTimeout:  seconds("dial_timeout"),
+		ReadTimeout:  seconds("read_timeout"),
+		WriteTimeout: seconds("write_timeout"),
+		KeepAlive:    seconds("keepalive"),
+	}
+}
+
+func (t netTuning) dialTimeout() time.Duration {
+	if t.DialTimeout > 0 {
+		return time.Duration(t.DialTimeout) * time.Second
+	}
+	return defaultDialTimeout
+}
+
+func (t netTuning) keepAlive() time.Duration {
+	switch {
+	case t.KeepAlive < 0:
+		return -1
+	case t.KeepAlive > 0:
+		return time.Duration(t.KeepAlive) * time.Second
+	}
+	return defaultKeepAlive
+}
+
+func (t netTuning) readTimeout() time.Duration {
+	return time.Duration(max(t.ReadTimeout, 0)) * time.Second
+}
+func (t netTuning) writeTimeout() time.Duration {
+	return time.Duration(max(t.WriteTimeout, 0)) * time.Second
+}
+
+// dial connects with the configured timeout and keep-alive and applies the
+// read and write timeouts to the connection.
+func (t netTuning) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := net.Dialer{Timeout: t.dialTimeout(), KeepAlive: t.keepAlive()}
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil || (t.readTimeout() == 0 && t.writeTimeout() == 0) {
+		return conn, err
+	}
+	return &deadlineConn{Conn: conn, read: t.readTimeout(), write: t.writeTimeout()}, nil
+}
+
+// deadlineConn renews the read or write deadline before each operation.
+type deadlineConn struct {
+	net.Conn
+	read, write time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if c.read > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.read))
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.write > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.write))
+	}
+	return c.Conn.Write(b)
+}
+
+// tunePostgres applies the network settings to a pgconn config.
+func (t netTuning) tunePostgres(cfg *pgconn.Config) {
+	cfg.ConnectTimeout = t.dialTimeout()
+	cfg.DialFunc = t.dial
+}
+
+var mysqlDialers sync.Map
+
+// mysqlNet registers a dialer with the MySQL driver for the keep-alive
+// setting and returns its network name for the DSN. The driver handles the
+// other timeouts through DSN parameters.
+func (t netTuning) mysqlNet() string {
+	name := "tcp-keepalive-" + strconv.Itoa(int(t.keepAlive()/time.Second))
+	if _, loaded := mysqlDialers.LoadOrStore(name, true); !loaded {
+		tuning := netTuning{KeepAlive: t.KeepAlive}
+		mysql.RegisterDialContext(name, func(ctx context.Context, addr string) (net.Conn, error) {
+			return tuning.dial(ctx, "tcp", addr)
+		})
+	}
+	return name
+}
+
+// mysqlParams are the DSN parameters for the timeouts.
+func (t netTuning) mysqlParams() string {
+	params := "&timeout=" + t.dialTimeout().String()
+	if d := t.readTimeout(); d > 0 {
+		params += "&readTimeout=" + d.String()
+	}
+	if d := t.writeTimeout(); d > 0 {
+		params += "&writeTimeout=" + d.String()
+	}
+	return params
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// serverNotice is a non-fatal message the server sent along with a result:
+// a PostgreSQL NOTICE or WARNING, a MySQL warning or a ClickHouse log line.
+type serverNotice struct {
+	Level   string
+	Message string
+}
+
+// noticeLog collects the notices of one request. Drivers may report them
+// from their own goroutines.
+type noticeLog struct {
+	mu      sync.Mutex
+	notices []serverNotice
+}
+
+func (l *noticeLog) add(level, message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.notices = append(l.notices, serverNotice{Level: level, Message: message})
+}
+
+func (l *noticeLog) list() []serverNotice {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]serverNotice(nil), l.notices...)
+}
+
+// requestNotices returns the notice log of the request, creating it on
+// first use; renderers read it back when building result.html.
+func requestNotices(c *gin.Context) *noticeLog {
+	if l, ok := c.Get("notices"); ok {
+		return l.(*noticeLog)
+	}
+	l := &noticeLog{}
+	c.Set("notices", l)
+	return l
+}
+
+// pgNoticeHandler is a pgconn OnNotice callback feeding the log.
+func pgNoticeHandler(l *noticeLog) pgconn.NoticeHandler {
+	return func(_ *pgconn.PgConn, n *pgconn.Notice) {
+		msg := n.Message
+		if n.Detail != "" {
+			msg += " (" + n.Detail + ")"
+		}
+		if n.Hint != "" {
+			msg += " Hint: " + n.Hint
+		}
+		l.add(n.Severity, msg)
+	}
+}
+
+// mysqlWarnings reads SHOW WARNINGS, which reports on the last statement of
+// the same connection, so q must be a *sql.Conn or *sql.Tx.
+func mysqlWarnings(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}, l *noticeLog) error {
+	rows, err := q.QueryContext(ctx, "SHOW WARNINGS")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var level, message string
+		var code int
+		if err := rows.Scan(&level, &code, &message); err != nil {
+			return err
+		}
+		l.add(strings.ToUpper(level), message)
+	}
+	return rows.Err()
+}
+
+// clickhouseLogs asks the server to stream log lines of warning level and
+// above with the query and passes them to the log. Other query options go
+// in the same call, as each clickhouse.Context replaces the previous one.
+func clickhouseLogs(ctx context.Context, l *noticeLog, options ...clickhouse.QueryOption) context.Context {
+	return clickhouse.Context(ctx, append(options,
+		clickhouse.WithSettings(clickhouse.Settings{"send_logs_level": "warning"}),
+		clickhouse.WithLogs(func(entry *clickhouse.Log) {
+			level := "WARNING"
+			if entry.Priority <= 3 {
+				level = "ERROR"
+			}
+			l.add(level, entry.Source+": "+entry.Text)
+		}),
+	)...)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const notifyTimeout = 30 * time.Second
+
+// notifyConfig sends a message whenever a scheduled saved query or a
+// background job ends. Secrets are read from the environment variables
+// named here.
+type notifyConfig struct {
+	// BaseURL is the address users open the app at, e.g.
+	// https://admin.example.com; without it messages carry no link
+	BaseURL string `json:"base_url"`
+	// Template is a text/template over notifyEvent; the first line is the
+	// email subject
+	Template string                `json:"template"`
+	Webhooks []notifyWebhookConfig `json:"webhooks"`
+	Slack    []slackConfig         `json:"slack"`
+	Email    []emailConfig         `json:"email"`
+}
+
+// notifyWebhookConfig posts the event as JSON, with the message as "text".
+type notifyWebhookConfig struct {
+	URL          string `json:"url"`
+	TokenEnv     string `json:"token_env"`
+	OnlyFailures bool   `json:"only_failures"`
+}
+
+// slackConfig posts to a Slack incoming webhook, whose URL is the secret.
+type slackConfig struct {
+	URLEnv       string `json:"url_env"`
+	OnlyFailures bool   `json:"only_failures"`
+}
+
+type emailConfig struct {
+	// Host and Port are the SMTP server, port 587 by default; STARTTLS is
+	// used when the server offers it
+	Host         string   `json:"host"`
+	Port         int      `json:"port"`
+	Username     string   `json:"username"`
+	PasswordEnv  string   `json:"password_env"`
+	From         string   `json:"from"`
+	To           []string `json:"to"`
+	OnlyFailures bool     `json:"only_failures"`
+}
+
+const defaultNotifyTemplate = `{{if eq .Kind "schema"}}Schema changed: {{.Name}} on {{.Target}}
+{{range .Changes}}{{.}}
+{{end}}{{else}}{{if .Failed}}Failed{{else}}Finished{{end}}: {{.Name}} on {{.Target}}
+{{if .Failed}}{{.Error}}{{else}}{{.Rows}} rows in {{.Elapsed}}{{end}}
+{{end}}{{if .Link}}{{.Link}}{{end}}`
+
+// notifyEvent is what a message is about.
+type notifyEvent struct {
+	// Kind is "schedule" for a scheduled saved query, "job" for a
+	// background query, "schema" for changes a schema snapshot found
+	Kind string `json:"kind"`
+	// Name is the saved query's name, the job's id or the saved connection
+	Name   string `json:"name"`
+	User   string `json:"user"`
+	Target string `json:"target"`
+	Query  string `json:"query"`
+	// Status is "succeeded", "failed" (a check with a failed assertion
+	// too), "canceled" or, for schema changes, "changed"; all but
+	// "succeeded" reach only_failures destinations
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Changes are the schema changes, one line each
+	Changes   []string      `json:"changes,omitempty"`
+	Rows      int           `json:"rows"`
+	Elapsed   time.Duration `json:"-"`
+	ElapsedMS int64         `json:"elapsed_ms"`
+	At        time.Time     `json:"at"`
+	// Link opens the result in the app
+	Link string `json:"link,omitempty"`
+}
+
+func (ev notifyEvent) Failed() bool { return ev.Status != "succeeded" }
+
+// notifier is one destination for messages.
+type notifier interface {
+	Notify(ctx context.Context, ev notifyEvent, text string) error
+	onlyFailures() bool
+}
+
+var (
+	notifiers      []notifier
+	notifyTemplate *template.Template
+)
+
+// setupNotifiers builds the configured notifiers; a broken configuration
+// stops the server rather than losing messages silently.
+func setupNotifiers() {
+	cfg := config.Notify
+	text := cfg.Template
+	if text == "" {
+		text = defaultNotifyTemplate
+	}
+	var err error
+	if notifyTemplate, err = template.New("notify").Parse(text); err != nil {
+		log.Fatalf("Invalid notification template: %v", err)
+	}
+	client := &http.Client{Timeout: notifyTimeout}
+	for _, wc := range cfg.Webhooks {
+		if wc.URL == "" {
+			log.Fatalf("A notification webhook in the configuration has no url")
+		}
+		notifiers = append(notifiers, &webhookNotifier{cfg: wc, http: client})
+	}
+	for _, sc := range cfg.Slack {
+		if os.Getenv(sc.URLEnv) == "" {
+			log.Fatalf("Slack notifications need the webhook URL in $%s", sc.URLEnv)
+		}
+		notifiers = append(notifiers, &slackNotifier{cfg: sc, http: client})
+	}
+	for _, ec := range cfg.Email {
+		if ec.Host == "" || ec.From == "" || len(ec.To) == 0 {
+			log.Fatalf("Email notifications need host, from and to")
+		}
+		notifiers = append(notifiers, &emailNotifier{cfg: ec})
+	}
+}
+
+// resultLink opens path in the app's page, or is empty without a base URL.
+func resultLink(path string) string {
+	if config.Notify.BaseURL == "" {
+		return ""
+	}
+	return strings.TrimRight(config.Notify.BaseURL, "/") + "/?show=" + url.QueryEscape(path)
+}
+
+// notify sends ev to every notifier in the background; failures are
+// logged.
+func notify(ev notifyEvent) {
+	if len(notifiers) == 0 {
+		return
+	}
+	ev.ElapsedMS = ev.Elapsed.Milliseconds()
+	var text bytes.Buffer
+	if err := notifyTemplate.Execute(&text, ev); err != nil {
+		log.Printf("Failed to render the notification for %s: %v", ev.Name, err)
+		return
+	}
+	for _, n := range notifiers {
+		if n.onlyFailures() && !ev.Failed() {
+			continue
+		}
+		go func(n notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			if err := n.Notify(ctx, ev, strings.TrimSpace(text.String())); err != nil {
+				log.Printf("Notification about %s failed: %v", ev.Name, err)
+			}
+		}(n)
+	}
+}
+
+// postJSON posts body and expects a 2xx answer.
+func postJSON(ctx context.Context, client *http.Client, target, token string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+type webhookNotifier struct {
+	cfg  notifyWebhookConfig
+	http *http.Client
+}
+
+func (w *webhookNotifier) onlyFailures() bool { return w.cfg.OnlyFailures }
+
+func (w *webhookNotifier) Notify(ctx context.Context, ev notifyEvent, text string) error {
+	body := struct {
+		notifyEvent
+		Text string `json:"text"`
+	}{ev, text}
+	token := ""
+	if w.cfg.TokenEnv != "" {
+		token = os.Getenv(w.cfg.TokenEnv)
+	}
+	return postJSON(ctx, w.http, w.cfg.URL, token, body)
+}
+
+type slackNotifier struct {
+	cfg  slackConfig
+	http *http.Client
+}
+
+func (s *slackNotifier) onlyFailures() bool { return s.cfg.OnlyFailures }
+
+func (s *slackNotifier) Notify(ctx context.Context, ev notifyEvent, text string) error {
+	return postJSON(ctx, s.http, os.Getenv(s.cfg.URLEnv), "", map[string]string{"text": text})
+}
+
+type emailNotifier struct {
+	cfg emailConfig
+}
+
+func (e *emailNotifier) onlyFailures() bool { return e.cfg.OnlyFailures }
+
+// Notify sends the message as plain text, its first line the subject.
+// net/smtp takes no context, so ctx doesn't bound the send.
+func (e *emailNotifier) Notify(ctx context.Context, ev notifyEvent, text string) error {
+	port := e.cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		auth = smtp.PlainAuth("", e.cfg.Username, os.Getenv(e.cfg.PasswordEnv), e.cfg.Host)
+	}
+	subject, body, _ := strings.Cut(text, "\n")
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", ev.At.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.TrimSpace(body), "\n", "\r\n") + "\r\n")
+	addr := e.cfg.Host + ":" + strconv.Itoa(port)
+	return smtp.SendMail(addr, auth, e.cfg.From, e.cfg.To, msg.Bytes())
+}
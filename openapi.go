@@ -0,0 +1,300 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// schemaOf derives a JSON schema from the Go type the handlers actually
+// bind or return, so the document can't drift from the code.
+func schemaOf(t reflect.Type) gin.H {
+	if t == reflect.TypeOf(time.Time{}) {
+		return gin.H{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := schemaOf(t.Elem())
+		s["nullable"] = true
+		return s
+	case reflect.String:
+		return gin.H{"type": "string"}
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return gin.H{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return gin.H{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return gin.H{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		props := gin.H{}
+		var required []string
+		addStructFields(t, props, &required)
+		s := gin.H{"type": "object", "properties": props}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	// interface{}: any JSON value
+	return gin.H{}
+}
+
+func addStructFields(t reflect.Type, props gin.H, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" {
+			addStructFields(f.Type, props, required)
+			continue
+		}
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = schemaOf(f.Type)
+		if strings.Contains(f.Tag.Get("binding"), "required") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func ref(name string) gin.H {
+	return gin.H{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonBody(schema gin.H) gin.H {
+	return gin.H{"content": gin.H{"application/json": gin.H{"schema": schema}}}
+}
+
+func jsonResponse(description string, schema gin.H) gin.H {
+	r := jsonBody(schema)
+	r["description"] = description
+	return r
+}
+
+func errorResponses() gin.H {
+	return gin.H{
+		"400":     jsonResponse("Invalid request or failed statement", ref("Error")),
+		"401":     jsonResponse("Authentication required", ref("Error")),
+		"404":     jsonResponse("Saved connection not found", ref("Error")),
+		"502":     jsonResponse("Database unreachable", ref("Error")),
+		"default": jsonResponse("Unexpected error", ref("Error")),
+	}
+}
+
+func operation(summary string, responses gin.H) gin.H {
+	for code, r := range errorResponses() {
+		if _, ok := responses[code]; !ok {
+			responses[code] = r
+		}
+	}
+	return gin.H{"summary": summary, "responses": responses}
+}
+
+func buildOpenAPI() gin.H {
+	type errorBody struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	type errorEnvelope struct {
+		Error errorBody `json:"error"`
+	}
+
+	queryOp := operation("Run a statement", gin.H{
+		"200": jsonResponse("Result set or affected row count", ref("QueryResponse")),
+	})
+	queryOp["requestBody"] = jsonBody(ref("QueryRequest"))
+
+	validateOp := operation("Parse and plan a statement without running it", gin.H{
+		"200": jsonResponse("Problems with their line and column", ref("ValidateResponse")),
+	})
+	validateOp["requestBody"] = jsonBody(ref("QueryRequest"))
+
+	formatOp := operation("Pretty-print SQL", gin.H{
+		"200": jsonResponse("The formatted SQL", ref("FormatResponse")),
+	})
+	formatOp["requestBody"] = jsonBody(ref("FormatRequest"))
+
+	saveOp := operation("Create or replace a saved connection", gin.H{
+		"200": jsonResponse("Saved connection without password", ref("Connection")),
+	})
+	saveOp["requestBody"] = jsonBody(ref("Connection"))
+
+	deleteOp := operation("Delete a saved connection", gin.H{
+		"204": gin.H{"description": "Deleted"},
+	})
+	deleteOp["parameters"] = []gin.H{{
+		"name": "name", "in": "path", "required": true, "schema": gin.H{"type": "string"},
+	}}
+
+	schemaGet := operation("List tables and columns of a saved connection", gin.H{
+		"200": jsonResponse("Tables", gin.H{"type": "object", "properties": gin.H{
+			"tables": gin.H{"type": "array", "items": ref("Table")},
+		}}),
+	})
+	schemaGet["parameters"] = []gin.H{{
+		"name": "connection", "in": "query", "required": true, "schema": gin.H{"type": "string"},
+	}}
+	schemaPost := operation("List tables and columns of any connection", gin.H{
+		"200": jsonResponse("Tables", gin.H{"type": "object", "properties": gin.H{
+			"tables": gin.H{"type": "array", "items": ref("Table")},
+		}}),
+	})
+	schemaPost["requestBody"] = jsonBody(ref("Target"))
+
+	completeGet := operation("Autocompletion for a saved connection", gin.H{
+		"200": jsonResponse("Tables, columns and keywords", ref("Completions")),
+	})
+	completeGet["parameters"] = []gin.H{
+		{"name": "connection", "in": "query", "required": true, "schema": gin.H{"type": "string"}},
+		{"name": "prefix", "in": "query", "schema": gin.H{"type": "string"}, "description": "Only names starting with this, case-insensitively"},
+		{"name": "table", "in": "query", "schema": gin.H{"type": "string"}, "description": "Only the columns of this table"},
+		{"name": "refresh", "in": "query", "schema": gin.H{"type": "boolean"}, "description": "Reload the cached catalog first"},
+	}
+	completePost := operation("Autocompletion for any connection", gin.H{
+		"200": jsonResponse("Tables, columns and keywords", ref("Completions")),
+	})
+	completePost["requestBody"] = jsonBody(ref("CompleteRequest"))
+
+	joinOp := operation("Suggest join conditions between two tables", gin.H{
+		"200": jsonResponse("Ranked conditions and a starter SELECT", ref("JoinResponse")),
+	})
+	joinOp["requestBody"] = jsonBody(ref("JoinRequest"))
+
+	graphOp := operation("Foreign key relationships as a graph", gin.H{
+		"200": jsonResponse("Tables as nodes, foreign keys as edges", ref("Graph")),
+	})
+	graphOp["requestBody"] = jsonBody(ref("GraphRequest"))
+
+	auditOp := operation("Audit log, newest first", gin.H{
+		"200": jsonResponse("Entries", gin.H{"type": "object", "properties": gin.H{
+			"entries": gin.H{"type": "array", "items": ref("AuditEntry")},
+		}}),
+	})
+	auditOp["parameters"] = []gin.H{
+		{"name": "ref", "in": "query", "schema": gin.H{"type": "string"}, "description": "Only entries with this reference, e.g. an export id"},
+		{"name": "limit", "in": "query", "schema": gin.H{"type": "integer", "default": 100}},
+	}
+
+	idParam := func(description string) []gin.H {
+		return []gin.H{{
+			"name": "id", "in": "path", "required": true, "schema": gin.H{"type": "string"}, "description": description,
+		}}
+	}
+	tokenCreate := operation("Create an API token for the caller", gin.H{
+		"201": jsonResponse("The token; its secret is only shown here", ref("TokenCreated")),
+		"403": jsonResponse("Called with a token", ref("Error")),
+	})
+	tokenCreate["requestBody"] = jsonBody(ref("TokenRequest"))
+	tokenRevoke := operation("Revoke one of the caller's tokens", gin.H{
+		"204": gin.H{"description": "Revoked"},
+	})
+	tokenRevoke["parameters"] = idParam("Token id")
+
+	editorSubmit := operation("Start a statement in the background for an external editor", gin.H{
+		"202": jsonResponse("The run, to poll until it is done", ref("EditorRun")),
+	})
+	editorSubmit["requestBody"] = jsonBody(ref("QueryRequest"))
+	editorStatus := operation("State and result of a run", gin.H{
+		"200": jsonResponse("The run", ref("EditorRun")),
+	})
+	editorStatus["parameters"] = append(idParam("Run id"), gin.H{
+		"name": "wait", "in": "query", "schema": gin.H{"type": "integer"},
+		"description": "Seconds to wait for the run to finish, at most 30",
+	})
+	editorCancel := operation("Cancel a run", gin.H{
+		"200": jsonResponse("The run", ref("EditorRun")),
+	})
+	editorCancel["parameters"] = idParam("Run id")
+
+	return gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":   "SimpleAdmin1File API",
+			"version": "1",
+		},
+		"servers": []gin.H{{"url": "/api/v1"}},
+		"paths": gin.H{
+			"/query":    gin.H{"post": queryOp},
+			"/validate": gin.H{"post": validateOp},
+			"/format":   gin.H{"post": formatOp},
+			"/connections": gin.H{
+				"get": operation("List saved connections", gin.H{
+					"200": jsonResponse("Saved connections without passwords", gin.H{"type": "object", "properties": gin.H{
+						"connections": gin.H{"type": "array", "items": ref("Connection")},
+					}}),
+				}),
+				"post": saveOp,
+			},
+			"/connections/{name}": gin.H{"delete": deleteOp},
+			"/schema": gin.H{
+				"get":  schemaGet,
+				"post": schemaPost,
+			},
+			"/complete": gin.H{
+				"get":  completeGet,
+				"post": completePost,
+			},
+			"/join":  gin.H{"post": joinOp},
+			"/graph": gin.H{"post": graphOp},
+			"/audit": gin.H{"get": auditOp},
+			"/tokens": gin.H{
+				"get": operation("List the caller's API tokens", gin.H{
+					"200": jsonResponse("Tokens without secrets", gin.H{"type": "object", "properties": gin.H{
+						"tokens": gin.H{"type": "array", "items": ref("Token")},
+					}}),
+				}),
+				"post": tokenCreate,
+			},
+			"/tokens/{id}":      gin.H{"delete": tokenRevoke},
+			"/editor/runs":      gin.H{"post": editorSubmit},
+			"/editor/runs/{id}": gin.H{"get": editorStatus, "delete": editorCancel},
+		},
+		"components": gin.H{
+			"schemas": gin.H{
+				"Error":            schemaOf(reflect.TypeOf(errorEnvelope{})),
+				"Target":           schemaOf(reflect.TypeOf(apiTarget{})),
+				"QueryRequest":     schemaOf(reflect.TypeOf(apiQueryRequest{})),
+				"QueryResponse":    schemaOf(reflect.TypeOf(apiQueryResponse{})),
+				"ValidateResponse": schemaOf(reflect.TypeOf(apiValidateResponse{})),
+				"FormatRequest":    schemaOf(reflect.TypeOf(apiFormatRequest{})),
+				"FormatResponse":   schemaOf(reflect.TypeOf(apiFormatResponse{})),
+				"Connection":       schemaOf(reflect.TypeOf(savedConnection{})),
+				"Table":            schemaOf(reflect.TypeOf(tableInfo{})),
+				"CompleteRequest":  schemaOf(reflect.TypeOf(apiCompleteRequest{})),
+				"Completions":      schemaOf(reflect.TypeOf(apiCompleteResponse{})),
+				"JoinRequest":      schemaOf(reflect.TypeOf(apiJoinRequest{})),
+				"JoinResponse":     schemaOf(reflect.TypeOf(apiJoinResponse{})),
+				"GraphRequest":     schemaOf(reflect.TypeOf(apiGraphRequest{})),
+				"Graph":            schemaOf(reflect.TypeOf(schemaGraph{})),
+				"AuditEntry":       schemaOf(reflect.TypeOf(auditEntry{})),
+				"Token":            schemaOf(reflect.TypeOf(apiToken{})),
+				"TokenRequest":     schemaOf(reflect.TypeOf(apiTokenRequest{})),
+				"TokenCreated":     schemaOf(reflect.TypeOf(apiTokenResponse{})),
+				"EditorRun":        schemaOf(reflect.TypeOf(apiEditorRun{})),
+			},
+		},
+	}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  gin.H
+)
+
+func openAPIHandler(c *gin.Context) {
+	openAPIOnce.Do(func() { openAPIDoc = buildOpenAPI() })
+	c.JSON(http.StatusOK, openAPIDoc)
+}
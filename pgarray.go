@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// sqlArray is an array value: a PostgreSQL array, one level of nesting per
+// dimension, or a ClickHouse Array. Pages show it bracketed,
+// [[1, 2], [3, NULL]]; the API sends a JSON array.
+type sqlArray []interface{}
+
+func (a sqlArray) String() string {
+	parts := make([]string, len(a))
+	for i, v := range a {
+		parts[i] = arrayElementText(v)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func arrayElementText(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return strconv.Quote(t)
+	case time.Time:
+		return displayTime(t)
+	case []byte:
+		return displayBinary(t)
+	case fmt.Stringer:
+		return t.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func (a sqlArray) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}(a))
+}
+
+// literal writes the array back in PostgreSQL's input syntax, every element
+// quoted so the server casts it to the column's element type.
+func (a sqlArray) literal() string {
+	parts := make([]string, len(a))
+	for i, v := range a {
+		switch t := v.(type) {
+		case nil:
+			parts[i] = "NULL"
+		case sqlArray:
+			parts[i] = t.literal()
+		default:
+			var s string
+			switch t := v.(type) {
+			case time.Time:
+				s = t.Format("2006-01-02 15:04:05.999999-07:00")
+			case []byte:
+				s = `\x` + hex.EncodeToString(t)
+			default:
+				s = fmt.Sprint(t)
+			}
+			parts[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+		}
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// nestArray splits pgx's flat elements by the array's dimensions.
+func nestArray(elements []interface{}, dims []pgtype.ArrayDimension) sqlArray {
+	if len(dims) <= 1 {
+		return append(sqlArray{}, elements...)
+	}
+	n := int(dims[0].Length)
+	size := len(elements) / n
+	nested := make(sqlArray, n)
+	for i := range nested {
+		nested[i] = nestArray(elements[i*size:(i+1)*size], dims[1:])
+	}
+	return nested
+}
+
+// decodePoolArray decodes an array column of the pgx pool, which Values
+// returns flattened, keeping its dimensions.
+func decodePoolArray(types *pgtype.Map, oid uint32, format int16, raw []byte) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var a pgtype.Array[interface{}]
+	if err := types.Scan(oid, format, raw, &a); err != nil {
+		return nil, err
+	}
+	for i, e := range a.Elements {
+		a.Elements[i] = canonicalUUID(exactDecimal(e))
+	}
+	return nestArray(a.Elements, a.Dims), nil
+}
+
+// isArrayType tells the array types pgx's database/sql driver names: the
+// PostgreSQL catalog name, element type prefixed with an underscore.
+func isArrayType(dbType string) bool {
+	return strings.HasPrefix(dbType, "_")
+}
+
+// parseArrayText reads an array as database/sql gets it, in PostgreSQL's
+// text form: {1,2,NULL}, {{a,"b c"},{d,e}}, with an optional [1:2]=
+// bounds prefix. Elements of numeric and boolean arrays are converted by
+// elemType; the rest stay text.
+func parseArrayText(s, elemType string) (sqlArray, error) {
+	if strings.HasPrefix(s, "[") {
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			return nil, errors.New("malformed array bounds")
+		}
+		s = s[i+1:]
+	}
+	p := arrayParser{s: s, kind: columnKind(elemType)}
+	a, err := p.parse()
+	if err == nil && p.i != len(p.s) {
+		err = errors.New("trailing text after array")
+	}
+	return a, err
+}
+
+type arrayParser struct {
+	s    string
+	i    int
+	kind string
+}
+
+func (p *arrayParser) parse() (sqlArray, error) {
+	if p.i >= len(p.s) || p.s[p.i] != '{' {
+		return nil, errors.New("array must start with {")
+	}
+	p.i++
+	a := sqlArray{}
+	if p.i < len(p.s) && p.s[p.i] == '}' {
+		p.i++
+		return a, nil
+	}
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case '{':
+			sub, err := p.parse()
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, sub)
+		case '"':
+			var b strings.Builder
+			for p.i++; p.i < len(p.s) && p.s[p.i] != '"'; p.i++ {
+				if p.s[p.i] == '\\' && p.i+1 < len(p.s) {
+					p.i++
+				}
+				b.WriteByte(p.s[p.i])
+			}
+			p.i++
+			a = append(a, p.element(b.String()))
+		default:
+			start := p.i
+			for p.i < len(p.s) && p.s[p.i] != ',' && p.s[p.i] != '}' {
+				p.i++
+			}
+			if text := strings.TrimSpace(p.s[start:p.i]); strings.EqualFold(text, "NULL") {
+				a = append(a, nil)
+			} else {
+				a = append(a, p.element(text))
+			}
+		}
+		if p.i >= len(p.s) {
+			break
+		}
+		p.i++
+		if p.s[p.i-1] == '}' {
+			return a, nil
+		}
+		if p.s[p.i-1] != ',' {
+			return nil, fmt.Errorf("unexpected %q in array", p.s[p.i-1])
+		}
+	}
+	return nil, errors.New("unterminated array")
+}
+
+func (p *arrayParser) element(text string) interface{} {
+	switch p.kind {
+	case kindInt:
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n
+		}
+	case kindFloat:
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+	case kindBool:
+		return text == "t"
+	}
+	return text
+}
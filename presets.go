@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// filterPreset is a named set of grid filters and sort order for one table.
+// Only the filters are kept, not SQL, so relative values like "now-7d" are
+// evaluated each time the preset is applied. Shared presets are visible to
+// everyone using this instance; others only to their creator.
+type filterPreset struct {
+	ID        int64
+	Name      string
+	Filters   []gridFilter
+	Sort      string
+	Desc      bool
+	Shared    bool
+	CreatedBy string
+}
+
+func listPresets(ctx context.Context, target, table, user string) ([]filterPreset, error) {
+	rows, err := store.QueryContext(ctx, `
+		SELECT id, name, filters, sort, descending, shared, created_by
+		FROM filter_presets
+		WHERE target = ? AND table_name = ? AND (shared != 0 OR created_by = ?)
+		ORDER BY name, created_by`, target, table, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var presets []filterPreset
+	for rows.Next() {
+		var fp filterPreset
+		var filters string
+		if err := rows.Scan(&fp.ID, &fp.Name, &filters, &fp.Sort, &fp.Desc, &fp.Shared, &fp.CreatedBy); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(filters), &fp.Filters); err != nil {
+			return nil, fmt.Errorf("preset %q: %w", fp.Name, err)
+		}
+		presets = append(presets, fp)
+	}
+	return presets, rows.Err()
+}
+
+// savePreset stores the preset, replacing one of the same name by the same
+// user on the same table.
+func savePreset(ctx context.Context, target, table string, fp filterPreset) error {
+	filters, err := json.Marshal(fp.Filters)
+	if err != nil {
+		return err
+	}
+	_, err = store.ExecContext(ctx, `
+		INSERT INTO filter_presets (target, table_name, name, filters, sort, descending, shared, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (target, table_name, name, created_by) DO UPDATE SET
+			filters = excluded.filters, sort = excluded.sort, descending = excluded.descending,
+			shared = excluded.shared, created_at = excluded.created_at`,
+		target, table, fp.Name, string(filters), fp.Sort, fp.Desc, fp.Shared, fp.CreatedBy, time.Now().Unix())
+	return err
+}
+
+// deletePreset removes a preset; only its creator may.
+func deletePreset(ctx context.Context, id int64, user string) error {
+	res, err := store.ExecContext(ctx, "DELETE FROM filter_presets WHERE id = ? AND created_by = ?", id, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("the preset is gone or was saved by someone else")
+	}
+	return nil
+}
+
+// applyPresetAction handles the preset controls of the grid form:
+// preset_action=apply replaces the filters and sort of st with the chosen
+// preset, save stores the current ones under preset_name, and delete removes
+// the chosen preset. It returns a line to show above the grid.
+func applyPresetAction(ctx context.Context, c *gin.Context, p connParams, table tableInfo, st *gridState) (string, error) {
+	user := currentIdentity(c).User
+	action := c.PostForm("preset_action")
+	if action == "" {
+		return "", nil
+	}
+	if action == "save" {
+		name := strings.TrimSpace(c.PostForm("preset_name"))
+		if name == "" {
+			return "", fmt.Errorf("enter a name for the preset")
+		}
+		fp := filterPreset{
+			Name:      name,
+			Filters:   st.Filters,
+			Sort:      st.Sort,
+			Desc:      st.Desc,
+			Shared:    c.PostForm("preset_shared") != "",
+			CreatedBy: user,
+		}
+		if err := savePreset(ctx, p.auditTarget(), st.Table, fp); err != nil {
+			return "", fmt.Errorf("failed to save the preset: %v", err)
+		}
+		return fmt.Sprintf("Saved preset %q.", name), nil
+	}
+
+	id, err := strconv.ParseInt(c.PostForm("preset"), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("choose a preset first")
+	}
+	switch action {
+	case "delete":
+		if err := deletePreset(ctx, id, user); err != nil {
+			return "", err
+		}
+		return "Deleted the preset.", nil
+	case "apply":
+		presets, err := listPresets(ctx, p.auditTarget(), st.Table, user)
+		if err != nil {
+			return "", err
+		}
+		for _, fp := range presets {
+			if fp.ID != id {
+				continue
+			}
+			// columns may have been dropped since the preset was saved
+			var skipped []string
+			st.Filters = nil
+			for _, f := range fp.Filters {
+				if _, ok := findColumn(table, f.Column); ok {
+					st.Filters = append(st.Filters, f)
+				} else {
+					skipped = append(skipped, f.Column)
+				}
+			}
+			st.Sort, st.Desc = "", fp.Desc
+			if _, ok := findColumn(table, fp.Sort); ok {
+				st.Sort = fp.Sort
+			}
+			st.Cursor, st.History = "", nil
+			if len(skipped) > 0 {
+				return fmt.Sprintf("Applied %q without filters on missing columns: %s.", fp.Name, strings.Join(skipped, ", ")), nil
+			}
+			return fmt.Sprintf("Applied %q.", fp.Name), nil
+		}
+		return "", fmt.Errorf("the preset is gone")
+	}
+	return "", fmt.Errorf("unknown preset action %q", action)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Long-running InnoDB DDL (ALTER TABLE, OPTIMIZE TABLE which is rebuilt as
+// ALTER ... FORCE) reports WORK_COMPLETED/WORK_ESTIMATED on its stage events.
+const mysqlProgressQuery = `
+SELECT t.PROCESSLIST_ID,
+       COALESCE(t.PROCESSLIST_INFO, ''),
+       s.EVENT_NAME,
+       COALESCE(s.WORK_COMPLETED, 0),
+       COALESCE(s.WORK_ESTIMATED, 0),
+       COALESCE(s.TIMER_WAIT, 0)
+FROM performance_schema.events_stages_current s
+JOIN performance_schema.threads t ON t.THREAD_ID = s.THREAD_ID
+WHERE s.EVENT_NAME LIKE 'stage/innodb/alter%'
+   OR s.EVENT_NAME = 'stage/sql/copy to tmp table'`
+
+const mysqlProgressInstrumentsQuery = `
+SELECT
+  (SELECT COUNT(*) FROM performance_schema.setup_instruments
+    WHERE NAME LIKE 'stage/innodb/alter%' AND ENABLED = 'YES'),
+  (SELECT COUNT(*) FROM performance_schema.setup_consumers
+    WHERE NAME IN ('events_stages_current', 'events_stages_history') AND ENABLED = 'YES')`
+
+type stageProgress struct {
+	ProcessID int64
+	Statement string
+	Stage     string
+	Completed int64
+	Estimated int64
+	Elapsed   time.Duration
+}
+
+func (s stageProgress) Percent() float64 {
+	if s.Estimated == 0 {
+		return 0
+	}
+	return float64(s.Completed) * 100 / float64(s.Estimated)
+}
+
+// Remaining extrapolates the time left from the rate observed so far.
+func (s stageProgress) Remaining() time.Duration {
+	if s.Completed == 0 || s.Completed >= s.Estimated {
+		return 0
+	}
+	rate := float64(s.Elapsed) / float64(s.Completed)
+	return time.Duration(rate * float64(s.Estimated-s.Completed)).Round(time.Second)
+}
+
+func mysqlProgressHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	if p.Driver != "mysql" {
+		renderError(c, http.StatusBadRequest, "progress.html", "Progress reporting is only available for MySQL")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		renderError(c, http.StatusServiceUnavailable, "progress.html", "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, mysqlProgressQuery)
+	if err != nil {
+		log.Printf("Progress query failed: %v", err)
+		renderError(c, http.StatusBadRequest, "progress.html", "Failed to read performance_schema: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var stages []stageProgress
+	for rows.Next() {
+		var s stageProgress
+		var timerWait int64
+		if err := rows.Scan(&s.ProcessID, &s.Statement, &s.Stage, &s.Completed, &s.Estimated, &timerWait); err != nil {
+			renderError(c, http.StatusInternalServerError, "progress.html", "Failed to scan row: %v", err)
+			return
+		}
+		// TIMER_WAIT is reported in picoseconds
+		s.Elapsed = time.Duration(timerWait / 1000).Round(time.Second)
+		stages = append(stages, s)
+	}
+	if err := rows.Err(); err != nil {
+		renderError(c, http.StatusInternalServerError, "progress.html", "Error during row iteration: %v", err)
+		return
+	}
+
+	// Without the stage instruments and consumers nothing is ever reported,
+	// so tell the user how to switch them on instead of showing an empty list.
+	instrumented := true
+	if len(stages) == 0 {
+		var instruments, consumers int
+		if err := db.QueryRowContext(ctx, mysqlProgressInstrumentsQuery).Scan(&instruments, &consumers); err == nil {
+			instrumented = instruments > 0 && consumers > 0
+		}
+	}
+
+	render(c, http.StatusOK, progressView{
+		Stages:       stages,
+		Instrumented: instrumented,
+		Polling:      len(stages) > 0,
+	})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryHandler runs the statement from the query form on the selected
+// driver and renders result.html.
+func queryHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	query := c.PostForm("query")
+	if changesSchema(query) {
+		defer invalidateSchema(p)
+	}
+
+	// BEGIN/COMMIT/ROLLBACK управляют транзакцией сессии
+	switch txControl(query) {
+	case "begin":
+		beginTx(c)
+		return
+	case "commit":
+		commitTx(c)
+		return
+	case "rollback":
+		rollbackTx(c)
+		return
+	}
+	// политики организации могут запретить запрос
+	afterHooks, ok := pageQueryHooks(c, p, query)
+	if !ok {
+		return
+	}
+	defer afterHooks()
+
+	if s := activeTx(c); s != nil {
+		queryInTx(c, s, query)
+		return
+	}
+
+	// Обработка адреса сервера и порта
+	if err := p.validateAddress(); err != nil {
+		render(c, http.StatusBadRequest, resultError(nil, "%v", err))
+		return
+	}
+	driver, ok := dbDrivers[p.Driver]
+	if !ok {
+		render(c, http.StatusBadRequest, resultError(nil, "Unsupported database driver %q", p.Driver))
+		return
+	}
+
+	// повторный SELECT отдаётся из кэша результатов
+	cacheKey := resultCacheKey(p, query, nil)
+	if c.PostForm("no_cache") == "" {
+		if rs, fetched, ok := lookupResult(cacheKey); ok {
+			renderResultSet(c, rs, fetched)
+			return
+		}
+	}
+
+	// не больше query_limit.per_host запросов одновременно на сервер
+	release, err := acquireQuerySlot(c.Request.Context(), p, c.PostForm("queue_ticket"))
+	if err != nil {
+		render(c, http.StatusServiceUnavailable, resultError(nil, "%v", err))
+		return
+	}
+	defer release()
+
+	log.Printf("%s is attempting to connect to %s database at %s", currentIdentity(c).User, p.Driver, p.address())
+
+	// Создаем контекст с таймаутом
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	notices := requestNotices(c)
+
+	conn, err := driver.Connect(ctx, p, notices)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		render(c, http.StatusServiceUnavailable, resultError(notices, "Failed to connect to database: %v", err))
+		return
+	}
+	defer conn.Close()
+	if c.PostForm("conn_tab") == "" {
+		rememberConnection(c, p)
+	}
+
+	ctx, stats := withStats(ctx)
+	started := time.Now()
+
+	// DML/DDL has no result set, report what the statement did instead
+	if !returnsRows(query) {
+		msg, err := conn.Exec(ctx, query)
+		if err != nil {
+			log.Printf("Statement execution failed: %v", err)
+			render(c, http.StatusBadRequest, queryFailure(err, notices))
+			return
+		}
+		stats.Elapsed = time.Since(started)
+		v := resultMessage(notices, msg)
+		v.Stats = stats
+		render(c, http.StatusOK, v)
+		return
+	}
+
+	rs, err := conn.Query(ctx, query, config.MaxRows)
+	if err != nil {
+		log.Printf("Query execution failed: %v", err)
+		render(c, http.StatusBadRequest, queryFailure(err, notices))
+		return
+	}
+	stats.Elapsed = time.Since(started)
+	stats.Rows, stats.Truncated = len(rs.Rows), rs.Truncated
+	// the second run under EXPLAIN ANALYZE is opt-in and only for reads
+	if p.Driver == "postgres" && c.PostForm("analyze_stats") != "" && cacheableQuery(query) {
+		if err := explainAnalyze(ctx, conn, query, stats); err != nil {
+			notices.add("WARNING", "EXPLAIN ANALYZE failed: "+err.Error())
+		}
+	}
+	rs.Stats = stats
+	if hasTimes(rs.Rows) {
+		rs.ServerZone = serverZone(ctx, conn, p.Driver)
+	}
+	storeResult(cacheKey, rs)
+	renderResultSet(c, rs, time.Time{})
+}
+
+// formResult reads the result of the query form's SELECT for the tools
+// built on it, charts and share links: from the result cache when the page
+// just showed it, otherwise by running it under the per-server limit. Rows
+// come back transcoded; status goes with the error.
+func formResult(c *gin.Context, p connParams, query string) (*resultSet, int, error) {
+	cacheKey := resultCacheKey(p, query, nil)
+	rs, _, cached := lookupResult(cacheKey)
+	if !cached || c.PostForm("no_cache") != "" {
+		release, err := acquireQuerySlot(c.Request.Context(), p, c.PostForm("queue_ticket"))
+		if err != nil {
+			return nil, http.StatusServiceUnavailable, err
+		}
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+
+		db, err := openDB(ctx, p)
+		if err != nil {
+			log.Printf("Database connection failed: %v", err)
+			return nil, http.StatusServiceUnavailable, fmt.Errorf("failed to connect to database: %v", err)
+		}
+		defer db.Close()
+
+		if rs, err = fetchResultMax(ctx, db, config.MaxRows, query); err != nil {
+			log.Printf("Query execution failed: %v", err)
+			return nil, http.StatusBadRequest, err
+		}
+		if p.Driver == "postgres" {
+			postgisToGeoJSON(ctx, sqlGeoQueryer(db), rs)
+		}
+		// the cache holds rows as the server sent them
+		storeResult(cacheKey, rs)
+	}
+	if err := p.transcodeRows(rs.Rows); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return rs, http.StatusOK, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryLimitConfig caps how many queries run at once against one database
+// server, so a single user can't take all of its connection slots.
+type queryLimitConfig struct {
+	// PerHost is the number of simultaneous queries per server; 0 is no
+	// limit
+	PerHost int `json:"per_host"`
+	// QueueTimeout is how long a query waits for a slot, in seconds
+	QueueTimeout int `json:"queue_timeout"`
+}
+
+// queryTicket is a query waiting for a slot. ID lets the page ask for its
+// position while the request is blocked.
+type queryTicket struct {
+	id    string
+	ready chan struct{}
+}
+
+// hostLimiter hands out query slots per server, first come first served.
+// A finished query passes its slot straight to the head of the queue.
+type hostLimiter struct {
+	mu      sync.Mutex
+	running map[string]int
+	queues  map[string][]*queryTicket
+}
+
+var queryLimiter = &hostLimiter{
+	running: make(map[string]int),
+	queues:  make(map[string][]*queryTicket),
+}
+
+// limiterHost keys the limiter: one server may hold several databases, and
+// they share its connection slots.
+func (p connParams) limiterHost() string {
+	return p.Driver + "://" + p.address()
+}
+
+// acquire waits for a query slot on host and returns the function giving it
+// back. ticket may be empty when nobody asks for the position.
+func (l *hostLimiter) acquire(ctx context.Context, host, ticket string) (func(), error) {
+	limit := config.QueryLimit.PerHost
+	if limit <= 0 {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	if l.running[host] < limit && len(l.queues[host]) == 0 {
+		l.running[host]++
+		l.mu.Unlock()
+		return l.releaser(host), nil
+	}
+	t := &queryTicket{id: ticket, ready: make(chan struct{})}
+	l.queues[host] = append(l.queues[host], t)
+	l.mu.Unlock()
+
+	select {
+	case <-t.ready:
+		return l.releaser(host), nil
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-t.ready:
+		// granted while giving up: hand the slot on
+		l.release(host)
+	default:
+		l.remove(host, t)
+	}
+	return nil, fmt.Errorf("%d queries are already running on %s; gave up waiting for a free slot", limit, host)
+}
+
+func (l *hostLimiter) releaser(host string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.release(host)
+			l.mu.Unlock()
+		})
+	}
+}
+
+// release frees a slot, or passes it on to the next queued query. Callers
+// hold l.mu.
+func (l *hostLimiter) release(host string) {
+	if q := l.queues[host]; len(q) > 0 {
+		l.queues[host] = q[1:]
+		if len(q) == 1 {
+			delete(l.queues, host)
+		}
+		close(q[0].ready)
+		return
+	}
+	if l.running[host]--; l.running[host] <= 0 {
+		delete(l.running, host)
+	}
+}
+
+func (l *hostLimiter) remove(host string, t *queryTicket) {
+	q := l.queues[host]
+	for i, queued := range q {
+		if queued == t {
+			l.queues[host] = append(q[:i:i], q[i+1:]...)
+			break
+		}
+	}
+	if len(l.queues[host]) == 0 {
+		delete(l.queues, host)
+	}
+}
+
+// position reports where the ticket waits, 1 being next.
+func (l *hostLimiter) position(ticket string) (host string, pos int, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for host, q := range l.queues {
+		for i, t := range q {
+			if t.id == ticket {
+				return host, i + 1, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// acquireQuerySlot waits for a slot on the connection's server for at most
+// the configured queue timeout, or until ctx ends.
+func acquireQuerySlot(ctx context.Context, p connParams, ticket string) (func(), error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.QueryLimit.QueueTimeout)*time.Second)
+	defer cancel()
+	return queryLimiter.acquire(ctx, p.limiterHost(), ticket)
+}
+
+// queuePositionHandler tells the page where its blocked query waits; it is
+// polled while the query form is submitting.
+func queuePositionHandler(c *gin.Context) {
+	host, pos, ok := queryLimiter.position(c.Query("ticket"))
+	if !ok || c.Query("ticket") == "" {
+		c.String(http.StatusOK, "")
+		return
+	}
+	c.String(http.StatusOK, "Queued: position %d for %s", pos, host)
+}
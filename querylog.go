@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// clickhouseFailure is the result.html data for a failed ClickHouse query:
+// the message, the server exception with its stack when there is one, and
+// the query_id the query ran under so it can be found in system.query_log.
+func clickhouseFailure(err error, queryID string, notices *noticeLog) resultView {
+	v := resultError(notices, "Query error: %v", err)
+	v.QueryID = queryID
+	var ex *clickhouse.Exception
+	if errors.As(err, &ex) {
+		v.Exception = ex
+	}
+	return v
+}
+
+// queryLogColumns are the system.query_log columns worth a post-mortem.
+const queryLogColumns = `event_time, type, query_duration_ms, read_rows, read_bytes, memory_usage,
+	exception_code, exception, stack_trace, user, query`
+
+// queryLogHandler shows the system.query_log entries of a query_id.
+func queryLogHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	queryID := c.PostForm("query_id")
+	if p.Driver != "clickhouse" || queryID == "" {
+		render(c, http.StatusBadRequest, resultError(nil, "A ClickHouse query_id is required"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		render(c, http.StatusServiceUnavailable, resultError(nil, "Failed to connect to database: %v", err))
+		return
+	}
+	defer db.Close()
+
+	// query_log is written in the background; flushing needs the SYSTEM
+	// FLUSH LOGS grant, without it the entry may just take a few seconds
+	if _, err := db.ExecContext(ctx, "SYSTEM FLUSH LOGS"); err != nil {
+		log.Printf("SYSTEM FLUSH LOGS failed: %v", err)
+	}
+	rs, err := fetchResult(ctx, db,
+		"SELECT "+queryLogColumns+" FROM system.query_log WHERE query_id = ? ORDER BY event_time_microseconds", queryID)
+	if err != nil {
+		render(c, http.StatusBadRequest, resultError(nil, "Failed to read system.query_log: %v", err))
+		return
+	}
+	if len(rs.Rows) == 0 {
+		v := resultMessage(nil, fmt.Sprintf("No system.query_log entries for %s yet, the log is flushed every few seconds.", queryID))
+		v.QueryID = queryID
+		render(c, http.StatusOK, v)
+		return
+	}
+	renderResult(c, rs.Columns, rs.Rows)
+}
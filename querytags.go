@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// queryTag is a key=value label attached to every query of a connection so
+// that the server side can attribute cost, e.g. team=data or purpose=adhoc.
+type queryTag struct {
+	Key   string
+	Value string
+}
+
+var (
+	tagKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`)
+	tagValuePattern = regexp.MustCompile(`^[A-Za-z0-9_./@ -]{0,64}$`)
+)
+
+// parseQueryTags reads "team=data, purpose=adhoc". Keys and values are kept
+// to characters every backend carries unescaped.
+func parseQueryTags(s string) ([]queryTag, error) {
+	var tags []queryTag
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || !tagKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid query tag %q, expected key=value", part)
+		}
+		if !tagValuePattern.MatchString(value) {
+			return nil, fmt.Errorf("invalid value for query tag %s", key)
+		}
+		tags = append(tags, queryTag{Key: key, Value: value})
+	}
+	return tags, nil
+}
+
+func (p connParams) queryTags() ([]queryTag, error) {
+	return parseQueryTags(p.QueryTags)
+}
+
+// clickhouseLogComment renders the tags as a JSON object for the log_comment
+// setting, which lands in system.query_log.
+func clickhouseLogComment(tags []queryTag) string {
+	m := make(map[string]string, len(tags))
+	for _, t := range tags {
+		m[t.Key] = t.Value
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
+
+// postgresApplicationName puts the tags into application_name, which
+// pg_stat_activity and log_line_prefix %a show. The server cuts it at 63
+// bytes.
+func postgresApplicationName(tags []queryTag) string {
+	parts := make([]string, len(tags))
+	for i, t := range tags {
+		parts[i] = t.Key + "=" + t.Value
+	}
+	return strings.Join(parts, ";")
+}
+
+// mysqlConnectionAttributes renders the tags for the connectionAttributes
+// DSN parameter; they show up in performance_schema.session_connect_attrs.
+func mysqlConnectionAttributes(tags []queryTag) string {
+	parts := make([]string, len(tags))
+	for i, t := range tags {
+		parts[i] = t.Key + ":" + t.Value
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryVariable is a {{name}} placeholder of a saved query, filled in when
+// it runs and sent as a bind parameter, never spliced into the SQL.
+// {{name:type}} picks the input and checks the value; {{name=value}} and
+// {{name:type=value}} give a default, which scheduled runs use.
+type queryVariable struct {
+	Name string
+	// Type is text, int, number, date, datetime or bool
+	Type       string
+	Default    string
+	HasDefault bool
+}
+
+var queryVariableTypes = map[string]bool{"text": true, "int": true, "number": true, "date": true, "datetime": true, "bool": true}
+
+var queryVariableSpec = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_]*)\s*(?::\s*([a-z]+)\s*)?(?:=(.*))?$`)
+
+// Input is the HTML input type of the variable's field.
+func (v queryVariable) Input() string {
+	switch v.Type {
+	case "int", "number":
+		return "number"
+	case "date":
+		return "date"
+	case "datetime":
+		return "datetime-local"
+	}
+	return "text"
+}
+
+// InputDefault is the default as the field takes it.
+func (v queryVariable) InputDefault() string {
+	if v.Type == "datetime" {
+		if s, err := v.value(v.Default); err == nil {
+			return strings.Replace(s.(string), " ", "T", 1)
+		}
+	}
+	return v.Default
+}
+
+// value checks s and converts it to the parameter sent.
+func (v queryVariable) value(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		if !v.HasDefault {
+			return nil, fmt.Errorf("%s needs a value", v.Name)
+		}
+		s = v.Default
+	}
+	switch v.Type {
+	case "int":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a whole number, not %q", v.Name, s)
+		}
+		return n, nil
+	case "number":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number, not %q", v.Name, s)
+		}
+		return f, nil
+	case "date":
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return nil, fmt.Errorf("%s must be a date like 2024-01-31, not %q", v.Name, s)
+		}
+	case "datetime":
+		// the browser's datetime-local sends 2024-01-31T09:30
+		for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02 15:04:05"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.Format("2006-01-02 15:04:05"), nil
+			}
+		}
+		return nil, fmt.Errorf("%s must be a date and time like 2024-01-31 09:30, not %q", v.Name, s)
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false, not %q", v.Name, s)
+		}
+		return b, nil
+	}
+	return s, nil
+}
+
+// queryTemplate is a query split at its placeholders. A placeholder that is
+// a whole string literal, '{{day}}', is a parameter like a bare one, so
+// templates can be written the way the SQL reads; inside a longer literal
+// or a comment braces are just text.
+type queryTemplate struct {
+	Variables []queryVariable
+	// parts alternate text and variable references; variable is -1 for
+	// text
+	parts []templatePart
+}
+
+type templatePart struct {
+	text     string
+	variable int
+}
+
+// parseQueryTemplate finds the placeholders of query. A query without any
+// has no variables and binds as it is.
+func parseQueryTemplate(query string) (*queryTemplate, error) {
+	t := &queryTemplate{}
+	index := make(map[string]int)
+	text := 0
+	addVariable := func(start, end int, spec string) error {
+		m := queryVariableSpec.FindStringSubmatch(spec)
+		if m == nil {
+			return fmt.Errorf("invalid placeholder {{%s}}", spec)
+		}
+		v := queryVariable{Name: m[1], Type: m[2], Default: strings.TrimSpace(m[3]), HasDefault: strings.Contains(spec, "=")}
+		if v.Type == "" {
+			v.Type = "text"
+		}
+		if !queryVariableTypes[v.Type] {
+			return fmt.Errorf("{{%s}}: unknown type %q; use text, int, number, date, datetime or bool", spec, v.Type)
+		}
+		if v.HasDefault {
+			if _, err := v.value(v.Default); err != nil {
+				return fmt.Errorf("{{%s}}: the default: %v", spec, err)
+			}
+		}
+		i, seen := index[v.Name]
+		if !seen {
+			i = len(t.Variables)
+			index[v.Name] = i
+			t.Variables = append(t.Variables, v)
+		} else if (m[2] != "" || v.HasDefault) && t.Variables[i] != v {
+			// a repeat may be bare; one with a type or default must match
+			return fmt.Errorf("{{%s}} is declared twice differently; declare it once and repeat it as {{%s}}", v.Name, v.Name)
+		}
+		t.parts = append(t.parts, templatePart{text: query[text:start], variable: -1}, templatePart{variable: i})
+		text = end
+		return nil
+	}
+
+	for i := 0; i < len(query); i++ {
+		switch {
+		case strings.HasPrefix(query[i:], "--"):
+			i = skipTo(query, i+2, "\n")
+		case strings.HasPrefix(query[i:], "/*"):
+			i = skipTo(query, i+2, "*/") + 1
+		case query[i] == '\'' || query[i] == '"' || query[i] == '`':
+			quote := query[i]
+			end := closingQuote(query, i)
+			inner := query[i+1 : end]
+			if quote == '\'' && strings.HasPrefix(inner, "{{") && strings.HasSuffix(inner, "}}") && !strings.Contains(inner[2:len(inner)-2], "}}") {
+				if err := addVariable(i, end+1, inner[2:len(inner)-2]); err != nil {
+					return nil, err
+				}
+			}
+			i = end
+		case strings.HasPrefix(query[i:], "{{"):
+			end := strings.Index(query[i+2:], "}}")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed placeholder at %q", truncate(20, query[i:]))
+			}
+			if err := addVariable(i, i+2+end+2, query[i+2:i+2+end]); err != nil {
+				return nil, err
+			}
+			i += 2 + end + 1
+		}
+	}
+	t.parts = append(t.parts, templatePart{text: query[text:], variable: -1})
+	return t, nil
+}
+
+// skipTo returns the index of the last byte of the first end at or after
+// from, or the end of s.
+func skipTo(s string, from int, end string) int {
+	if j := strings.Index(s[from:], end); j >= 0 {
+		return from + j + len(end) - 1
+	}
+	return len(s) - 1
+}
+
+// closingQuote finds the quote ending the literal opened at start; doubled
+// quotes and backslash escapes stay inside it.
+func closingQuote(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(s) - 1
+}
+
+// bind writes the query with the driver's parameter markers and returns
+// the parameters in their order; values are by variable name.
+func (t *queryTemplate) bind(driver string, values map[string]string) (string, []interface{}, error) {
+	var b strings.Builder
+	var args []interface{}
+	for _, part := range t.parts {
+		if part.variable < 0 {
+			b.WriteString(part.text)
+			continue
+		}
+		v := t.Variables[part.variable]
+		arg, err := v.value(values[v.Name])
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, arg)
+		b.WriteString(placeholder(driver, len(args)))
+	}
+	return b.String(), args, nil
+}
+
+// check tells whether values fill in every variable.
+func (t *queryTemplate) check(values map[string]string) error {
+	for _, v := range t.Variables {
+		if _, err := v.value(values[v.Name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unattended tells whether the template can run without anyone filling it
+// in, every variable having a default.
+func (t *queryTemplate) Unattended() bool {
+	for _, v := range t.Variables {
+		if !v.HasDefault {
+			return false
+		}
+	}
+	return true
+}
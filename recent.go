@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRecentConnections is how many connections the index page offers again.
+const maxRecentConnections = 10
+
+// recentConnection is a connection the query form used lately, kept without
+// its password so that picking it fills in everything else.
+type recentConnection struct {
+	ID             int64
+	Driver         string
+	Server         string
+	Username       string
+	Database       string
+	TLSFingerprint string
+	QueryTags      string
+	Charset        string
+	ResultEncoding string
+	UsedAt         time.Time
+}
+
+// Label describes the connection in the list.
+func (r recentConnection) Label() string {
+	s := r.Server
+	if r.Username != "" {
+		s = r.Username + "@" + s
+	}
+	if r.Database != "" {
+		s += "/" + r.Database
+	}
+	return s
+}
+
+// rememberConnection moves the form's connection to the top of the list,
+// dropping the oldest past maxRecentConnections. Failures are only logged:
+// the list is a convenience.
+func rememberConnection(c *gin.Context, p connParams) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	owner := preferenceOwner(c)
+	_, err := store.ExecContext(ctx, `
+		INSERT INTO recent_connections (owner, driver, server, username, database, tls_fingerprint, query_tags,
+			charset, result_encoding, used_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (owner, driver, server, username, database) DO UPDATE SET
+			tls_fingerprint = excluded.tls_fingerprint, query_tags = excluded.query_tags,
+			charset = excluded.charset, result_encoding = excluded.result_encoding, used_at = excluded.used_at`,
+		owner, p.Driver, p.Server, p.Username, p.Database, p.TLSFingerprint, p.QueryTags,
+		p.Charset, p.ResultEncoding, time.Now().UnixNano())
+	if err == nil {
+		_, err = store.ExecContext(ctx, `
+			DELETE FROM recent_connections WHERE owner = ? AND id NOT IN (
+				SELECT id FROM recent_connections WHERE owner = ? ORDER BY used_at DESC LIMIT ?)`,
+			owner, owner, maxRecentConnections)
+	}
+	if err != nil {
+		log.Printf("Failed to remember the connection to %s: %v", p.address(), err)
+	}
+}
+
+func listRecentConnections(ctx context.Context, owner string) ([]recentConnection, error) {
+	rows, err := store.QueryContext(ctx, `
+		SELECT id, driver, server, username, database, tls_fingerprint, query_tags, charset, result_encoding, used_at
+		FROM recent_connections WHERE owner = ? ORDER BY used_at DESC`, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var recent []recentConnection
+	for rows.Next() {
+		var r recentConnection
+		var usedAt int64
+		if err := rows.Scan(&r.ID, &r.Driver, &r.Server, &r.Username, &r.Database, &r.TLSFingerprint, &r.QueryTags,
+			&r.Charset, &r.ResultEncoding, &usedAt); err != nil {
+			return nil, err
+		}
+		r.UsedAt = time.Unix(0, usedAt)
+		recent = append(recent, r)
+	}
+	return recent, rows.Err()
+}
+
+// recentConnectionsHandler renders the list for the index page.
+func recentConnectionsHandler(c *gin.Context) {
+	recent, err := listRecentConnections(c.Request.Context(), preferenceOwner(c))
+	if err != nil {
+		renderError(c, http.StatusInternalServerError, "recent.html", "Failed to read recent connections: %v", err)
+		return
+	}
+	render(c, http.StatusOK, recentConnectionsView{Recent: recent})
+}
+
+// forgetRecentHandler drops one connection from the list, or all of them
+// without an id.
+func forgetRecentHandler(c *gin.Context) {
+	owner := preferenceOwner(c)
+	var err error
+	if id, parseErr := strconv.ParseInt(c.PostForm("id"), 10, 64); parseErr == nil {
+		_, err = store.ExecContext(c.Request.Context(), "DELETE FROM recent_connections WHERE owner = ? AND id = ?", owner, id)
+	} else {
+		_, err = store.ExecContext(c.Request.Context(), "DELETE FROM recent_connections WHERE owner = ?", owner)
+	}
+	if err != nil {
+		renderError(c, http.StatusInternalServerError, "recent.html", "Failed to forget recent connections: %v", err)
+		return
+	}
+	recentConnectionsHandler(c)
+}
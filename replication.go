@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// replicationLagWarning marks a link as unhealthy on the page.
+const replicationLagWarning = 60 * time.Second
+
+// replicationLink is one replication stream as seen from the connected
+// server: a standby of this primary, this server's own upstream, or a
+// replicated ClickHouse table.
+type replicationLink struct {
+	Name  string
+	Peer  string
+	State string
+	Lag   time.Duration
+	// LagKnown is false when the server doesn't report a lag
+	LagKnown bool
+	// LagBytes is the WAL not yet replayed, PostgreSQL primaries only
+	LagBytes sql.NullInt64
+	Error    string
+}
+
+func (l replicationLink) Healthy() bool {
+	return l.Error == "" && l.Lag < replicationLagWarning
+}
+
+func (l *replicationLink) setLag(seconds sql.NullFloat64) {
+	l.Lag = time.Duration(seconds.Float64 * float64(time.Second)).Round(time.Millisecond)
+	l.LagKnown = seconds.Valid
+}
+
+// replicationStatus returns the role of the server and its links.
+func replicationStatus(ctx context.Context, db *sql.DB, driver string) (string, []replicationLink, error) {
+	switch driver {
+	case "postgres":
+		return postgresReplication(ctx, db)
+	case "mysql":
+		links, err := mysqlReplication(ctx, db)
+		return "replica", links, err
+	case "clickhouse":
+		links, err := clickhouseReplication(ctx, db)
+		return "replicated tables", links, err
+	}
+	return "", nil, fmt.Errorf("replication status is not supported for %q", driver)
+}
+
+func postgresReplication(ctx context.Context, db *sql.DB) (string, []replicationLink, error) {
+	var standby bool
+	if err := db.QueryRowContext(ctx, "SELECT pg_is_in_recovery()").Scan(&standby); err != nil {
+		return "", nil, err
+	}
+	var links []replicationLink
+	if standby {
+		var l replicationLink
+		var lag sql.NullFloat64
+		err := db.QueryRowContext(ctx, `
+			SELECT COALESCE(r.sender_host, ''), COALESCE(r.status, 'not streaming'),
+			       EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+			FROM (SELECT 1) one
+			LEFT JOIN pg_stat_wal_receiver r ON true`).Scan(&l.Peer, &l.State, &lag)
+		if err != nil {
+			return "", nil, err
+		}
+		l.Name = "upstream"
+		l.setLag(lag)
+		if l.State != "streaming" {
+			l.Error = "WAL receiver is not streaming"
+		}
+		return "standby", append(links, l), nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT COALESCE(application_name, ''), COALESCE(client_addr::text, 'local'),
+		       COALESCE(state, '') || CASE WHEN sync_state IS NULL THEN '' ELSE ', ' || sync_state END,
+		       EXTRACT(EPOCH FROM replay_lag),
+		       pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn)::bigint
+		FROM pg_stat_replication
+		ORDER BY application_name`)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l replicationLink
+		var lag sql.NullFloat64
+		if err := rows.Scan(&l.Name, &l.Peer, &l.State, &lag, &l.LagBytes); err != nil {
+			return "", nil, err
+		}
+		l.setLag(lag)
+		links = append(links, l)
+	}
+	return "primary", links, rows.Err()
+}
+
+// mysqlReplication reads SHOW REPLICA STATUS, or SHOW SLAVE STATUS before
+// 8.0.22, one row per channel. Columns are picked by name since their set
+// and naming differ between versions and MariaDB.
+func mysqlReplication(ctx context.Context, db *sql.DB) ([]replicationLink, error) {
+	rs, err := fetchResult(ctx, db, "SHOW REPLICA STATUS")
+	if err != nil {
+		if rs, err = fetchResult(ctx, db, "SHOW SLAVE STATUS"); err != nil {
+			return nil, err
+		}
+	}
+	var links []replicationLink
+	for _, row := range rs.Rows {
+		field := func(names ...string) string {
+			for _, name := range names {
+				for i, col := range rs.Columns {
+					if col == name && row[i] != nil {
+						return fmt.Sprint(row[i])
+					}
+				}
+			}
+			return ""
+		}
+		l := replicationLink{
+			Name: field("Channel_Name", "Connection_name"),
+			Peer: field("Source_Host", "Master_Host") + ":" + field("Source_Port", "Master_Port"),
+			State: fmt.Sprintf("IO %s, SQL %s",
+				field("Replica_IO_Running", "Slave_IO_Running"), field("Replica_SQL_Running", "Slave_SQL_Running")),
+			Error: field("Last_IO_Error") + field("Last_SQL_Error"),
+		}
+		if l.Name == "" {
+			l.Name = "default"
+		}
+		if s, err := strconv.ParseFloat(field("Seconds_Behind_Source", "Seconds_Behind_Master"), 64); err == nil {
+			l.setLag(sql.NullFloat64{Float64: s, Valid: true})
+		}
+		if l.Error == "" && (field("Replica_IO_Running", "Slave_IO_Running") != "Yes" ||
+			field("Replica_SQL_Running", "Slave_SQL_Running") != "Yes") {
+			l.Error = "replication threads are not running"
+		}
+		links = append(links, l)
+	}
+	return links, nil
+}
+
+func clickhouseReplication(ctx context.Context, db *sql.DB) ([]replicationLink, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT database || '.' || table,
+		       toString(active_replicas) || '/' || toString(total_replicas) || ' replicas active',
+		       'queue ' || toString(queue_size) || ', inserts ' || toString(inserts_in_queue) || ', merges ' || toString(merges_in_queue),
+		       toFloat64(absolute_delay),
+		       multiIf(is_session_expired, 'ZooKeeper session expired', is_readonly, 'read-only', '')
+		FROM system.replicas
+		ORDER BY absolute_delay DESC, database, table`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []replicationLink
+	for rows.Next() {
+		var l replicationLink
+		var lag float64
+		if err := rows.Scan(&l.Name, &l.Peer, &l.State, &lag, &l.Error); err != nil {
+			return nil, err
+		}
+		l.setLag(sql.NullFloat64{Float64: lag, Valid: true})
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// replicationHandler shows replication lag and state; the page refreshes
+// itself while open.
+func replicationHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		renderError(c, http.StatusServiceUnavailable, "replication.html", "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	role, links, err := replicationStatus(ctx, db, p.Driver)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "replication.html", "Failed to read replication status: %v", err)
+		return
+	}
+	render(c, http.StatusOK, replicationView{
+		Role:    role,
+		Links:   links,
+		Checked: time.Now().Format("15:04:05"),
+	})
+}
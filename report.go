@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	reportPageRows = 40
+	// rows beyond this are left out of the report, which says so
+	reportMaxRows = 10000
+)
+
+// reportPage is one printed page of the report.
+type reportPage struct {
+	Number int
+	Rows   [][]interface{}
+}
+
+// paginate splits rows into pages of size rows; there is always at least
+// one page so the header and the "no rows" note get printed.
+func paginate(rows [][]interface{}, size int) []reportPage {
+	pages := []reportPage{{Number: 1}}
+	for i, row := range rows {
+		if i > 0 && i%size == 0 {
+			pages = append(pages, reportPage{Number: len(pages) + 1})
+		}
+		pages[len(pages)-1].Rows = append(pages[len(pages)-1].Rows, row)
+	}
+	return pages
+}
+
+// reportHandler renders the query result as a standalone, print-ready HTML
+// page: title, query, connection, who and when, then the rows in pages with
+// repeated headers. Browsers print it to PDF as laid out. Reports are
+// exports, so they carry an export id and go to the audit log.
+func reportHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	query := c.PostForm("query")
+	pageRows, err := strconv.Atoi(c.DefaultPostForm("page_rows", strconv.Itoa(reportPageRows)))
+	if err != nil || pageRows < 1 {
+		pageRows = reportPageRows
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "report.html", format, args...)
+	}
+	if !returnsRows(query) {
+		fail(http.StatusBadRequest, "Reports are built from queries that return rows")
+		return
+	}
+	guard, err := guardQuery(c.Request.Context(), newQueryEvent(c, p, "report", query))
+	if err != nil {
+		fail(http.StatusForbidden, "%v", err)
+		return
+	}
+	defer guard.doneAfter(c)
+	release, err := acquireQuerySlot(c.Request.Context(), p, "")
+	if err != nil {
+		fail(http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	defer release()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	rs, err := fetchResultMax(ctx, db, reportMaxRows, query)
+	if err == nil {
+		err = p.transcodeRows(rs.Rows)
+	}
+	if err != nil {
+		log.Printf("Query execution failed: %v", err)
+		fail(http.StatusBadRequest, "Query error: %v", err)
+		return
+	}
+
+	mark := exportMark{
+		ID:      randomID(8),
+		User:    currentIdentity(c).User,
+		At:      time.Now(),
+		Visible: config.ExportWatermark,
+	}
+	auditExport(c, mark, p, "report", query, len(rs.Rows))
+
+	title := strings.TrimSpace(c.PostForm("title"))
+	if title == "" {
+		title = "Query report"
+	}
+	pages := paginate(rs.Rows, pageRows)
+	render(c, http.StatusOK, reportView{
+		Title:      title,
+		Query:      query,
+		Connection: p.auditTarget(),
+		Mark:       mark,
+		Watermark:  mark.notice(),
+		Generated:  mark.At.Format("2006-01-02 15:04:05 MST"),
+		Columns:    rs.Columns,
+		Pages:      pages,
+		PageCount:  len(pages),
+		Rows:       len(rs.Rows),
+		Truncated:  rs.Truncated,
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resultRow is one grid row. Dups is how many times the row occurs in the
+// fetched result, filled in when duplicate highlighting is on; Index is
+// its position there, which hidden duplicates don't shift.
+type resultRow struct {
+	Cells []interface{}
+	Dups  int
+	Index int
+}
+
+// rowKey builds a comparison key that keeps values of different types apart,
+// so the string "1" and the integer 1 are not duplicates.
+func rowKey(values []interface{}) string {
+	var b strings.Builder
+	for _, v := range values {
+		fmt.Fprintf(&b, "%T:%v\x00", v, v)
+	}
+	return b.String()
+}
+
+// dedupeRows applies the grid's "distinct" and "duplicates" toggles. It
+// returns the rows to show and how many duplicates were dropped.
+func dedupeRows(rows [][]interface{}, distinct, highlight bool) ([]resultRow, int) {
+	out := make([]resultRow, 0, len(rows))
+	if !distinct && !highlight {
+		for i, values := range rows {
+			out = append(out, resultRow{Cells: values, Index: i})
+		}
+		return out, 0
+	}
+
+	counts := make(map[string]int)
+	keys := make([]string, len(rows))
+	for i, values := range rows {
+		keys[i] = rowKey(values)
+		counts[keys[i]]++
+	}
+
+	seen := make(map[string]bool)
+	removed := 0
+	for i, values := range rows {
+		row := resultRow{Cells: values, Index: i}
+		if highlight {
+			row.Dups = counts[keys[i]]
+		}
+		if distinct {
+			if seen[keys[i]] {
+				removed++
+				continue
+			}
+			seen[keys[i]] = true
+		}
+		out = append(out, row)
+	}
+	return out, removed
+}
+
+// renderResult renders a successful result set into result.html.
+func renderResult(c *gin.Context, columns []string, rows [][]interface{}) {
+	renderResultSet(c, &resultSet{Columns: columns, Rows: rows}, time.Time{})
+}
+
+// renderResultSet renders a result fetched at the given time; a non-zero
+// time marks it as served from the result cache.
+func renderResultSet(c *gin.Context, rs *resultSet, fetched time.Time) {
+	columns, rows := rs.Columns, rs.Rows
+	if err := connParamsFromForm(c).transcodeRows(rows); err != nil {
+		render(c, http.StatusBadRequest, resultError(requestNotices(c), "%v", err))
+		return
+	}
+	keys, err := parseJSONKeys(c.PostForm("json_keys"), columns)
+	if err != nil {
+		render(c, http.StatusBadRequest, resultError(requestNotices(c), "%v", err))
+		return
+	}
+	loc, err := requestZone(c)
+	if err != nil {
+		render(c, http.StatusBadRequest, resultError(requestNotices(c), "%v", err))
+		return
+	}
+	rows = inZone(rows, loc)
+	jsonCols := append(jsonColumns(rs), make([]bool, len(keys))...)
+	columns, rows = expandJSONKeys(columns, rows, keys)
+	distinct := c.PostForm("distinct") != ""
+	highlight := c.PostForm("duplicates") != ""
+	view, removed := dedupeRows(rows, distinct, highlight)
+
+	duplicated := 0
+	for _, row := range view {
+		if row.Dups > 1 {
+			duplicated++
+		}
+	}
+
+	truncatedAt := 0
+	if rs.Truncated {
+		truncatedAt = len(rows)
+	}
+	render(c, http.StatusOK, resultView{
+		Columns:     columns,
+		Rows:        view,
+		JSONColumns: jsonCols,
+		JSONKeys:    len(keys),
+		TimeZone:    zoneName(loc),
+		ServerZone:  rs.ServerZone,
+		HasTimes:    hasTimes(rows),
+		Stats:       rs.Stats,
+		Removed:     removed,
+		Duplicated:  duplicated,
+		TruncatedAt: truncatedAt,
+		Cached:      !fetched.IsZero(),
+		CachedAge:   time.Since(fetched),
+		Notices:     requestNotices(c).list(),
+	})
+}
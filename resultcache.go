@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+type resultCacheConfig struct {
+	// TTL is how long a result is served from the cache, in seconds; 0
+	// turns the cache off
+	TTL int `json:"ttl"`
+	// MaxEntries caps the number of cached results
+	MaxEntries int `json:"max_entries"`
+	// MaxRows is the largest result kept
+	MaxRows int `json:"max_rows"`
+}
+
+type cachedResult struct {
+	rs      *resultSet
+	fetched time.Time
+}
+
+// resultCache holds results of read-only queries by connection and query,
+// so dashboards re-running the same SELECT every few seconds hit the
+// server once per TTL.
+var resultCache = struct {
+	sync.Mutex
+	entries map[string]cachedResult
+}{entries: make(map[string]cachedResult)}
+
+// cacheableQuery accepts plain reads only: no locking reads, SELECT INTO or
+// data-modifying CTEs. Volatile functions such as random() can't be told
+// apart, which is what "bypass cache" is for.
+func cacheableQuery(query string) bool {
+	switch firstKeyword(query) {
+	case "SELECT", "WITH", "SHOW", "VALUES", "TABLE":
+	default:
+		return false
+	}
+	for _, t := range tokenizeSQL(query) {
+		switch t.upper() {
+		case "INSERT", "UPDATE", "DELETE", "MERGE", "INTO", "RETURNING", "SHARE":
+			return false
+		}
+	}
+	return true
+}
+
+// resultCacheKey identifies a query on a connection, with every connection
+// setting (credentials included, so users with other grants never share
+// results). It is "" when the cache is off or the query isn't cacheable.
+func resultCacheKey(p connParams, query string, args []interface{}) string {
+	if config.ResultCache.TTL <= 0 || !cacheableQuery(query) {
+		return ""
+	}
+	data, err := json.Marshal(struct {
+		Conn  connParams
+		Query string
+		Args  []interface{}
+	}{p, query, args})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// clone copies the rows, since results are transcoded in place.
+func (rs *resultSet) clone() *resultSet {
+	out := *rs
+	out.Rows = make([][]interface{}, len(rs.Rows))
+	for i, row := range rs.Rows {
+		out.Rows[i] = append([]interface{}(nil), row...)
+	}
+	return &out
+}
+
+// lookupResult returns a copy of a cached result that is still fresh and
+// when it was fetched.
+func lookupResult(key string) (*resultSet, time.Time, bool) {
+	if key == "" {
+		return nil, time.Time{}, false
+	}
+	resultCache.Lock()
+	defer resultCache.Unlock()
+	e, ok := resultCache.entries[key]
+	if !ok || time.Since(e.fetched) > time.Duration(config.ResultCache.TTL)*time.Second {
+		return nil, time.Time{}, false
+	}
+	return e.rs.clone(), e.fetched, true
+}
+
+// storeResult caches a copy of rs under key, evicting expired entries and
+// then the oldest when the cache is full.
+func storeResult(key string, rs *resultSet) {
+	if key == "" || len(rs.Rows) > config.ResultCache.MaxRows {
+		return
+	}
+	resultCache.Lock()
+	defer resultCache.Unlock()
+	ttl := time.Duration(config.ResultCache.TTL) * time.Second
+	if len(resultCache.entries) >= config.ResultCache.MaxEntries {
+		var oldest string
+		for k, e := range resultCache.entries {
+			if time.Since(e.fetched) > ttl {
+				delete(resultCache.entries, k)
+			} else if oldest == "" || e.fetched.Before(resultCache.entries[oldest].fetched) {
+				oldest = k
+			}
+		}
+		if len(resultCache.entries) >= config.ResultCache.MaxEntries && oldest != "" {
+			delete(resultCache.entries, oldest)
+		}
+	}
+	resultCache.entries[key] = cachedResult{
+		rs:      rs.clone(),
+		fetched: time.Now(),
+	}
+}
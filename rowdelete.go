@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rowDeletePreview caps the matching rows shown before a delete.
+const rowDeletePreview = 20
+
+// deleteRowHandler previews the DELETE of a row by primary key together
+// with the number of rows it matches and the first of them, and runs it once
+// the previewed statement is confirmed. Matching several rows needs an
+// extra confirmation, and the delete is rolled back unless exactly the
+// counted rows go.
+func deleteRowHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name, key := c.PostForm("table"), c.PostForm("key")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "rowdelete.html", format, args...)
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	table, pk, err := rowTable(ctx, db, p.Driver, name)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	where, args, err := keyCondition(p.Driver, pk, key, nil)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	target := quoteIdent(p.Driver, qualifiedName(table))
+	st := rowStatement{Query: "DELETE FROM " + target + " WHERE " + where, Args: args}
+
+	n, err := countKeyRows(ctx, db, p.Driver, table, pk, key)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to count matching rows: %v", err)
+		return
+	}
+	if confirmed := c.PostForm("confirm") == st.Digest(); !confirmed || n == 0 || !manyConfirmed(c, n) {
+		rs, err := fetchResult(ctx, db, "SELECT * FROM "+target+" WHERE "+where+
+			fmt.Sprintf(" LIMIT %d", rowDeletePreview), args...)
+		if err != nil {
+			fail(http.StatusBadRequest, "Query failed: %v", err)
+			return
+		}
+		page := rowDeleteView{
+			Table:     name,
+			Key:       key,
+			Statement: st,
+			Matches:   n,
+			Columns:   rs.Columns,
+			Rows:      rs.Rows,
+		}
+		if confirmed && n > 1 {
+			page.Problem = fmt.Sprintf("The statement matches %d rows; tick the box to delete all of them.", n)
+		}
+		render(c, http.StatusOK, page)
+		return
+	}
+
+	if err := execRows(ctx, db, st, n); err != nil {
+		fail(http.StatusBadRequest, "Delete failed: %v", err)
+		return
+	}
+
+	user := currentIdentity(c).User
+	log.Printf("%s deleted %d row(s) of %s on %s", user, n, name, p.address())
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "row_delete",
+		Target: p.auditTarget(),
+		Query:  st.Query,
+		Detail: fmt.Sprintf("%s, %d row(s), params: %s", name, n, strings.Join(st.Params(), ", ")),
+	})
+	render(c, http.StatusOK, rowDeleteView{
+		Done:      fmt.Sprintf("Deleted %d row(s) from %s.", n, name),
+		Statement: st,
+	})
+}
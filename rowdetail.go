@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rowDetailField is one column of an expanded row with its full value.
+type rowDetailField struct {
+	Name string
+	Type string
+	Key  bool
+	Null bool
+	// Text is the whole value, binary values in hex
+	Text string
+	JSON bool
+	// Binary values can be downloaded as a file
+	Binary bool
+}
+
+// rowLink opens the grid of a related table filtered to the related rows.
+type rowLink struct {
+	Table   string
+	Filters []gridFilter
+	Label   string
+}
+
+// newRowLink links to the rows of table whose columns equal values; it
+// returns false when a value is NULL and nothing can match.
+func newRowLink(table tableInfo, columns []string, values []interface{}, driver string) (rowLink, bool) {
+	l := rowLink{Table: qualifiedName(table)}
+	conds := make([]string, len(columns))
+	for i, col := range columns {
+		if values[i] == nil {
+			return l, false
+		}
+		text := keyValue(driver, values[i])
+		l.Filters = append(l.Filters, gridFilter{Column: col, Text: "=" + text})
+		conds[i] = col + " = " + text
+	}
+	l.Label = fmt.Sprintf("%s (%s)", l.Table, strings.Join(conds, ", "))
+	return l, true
+}
+
+// rowRelations links the row to the rows it references and the rows
+// referencing it, following the declared foreign keys.
+func rowRelations(driver string, table tableInfo, keys []foreignKey, rs *resultSet) (refs, referencedBy []rowLink) {
+	value := func(col string) interface{} {
+		for i, name := range rs.Columns {
+			if name == col {
+				return rs.Rows[0][i]
+			}
+		}
+		return nil
+	}
+	values := func(cols []string) []interface{} {
+		out := make([]interface{}, len(cols))
+		for i, col := range cols {
+			out[i] = value(col)
+		}
+		return out
+	}
+	for _, fk := range keys {
+		if sameTable(table, fk.Schema, fk.Table) {
+			ref := tableInfo{Schema: fk.RefSchema, Name: fk.RefTable}
+			if l, ok := newRowLink(ref, fk.RefColumns, values(fk.Columns), driver); ok {
+				refs = append(refs, l)
+			}
+		}
+		if sameTable(table, fk.RefSchema, fk.RefTable) {
+			child := tableInfo{Schema: fk.Schema, Name: fk.Table}
+			if l, ok := newRowLink(child, fk.Columns, values(fk.RefColumns), driver); ok {
+				referencedBy = append(referencedBy, l)
+			}
+		}
+	}
+	return refs, referencedBy
+}
+
+// rowDetailHandler shows one row vertically with untruncated values and
+// links to related rows.
+func rowDetailHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name, key := c.PostForm("table"), c.PostForm("key")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "rowdetail.html", format, args...)
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	table, pk, err := rowTable(ctx, db, p.Driver, name)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	rs, err := fetchKeyRows(ctx, db, p.Driver, table, pk, key, false)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to load the row: %v", err)
+		return
+	}
+	if err := p.transcodeRows(rs.Rows); err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	loc, err := requestZone(c)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	rs.Rows = inZone(rs.Rows, loc)
+
+	v := rowDetailView{Table: name, Key: key}
+	doc := make(map[string]interface{}, len(rs.Columns))
+	for i, col := range rs.Columns {
+		f := rowDetailField{Name: col, Key: containsString(pk, col)}
+		if info, ok := findColumn(table, col); ok {
+			f.Type = info.Type
+		}
+		switch val := rs.Rows[0][i].(type) {
+		case nil:
+			f.Null = true
+		case []byte:
+			f.Text, f.Binary = fmt.Sprintf("%x", val), true
+		case time.Time:
+			f.Text = displayTime(val)
+		case string:
+			f.Text, f.JSON = val, looksLikeJSON(val)
+			if f.JSON {
+				f.Text = jsonPretty(val)
+			}
+		default:
+			f.Text = keyValue(p.Driver, val)
+		}
+		v.Fields = append(v.Fields, f)
+		doc[col] = rs.Rows[0][i]
+	}
+	if data, err := json.MarshalIndent(doc, "", "  "); err == nil {
+		v.JSON = string(data)
+	}
+
+	keys, err := listForeignKeys(ctx, db, p.Driver)
+	if err != nil {
+		// the row is still worth showing without the links
+		log.Printf("Failed to read foreign keys: %v", err)
+	}
+	v.References, v.ReferencedBy = rowRelations(p.Driver, table, keys, rs)
+
+	render(c, http.StatusOK, v)
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rows are edited by primary key only: the key travels through the page as
+// an encoded cursor of its values (see encodeCursor), and every statement
+// binds values as parameters.
+
+// rowField is one column of the row edit form.
+type rowField struct {
+	Name     string
+	Type     string
+	Value    string
+	Null     bool
+	Nullable bool
+	Key      bool
+	// Binary values are shown but can't be edited as text
+	Binary bool
+	// Default is the column default expression; UseDefault leaves the
+	// column out of an INSERT
+	Default    string
+	UseDefault bool
+}
+
+// sameValue reports whether two fields hold the same value.
+func (f rowField) sameValue(o rowField) bool {
+	return f.Null == o.Null && (f.Null || f.Value == o.Value)
+}
+
+func newRowField(col columnInfo, pk []string) rowField {
+	f := rowField{
+		Name:     col.Name,
+		Type:     col.Type,
+		Nullable: col.Nullable,
+		Key:      containsString(pk, col.Name),
+		Binary:   columnKind(col.Type) == kindBinary,
+	}
+	if col.Default != nil {
+		f.Default = *col.Default
+	}
+	return f
+}
+
+func lookupTable(ctx context.Context, db *sql.DB, driver, name string) (tableInfo, error) {
+	tables, err := listTables(ctx, db, driver)
+	if err != nil {
+		return tableInfo{}, fmt.Errorf("failed to read columns: %w", err)
+	}
+	table, ok := findTable(tables, name)
+	if !ok {
+		return tableInfo{}, fmt.Errorf("table not found: %s", name)
+	}
+	return table, nil
+}
+
+// rowTable looks up a table and its primary key for row editing.
+func rowTable(ctx context.Context, db *sql.DB, driver, name string) (tableInfo, []string, error) {
+	table, err := lookupTable(ctx, db, driver, name)
+	if err != nil {
+		return tableInfo{}, nil, err
+	}
+	schema, _ := splitTableName(name)
+	pk, err := primaryKey(ctx, db, driver, schema, table.Name)
+	if err != nil {
+		return tableInfo{}, nil, fmt.Errorf("failed to read primary key: %w", err)
+	}
+	if len(pk) == 0 {
+		return tableInfo{}, nil, fmt.Errorf("%s has no primary key, rows can't be edited", name)
+	}
+	return table, pk, nil
+}
+
+// keyCondition renders "pk1 = ? AND pk2 = ?" for an encoded key, appending
+// the key values to args.
+func keyCondition(driver string, pk []string, key string, args []interface{}) (string, []interface{}, error) {
+	values, err := decodeCursor(key)
+	if err != nil || len(values) != len(pk) {
+		return "", nil, fmt.Errorf("invalid row key")
+	}
+	conds := make([]string, len(pk))
+	for i, col := range pk {
+		args = append(args, values[i])
+		conds[i] = quoteIdent(driver, col) + " = " + placeholder(driver, len(args))
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// rowKeys encodes the primary key of every row, or returns nil when the
+// result doesn't contain the whole key.
+func rowKeys(driver string, pk []string, rs *resultSet) []string {
+	if len(pk) == 0 {
+		return nil
+	}
+	index := make([]int, len(pk))
+	for i, col := range pk {
+		index[i] = -1
+		for j, name := range rs.Columns {
+			if name == col {
+				index[i] = j
+			}
+		}
+		if index[i] < 0 {
+			return nil
+		}
+	}
+	keys := make([]string, len(rs.Rows))
+	for r, row := range rs.Rows {
+		values := make([]string, len(pk))
+		for i, j := range index {
+			values[i] = keyValue(driver, row[j])
+		}
+		keys[r] = encodeCursor(values)
+	}
+	return keys
+}
+
+// rowQueryer is a *sql.DB or *sql.Tx.
+type rowQueryer interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}
+
+// fetchKeyRows reads the rows with the given key, normally one, locking
+// them for the rest of the transaction when asked to.
+func fetchKeyRows(ctx context.Context, q rowQueryer, driver string, table tableInfo, pk []string, key string, lock bool) (*resultSet, error) {
+	where, args, err := keyCondition(driver, pk, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	query := "SELECT * FROM " + quoteIdent(driver, qualifiedName(table)) + " WHERE " + where
+	if lock {
+		query += " FOR UPDATE"
+	}
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rs, err := scanResult(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs.Rows) == 0 {
+		return nil, fmt.Errorf("the row is gone")
+	}
+	return rs, nil
+}
+
+// countKeyRows counts the rows a key matches, with the WHERE clause the
+// generated UPDATE and DELETE use.
+func countKeyRows(ctx context.Context, db *sql.DB, driver string, table tableInfo, pk []string, key string) (int64, error) {
+	where, args, err := keyCondition(driver, pk, key, nil)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	err = db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM "+quoteIdent(driver, qualifiedName(table))+" WHERE "+where, args...).Scan(&n)
+	return n, err
+}
+
+// manyConfirmed reports whether a statement matching n rows may run: more
+// than one needs the "many" box ticked for exactly that count.
+func manyConfirmed(c *gin.Context, n int64) bool {
+	return n <= 1 || c.PostForm("many") == strconv.FormatInt(n, 10)
+}
+
+// rowVersion is a checksum of the fetched rows. The edit form carries it, so
+// that an update only applies to the rows as they were shown.
+func rowVersion(driver string, rs *resultSet) string {
+	h := sha256.New()
+	for _, row := range rs.Rows {
+		for i, col := range rs.Columns {
+			switch v := row[i].(type) {
+			case nil:
+				fmt.Fprintf(h, "%s\x00null\n", col)
+			case []byte:
+				fmt.Fprintf(h, "%s\x00%x\n", col, v)
+			default:
+				fmt.Fprintf(h, "%s\x00%s\n", col, keyValue(driver, v))
+			}
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// rowFieldsFromResult fills the edit form from the first fetched row.
+func rowFieldsFromResult(driver string, table tableInfo, pk []string, rs *resultSet) []rowField {
+	var fields []rowField
+	for _, col := range table.Columns {
+		f := newRowField(col, pk)
+		for i, name := range rs.Columns {
+			if name != col.Name {
+				continue
+			}
+			switch v := rs.Rows[0][i].(type) {
+			case nil:
+				f.Null = true
+			case []byte:
+				f.Value = fmt.Sprintf("%d bytes", len(v))
+			default:
+				f.Value = keyValue(driver, v)
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// rowStatement is a statement generated by the row and table forms and its
+// bind values.
+type rowStatement struct {
+	Query string
+	Args  []interface{}
+	// Changed lists the assigned columns, in table order
+	Changed []string
+}
+
+// Digest identifies the statement, so that a confirmation only runs what
+// was shown.
+func (st rowStatement) Digest() string {
+	h := sha256.New()
+	fmt.Fprintln(h, st.Query)
+	for _, a := range st.Args {
+		fmt.Fprintf(h, "%T:%v\n", a, a)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Params lists the bind values for display.
+func (st rowStatement) Params() []string {
+	out := make([]string, len(st.Args))
+	for i, a := range st.Args {
+		if a == nil {
+			out[i] = "NULL"
+		} else {
+			out[i] = quoteString("", fmt.Sprint(a))
+		}
+	}
+	return out
+}
+
+// execRows runs st in a transaction that is only committed when the
+// statement affected exactly want rows.
+func execRows(ctx context.Context, db *sql.DB, st rowStatement, want int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, st.Query, st.Args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n != want {
+		return fmt.Errorf("the statement matched %d rows instead of %d and was rolled back", n, want)
+	}
+	return tx.Commit()
+}
+
+// errRowChanged reports that a row no longer has the version its edit form
+// was loaded with.
+var errRowChanged = errors.New("the row was changed since it was loaded")
+
+// execRowChecked runs st like execRows, after checking that the rows with
+// key still have the given version. PostgreSQL and MySQL lock the rows for
+// the check; SQLite locks the whole database once the update starts. On a
+// mismatch nothing runs and the current rows come back with errRowChanged.
+func execRowChecked(ctx context.Context, db *sql.DB, driver string, table tableInfo, pk []string, key, version string, st rowStatement, want int64) (*resultSet, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	rs, err := fetchKeyRows(ctx, tx, driver, table, pk, key, driver == "postgres" || driver == "mysql")
+	if err != nil {
+		return nil, err
+	}
+	if rowVersion(driver, rs) != version {
+		return rs, errRowChanged
+	}
+	res, err := tx.ExecContext(ctx, st.Query, st.Args...)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n != want {
+		return nil, fmt.Errorf("the statement matched %d rows instead of %d and was rolled back", n, want)
+	}
+	return nil, tx.Commit()
+}
+
+// rowFieldsFromForm reads the edit form: value.<col> and null.<col> hold the
+// new value, orig.<col> and orig_null.<col> what the form was loaded with.
+func rowFieldsFromForm(c *gin.Context, table tableInfo, pk []string) (fields, orig []rowField) {
+	for _, col := range table.Columns {
+		f := newRowField(col, pk)
+		o := f
+		f.Value, f.Null = c.PostForm("value."+col.Name), c.PostForm("null."+col.Name) != ""
+		o.Value, o.Null = c.PostForm("orig."+col.Name), c.PostForm("orig_null."+col.Name) != ""
+		fields, orig = append(fields, f), append(orig, o)
+	}
+	return fields, orig
+}
+
+// buildRowUpdate assigns the columns whose value differs from what the form
+// was loaded with. Binary columns are never assigned.
+func buildRowUpdate(driver string, table tableInfo, pk []string, key string, fields, orig []rowField) (rowStatement, error) {
+	var u rowStatement
+	var sets []string
+	for i, f := range fields {
+		if f.Binary || f.sameValue(orig[i]) {
+			continue
+		}
+		if f.Null && !f.Nullable {
+			return u, fmt.Errorf("%s can't be NULL", f.Name)
+		}
+		var v interface{}
+		if !f.Null {
+			v = f.Value
+		}
+		u.Args = append(u.Args, v)
+		u.Changed = append(u.Changed, f.Name)
+		sets = append(sets, quoteIdent(driver, f.Name)+" = "+placeholder(driver, len(u.Args)))
+	}
+	if len(sets) == 0 {
+		return u, fmt.Errorf("nothing changed")
+	}
+	where, args, err := keyCondition(driver, pk, key, u.Args)
+	if err != nil {
+		return u, err
+	}
+	u.Args = args
+	u.Query = fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		quoteIdent(driver, qualifiedName(table)), strings.Join(sets, ", "), where)
+	return u, nil
+}
+
+// editRowHandler loads one row into the edit form.
+func editRowHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name, key := c.PostForm("table"), c.PostForm("key")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "rowedit.html", format, args...)
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	table, pk, err := rowTable(ctx, db, p.Driver, name)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	rs, err := fetchKeyRows(ctx, db, p.Driver, table, pk, key, false)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to load the row: %v", err)
+		return
+	}
+
+	fields := rowFieldsFromResult(p.Driver, table, pk, rs)
+	render(c, http.StatusOK, rowEditView{
+		Table:   name,
+		Key:     key,
+		Version: rowVersion(p.Driver, rs),
+		Fields:  fields,
+		Orig:    fields,
+	})
+}
+
+// rowConflict is a column that both the user and someone else changed.
+type rowConflict struct {
+	Name    string
+	Orig    rowField
+	Current rowField
+	Mine    rowField
+}
+
+// updateRowHandler previews the UPDATE for an edited row and runs it once
+// confirmed. The confirmation carries the digest of the previewed statement;
+// if the form was changed in between, the new statement is previewed instead.
+// If the row changed since the form was loaded, nothing is written: the form
+// comes back rebased on the current row, with the user's edits kept and the
+// columns both sides changed listed.
+func updateRowHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name, key, version := c.PostForm("table"), c.PostForm("key"), c.PostForm("version")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "rowedit.html", format, args...)
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	table, pk, err := rowTable(ctx, db, p.Driver, name)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	fields, orig := rowFieldsFromForm(c, table, pk)
+	page := rowEditView{Table: name, Key: key, Version: version, Fields: fields, Orig: orig}
+
+	u, err := buildRowUpdate(p.Driver, table, pk, key, fields, orig)
+	if err != nil {
+		page.Problem = err.Error()
+		render(c, http.StatusBadRequest, page)
+		return
+	}
+	n, err := countKeyRows(ctx, db, p.Driver, table, pk, key)
+	if err != nil {
+		page.Problem = fmt.Sprintf("Failed to count matching rows: %v", err)
+		render(c, http.StatusBadRequest, page)
+		return
+	}
+	if n == 0 {
+		page.Problem = "The key matches no rows any more; the row was probably deleted."
+		render(c, http.StatusNotFound, page)
+		return
+	}
+	if confirmed := c.PostForm("confirm") == u.Digest(); !confirmed || !manyConfirmed(c, n) {
+		page.Update, page.Matches = &u, n
+		if confirmed {
+			page.Problem = fmt.Sprintf("The statement matches %d rows; tick the box to update all of them.", n)
+		}
+		render(c, http.StatusOK, page)
+		return
+	}
+
+	current, err := execRowChecked(ctx, db, p.Driver, table, pk, key, version, u, n)
+	if errors.Is(err, errRowChanged) {
+		rebased := rowFieldsFromResult(p.Driver, table, pk, current)
+		var conflicts []rowConflict
+		for i := range fields {
+			if fields[i].sameValue(orig[i]) {
+				fields[i] = rebased[i]
+			} else if !rebased[i].sameValue(orig[i]) {
+				conflicts = append(conflicts, rowConflict{Name: fields[i].Name, Orig: orig[i], Current: rebased[i], Mine: fields[i]})
+			}
+		}
+		page.Orig, page.Version, page.Conflicts = rebased, rowVersion(p.Driver, current), conflicts
+		page.Problem = "The row was changed by someone else after you loaded it, nothing was written. " +
+			"The form now starts from the current row with your changes kept; preview again to apply them."
+		render(c, http.StatusConflict, page)
+		return
+	}
+	if err != nil {
+		page.Problem = fmt.Sprintf("Update failed: %v", err)
+		render(c, http.StatusBadRequest, page)
+		return
+	}
+
+	user := currentIdentity(c).User
+	log.Printf("%s updated a row of %s on %s", user, name, p.address())
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "row_update",
+		Target: p.auditTarget(),
+		Query:  u.Query,
+		Detail: fmt.Sprintf("%s, %d row(s), params: %s", name, n, strings.Join(u.Params(), ", ")),
+	})
+	render(c, http.StatusOK, rowEditView{
+		Done:   fmt.Sprintf("Updated %s in %d row(s) of %s.", strings.Join(u.Changed, ", "), n, name),
+		Update: &u,
+	})
+}
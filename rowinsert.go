@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// insertFields returns the insert form of a table. Columns with a default
+// start out using it, nullable ones without a default start out NULL.
+func insertFields(table tableInfo) []rowField {
+	fields := make([]rowField, len(table.Columns))
+	for i, col := range table.Columns {
+		f := newRowField(col, nil)
+		f.UseDefault = col.Default != nil
+		f.Null = !f.UseDefault && col.Nullable
+		fields[i] = f
+	}
+	return fields
+}
+
+// insertFieldsFromForm reads value.<col>, null.<col> and default.<col>.
+func insertFieldsFromForm(c *gin.Context, table tableInfo) []rowField {
+	fields := make([]rowField, len(table.Columns))
+	for i, col := range table.Columns {
+		f := newRowField(col, nil)
+		f.Value = c.PostForm("value." + col.Name)
+		f.Null = c.PostForm("null."+col.Name) != ""
+		f.UseDefault = c.PostForm("default."+col.Name) != ""
+		fields[i] = f
+	}
+	return fields
+}
+
+// buildRowInsert inserts the columns not left to their default. Binary
+// columns can only be NULL or default.
+func buildRowInsert(driver string, table tableInfo, fields []rowField) (rowStatement, error) {
+	var st rowStatement
+	var marks []string
+	for _, f := range fields {
+		if f.UseDefault || (f.Binary && !f.Null) {
+			continue
+		}
+		if f.Null && !f.Nullable {
+			return st, fmt.Errorf("%s can't be NULL", f.Name)
+		}
+		var v interface{}
+		if !f.Null {
+			v = f.Value
+		}
+		st.Args = append(st.Args, v)
+		st.Changed = append(st.Changed, f.Name)
+		marks = append(marks, placeholder(driver, len(st.Args)))
+	}
+
+	target := quoteIdent(driver, qualifiedName(table))
+	if len(st.Changed) == 0 {
+		if driver == "mysql" {
+			st.Query = "INSERT INTO " + target + " () VALUES ()"
+		} else {
+			st.Query = "INSERT INTO " + target + " DEFAULT VALUES"
+		}
+		return st, nil
+	}
+	columns := make([]string, len(st.Changed))
+	for i, col := range st.Changed {
+		columns[i] = quoteIdent(driver, col)
+	}
+	st.Query = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		target, strings.Join(columns, ", "), strings.Join(marks, ", "))
+	return st, nil
+}
+
+// insertRowHandler shows the insert form, previews the INSERT and runs it
+// once the previewed statement is confirmed, like updateRowHandler.
+func insertRowHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	name := c.PostForm("table")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "rowinsert.html", format, args...)
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	table, err := lookupTable(ctx, db, p.Driver, name)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	if c.PostForm("submitted") == "" {
+		render(c, http.StatusOK, rowInsertView{Table: name, Fields: insertFields(table)})
+		return
+	}
+
+	fields := insertFieldsFromForm(c, table)
+	page := rowInsertView{Table: name, Fields: fields}
+	st, err := buildRowInsert(p.Driver, table, fields)
+	if err != nil {
+		page.Problem = err.Error()
+		render(c, http.StatusBadRequest, page)
+		return
+	}
+	if c.PostForm("confirm") != st.Digest() {
+		page.Statement = &st
+		render(c, http.StatusOK, page)
+		return
+	}
+
+	if _, err := db.ExecContext(ctx, st.Query, st.Args...); err != nil {
+		page.Problem = fmt.Sprintf("Insert failed: %v", err)
+		render(c, http.StatusBadRequest, page)
+		return
+	}
+
+	user := currentIdentity(c).User
+	log.Printf("%s inserted a row into %s on %s", user, name, p.address())
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "row_insert",
+		Target: p.auditTarget(),
+		Query:  st.Query,
+		Detail: fmt.Sprintf("%s, params: %s", name, strings.Join(st.Params(), ", ")),
+	})
+	render(c, http.StatusOK, rowInsertView{
+		Done:      fmt.Sprintf("Inserted a row into %s.", name),
+		Statement: &st,
+	})
+}
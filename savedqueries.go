@@ -0,0 +1,635 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	checkTimeout      = time.Minute
+	checkHistoryLimit = 50
+	// runResultRows is how much of each run's result is kept
+	runResultRows = 100
+	// schedulerUser is the user recorded for runs nobody started
+	schedulerUser = "scheduler"
+)
+
+// savedQuery is a named query on a saved connection. With assertions it is a
+// data quality check. It runs on demand, every Interval or on the cron
+// Schedule; each run is kept.
+type savedQuery struct {
+	ID         int64
+	Name       string
+	Connection string
+	Query      string
+	Assertions []queryAssertion
+	Interval   time.Duration
+	// Schedule is a cron expression, see parseCron
+	Schedule  string
+	CreatedBy string
+	CreatedAt time.Time
+	// LastRun is the latest run, nil before the first
+	LastRun *checkRun
+	// claimed is the next run the scheduler set aside before starting the
+	// last one; zero when the query was changed since
+	claimed time.Time
+}
+
+// NextRun is when the scheduler runs the query next; zero when it only
+// runs on demand. A run overdue while the server was down happens once,
+// right after it starts.
+func (sq savedQuery) NextRun() time.Time {
+	if sq.Schedule == "" && sq.Interval <= 0 {
+		return time.Time{}
+	}
+	next := sq.CreatedAt
+	if sq.Schedule != "" {
+		last := sq.CreatedAt
+		if sq.LastRun != nil && sq.LastRun.At.After(last) {
+			last = sq.LastRun.At
+		}
+		next = sq.runAfter(last)
+	} else if sq.LastRun != nil {
+		next = sq.runAfter(sq.LastRun.At)
+	}
+	if next.IsZero() || sq.claimed.After(next) {
+		return sq.claimed
+	}
+	return next
+}
+
+// runAfter is the first run the schedule or interval puts after t.
+func (sq savedQuery) runAfter(t time.Time) time.Time {
+	if sq.Schedule != "" {
+		s, err := parseCron(sq.Schedule)
+		if err != nil {
+			return time.Time{}
+		}
+		return s.next(t)
+	}
+	return t.Add(sq.Interval)
+}
+
+// AssertionText is the assertions in the syntax of parseAssertions.
+func (sq savedQuery) AssertionText() string {
+	lines := make([]string, len(sq.Assertions))
+	for i, a := range sq.Assertions {
+		lines[i] = a.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkRun is one execution of a saved query. It passed when the query ran
+// and every assertion held.
+type checkRun struct {
+	ID      int64
+	At      time.Time
+	User    string
+	Passed  bool
+	Rows    int
+	Elapsed time.Duration
+	Error   string
+	Results []assertionResult
+	// Result is the head of the rows the run read; not loaded with the
+	// latest run of a listing
+	Result *runResult
+}
+
+// runResult is what a run keeps of its result: the first runResultRows rows.
+type runResult struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// decodeRunResult reads a stored result; numbers stay json.Numbers so large
+// integers show as they were.
+func decodeRunResult(s string) (*runResult, error) {
+	if s == "" {
+		return nil, nil
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var r runResult
+	if err := dec.Decode(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+var errSavedQueryNotFound = errors.New("saved query not found")
+
+const savedQueryColumns = `
+	sq.id, sq.name, sq.connection, sq.query, sq.assertions, sq.check_interval, sq.schedule, sq.created_by, sq.created_at, sq.next_run,
+	r.id, r.at, r.user, r.passed, r.row_count, r.elapsed_ms, r.error, r.results`
+
+// savedQueryFrom joins each saved query with its latest run.
+const savedQueryFrom = `
+	FROM saved_queries sq
+	LEFT JOIN check_runs r ON r.id = (SELECT max(id) FROM check_runs WHERE query_id = sq.id)`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSavedQuery(row rowScanner) (savedQuery, error) {
+	var sq savedQuery
+	var assertions string
+	var interval, createdAt, claimed int64
+	var runID, at, passed, rows, elapsed sql.NullInt64
+	var user, runErr, results sql.NullString
+	err := row.Scan(&sq.ID, &sq.Name, &sq.Connection, &sq.Query, &assertions, &interval, &sq.Schedule, &sq.CreatedBy, &createdAt, &claimed,
+		&runID, &at, &user, &passed, &rows, &elapsed, &runErr, &results)
+	if err != nil {
+		return sq, err
+	}
+	if err := json.Unmarshal([]byte(assertions), &sq.Assertions); err != nil {
+		return sq, fmt.Errorf("saved query %q: %w", sq.Name, err)
+	}
+	sq.Interval = time.Duration(interval) * time.Second
+	sq.CreatedAt = time.Unix(createdAt, 0)
+	if claimed > 0 {
+		sq.claimed = time.Unix(claimed, 0)
+	}
+	if runID.Valid {
+		sq.LastRun = &checkRun{
+			ID:      runID.Int64,
+			At:      time.Unix(at.Int64, 0),
+			User:    user.String,
+			Passed:  passed.Int64 != 0,
+			Rows:    int(rows.Int64),
+			Elapsed: time.Duration(elapsed.Int64) * time.Millisecond,
+			Error:   runErr.String,
+		}
+		json.Unmarshal([]byte(results.String), &sq.LastRun.Results)
+	}
+	return sq, nil
+}
+
+func listSavedQueries(ctx context.Context) ([]savedQuery, error) {
+	rows, err := store.QueryContext(ctx, "SELECT"+savedQueryColumns+savedQueryFrom+" ORDER BY sq.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queries []savedQuery
+	for rows.Next() {
+		sq, err := scanSavedQuery(rows)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, sq)
+	}
+	return queries, rows.Err()
+}
+
+func getSavedQuery(ctx context.Context, id int64) (savedQuery, error) {
+	sq, err := scanSavedQuery(store.QueryRowContext(ctx, "SELECT"+savedQueryColumns+savedQueryFrom+" WHERE sq.id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return sq, errSavedQueryNotFound
+	}
+	return sq, err
+}
+
+// saveSavedQuery stores the query, replacing one of the same name saved by
+// the same user.
+func saveSavedQuery(ctx context.Context, sq savedQuery) error {
+	assertions, err := json.Marshal(sq.Assertions)
+	if err != nil {
+		return err
+	}
+	res, err := store.ExecContext(ctx, `
+		INSERT INTO saved_queries (name, connection, query, assertions, check_interval, schedule, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			connection = excluded.connection, query = excluded.query, assertions = excluded.assertions,
+			check_interval = excluded.check_interval, schedule = excluded.schedule, next_run = 0
+		WHERE saved_queries.created_by = excluded.created_by`,
+		sq.Name, sq.Connection, sq.Query, string(assertions), int64(sq.Interval/time.Second), sq.Schedule, sq.CreatedBy, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("a query named %q was saved by someone else", sq.Name)
+	}
+	return nil
+}
+
+// deleteSavedQuery removes a saved query and its history; only its creator
+// may.
+func deleteSavedQuery(ctx context.Context, id int64, user string) error {
+	res, err := store.ExecContext(ctx, "DELETE FROM saved_queries WHERE id = ? AND created_by = ?", id, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("the query is gone or was saved by someone else")
+	}
+	_, err = store.ExecContext(ctx, "DELETE FROM check_runs WHERE query_id = ?", id)
+	return err
+}
+
+func recordCheckRun(ctx context.Context, queryID int64, run checkRun) error {
+	results, err := json.Marshal(run.Results)
+	if err != nil {
+		return err
+	}
+	var result []byte
+	if run.Result != nil {
+		if result, err = json.Marshal(run.Result); err != nil {
+			return err
+		}
+	}
+	_, err = store.ExecContext(ctx, `
+		INSERT INTO check_runs (query_id, at, user, passed, row_count, elapsed_ms, error, results, result)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		queryID, run.At.Unix(), run.User, run.Passed, run.Rows, run.Elapsed.Milliseconds(), run.Error, string(results), string(result))
+	return err
+}
+
+// listCheckRuns returns the latest runs of a saved query, newest first.
+func listCheckRuns(ctx context.Context, queryID int64, limit int) ([]checkRun, error) {
+	rows, err := store.QueryContext(ctx, `
+		SELECT id, at, user, passed, row_count, elapsed_ms, error, results, result
+		FROM check_runs WHERE query_id = ? ORDER BY id DESC LIMIT ?`, queryID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []checkRun
+	for rows.Next() {
+		var run checkRun
+		var at, elapsed int64
+		var results, result string
+		if err := rows.Scan(&run.ID, &at, &run.User, &run.Passed, &run.Rows, &elapsed, &run.Error, &results, &result); err != nil {
+			return nil, err
+		}
+		run.At, run.Elapsed = time.Unix(at, 0), time.Duration(elapsed)*time.Millisecond
+		if err := json.Unmarshal([]byte(results), &run.Results); err != nil {
+			return nil, err
+		}
+		if run.Result, err = decodeRunResult(result); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// fetchSavedQuery runs the query on its connection under the query hooks,
+// with values for its variables; missing ones take their defaults.
+func fetchSavedQuery(ctx context.Context, sq savedQuery, user string, values map[string]string) (*resultSet, error) {
+	sc, err := getConnection(ctx, sq.Connection)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := parseQueryTemplate(sq.Query)
+	if err != nil {
+		return nil, err
+	}
+	query, args, err := tmpl.bind(sc.Driver, values)
+	if err != nil {
+		return nil, err
+	}
+	ev := queryEvent{
+		Source:     "check",
+		User:       user,
+		Connection: sc.auditTarget(),
+		Driver:     sc.Driver,
+		Database:   sc.Database,
+		Query:      sq.Query,
+	}
+	if _, err := beforeQuery(ctx, ev); err != nil {
+		return nil, err
+	}
+	release, err := acquireQuerySlot(ctx, sc.connParams, "")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	db, err := openDB(ctx, sc.connParams)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	started := time.Now()
+	rs, err := fetchResult(ctx, db, query, args...)
+	if err == nil {
+		err = sc.transcodeRows(rs.Rows)
+	}
+	afterQuery(ctx, ev, started, err)
+	return rs, err
+}
+
+// runSavedQuery runs a saved query, checks its assertions and records the
+// run.
+func runSavedQuery(ctx context.Context, sq savedQuery, user string, values map[string]string) checkRun {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	run := checkRun{At: time.Now(), User: user}
+	rs, err := fetchSavedQuery(ctx, sq, user, values)
+	run.Elapsed = time.Since(run.At)
+	if err != nil {
+		run.Error = err.Error()
+	} else {
+		run.Passed = true
+		run.Rows = len(rs.Rows)
+		run.Result = &runResult{Columns: rs.Columns, Rows: rs.Rows, Truncated: len(rs.Rows) > runResultRows}
+		if run.Result.Truncated {
+			run.Result.Rows = rs.Rows[:runResultRows]
+		}
+		for _, a := range sq.Assertions {
+			r := a.check(rs)
+			run.Passed = run.Passed && r.Passed
+			run.Results = append(run.Results, r)
+		}
+	}
+
+	if err := recordCheckRun(ctx, sq.ID, run); err != nil {
+		log.Printf("Failed to record the run of %s: %v", sq.Name, err)
+	}
+	recordAudit(ctx, auditEntry{
+		User:   user,
+		Action: "check_run",
+		Target: sq.Connection,
+		Query:  sq.Query,
+		Ref:    strconv.FormatInt(sq.ID, 10),
+		Detail: strings.TrimSpace(fmt.Sprintf("passed=%t %s %s", run.Passed, variableText(values), run.Error)),
+	})
+	return run
+}
+
+// runDueChecks runs the saved queries whose interval has passed since
+// their last run or whose schedule fired, at the start of every minute.
+// Each due check first moves its next run on, so a run that fails to be
+// recorded isn't repeated every minute, then runs alongside the others;
+// the query limiter keeps them from crowding a server.
+func runDueChecks() {
+	var mu sync.Mutex
+	running := map[int64]bool{}
+	for ; ; time.Sleep(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute))) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		queries, err := listSavedQueries(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to read saved queries: %v", err)
+			continue
+		}
+		now := time.Now()
+		for _, sq := range queries {
+			if next := sq.NextRun(); next.IsZero() || next.After(now) {
+				continue
+			}
+			mu.Lock()
+			busy := running[sq.ID]
+			mu.Unlock()
+			if busy {
+				continue
+			}
+			if err := claimCheckRun(sq, now); err != nil {
+				log.Printf("Failed to schedule check %s: %v", sq.Name, err)
+				continue
+			}
+			mu.Lock()
+			running[sq.ID] = true
+			mu.Unlock()
+			go func(sq savedQuery) {
+				defer func() {
+					mu.Lock()
+					delete(running, sq.ID)
+					mu.Unlock()
+				}()
+				runScheduledCheck(sq)
+			}(sq)
+		}
+	}
+}
+
+// claimCheckRun stores the run after now as the query's next, before the
+// scheduler starts the one that is due.
+func claimCheckRun(sq savedQuery, now time.Time) error {
+	next := sq.runAfter(now)
+	if next.IsZero() {
+		return fmt.Errorf("schedule %q never fires", sq.Schedule)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := store.ExecContext(ctx, "UPDATE saved_queries SET next_run = ? WHERE id = ?", next.Unix(), sq.ID)
+	return err
+}
+
+// runScheduledCheck runs a due check and sends its notification.
+func runScheduledCheck(sq savedQuery) {
+	run := runSavedQuery(context.Background(), sq, schedulerUser, nil)
+	if !run.Passed {
+		log.Printf("Check %s failed: %s", sq.Name, checkSummary(run))
+	}
+	ev := notifyEvent{
+		Kind:    "schedule",
+		Name:    sq.Name,
+		User:    sq.CreatedBy,
+		Target:  sq.Connection,
+		Query:   sq.Query,
+		Status:  "succeeded",
+		Rows:    run.Rows,
+		Elapsed: run.Elapsed,
+		At:      run.At,
+		Link:    resultLink("/queries/history?id=" + strconv.FormatInt(sq.ID, 10)),
+	}
+	if !run.Passed {
+		ev.Status, ev.Error = "failed", checkSummary(run)
+	}
+	notify(ev)
+}
+
+// variableText lists the values a run was given, for the audit log.
+func variableText(values map[string]string) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + strconv.Quote(values[name])
+	}
+	return strings.Join(names, " ")
+}
+
+// checkSummary describes a failed run in one line.
+func checkSummary(run checkRun) string {
+	if run.Error != "" {
+		return run.Error
+	}
+	var failed []string
+	for _, r := range run.Results {
+		if !r.Passed {
+			failed = append(failed, r.Assertion+" ("+r.Detail+")")
+		}
+	}
+	return strings.Join(failed, "; ")
+}
+
+// savedQueriesHandler lists the saved queries with their latest run.
+func savedQueriesHandler(c *gin.Context) {
+	renderSavedQueries(c, "")
+}
+
+func renderSavedQueries(c *gin.Context, message string) {
+	queries, err := listSavedQueries(c.Request.Context())
+	if err != nil {
+		renderError(c, http.StatusInternalServerError, "savedqueries.html", "Failed to read saved queries: %v", err)
+		return
+	}
+	render(c, http.StatusOK, savedQueriesView{
+		Queries: queries,
+		User:    currentIdentity(c).User,
+		Message: message,
+	})
+}
+
+// saveQueryHandler saves the query of the query form with its assertions.
+func saveQueryHandler(c *gin.Context) {
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "savedqueries.html", format, args...)
+	}
+
+	sq := savedQuery{
+		Name:       strings.TrimSpace(c.PostForm("saved_name")),
+		Connection: c.PostForm("saved_connection"),
+		Query:      strings.TrimSpace(c.PostForm("query")),
+		CreatedBy:  currentIdentity(c).User,
+	}
+	if sq.Name == "" || sq.Connection == "" || sq.Query == "" {
+		fail(http.StatusBadRequest, "A name, a saved connection and a query are required")
+		return
+	}
+	if !returnsRows(sq.Query) {
+		fail(http.StatusBadRequest, "Only queries returning rows can be saved")
+		return
+	}
+	tmpl, err := parseQueryTemplate(sq.Query)
+	if err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	if sq.Assertions, err = parseAssertions(c.PostForm("assertions")); err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	if minutes := c.PostForm("interval"); minutes != "" {
+		n, err := strconv.Atoi(minutes)
+		if err != nil || n < 0 {
+			fail(http.StatusBadRequest, "Invalid interval %q", minutes)
+			return
+		}
+		sq.Interval = time.Duration(n) * time.Minute
+	}
+	if sq.Schedule = strings.TrimSpace(c.PostForm("schedule")); sq.Schedule != "" {
+		if sq.Interval > 0 {
+			fail(http.StatusBadRequest, "Give either an interval or a schedule, not both")
+			return
+		}
+		s, err := parseCron(sq.Schedule)
+		if err != nil {
+			fail(http.StatusBadRequest, "%v", err)
+			return
+		}
+		if s.next(time.Now()).IsZero() {
+			fail(http.StatusBadRequest, "The schedule %q never fires", sq.Schedule)
+			return
+		}
+	}
+	if (sq.Interval > 0 || sq.Schedule != "") && !tmpl.Unattended() {
+		fail(http.StatusBadRequest, "Scheduled queries run unattended: give every variable a default, like {{day:date=2024-01-01}}")
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := getConnection(ctx, sq.Connection); err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	if err := saveSavedQuery(ctx, sq); err != nil {
+		fail(http.StatusBadRequest, "Failed to save the query: %v", err)
+		return
+	}
+	renderSavedQueries(c, fmt.Sprintf("Saved %s.", sq.Name))
+}
+
+// deleteSavedQueryHandler removes a saved query of the current user.
+func deleteSavedQueryHandler(c *gin.Context) {
+	id, _ := strconv.ParseInt(c.PostForm("id"), 10, 64)
+	if err := deleteSavedQuery(c.Request.Context(), id, currentIdentity(c).User); err != nil {
+		renderError(c, http.StatusBadRequest, "savedqueries.html", "Failed to delete the query: %v", err)
+		return
+	}
+	renderSavedQueries(c, "Deleted.")
+}
+
+// runSavedQueryHandler runs a saved query now and shows its history.
+func runSavedQueryHandler(c *gin.Context) {
+	showCheckRuns(c, true)
+}
+
+// checkHistoryHandler shows the runs of a saved query.
+func checkHistoryHandler(c *gin.Context) {
+	showCheckRuns(c, false)
+}
+
+func showCheckRuns(c *gin.Context, run bool) {
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "checkruns.html", format, args...)
+	}
+
+	ctx := c.Request.Context()
+	// GET ?id= is the link in notifications
+	id, _ := strconv.ParseInt(c.Request.FormValue("id"), 10, 64)
+	sq, err := getSavedQuery(ctx, id)
+	if err != nil {
+		fail(http.StatusNotFound, "%v", err)
+		return
+	}
+	if run {
+		tmpl, err := parseQueryTemplate(sq.Query)
+		if err != nil {
+			fail(http.StatusBadRequest, "%v", err)
+			return
+		}
+		// a query with variables asks for them first
+		if len(tmpl.Variables) > 0 && c.PostForm("variables") == "" {
+			render(c, http.StatusOK, queryVariablesView{Query: sq, Variables: tmpl.Variables})
+			return
+		}
+		values := make(map[string]string, len(tmpl.Variables))
+		for _, v := range tmpl.Variables {
+			values[v.Name] = c.PostForm("var." + v.Name)
+		}
+		if err := tmpl.check(values); err != nil {
+			render(c, http.StatusBadRequest, queryVariablesView{Query: sq, Variables: tmpl.Variables, Values: values, Message: err.Error()})
+			return
+		}
+		runSavedQuery(ctx, sq, currentIdentity(c).User, values)
+	}
+	runs, err := listCheckRuns(ctx, id, checkHistoryLimit)
+	if err != nil {
+		fail(http.StatusInternalServerError, "Failed to read the history: %v", err)
+		return
+	}
+	render(c, http.StatusOK, checkRunsView{Query: sq, Runs: runs})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+type columnInfo struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Nullable bool    `json:"nullable"`
+	Default  *string `json:"default,omitempty"`
+}
+
+type tableInfo struct {
+	Schema  string       `json:"schema,omitempty"`
+	Name    string       `json:"name"`
+	Columns []columnInfo `json:"columns"`
+}
+
+// Each query returns schema, table, column, type, nullable, default ordered
+// by table and column position.
+var columnsQueries = map[string]string{
+	"postgres": `
+		SELECT table_schema, table_name, column_name, data_type, is_nullable = 'YES', column_default
+		FROM information_schema.columns
+		WHERE table_schema NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY table_schema, table_name, ordinal_position`,
+	"mysql": `
+		SELECT table_schema, table_name, column_name, column_type, is_nullable = 'YES', column_default
+		FROM information_schema.columns
+		WHERE table_schema = DATABASE()
+		ORDER BY table_name, ordinal_position`,
+	"clickhouse": `
+		SELECT database, table, name, type, startsWith(type, 'Nullable('), nullIf(default_expression, '')
+		FROM system.columns
+		WHERE database = currentDatabase()
+		ORDER BY table, position`,
+	"sqlite": `
+		SELECT 'main', m.name, p.name, p.type, p."notnull" = 0, p.dflt_value
+		FROM sqlite_master m
+		JOIN pragma_table_info(m.name) p
+		WHERE m.type IN ('table', 'view') AND m.name NOT LIKE 'sqlite_%'
+		ORDER BY m.name, p.cid`,
+}
+
+// listTables returns every user table of the connected database with its columns.
+func listTables(ctx context.Context, db *sql.DB, driver string) ([]tableInfo, error) {
+	query, ok := columnsQueries[driver]
+	if !ok {
+		return nil, fmt.Errorf("schema introspection is not supported for %q", driver)
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []tableInfo
+	for rows.Next() {
+		var schema, table string
+		var col columnInfo
+		if err := rows.Scan(&schema, &table, &col.Name, &col.Type, &col.Nullable, &col.Default); err != nil {
+			return nil, err
+		}
+		if n := len(tables); n == 0 || tables[n-1].Schema != schema || tables[n-1].Name != table {
+			tables = append(tables, tableInfo{Schema: schema, Name: table})
+		}
+		last := &tables[len(tables)-1]
+		last.Columns = append(last.Columns, col)
+	}
+	return tables, rows.Err()
+}
+
+// listDatabases returns the databases (attached files for SQLite) on the server.
+func listDatabases(ctx context.Context, db *sql.DB, driver string) ([]string, error) {
+	d, ok := dbDrivers[driver]
+	if !ok {
+		return nil, fmt.Errorf("listing databases is not supported for %q", driver)
+	}
+	return d.ListSchemas(ctx, db)
+}
+
+type foreignKey struct {
+	Name       string   `json:"name"`
+	Schema     string   `json:"schema,omitempty"`
+	Table      string   `json:"table"`
+	Columns    []string `json:"columns"`
+	RefSchema  string   `json:"ref_schema,omitempty"`
+	RefTable   string   `json:"ref_table"`
+	RefColumns []string `json:"ref_columns"`
+}
+
+// Each query returns name, schema, table, column, ref schema, ref table, ref
+// column with one row per column pair in key order. ClickHouse has no
+// foreign keys.
+var foreignKeysQueries = map[string]string{
+	"postgres": `
+		SELECT con.conname, ns.nspname, cl.relname, att.attname, rns.nspname, rcl.relname, ratt.attname
+		FROM pg_constraint con
+		JOIN pg_class cl ON cl.oid = con.conrelid
+		JOIN pg_namespace ns ON ns.oid = cl.relnamespace
+		JOIN pg_class rcl ON rcl.oid = con.confrelid
+		JOIN pg_namespace rns ON rns.oid = rcl.relnamespace
+		CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, refnum, ord)
+		JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = k.attnum
+		JOIN pg_attribute ratt ON ratt.attrelid = con.confrelid AND ratt.attnum = k.refnum
+		WHERE con.contype = 'f' AND ns.nspname NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY ns.nspname, cl.relname, con.conname, k.ord`,
+	"mysql": `
+		SELECT constraint_name, table_schema, table_name, column_name,
+		       referenced_table_schema, referenced_table_name, referenced_column_name
+		FROM information_schema.key_column_usage
+		WHERE table_schema = DATABASE() AND referenced_table_name IS NOT NULL
+		ORDER BY table_name, constraint_name, ordinal_position`,
+	"sqlite": `
+		SELECT 'fk_' || m.name || '_' || f.id, 'main', m.name, f."from", 'main', f."table", COALESCE(f."to", '')
+		FROM sqlite_master m
+		JOIN pragma_foreign_key_list(m.name) f
+		WHERE m.type = 'table'
+		ORDER BY m.name, f.id, f.seq`,
+}
+
+func listForeignKeys(ctx context.Context, db *sql.DB, driver string) ([]foreignKey, error) {
+	query, ok := foreignKeysQueries[driver]
+	if !ok {
+		return nil, nil
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []foreignKey
+	for rows.Next() {
+		var fk foreignKey
+		var col, refCol string
+		if err := rows.Scan(&fk.Name, &fk.Schema, &fk.Table, &col, &fk.RefSchema, &fk.RefTable, &refCol); err != nil {
+			return nil, err
+		}
+		if n := len(keys); n > 0 && keys[n-1].Name == fk.Name && keys[n-1].Schema == fk.Schema && keys[n-1].Table == fk.Table {
+			keys[n-1].Columns = append(keys[n-1].Columns, col)
+			keys[n-1].RefColumns = append(keys[n-1].RefColumns, refCol)
+			continue
+		}
+		fk.Columns, fk.RefColumns = []string{col}, []string{refCol}
+		keys = append(keys, fk)
+	}
+	return keys, rows.Err()
+}
+
+// splitTableName splits "schema.name"; schema is empty for a bare name.
+func splitTableName(name string) (schema, table string) {
+	schema, table, qualified := strings.Cut(name, ".")
+	if !qualified {
+		return "", name
+	}
+	return schema, table
+}
+
+// findTable looks a table up by "name" or "schema.name".
+func findTable(tables []tableInfo, name string) (tableInfo, bool) {
+	schema, table := splitTableName(name)
+	for _, t := range tables {
+		if t.Name == table && (schema == "" || t.Schema == schema) {
+			return t, true
+		}
+	}
+	return tableInfo{}, false
+}
+
+// tableSummary is a table or view with the storage details the server reports.
+type tableSummary struct {
+	Schema string `json:"schema,omitempty"`
+	Name   string `json:"name"`
+	Kind   string `json:"kind"`
+	Engine string `json:"engine,omitempty"`
+	// Rows is the planner's estimate, nil where the server keeps none
+	Rows *int64 `json:"rows,omitempty"`
+}
+
+// Each query returns schema, name, kind, engine, estimated rows.
+var tableSummaryQueries = map[string]string{
+	"postgres": `
+		SELECT n.nspname, c.relname,
+		       CASE c.relkind WHEN 'v' THEN 'view' WHEN 'm' THEN 'materialized view'
+		                      WHEN 'f' THEN 'foreign table' ELSE 'table' END,
+		       COALESCE(am.amname, ''),
+		       CASE WHEN c.reltuples < 0 OR c.relkind IN ('v', 'f') THEN NULL ELSE c.reltuples::bigint END
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_am am ON am.oid = c.relam
+		WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f')
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%'
+		ORDER BY n.nspname, c.relname`,
+	"mysql": `
+		SELECT table_schema, table_name,
+		       CASE table_type WHEN 'BASE TABLE' THEN 'table' WHEN 'VIEW' THEN 'view' ELSE LOWER(table_type) END,
+		       COALESCE(engine, ''), table_rows
+		FROM information_schema.tables
+		WHERE table_schema = DATABASE()
+		ORDER BY table_name`,
+	"clickhouse": `
+		SELECT database, name, if(engine LIKE '%View', 'view', 'table'), engine, toInt64OrNull(toString(total_rows))
+		FROM system.tables
+		WHERE database = currentDatabase()
+		ORDER BY name`,
+	"sqlite": `
+		SELECT 'main', name, type, '', NULL
+		FROM sqlite_master
+		WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`,
+}
+
+func listTableSummaries(ctx context.Context, db *sql.DB, driver string) ([]tableSummary, error) {
+	query, ok := tableSummaryQueries[driver]
+	if !ok {
+		return nil, fmt.Errorf("listing tables is not supported for %q", driver)
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []tableSummary
+	for rows.Next() {
+		var t tableSummary
+		var estimate sql.NullInt64
+		if err := rows.Scan(&t.Schema, &t.Name, &t.Kind, &t.Engine, &estimate); err != nil {
+			return nil, err
+		}
+		if estimate.Valid {
+			t.Rows = &estimate.Int64
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+// Qualified returns "schema.name", or just the name where schemas don't apply.
+func (t tableSummary) Qualified() string {
+	if t.Schema == "" || t.Schema == "main" {
+		return t.Name
+	}
+	return t.Schema + "." + t.Name
+}
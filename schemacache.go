@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Schema browsing, the assistant, the APIs and autocomplete read table
+// metadata through this cache instead of querying the catalog each time.
+// An entry older than the TTL is still served while a background refresh
+// reloads it; past the max age it is reloaded before answering.
+const (
+	schemaCacheTTL       = 2 * time.Minute
+	schemaCacheMaxAge    = 30 * time.Minute
+	schemaRefreshTimeout = 30 * time.Second
+)
+
+type schemaCacheEntry struct {
+	value      interface{}
+	loaded     time.Time
+	refreshing bool
+}
+
+var (
+	schemaCacheMu sync.Mutex
+	schemaCache   = make(map[string]*schemaCacheEntry)
+)
+
+type schemaLoader func(ctx context.Context, db *sql.DB, driver string) (interface{}, error)
+
+func schemaCacheKey(p connParams, kind string) string {
+	return p.cacheKey() + "|" + kind
+}
+
+// cachedSchema returns the metadata of kind for the target, loading it
+// through db when there is no usable entry.
+func cachedSchema(ctx context.Context, db *sql.DB, p connParams, kind string, load schemaLoader) (interface{}, error) {
+	if value, ok := usableSchema(p, kind, load); ok {
+		return value, nil
+	}
+	value, err := load(ctx, db, p.Driver)
+	if err != nil {
+		return nil, err
+	}
+	schemaCacheMu.Lock()
+	schemaCache[schemaCacheKey(p, kind)] = &schemaCacheEntry{value: value, loaded: time.Now()}
+	schemaCacheMu.Unlock()
+	return value, nil
+}
+
+// usableSchema returns a cached entry young enough to serve, starting its
+// background refresh once it is past the TTL. Callers that can answer
+// from it skip connecting altogether.
+func usableSchema(p connParams, kind string, load schemaLoader) (interface{}, bool) {
+	schemaCacheMu.Lock()
+	defer schemaCacheMu.Unlock()
+	entry, ok := schemaCache[schemaCacheKey(p, kind)]
+	if !ok || time.Since(entry.loaded) >= schemaCacheMaxAge {
+		return nil, false
+	}
+	if time.Since(entry.loaded) >= schemaCacheTTL && !entry.refreshing {
+		entry.refreshing = true
+		go refreshSchema(p, kind, load)
+	}
+	return entry.value, true
+}
+
+// refreshSchema reloads an entry over its own connection, as the request
+// that found it stale may be long gone.
+func refreshSchema(p connParams, kind string, load schemaLoader) {
+	key := schemaCacheKey(p, kind)
+	ctx, cancel := context.WithTimeout(context.Background(), schemaRefreshTimeout)
+	defer cancel()
+
+	value, err := func() (interface{}, error) {
+		db, err := openDB(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		return load(ctx, db, p.Driver)
+	}()
+
+	schemaCacheMu.Lock()
+	defer schemaCacheMu.Unlock()
+	entry, ok := schemaCache[key]
+	if err != nil {
+		log.Printf("Schema refresh for %s failed: %v", p.auditTarget(), err)
+		if ok {
+			entry.refreshing = false
+		}
+		return
+	}
+	if ok {
+		schemaCache[key] = &schemaCacheEntry{value: value, loaded: time.Now()}
+	}
+}
+
+// invalidateSchema drops everything cached for the target.
+func invalidateSchema(p connParams) {
+	prefix := p.cacheKey() + "|"
+	schemaCacheMu.Lock()
+	defer schemaCacheMu.Unlock()
+	for key := range schemaCache {
+		if strings.HasPrefix(key, prefix) {
+			delete(schemaCache, key)
+		}
+	}
+}
+
+// schemaLoadedAt returns when the oldest cached metadata of the target was
+// loaded, or the zero time when nothing is cached.
+func schemaLoadedAt(p connParams) time.Time {
+	prefix := p.cacheKey() + "|"
+	schemaCacheMu.Lock()
+	defer schemaCacheMu.Unlock()
+	var oldest time.Time
+	for key, entry := range schemaCache {
+		if strings.HasPrefix(key, prefix) && (oldest.IsZero() || entry.loaded.Before(oldest)) {
+			oldest = entry.loaded
+		}
+	}
+	return oldest
+}
+
+// changesSchema reports statements after which cached metadata is stale.
+func changesSchema(query string) bool {
+	switch firstKeyword(query) {
+	case "CREATE", "ALTER", "DROP", "RENAME", "COMMENT":
+		return true
+	}
+	return false
+}
+
+// The cached values are shared: callers must not modify them.
+
+func loadTables(ctx context.Context, db *sql.DB, driver string) (interface{}, error) {
+	return listTables(ctx, db, driver)
+}
+
+func schemaTables(ctx context.Context, db *sql.DB, p connParams) ([]tableInfo, error) {
+	v, err := cachedSchema(ctx, db, p, "tables", loadTables)
+	tables, _ := v.([]tableInfo)
+	return tables, err
+}
+
+func schemaSummaries(ctx context.Context, db *sql.DB, p connParams) ([]tableSummary, error) {
+	v, err := cachedSchema(ctx, db, p, "summaries", func(ctx context.Context, db *sql.DB, driver string) (interface{}, error) {
+		return listTableSummaries(ctx, db, driver)
+	})
+	tables, _ := v.([]tableSummary)
+	return tables, err
+}
+
+func schemaForeignKeys(ctx context.Context, db *sql.DB, p connParams) ([]foreignKey, error) {
+	v, err := cachedSchema(ctx, db, p, "foreign_keys", func(ctx context.Context, db *sql.DB, driver string) (interface{}, error) {
+		return listForeignKeys(ctx, db, driver)
+	})
+	fks, _ := v.([]foreignKey)
+	return fks, err
+}
+
+// schemaRefreshHandler drops the cached metadata of the connection and lists
+// its tables afresh.
+func schemaRefreshHandler(c *gin.Context) {
+	invalidateSchema(connParamsFromForm(c))
+	browseTables(c)
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	schemaSnapshotTimeout = time.Minute
+	// schemaHistorySnapshots is how many snapshots the history page diffs
+	schemaHistorySnapshots = 50
+)
+
+// schemaSnapshotConfig records the schema of saved connections over time,
+// so columns added or changed outside any migration show up with a date.
+type schemaSnapshotConfig struct {
+	// Connections are saved connection names; "*" takes all of them
+	Connections []string `json:"connections"`
+	// Interval is in minutes between snapshots, 60 when zero
+	Interval int `json:"interval"`
+	// Notify sends the changes a snapshot finds to the notifiers
+	Notify bool `json:"notify"`
+}
+
+func (s schemaSnapshotConfig) interval() time.Duration {
+	if s.Interval > 0 {
+		return time.Duration(s.Interval) * time.Minute
+	}
+	return time.Hour
+}
+
+// schemaSnapshot is the tables and columns of a connection when it was
+// taken. A snapshot is only stored when the schema differs from the
+// previous one, so the history holds changes rather than every interval.
+type schemaSnapshot struct {
+	ID         int64
+	Connection string
+	At         time.Time
+	Tables     []tableInfo
+}
+
+// schemaChange is one difference between two snapshots.
+type schemaChange struct {
+	// Kind is "table added", "table dropped", "column added", "column
+	// dropped" or "column changed"
+	Kind   string
+	Table  string
+	Column string
+	// Detail says what changed about a column, e.g. type int → bigint
+	Detail string
+}
+
+func (ch schemaChange) String() string {
+	switch ch.Kind {
+	case "table added", "table dropped":
+		return fmt.Sprintf("%s %s", ch.Kind, ch.Table)
+	case "column changed":
+		return fmt.Sprintf("column %s changed on table %s: %s", ch.Column, ch.Table, ch.Detail)
+	}
+	return fmt.Sprintf("column %s %s on table %s", ch.Column, strings.TrimPrefix(ch.Kind, "column "), ch.Table)
+}
+
+// schemaRevision is a snapshot with the changes from the one before it;
+// the first snapshot of a connection has none.
+type schemaRevision struct {
+	Snapshot schemaSnapshot
+	Changes  []schemaChange
+	First    bool
+}
+
+func columnText(col columnInfo) string {
+	s := col.Type
+	if !col.Nullable {
+		s += " NOT NULL"
+	}
+	if col.Default != nil {
+		s += " DEFAULT " + *col.Default
+	}
+	return s
+}
+
+// diffSchemas lists what changed from old to new, tables in the order of
+// new and dropped ones last.
+func diffSchemas(old, new []tableInfo) []schemaChange {
+	oldTables := make(map[string]tableInfo, len(old))
+	for _, t := range old {
+		oldTables[qualifiedName(t)] = t
+	}
+	var changes []schemaChange
+	seen := make(map[string]bool, len(new))
+	for _, t := range new {
+		name := qualifiedName(t)
+		seen[name] = true
+		before, ok := oldTables[name]
+		if !ok {
+			changes = append(changes, schemaChange{Kind: "table added", Table: name})
+			continue
+		}
+		oldColumns := make(map[string]columnInfo, len(before.Columns))
+		for _, col := range before.Columns {
+			oldColumns[col.Name] = col
+		}
+		for _, col := range t.Columns {
+			prev, ok := oldColumns[col.Name]
+			delete(oldColumns, col.Name)
+			switch {
+			case !ok:
+				changes = append(changes, schemaChange{Kind: "column added", Table: name, Column: col.Name, Detail: columnText(col)})
+			case columnText(prev) != columnText(col):
+				changes = append(changes, schemaChange{Kind: "column changed", Table: name, Column: col.Name,
+					Detail: columnText(prev) + " → " + columnText(col)})
+			}
+		}
+		for _, col := range before.Columns {
+			if _, dropped := oldColumns[col.Name]; dropped {
+				changes = append(changes, schemaChange{Kind: "column dropped", Table: name, Column: col.Name, Detail: columnText(col)})
+			}
+		}
+	}
+	for _, t := range old {
+		if name := qualifiedName(t); !seen[name] {
+			changes = append(changes, schemaChange{Kind: "table dropped", Table: name})
+		}
+	}
+	return changes
+}
+
+func scanSchemaSnapshot(row rowScanner) (schemaSnapshot, error) {
+	var s schemaSnapshot
+	var at int64
+	var tables string
+	if err := row.Scan(&s.ID, &s.Connection, &at, &tables); err != nil {
+		return s, err
+	}
+	s.At = time.Unix(at, 0)
+	return s, json.Unmarshal([]byte(tables), &s.Tables)
+}
+
+// listSchemaSnapshots returns the newest snapshots of a connection first.
+func listSchemaSnapshots(ctx context.Context, connection string, limit int) ([]schemaSnapshot, error) {
+	rows, err := store.QueryContext(ctx, `
+		SELECT id, connection, at, tables FROM schema_snapshots
+		WHERE connection = ? ORDER BY id DESC LIMIT ?`, connection, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var snapshots []schemaSnapshot
+	for rows.Next() {
+		s, err := scanSchemaSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+// takeSchemaSnapshot reads the schema of a saved connection and stores it
+// when it differs from the last snapshot, returning the changes. taken is
+// false when nothing changed.
+func takeSchemaSnapshot(ctx context.Context, sc savedConnection) (changes []schemaChange, taken bool, err error) {
+	db, err := openDB(ctx, sc.connParams)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+	// read the catalog directly: a cached schema could hide a fresh change
+	tables, err := listTables(ctx, db, sc.Driver)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err := json.Marshal(tables)
+	if err != nil {
+		return nil, false, err
+	}
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	var lastChecksum, lastTables string
+	err = store.QueryRowContext(ctx, `
+		SELECT checksum, tables FROM schema_snapshots
+		WHERE connection = ? ORDER BY id DESC LIMIT 1`, sc.Name).Scan(&lastChecksum, &lastTables)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, false, err
+	case lastChecksum == checksum:
+		return nil, false, nil
+	default:
+		var last []tableInfo
+		if err := json.Unmarshal([]byte(lastTables), &last); err != nil {
+			return nil, false, err
+		}
+		changes = diffSchemas(last, tables)
+	}
+	_, err = store.ExecContext(ctx, `
+		INSERT INTO schema_snapshots (connection, at, checksum, tables) VALUES (?, ?, ?, ?)`,
+		sc.Name, time.Now().Unix(), checksum, string(data))
+	return changes, err == nil, err
+}
+
+// snapshotConnections are the saved connections the configuration names.
+func snapshotConnections(ctx context.Context) ([]savedConnection, error) {
+	all, err := listConnections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool)
+	for _, name := range config.SchemaSnapshots.Connections {
+		wanted[name] = true
+	}
+	var conns []savedConnection
+	for _, sc := range all {
+		if wanted["*"] || wanted[sc.Name] {
+			conns = append(conns, sc)
+		}
+	}
+	return conns, nil
+}
+
+// snapshotSchema takes a snapshot and reports what it found in the audit
+// log and, when configured, to the notifiers.
+func snapshotSchema(sc savedConnection, user string) ([]schemaChange, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), schemaSnapshotTimeout)
+	defer cancel()
+	changes, taken, err := takeSchemaSnapshot(ctx, sc)
+	if err != nil || !taken {
+		return changes, taken, err
+	}
+	lines := make([]string, len(changes))
+	for i, ch := range changes {
+		lines[i] = ch.String()
+	}
+	recordAudit(ctx, auditEntry{
+		User:   user,
+		Action: "schema_snapshot",
+		Target: sc.Name,
+		Detail: strings.Join(lines, "\n"),
+	})
+	if len(changes) > 0 && config.SchemaSnapshots.Notify {
+		notify(notifyEvent{
+			Kind:    "schema",
+			Name:    sc.Name,
+			User:    user,
+			Target:  sc.auditTarget(),
+			Status:  "changed",
+			Changes: lines,
+			At:      time.Now(),
+			Link:    resultLink("/schema/history?connection=" + url.QueryEscape(sc.Name)),
+		})
+	}
+	return changes, taken, nil
+}
+
+// runSchemaSnapshots snapshots the configured connections every interval;
+// without any configured it does nothing.
+func runSchemaSnapshots() {
+	if len(config.SchemaSnapshots.Connections) == 0 {
+		return
+	}
+	for ; ; time.Sleep(config.SchemaSnapshots.interval()) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		conns, err := snapshotConnections(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to read saved connections: %v", err)
+			continue
+		}
+		for _, sc := range conns {
+			changes, _, err := snapshotSchema(sc, schedulerUser)
+			if err != nil {
+				log.Printf("Schema snapshot of %s failed: %v", sc.Name, err)
+				continue
+			}
+			if len(changes) > 0 {
+				log.Printf("Schema of %s changed: %d changes", sc.Name, len(changes))
+			}
+		}
+	}
+}
+
+// schemaRevisions pairs each snapshot with the changes since the one
+// before it, newest first.
+func schemaRevisions(snapshots []schemaSnapshot, complete bool) []schemaRevision {
+	revisions := make([]schemaRevision, 0, len(snapshots))
+	for i, s := range snapshots {
+		r := schemaRevision{Snapshot: s}
+		if i+1 < len(snapshots) {
+			r.Changes = diffSchemas(snapshots[i+1].Tables, s.Tables)
+		} else if complete {
+			r.First = true
+		} else {
+			// the one before it is past the page; it only anchors the diff
+			break
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions
+}
+
+// schemaHistoryHandler shows how the schema of a saved connection changed
+// between snapshots.
+func schemaHistoryHandler(c *gin.Context) {
+	renderSchemaHistory(c, c.Request.FormValue("connection"), "")
+}
+
+func renderSchemaHistory(c *gin.Context, connection, message string) {
+	if connection == "" {
+		renderError(c, http.StatusBadRequest, "schemahistory.html", "Pick a saved connection")
+		return
+	}
+	// one more than shown, to diff the oldest shown against
+	snapshots, err := listSchemaSnapshots(c.Request.Context(), connection, schemaHistorySnapshots+1)
+	if err != nil {
+		renderError(c, http.StatusInternalServerError, "schemahistory.html", "Failed to read schema snapshots: %v", err)
+		return
+	}
+	render(c, http.StatusOK, schemaHistoryView{
+		Connection: connection,
+		Revisions:  schemaRevisions(snapshots, len(snapshots) <= schemaHistorySnapshots),
+		Message:    message,
+	})
+}
+
+// schemaSnapshotHandler takes a snapshot of a saved connection now, then
+// shows its history.
+func schemaSnapshotHandler(c *gin.Context) {
+	name := c.PostForm("connection")
+	if name == "" {
+		renderError(c, http.StatusBadRequest, "schemahistory.html", "Pick a saved connection")
+		return
+	}
+	sc, err := getConnection(c.Request.Context(), name)
+	if err != nil {
+		renderError(c, http.StatusNotFound, "schemahistory.html", "%v", err)
+		return
+	}
+	changes, taken, err := snapshotSchema(sc, currentIdentity(c).User)
+	if err != nil {
+		renderError(c, http.StatusBadGateway, "schemahistory.html", "Schema snapshot failed: %v", err)
+		return
+	}
+	message := "The schema has not changed since the last snapshot"
+	switch {
+	case taken && len(changes) > 0:
+		message = fmt.Sprintf("Snapshot taken, %d changes", len(changes))
+	case taken:
+		message = "Snapshot taken"
+	}
+	renderSchemaHistory(c, name, message)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	scriptMaxBytes = 64 << 20
+	scriptTimeout  = 2 * time.Hour
+	// errors listed on the page; the audit log counts all of them
+	scriptShownErrors = 100
+)
+
+// scriptError is a statement of an uploaded script that failed.
+type scriptError struct {
+	Line      int
+	Statement string
+	Error     string
+}
+
+// scriptRun executes an uploaded .sql file in the background, statement by
+// statement on one connection so that session state (SET, USE, temporary
+// tables, the file's own BEGIN/COMMIT) carries over. The page polls it.
+type scriptRun struct {
+	ID      string
+	File    string
+	Total   int
+	Started time.Time
+
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	done     int
+	current  scriptStatement
+	affected int64
+	errors   []scriptError
+	failed   int
+	finished time.Time
+	stopped  string
+}
+
+var (
+	scriptRunsMu sync.Mutex
+	scriptRuns   = make(map[string]*scriptRun)
+)
+
+func (r *scriptRun) run(ctx context.Context, db *sql.DB, statements []scriptStatement, guards []*guardedQuery, stopOnError bool, done func(*scriptRun)) {
+	defer db.Close()
+	defer r.cancel()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		r.finish(err.Error())
+		done(r)
+		return
+	}
+	defer conn.Close()
+
+	for i, st := range statements {
+		r.mu.Lock()
+		r.current = st
+		r.mu.Unlock()
+
+		guards[i].started = time.Now()
+		res, err := conn.ExecContext(ctx, st.Text)
+		guards[i].done(err)
+		r.mu.Lock()
+		r.done++
+		if err == nil {
+			if n, err := res.RowsAffected(); err == nil {
+				r.affected += n
+			}
+		} else {
+			r.failed++
+			if len(r.errors) < scriptShownErrors {
+				r.errors = append(r.errors, scriptError{Line: st.Line, Statement: truncate(300, st.Text), Error: err.Error()})
+			}
+		}
+		r.mu.Unlock()
+
+		if ctx.Err() != nil {
+			r.finish("Cancelled or timed out")
+			done(r)
+			return
+		}
+		if err != nil && stopOnError {
+			r.finish(fmt.Sprintf("Stopped at line %d", st.Line))
+			done(r)
+			return
+		}
+	}
+	r.finish("")
+	done(r)
+}
+
+func (r *scriptRun) finish(stopped string) {
+	r.mu.Lock()
+	r.stopped = stopped
+	r.finished = time.Now()
+	r.mu.Unlock()
+
+	time.AfterFunc(time.Hour, func() {
+		scriptRunsMu.Lock()
+		delete(scriptRuns, r.ID)
+		scriptRunsMu.Unlock()
+	})
+}
+
+func (r *scriptRun) view() scriptView {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v := scriptView{
+		ID:       r.ID,
+		File:     r.File,
+		Total:    r.Total,
+		Done:     r.done,
+		Failed:   r.failed,
+		Affected: r.affected,
+		Errors:   append([]scriptError(nil), r.errors...),
+		More:     r.failed - len(r.errors),
+		Running:  r.finished.IsZero(),
+		Stopped:  r.stopped,
+		Elapsed:  time.Since(r.Started).Round(time.Second),
+	}
+	if r.finished.IsZero() {
+		v.Current = &scriptStatement{Line: r.current.Line, Text: truncate(300, r.current.Text)}
+	} else {
+		v.Elapsed = r.finished.Sub(r.Started).Round(time.Second)
+	}
+	return v
+}
+
+// runScriptHandler starts executing an uploaded .sql file and renders the
+// progress fragment, which polls scriptStatusHandler until the run ends.
+func runScriptHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "script.html", format, args...)
+	}
+	upload, err := c.FormFile("script")
+	if err != nil {
+		fail(http.StatusBadRequest, "Upload a .sql file")
+		return
+	}
+	if upload.Size > scriptMaxBytes {
+		fail(http.StatusBadRequest, "The file is larger than %s", formatBytes(scriptMaxBytes))
+		return
+	}
+	f, err := upload.Open()
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to read upload: %v", err)
+		return
+	}
+	defer f.Close()
+	text, err := io.ReadAll(f)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to read upload: %v", err)
+		return
+	}
+	statements := splitStatements(strings.TrimPrefix(string(text), "\ufeff"), p.Driver)
+	if len(statements) == 0 {
+		fail(http.StatusBadRequest, "The file contains no statements")
+		return
+	}
+	// a script runs only if the hooks let every statement in it through
+	guards := make([]*guardedQuery, len(statements))
+	for i, st := range statements {
+		guards[i], err = guardQuery(c.Request.Context(), newQueryEvent(c, p, "script", st.Text))
+		if err != nil {
+			fail(http.StatusForbidden, "Line %d: %v", st.Line, err)
+			return
+		}
+	}
+
+	// the script holds one query slot on the server until it finishes
+	release, err := acquireQuerySlot(c.Request.Context(), p, "")
+	if err != nil {
+		fail(http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), scriptTimeout)
+	db, err := openDB(ctx, p)
+	if err != nil {
+		release()
+		cancel()
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+
+	user := currentIdentity(c).User
+	run := &scriptRun{
+		ID:      randomID(8),
+		File:    upload.Filename,
+		Total:   len(statements),
+		Started: time.Now(),
+		cancel:  cancel,
+	}
+	scriptRunsMu.Lock()
+	scriptRuns[run.ID] = run
+	scriptRunsMu.Unlock()
+
+	log.Printf("%s runs %s (%d statements) on %s", user, upload.Filename, len(statements), p.address())
+	go run.run(ctx, db, statements, guards, c.PostForm("continue") == "", func(r *scriptRun) {
+		release()
+		invalidateSchema(p)
+		view := r.view()
+		recordAudit(context.Background(), auditEntry{
+			User:   user,
+			Action: "run_script",
+			Target: p.auditTarget(),
+			Query:  upload.Filename,
+			Detail: fmt.Sprintf("%d of %d statements run, %d failed, %d rows affected. %s",
+				view.Done, r.Total, view.Failed, view.Affected, view.Stopped),
+		})
+	})
+
+	render(c, http.StatusOK, run.view())
+}
+
+func lookupScriptRun(id string) (*scriptRun, bool) {
+	scriptRunsMu.Lock()
+	defer scriptRunsMu.Unlock()
+	run, ok := scriptRuns[id]
+	return run, ok
+}
+
+func scriptStatusHandler(c *gin.Context) {
+	run, ok := lookupScriptRun(c.Query("id"))
+	if !ok {
+		renderError(c, http.StatusNotFound, "script.html", "Unknown script run")
+		return
+	}
+	render(c, http.StatusOK, run.view())
+}
+
+// scriptCancelHandler cancels a running script; the statement in flight is
+// interrupted by the driver where it supports cancellation.
+func scriptCancelHandler(c *gin.Context) {
+	run, ok := lookupScriptRun(c.Query("id"))
+	if !ok {
+		renderError(c, http.StatusNotFound, "script.html", "Unknown script run")
+		return
+	}
+	run.cancel()
+	render(c, http.StatusOK, run.view())
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const sessionCookie = "sa_session"
+
+// sessionID returns the browser session id, issuing a cookie on first use.
+func sessionID(c *gin.Context) string {
+	if id, err := c.Cookie(sessionCookie); err == nil && id != "" {
+		return id
+	}
+	id := randomID(16)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, id, 0, "/", "", false, true)
+	return id
+}
+
+// preferenceOwner keys what a person keeps between visits, the recent
+// connections and the display time zone, by the signed-in user, so it
+// follows them to other browsers; without sign-in it is the browser
+// session's.
+func preferenceOwner(c *gin.Context) string {
+	if user := currentIdentity(c).User; user != "anonymous" {
+		return "user:" + user
+	}
+	return "session:" + sessionID(c)
+}
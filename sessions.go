@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serverSession is one client connection or running query on the server.
+type serverSession struct {
+	ID       string
+	User     string
+	Database string
+	Client   string
+	State    string
+	Elapsed  time.Duration
+	Query    string
+}
+
+// Each query returns id, user, database, client, state, elapsed
+// milliseconds and query text, longest running first, leaving out the
+// session asking. ClickHouse lists queries rather than connections.
+var sessionQueries = map[string]string{
+	"postgres": `
+		SELECT pid::text, COALESCE(usename, ''), COALESCE(datname, ''),
+		       COALESCE(client_addr::text, 'local'), COALESCE(state, ''),
+		       COALESCE((EXTRACT(EPOCH FROM now() - COALESCE(query_start, backend_start)) * 1000)::bigint, 0),
+		       COALESCE(query, '')
+		FROM pg_stat_activity
+		WHERE pid <> pg_backend_pid() AND backend_type = 'client backend'
+		ORDER BY 6 DESC`,
+	"mysql": `
+		SELECT CAST(id AS CHAR), COALESCE(user, ''), COALESCE(db, ''), COALESCE(host, ''),
+		       COALESCE(NULLIF(state, ''), command), CAST(time AS SIGNED) * 1000, COALESCE(info, '')
+		FROM information_schema.processlist
+		WHERE id <> CONNECTION_ID()
+		ORDER BY 6 DESC`,
+	"clickhouse": `
+		SELECT query_id, user, current_database, toString(address), 'running',
+		       toInt64(elapsed * 1000), query
+		FROM system.processes
+		WHERE is_initial_query AND query_id != queryID()
+		ORDER BY 6 DESC`,
+}
+
+func listSessions(ctx context.Context, db *sql.DB, driver string) ([]serverSession, error) {
+	query, ok := sessionQueries[driver]
+	if !ok {
+		return nil, fmt.Errorf("sessions are not supported for %q", driver)
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []serverSession
+	for rows.Next() {
+		var s serverSession
+		var ms int64
+		if err := rows.Scan(&s.ID, &s.User, &s.Database, &s.Client, &s.State, &ms, &s.Query); err != nil {
+			return nil, err
+		}
+		s.Elapsed = time.Duration(ms) * time.Millisecond
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// killSession stops the running query of a session, or with terminate the
+// whole session. ClickHouse can only kill queries.
+func killSession(ctx context.Context, db *sql.DB, driver, id string, terminate bool) (string, error) {
+	switch driver {
+	case "postgres", "mysql":
+		pid, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid session id %q", id)
+		}
+		if driver == "mysql" {
+			query := "KILL QUERY " + strconv.FormatInt(pid, 10)
+			if terminate {
+				query = "KILL " + strconv.FormatInt(pid, 10)
+			}
+			_, err := db.ExecContext(ctx, query)
+			return query, err
+		}
+		query := "SELECT pg_cancel_backend($1)"
+		if terminate {
+			query = "SELECT pg_terminate_backend($1)"
+		}
+		var ok bool
+		if err := db.QueryRowContext(ctx, query, pid).Scan(&ok); err != nil {
+			return query, err
+		}
+		if !ok {
+			return query, fmt.Errorf("session %d is gone or could not be signalled", pid)
+		}
+		return query, nil
+	case "clickhouse":
+		if terminate {
+			return "", fmt.Errorf("ClickHouse sessions cannot be terminated, only their queries")
+		}
+		query := "KILL QUERY WHERE query_id = ?"
+		_, err := db.ExecContext(ctx, query, id)
+		return query, err
+	default:
+		return "", fmt.Errorf("sessions are not supported for %q", driver)
+	}
+}
+
+// sessionsHandler lists the sessions on the server; with an id it first
+// cancels that session's query, or terminates it, and lists again.
+func sessionsHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "sessions.html", format, args...)
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	page := sessionsView{Terminate: p.Driver != "clickhouse"}
+	if id := c.PostForm("id"); id != "" {
+		terminate := c.PostForm("mode") == "terminate"
+		query, err := killSession(ctx, db, p.Driver, id, terminate)
+		if err != nil {
+			page.Problem = fmt.Sprintf("Failed to stop session %s: %v", id, err)
+		} else {
+			action := "Cancelled the query of session"
+			if terminate {
+				action = "Terminated session"
+			}
+			page.Done = fmt.Sprintf("%s %s.", action, id)
+
+			user := currentIdentity(c).User
+			log.Printf("%s stopped session %s on %s (terminate: %t)", user, id, p.address(), terminate)
+			recordAudit(c.Request.Context(), auditEntry{
+				User:   user,
+				Action: "kill_session",
+				Target: p.auditTarget(),
+				Query:  query,
+				Detail: fmt.Sprintf("session %s, terminate: %t", id, terminate),
+			})
+		}
+	}
+
+	sessions, err := listSessions(ctx, db, p.Driver)
+	if err != nil {
+		fail(http.StatusBadRequest, "Failed to list sessions: %v", err)
+		return
+	}
+	page.Sessions = sessions
+	render(c, http.StatusOK, page)
+}
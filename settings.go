@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serverSetting is one configuration variable of the server.
+type serverSetting struct {
+	Name        string
+	Value       string
+	Unit        string
+	Description string
+	// Source tells where a non-default value comes from, when the server says
+	Source string
+}
+
+// Each query returns name, value, unit, description and source. MySQL
+// only has names and values; SQLite lists the common pragmas.
+var settingsQueries = map[string]string{
+	"postgres": `
+		SELECT name, setting, COALESCE(unit, ''), COALESCE(short_desc, ''),
+		       CASE WHEN source = 'default' THEN '' ELSE source END
+		FROM pg_settings
+		ORDER BY name`,
+	"mysql": `SHOW GLOBAL VARIABLES`,
+	"clickhouse": `
+		SELECT name, value, '', description, if(changed, 'changed', '')
+		FROM system.settings
+		ORDER BY name`,
+	"sqlite": `
+		SELECT 'auto_vacuum', auto_vacuum, '', '', '' FROM pragma_auto_vacuum
+		UNION ALL SELECT 'cache_size', cache_size, 'pages, or KiB if negative', '', '' FROM pragma_cache_size
+		UNION ALL SELECT 'encoding', encoding, '', '', '' FROM pragma_encoding
+		UNION ALL SELECT 'foreign_keys', foreign_keys, '', '', '' FROM pragma_foreign_keys
+		UNION ALL SELECT 'journal_mode', journal_mode, '', '', '' FROM pragma_journal_mode
+		UNION ALL SELECT 'page_size', page_size, 'bytes', '', '' FROM pragma_page_size
+		UNION ALL SELECT 'synchronous', synchronous, '', '', '' FROM pragma_synchronous
+		UNION ALL SELECT 'temp_store', temp_store, '', '', '' FROM pragma_temp_store
+		UNION ALL SELECT 'user_version', user_version, '', '', '' FROM pragma_user_version`,
+}
+
+func listSettings(ctx context.Context, db *sql.DB, driver string) ([]serverSetting, error) {
+	query, ok := settingsQueries[driver]
+	if !ok {
+		return nil, fmt.Errorf("settings are not supported for %q", driver)
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var settings []serverSetting
+	for rows.Next() {
+		var s serverSetting
+		if driver == "mysql" {
+			err = rows.Scan(&s.Name, &s.Value)
+		} else {
+			err = rows.Scan(&s.Name, &s.Value, &s.Unit, &s.Description, &s.Source)
+		}
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, s)
+	}
+	return settings, rows.Err()
+}
+
+// matches reports whether the setting's name or description contains every
+// word of the search, ignoring case.
+func (s serverSetting) matches(search string) bool {
+	text := strings.ToLower(s.Name + " " + s.Description)
+	for _, word := range strings.Fields(strings.ToLower(search)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// settingsHandler lists the server configuration, filtered by the search
+// field. It only reads.
+func settingsHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	search := strings.TrimSpace(c.PostForm("search"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		renderError(c, http.StatusServiceUnavailable, "settings.html", "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	settings, err := listSettings(ctx, db, p.Driver)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "settings.html", "Failed to read settings: %v", err)
+		return
+	}
+	total := len(settings)
+	if search != "" {
+		var found []serverSetting
+		for _, s := range settings {
+			if s.matches(search) {
+				found = append(found, s)
+			}
+		}
+		settings = found
+	}
+
+	render(c, http.StatusOK, settingsView{
+		Settings: settings,
+		Total:    total,
+		Search:   search,
+		Details:  p.Driver != "mysql",
+	})
+}
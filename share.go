@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shareMaxRows caps a snapshot; a link is for showing a result, not for
+// moving data
+const shareMaxRows = 10000
+
+// shareConfig sets up result share links.
+type shareConfig struct {
+	// DefaultExpiry and MaxExpiry are in hours, 24 and 720 when zero
+	DefaultExpiry int `json:"default_expiry"`
+	MaxExpiry     int `json:"max_expiry"`
+	// RequireLogin keeps links behind the app's sign-in; by default the
+	// signed link alone opens the snapshot
+	RequireLogin bool `json:"require_login"`
+}
+
+func (s shareConfig) expiries() (def, max time.Duration) {
+	def, max = 24*time.Hour, 720*time.Hour
+	if s.DefaultExpiry > 0 {
+		def = time.Duration(s.DefaultExpiry) * time.Hour
+	}
+	if s.MaxExpiry > 0 {
+		max = time.Duration(s.MaxExpiry) * time.Hour
+	}
+	return min(def, max), max
+}
+
+// sharedResult is a snapshot of a result behind a share link.
+type sharedResult struct {
+	ID        string
+	Title     string
+	Target    string
+	Query     string
+	CreatedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Result    *runResult
+}
+
+// shareClaims are signed into the link, so a link can't be made up or
+// extended; the store's expiry is checked as well.
+type shareClaims struct {
+	ID      string `json:"id"`
+	Expires int64  `json:"exp"`
+}
+
+var (
+	shareSecretOnce sync.Once
+	shareSecretKey  string
+)
+
+// shareSecret signs links with the auth secret. Without one configured a
+// random key is used and links die with the process.
+func shareSecret() string {
+	shareSecretOnce.Do(func() {
+		shareSecretKey = config.Auth.Secret
+		if shareSecretKey == "" {
+			shareSecretKey = randomID(32)
+		}
+	})
+	return shareSecretKey
+}
+
+// appURL makes path absolute for a link sent outside the page. Only the
+// configured base URL is used: the request's Host is whatever the client
+// sent, and a signed link must not point anywhere else.
+func appURL(path string) string {
+	return strings.TrimRight(config.Notify.BaseURL, "/") + path
+}
+
+func saveSharedResult(ctx context.Context, s sharedResult) error {
+	result, err := json.Marshal(s.Result)
+	if err != nil {
+		return err
+	}
+	// expired snapshots go when new ones come
+	if _, err := store.ExecContext(ctx, "DELETE FROM shared_results WHERE expires_at < ?", time.Now().Unix()); err != nil {
+		return err
+	}
+	_, err = store.ExecContext(ctx, `
+		INSERT INTO shared_results (id, title, target, query, result, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ID, s.Title, s.Target, s.Query, string(result), s.CreatedBy, s.CreatedAt.Unix(), s.ExpiresAt.Unix())
+	return err
+}
+
+var errShareNotFound = errors.New("this link is invalid or has expired")
+
+func getSharedResult(ctx context.Context, id string) (sharedResult, error) {
+	s := sharedResult{ID: id}
+	var result string
+	var created, expires int64
+	err := store.QueryRowContext(ctx, `
+		SELECT title, target, query, result, created_by, created_at, expires_at
+		FROM shared_results WHERE id = ?`, id).
+		Scan(&s.Title, &s.Target, &s.Query, &result, &s.CreatedBy, &created, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, errShareNotFound
+	}
+	if err != nil {
+		return s, err
+	}
+	s.CreatedAt, s.ExpiresAt = time.Unix(created, 0), time.Unix(expires, 0)
+	if time.Now().After(s.ExpiresAt) {
+		return s, errShareNotFound
+	}
+	s.Result, err = decodeRunResult(result)
+	return s, err
+}
+
+// shareHandler snapshots the query form's result and answers with a signed
+// link to it, valid for share_expiry hours.
+func shareHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	query := c.PostForm("query")
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "share.html", format, args...)
+	}
+	if config.Notify.BaseURL == "" {
+		fail(http.StatusBadRequest, "Sharing needs notify.base_url, the address the app is opened at")
+		return
+	}
+	if !returnsRows(query) {
+		fail(http.StatusBadRequest, "Only results of queries that return rows can be shared")
+		return
+	}
+	if err := p.validateAddress(); err != nil {
+		fail(http.StatusBadRequest, "%v", err)
+		return
+	}
+	ttl, maxTTL := config.Share.expiries()
+	if hours := c.PostForm("share_expiry"); hours != "" {
+		n, err := strconv.Atoi(hours)
+		if err != nil || n < 1 {
+			fail(http.StatusBadRequest, "Invalid expiry %q", hours)
+			return
+		}
+		ttl = time.Duration(n) * time.Hour
+	}
+	if ttl > maxTTL {
+		fail(http.StatusBadRequest, "Links can be valid for at most %s", formatDuration(maxTTL))
+		return
+	}
+	afterHooks, ok := pageQueryHooks(c, p, query)
+	if !ok {
+		return
+	}
+	defer afterHooks()
+
+	rs, status, err := formResult(c, p, query)
+	if err != nil {
+		fail(status, "Share failed: %v", err)
+		return
+	}
+	now := time.Now()
+	s := sharedResult{
+		ID:        randomID(16),
+		Title:     strings.TrimSpace(c.PostForm("share_title")),
+		Target:    p.auditTarget(),
+		Query:     query,
+		CreatedBy: currentIdentity(c).User,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+		Result:    &runResult{Columns: rs.Columns, Rows: rs.Rows, Truncated: rs.Truncated},
+	}
+	if len(rs.Rows) > shareMaxRows {
+		s.Result.Rows, s.Result.Truncated = rs.Rows[:shareMaxRows], true
+	}
+	if err := saveSharedResult(c.Request.Context(), s); err != nil {
+		log.Printf("Failed to save shared result: %v", err)
+		fail(http.StatusInternalServerError, "Failed to save the snapshot: %v", err)
+		return
+	}
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   s.CreatedBy,
+		Action: "share",
+		Target: s.Target,
+		Query:  query,
+		Ref:    s.ID,
+		Detail: fmt.Sprintf("%d rows, expires %s", len(s.Result.Rows), s.ExpiresAt.Format(time.RFC3339)),
+	})
+
+	claims, _ := json.Marshal(shareClaims{ID: s.ID, Expires: s.ExpiresAt.Unix()})
+	render(c, http.StatusOK, shareView{
+		Link:    appURL("/share/" + signValue(shareSecret(), claims)),
+		Rows:    len(s.Result.Rows),
+		Expires: s.ExpiresAt,
+	})
+}
+
+// verifyShareToken reads the claims of a link signed with secret, if the
+// signature holds and the link hasn't expired by now.
+func verifyShareToken(secret, token string, now time.Time) (shareClaims, bool) {
+	var claims shareClaims
+	payload, ok := verifyValue(secret, token)
+	if !ok || json.Unmarshal(payload, &claims) != nil || now.Unix() > claims.Expires {
+		return shareClaims{}, false
+	}
+	return claims, true
+}
+
+// sharedResultHandler shows a snapshot to whoever has its link.
+func sharedResultHandler(c *gin.Context) {
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "shared.html", format, args...)
+	}
+
+	claims, ok := verifyShareToken(shareSecret(), c.Param("token"), time.Now())
+	if !ok {
+		fail(http.StatusNotFound, "%v", errShareNotFound)
+		return
+	}
+	s, err := getSharedResult(c.Request.Context(), claims.ID)
+	if errors.Is(err, errShareNotFound) {
+		fail(http.StatusNotFound, "%v", err)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read shared result %s: %v", claims.ID, err)
+		fail(http.StatusInternalServerError, "Failed to read the snapshot")
+		return
+	}
+
+	rows, _ := dedupeRows(s.Result.Rows, false, false)
+	v := sharedView{Share: s, Result: resultView{Columns: s.Result.Columns, Rows: rows}}
+	if s.Result.Truncated {
+		v.Result.TruncatedAt = len(s.Result.Rows)
+	}
+	render(c, http.StatusOK, v)
+}
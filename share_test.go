@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyShareToken(t *testing.T) {
+	const secret = "s3cret"
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sign := func(c shareClaims) string {
+		payload, _ := json.Marshal(c)
+		return signValue(secret, payload)
+	}
+	valid := sign(shareClaims{ID: "abc", Expires: now.Add(time.Hour).Unix()})
+	payload, sig, _ := strings.Cut(valid, ".")
+	// the same signature on a link extended by a day
+	extended, _ := json.Marshal(shareClaims{ID: "abc", Expires: now.Add(25 * time.Hour).Unix()})
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", valid, true},
+		{"expires this second", sign(shareClaims{ID: "abc", Expires: now.Unix()}), true},
+		{"expired", sign(shareClaims{ID: "abc", Expires: now.Add(-time.Second).Unix()}), false},
+		{"extended", base64.RawURLEncoding.EncodeToString(extended) + "." + sig, false},
+		{"other secret", signValue("other", []byte(`{"id":"abc","exp":9999999999}`)), false},
+		{"truncated signature", payload + "." + sig[:len(sig)-2], false},
+		{"no signature", payload, false},
+		{"not base64", "!!!." + sig, false},
+		{"not JSON", signValue(secret, []byte("abc")), false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		claims, ok := verifyShareToken(secret, tt.token, now)
+		if ok != tt.ok {
+			t.Errorf("%s: verifyShareToken ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && claims.ID != "abc" {
+			t.Errorf("%s: claims.ID = %q, want %q", tt.name, claims.ID, "abc")
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tableSize is the disk usage of one table, largest first on the page.
+type tableSize struct {
+	Schema string `json:"schema,omitempty"`
+	Name   string `json:"name"`
+	// Rows is an estimate on PostgreSQL and MySQL, nil where unknown
+	Rows       *int64  `json:"rows,omitempty"`
+	DataBytes  int64   `json:"data_bytes"`
+	IndexBytes int64   `json:"index_bytes"`
+	TotalBytes int64   `json:"total_bytes"`
+	Percent    float64 `json:"percent"`
+}
+
+func (t tableSize) Qualified() string {
+	return tableSummary{Schema: t.Schema, Name: t.Name}.Qualified()
+}
+
+// Each query returns schema, table, rows, data bytes, index bytes and total
+// bytes, largest first. Data includes TOAST on PostgreSQL; for ClickHouse it
+// is the compressed size of the active parts and the index is the primary
+// key held in memory; SQLite needs the dbstat virtual table.
+var tableSizeQueries = map[string]string{
+	"postgres": `
+		SELECT n.nspname, c.relname,
+		       CASE WHEN c.reltuples < 0 THEN NULL ELSE c.reltuples::bigint END,
+		       pg_table_size(c.oid), pg_indexes_size(c.oid), pg_total_relation_size(c.oid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p', 'm')
+		  AND n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%'
+		ORDER BY 6 DESC, 1, 2`,
+	"mysql": `
+		SELECT table_schema, table_name, table_rows,
+		       COALESCE(data_length, 0), COALESCE(index_length, 0),
+		       COALESCE(data_length, 0) + COALESCE(index_length, 0)
+		FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'
+		ORDER BY 6 DESC, 2`,
+	"clickhouse": `
+		SELECT database, table, toInt64(sum(rows)),
+		       toInt64(sum(data_compressed_bytes)), toInt64(sum(primary_key_bytes_in_memory)),
+		       toInt64(sum(bytes_on_disk))
+		FROM system.parts
+		WHERE active AND database = currentDatabase()
+		GROUP BY database, table
+		ORDER BY 6 DESC, 2`,
+	"sqlite": `
+		SELECT 'main', t.name, NULL,
+		       SUM(CASE WHEN s.name = t.name THEN s.pgsize ELSE 0 END),
+		       SUM(CASE WHEN s.name != t.name THEN s.pgsize ELSE 0 END),
+		       SUM(s.pgsize)
+		FROM sqlite_master t
+		JOIN sqlite_master o ON o.tbl_name = t.name AND o.type IN ('table', 'index')
+		JOIN dbstat s ON s.name = o.name
+		WHERE t.type = 'table'
+		GROUP BY t.name
+		ORDER BY 6 DESC, 2`,
+}
+
+func listTableSizes(ctx context.Context, db *sql.DB, driver string) ([]tableSize, error) {
+	query, ok := tableSizeQueries[driver]
+	if !ok {
+		return nil, fmt.Errorf("table sizes are not supported for %q", driver)
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sizes []tableSize
+	for rows.Next() {
+		var t tableSize
+		var estimate sql.NullInt64
+		if err := rows.Scan(&t.Schema, &t.Name, &estimate, &t.DataBytes, &t.IndexBytes, &t.TotalBytes); err != nil {
+			return nil, err
+		}
+		if estimate.Valid {
+			t.Rows = &estimate.Int64
+		}
+		sizes = append(sizes, t)
+	}
+	return sizes, rows.Err()
+}
+
+// tableSizesHandler shows which tables take up the space of the database.
+func tableSizesHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		renderError(c, http.StatusServiceUnavailable, "sizes.html", "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	sizes, err := listTableSizes(ctx, db, p.Driver)
+	if err != nil {
+		renderError(c, http.StatusBadRequest, "sizes.html", "Failed to read table sizes: %v", err)
+		return
+	}
+
+	var total, data, index int64
+	for _, t := range sizes {
+		total += t.TotalBytes
+		data += t.DataBytes
+		index += t.IndexBytes
+	}
+	for i := range sizes {
+		if total > 0 {
+			sizes[i].Percent = float64(sizes[i].TotalBytes) * 100 / float64(total)
+		}
+	}
+	render(c, http.StatusOK, sizesView{
+		Tables:     sizes,
+		Total:      total,
+		Data:       data,
+		Index:      index,
+		Estimated:  p.Driver == "mysql" || p.Driver == "postgres",
+		ClickHouse: p.Driver == "clickhouse",
+	})
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// formatKeywords are upper-cased by the formatter. Function names and
+// words often used as column names (key, first, range) stay as written:
+// ClickHouse identifiers are case-sensitive.
+var formatKeywords = wordSet(`
+	ALL ALTER AND ANY AS ASC BETWEEN BY CASE CAST CONSTRAINT CREATE CROSS DEFAULT DELETE DESC
+	DISTINCT DO DROP ELSE END EXCEPT EXISTS EXPLAIN FALSE FETCH FOR FOREIGN FROM FULL GRANT GROUP
+	HAVING ILIKE IN INNER INSERT INTERSECT INTERVAL INTO IS JOIN LATERAL LEFT LIKE LIMIT NATURAL NOT
+	NULL NULLS OFFSET ON OR ORDER OUTER PREWHERE PRIMARY RECURSIVE REFERENCES RETURNING REVOKE RIGHT
+	SELECT SET TABLE THEN TRUE TRUNCATE UNION UNIQUE UPDATE USING VALUES WHEN WHERE WINDOW WITH`)
+
+// formatClauses start a line at the indentation of their statement.
+var formatClauses = wordSet(`
+	SELECT FROM WHERE PREWHERE GROUP HAVING ORDER LIMIT OFFSET FETCH UNION INTERSECT EXCEPT WINDOW
+	VALUES SET RETURNING WITH INSERT UPDATE DELETE JOIN LEFT RIGHT INNER FULL CROSS NATURAL SETTINGS`)
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// formatScope is one statement level: the top, or a parenthesized
+// subquery. Other parentheses stay on one line.
+type formatScope struct {
+	indent   int
+	subquery bool
+	// clause is the keyword of the clause being written
+	clause string
+	// between is set until the AND of a BETWEEN
+	between bool
+}
+
+// formatSQL pretty-prints SQL: one clause per line, one select item and
+// condition per line, subqueries indented, keywords upper-cased and
+// comments kept. It only moves whitespace and changes keyword case, so the
+// statement means the same. Literals are read in the syntax of driver.
+func formatSQL(query, driver string) string {
+	const unit = "    "
+	tokens := lexSQL(query, driver, true)
+	var out []byte
+	// lineStart is where the current line's text begins, after its indent
+	lineStart := 0
+	newline := func(indent int) {
+		if len(out) == lineStart {
+			// nothing written on this line yet, just re-indent it
+			out = out[:strings.LastIndexByte(string(out), '\n')+1]
+		} else if len(out) > 0 {
+			out = append(out, '\n')
+		}
+		if len(out) > 0 {
+			out = append(out, strings.Repeat(unit, indent)...)
+		}
+		lineStart = len(out)
+	}
+	scopes := []formatScope{{subquery: true}}
+
+	for i, t := range tokens {
+		top := &scopes[len(scopes)-1]
+		var prev, next sqlToken
+		if i > 0 {
+			prev = tokens[i-1]
+		}
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+		word := t.upper()
+		if prev.is(".") || next.is(".") {
+			// a qualified name like o.order is no keyword
+			word = ""
+		}
+		if formatKeywords[word] {
+			t.Text = word
+		}
+
+		switch {
+		case t.Kind == tokComment || !top.subquery:
+			// comments stay where they are, calls and lists on one line
+		case word == "ON" && next.upper() == "CONFLICT" || word == "ON" && next.upper() == "DUPLICATE":
+			newline(top.indent)
+			top.clause = "ON CONFLICT"
+		case formatClauses[word] && !continuesClause(prev.upper(), word) &&
+			(!joinModifier(word) || next.upper() == "JOIN" || joinModifier(next.upper())):
+			newline(top.indent)
+			if word != "JOIN" || !joinModifier(prev.upper()) {
+				top.clause = word
+			}
+			top.between = false
+		case word == "ON":
+			newline(top.indent + 1)
+			top.clause = "ON"
+		case (word == "AND" || word == "OR") && !top.between:
+			switch top.clause {
+			case "WHERE", "PREWHERE", "ON", "HAVING":
+				newline(top.indent + 1)
+			}
+		case prev.is(",") && (top.clause == "SELECT" || top.clause == "SET" || top.clause == "WITH"):
+			newline(top.indent + 1)
+		case top.clause == "SELECT" && word != "DISTINCT" && (prev.upper() == "SELECT" || prev.upper() == "DISTINCT" && i > 1 && tokens[i-2].upper() == "SELECT"):
+			newline(top.indent + 1)
+		}
+		if word == "BETWEEN" {
+			top.between = true
+		} else if word == "AND" {
+			top.between = false
+		}
+
+		if len(out) > lineStart && (prev.Kind == tokComment || !tight(prev, t) || t.is("(") && spaceBeforeParen(tokens, i)) {
+			out = append(out, ' ')
+		}
+		out = append(out, t.Text...)
+
+		switch {
+		case t.is("("):
+			sub := next.upper() == "SELECT" || next.upper() == "WITH" || next.upper() == "VALUES"
+			scopes = append(scopes, formatScope{indent: top.indent + 1, subquery: sub})
+			if sub {
+				newline(top.indent + 1)
+			}
+		case t.is(")") && len(scopes) > 1:
+			// a subquery's closing parenthesis goes on a line of its own
+			closed := scopes[len(scopes)-1]
+			scopes = scopes[:len(scopes)-1]
+			if closed.subquery {
+				out = out[:len(out)-1]
+				newline(scopes[len(scopes)-1].indent)
+				out = append(out, ')')
+			}
+		case t.is(";"):
+			scopes = []formatScope{{subquery: true}}
+			if i+1 < len(tokens) {
+				out = append(out, '\n')
+				newline(0)
+			}
+		case t.Kind == tokComment && strings.HasPrefix(t.Text, "--"):
+			newline(top.indent + 1)
+		}
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// spaceBeforeParen separates a column list from its table, "INTO t (a, b)",
+// and a parenthesis from a keyword, where tight would join them like a
+// function call.
+func spaceBeforeParen(tokens []sqlToken, i int) bool {
+	if i == 0 {
+		return false
+	}
+	prev := tokens[i-1].upper()
+	switch prev {
+	case "LEFT", "RIGHT":
+		// also functions
+		return false
+	}
+	if formatKeywords[prev] {
+		return true
+	}
+	if i < 2 {
+		return false
+	}
+	switch tokens[i-2].upper() {
+	case "INTO", "TABLE", "JOIN", "FROM", "UPDATE", "EXISTS":
+		return tokens[i-1].Kind == tokWord || tokens[i-1].Kind == tokIdent
+	}
+	return false
+}
+
+// continuesClause reports whether word belongs to the clause prev opened
+// rather than starting one: DELETE FROM, LEFT OUTER JOIN, DO UPDATE.
+func continuesClause(prev, word string) bool {
+	switch {
+	case word == "FROM" && prev == "DELETE":
+		return true
+	case word == "JOIN" && joinModifier(prev):
+		return true
+	case joinModifier(word) && joinModifier(prev):
+		return true
+	case word == "UPDATE" && (prev == "DO" || prev == "KEY" || prev == "FOR"):
+		return true
+	}
+	return false
+}
+
+func joinModifier(word string) bool {
+	switch word {
+	case "LEFT", "RIGHT", "INNER", "FULL", "CROSS", "NATURAL", "OUTER":
+		return true
+	}
+	return false
+}
+
+// formatHandler returns the query form's SQL pretty-printed as text for
+// the editor to replace its contents with.
+func formatHandler(c *gin.Context) {
+	c.String(http.StatusOK, formatSQL(c.PostForm("query"), c.PostForm("driver")))
+}
+
+type apiFormatRequest struct {
+	Query string `json:"query"`
+	// Driver selects the literal syntax, standard SQL when empty
+	Driver string `json:"driver,omitempty"`
+}
+
+type apiFormatResponse struct {
+	Query string `json:"query"`
+}
+
+func apiFormat(c *gin.Context) {
+	var req apiFormatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, apiFormatResponse{Query: formatSQL(req.Query, req.Driver)})
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestFormatSQL(t *testing.T) {
+	tests := []struct {
+		driver string
+		query  string
+		want   string
+	}{
+		{"postgres", "select a, b from t where x = 1 and y = 2",
+			"SELECT\n    a,\n    b\nFROM t\nWHERE x = 1\n    AND y = 2"},
+		{"postgres", "select distinct a from t order by a desc limit 10",
+			"SELECT DISTINCT\n    a\nFROM t\nORDER BY a DESC\nLIMIT 10"},
+		{"postgres", "select * from a left join b on a.id = b.a_id and b.x > 0",
+			"SELECT\n    *\nFROM a\nLEFT JOIN b\n    ON a.id = b.a_id\n    AND b.x > 0"},
+		// the AND of a BETWEEN stays on its line
+		{"postgres", "select * from t where id in (select id from u where z between 1 and 5)",
+			"SELECT\n    *\nFROM t\nWHERE id IN (\n    SELECT\n        id\n    FROM u\n    WHERE z BETWEEN 1 AND 5\n)"},
+		{"postgres", "insert into t (a, b) values (1, 'x;y') returning id",
+			"INSERT INTO t (a, b)\nVALUES (1, 'x;y')\nRETURNING id"},
+		{"postgres", "update t set a = 1, b = 'it''s' where id = 2",
+			"UPDATE t\nSET a = 1,\n    b = 'it''s'\nWHERE id = 2"},
+		{"postgres", "select count(*), max(x) from t group by y having count(*) > 1",
+			"SELECT\n    count(*),\n    max(x)\nFROM t\nGROUP BY y\nHAVING count(*) > 1"},
+		{"postgres", "select 1; select 2",
+			"SELECT\n    1;\n\nSELECT\n    2"},
+		{"postgres", "select a -- note\nfrom t",
+			"SELECT\n    a -- note\nFROM t"},
+		// qualified names are no keywords
+		{"postgres", "select o.order, o.from from orders o",
+			"SELECT\n    o.order,\n    o.from\nFROM orders o"},
+		{"postgres", `select 'C:\' as p, 1`,
+			"SELECT\n    'C:\\' AS p,\n    1"},
+		{"mysql", `select 'it\'s; here' as x from t`,
+			"SELECT\n    'it\\'s; here' AS x\nFROM t"},
+		// numbers, operators and placeholders stay whole
+		{"postgres", "select 1e5, 2.5E-3, 0x1F from t",
+			"SELECT\n    1e5,\n    2.5E-3,\n    0x1F\nFROM t"},
+		{"mysql", "select * from t where a <=> b and @x := 1 and @@session.sql_mode = ''",
+			"SELECT\n    *\nFROM t\nWHERE a <=> b\n    AND @x := 1\n    AND @@session.sql_mode = ''"},
+		{"postgres", "select * from t where data @> '{}' and d <@ data and b !~ 'x' and c ~* 'y' and e !~* 'z'",
+			"SELECT\n    *\nFROM t\nWHERE data @> '{}'\n    AND d <@ data\n    AND b !~ 'x'\n    AND c ~* 'y'\n    AND e !~* 'z'"},
+		{"postgres", "select data #> '{a}', data #>> '{a,b}' from t where j ?| k and j ?& k",
+			"SELECT\n    data #> '{a}',\n    data #>> '{a,b}'\nFROM t\nWHERE j ?| k\n    AND j ?& k"},
+		{"postgres", "select * from t where id = :id and name = :user_name and x::text = 'a'",
+			"SELECT\n    *\nFROM t\nWHERE id = :id\n    AND name = :user_name\n    AND x::text = 'a'"},
+	}
+	for _, tt := range tests {
+		got := formatSQL(tt.query, tt.driver)
+		if got != tt.want {
+			t.Errorf("formatSQL(%q, %s) =\n%s\nwant\n%s", tt.query, tt.driver, got, tt.want)
+			continue
+		}
+		if again := formatSQL(got, tt.driver); again != got {
+			t.Errorf("formatSQL is not stable on %q:\n%s", got, again)
+		}
+	}
+}
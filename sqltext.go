@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// stripLeading drops whitespace, comments and opening parentheses in front
+// of the first keyword of a statement.
+func stripLeading(query string) string {
+	s := query
+	for {
+		s = strings.TrimLeftFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '(' })
+		switch {
+		case strings.HasPrefix(s, "--"):
+			if i := strings.IndexByte(s, '\n'); i >= 0 {
+				s = s[i+1:]
+				continue
+			}
+			return ""
+		case strings.HasPrefix(s, "/*"):
+			if i := strings.Index(s, "*/"); i >= 0 {
+				s = s[i+2:]
+				continue
+			}
+			return ""
+		}
+		return s
+	}
+}
+
+// firstKeyword returns the upper-cased leading keyword of a statement.
+func firstKeyword(query string) string {
+	s := stripLeading(query)
+	end := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && r != '_' })
+	if end < 0 {
+		end = len(s)
+	}
+	return strings.ToUpper(s[:end])
+}
+
+// returnsRows guesses whether a statement produces a result set, so that
+// DML and DDL can go through Exec and report affected rows instead.
+func returnsRows(query string) bool {
+	switch firstKeyword(query) {
+	case "SELECT", "WITH", "SHOW", "DESCRIBE", "DESC", "EXPLAIN", "VALUES",
+		"TABLE", "PRAGMA", "EXISTS", "CHECK", "FETCH", "CALL":
+		return true
+	}
+	// INSERT/UPDATE/DELETE ... RETURNING, but not a literal or a name
+	// like returning_at
+	for _, t := range tokenizeSQL(query) {
+		if t.upper() == "RETURNING" {
+			return true
+		}
+	}
+	return false
+}
+
+func execSummary(affected int64) string {
+	if affected < 0 {
+		return "Statement executed successfully"
+	}
+	return fmt.Sprintf("Statement executed successfully, %d rows affected", affected)
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokPunct
+	// tokComment is only produced by lexSQL for the formatter
+	tokComment
+)
+
+type sqlToken struct {
+	Kind tokenKind
+	Text string
+}
+
+// upper returns the keyword form of bare words and "" for anything else.
+func (t sqlToken) upper() string {
+	if t.Kind != tokWord {
+		return ""
+	}
+	return strings.ToUpper(t.Text)
+}
+
+func (t sqlToken) is(punct string) bool {
+	return t.Kind == tokPunct && t.Text == punct
+}
+
+// name returns the identifier a word or quoted identifier refers to.
+func (t sqlToken) name() string {
+	if t.Kind == tokIdent {
+		return t.Text[1 : len(t.Text)-1]
+	}
+	return t.Text
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$'
+}
+
+// tokenizeSQL splits a statement into words, quoted identifiers, literals
+// and punctuation, dropping whitespace and comments. It is lenient: an
+// unterminated literal simply runs to the end of the input. Literals follow
+// standard SQL, where a backslash is an ordinary character.
+func tokenizeSQL(query string) []sqlToken {
+	return lexSQL(query, "", false)
+}
+
+// lexSQL is tokenizeSQL in the literal syntax of driver, keeping comments
+// as tokComment when asked.
+func lexSQL(query, driver string, comments bool) []sqlToken {
+	var tokens []sqlToken
+	s := []rune(query)
+	n := len(s)
+	backslash := backslashEscapes(driver)
+	for i := 0; i < n; {
+		r := s[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < n && s[i+1] == '-':
+			j := i
+			for j < n && s[j] != '\n' {
+				j++
+			}
+			if comments {
+				tokens = append(tokens, sqlToken{tokComment, strings.TrimRight(string(s[i:j]), " \t\r")})
+			}
+			i = j
+		case r == '/' && i+1 < n && s[i+1] == '*':
+			j := min(indexRunes(s, i+2, "*/")+2, n)
+			if comments {
+				tokens = append(tokens, sqlToken{tokComment, string(s[i:j])})
+			}
+			i = j
+		case r == '\'':
+			j := quotedEnd(s, i, backslash)
+			tokens = append(tokens, sqlToken{tokString, string(s[i:j])})
+			i = j
+		case r == '"' || r == '`':
+			j := quotedEnd(s, i, backslash)
+			if j == n && (j-i < 2 || s[n-1] != r) {
+				tokens = append(tokens, sqlToken{tokIdent, string(s[i:]) + string(r)})
+			} else {
+				tokens = append(tokens, sqlToken{tokIdent, string(s[i:j])})
+			}
+			i = j
+		case r == '$' && i+1 < n && (s[i+1] == '$' || unicode.IsLetter(s[i+1])):
+			// PostgreSQL dollar quoting: $$...$$ or $tag$...$tag$
+			j := i + 1
+			for j < n && (unicode.IsLetter(s[j]) || s[j] == '_') {
+				j++
+			}
+			if j < n && s[j] == '$' {
+				tag := string(s[i : j+1])
+				k := min(indexRunes(s, j+1, tag)+len(tag), n)
+				tokens = append(tokens, sqlToken{tokString, string(s[i:k])})
+				i = k
+				continue
+			}
+			tokens = append(tokens, sqlToken{tokPunct, "$"})
+			i++
+		case unicode.IsDigit(r):
+			j := numberEnd(s, i)
+			tokens = append(tokens, sqlToken{tokNumber, string(s[i:j])})
+			i = j
+		case r == ':' && i+1 < n && (unicode.IsLetter(s[i+1]) || s[i+1] == '_'):
+			// a named placeholder, :name
+			j := i + 1
+			for j < n && isWordRune(s[j]) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{tokWord, string(s[i:j])})
+			i = j
+		case r == '@' && i+1 < n && (unicode.IsLetter(s[i+1]) || s[i+1] == '_' || s[i+1] == '@'):
+			// a MySQL variable, @name or @@system_name
+			j := i + 1
+			if s[j] == '@' {
+				j++
+			}
+			for j < n && (isWordRune(s[j]) || s[j] == '.' && j+1 < n && isWordRune(s[j+1])) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{tokWord, string(s[i:j])})
+			i = j
+		case isWordRune(r):
+			j := i
+			for j < n && isWordRune(s[j]) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{tokWord, string(s[i:j])})
+			i = j
+		default:
+			text := string(r)
+			for _, op := range sqlOperators {
+				if strings.HasPrefix(string(s[i:min(i+3, n)]), op) {
+					text = op
+					break
+				}
+			}
+			tokens = append(tokens, sqlToken{tokPunct, text})
+			i += len(text)
+		}
+	}
+	return tokens
+}
+
+// sqlOperators are the operators of more than one character, longest
+// first: the standard ones, MySQL's <=> and :=, and PostgreSQL's JSON,
+// containment and regular expression operators.
+var sqlOperators = []string{
+	"->>", "#>>", "!~*", "<=>",
+	"::", ":=", "<=", ">=", "<>", "!=", "||", "->", "#>", "@>", "<@", "!~", "~*", "?|", "?&",
+}
+
+// numberEnd returns the position just past the number starting at s[i]:
+// digits with an optional fraction and exponent (1.5e-3), or a 0x hex
+// literal.
+func numberEnd(s []rune, i int) int {
+	n := len(s)
+	if s[i] == '0' && i+2 < n && (s[i+1] == 'x' || s[i+1] == 'X') && isHexDigit(s[i+2]) {
+		j := i + 2
+		for j < n && isHexDigit(s[j]) {
+			j++
+		}
+		return j
+	}
+	j := i
+	for j < n && (unicode.IsDigit(s[j]) || s[j] == '.') {
+		j++
+	}
+	if j < n && (s[j] == 'e' || s[j] == 'E') {
+		k := j + 1
+		if k < n && (s[k] == '+' || s[k] == '-') {
+			k++
+		}
+		if k < n && unicode.IsDigit(s[k]) {
+			for k < n && unicode.IsDigit(s[k]) {
+				k++
+			}
+			j = k
+		}
+	}
+	return j
+}
+
+func isHexDigit(r rune) bool {
+	return unicode.IsDigit(r) || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F'
+}
+
+// backslashEscapes reports whether a backslash escapes the next character
+// in the string literals of driver, as it does in MySQL and ClickHouse.
+func backslashEscapes(driver string) bool {
+	return driver == "mysql" || driver == "clickhouse"
+}
+
+// quotedEnd returns the position just past the quoted text opening at
+// s[i], or len(s) when it is unterminated. A doubled quote stands for
+// itself, and with backslash set so does a backslash-escaped character in a
+// string literal.
+func quotedEnd(s []rune, i int, backslash bool) int {
+	quote := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case s[j] == '\\' && backslash && quote == '\'':
+			j++
+		case s[j] == quote && j+1 < len(s) && s[j+1] == quote:
+			j++
+		case s[j] == quote:
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// indexRunes finds sub in s at or after from, returning len(s) if absent.
+func indexRunes(s []rune, from int, sub string) int {
+	want := []rune(sub)
+	for i := from; i+len(want) <= len(s); i++ {
+		if string(s[i:i+len(want)]) == sub {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// spacedBeforeParen are keywords rather than function names when followed by "(".
+var spacedBeforeParen = map[string]bool{
+	"IN": true, "EXISTS": true, "AS": true, "AND": true, "OR": true, "NOT": true,
+	"ON": true, "USING": true, "VALUES": true, "ANY": true, "ALL": true,
+	"FROM": true, "JOIN": true, "WHERE": true, "SELECT": true, "OVER": true,
+}
+
+// tight reports whether t follows prev without a space.
+func tight(prev, t sqlToken) bool {
+	return t.is(",") || t.is(")") || t.is(".") || t.is("::") || t.is(";") ||
+		prev.is("(") || prev.is(".") || prev.is("::") ||
+		(t.is("(") && prev.Kind == tokWord && !spacedBeforeParen[prev.upper()])
+}
+
+// joinTokens renders tokens back to compact, single-line SQL.
+func joinTokens(tokens []sqlToken) string {
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && !tight(tokens[i-1], t) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.Text)
+	}
+	return b.String()
+}
+
+// scriptStatement is one statement of a script and the line it starts on.
+type scriptStatement struct {
+	Line int
+	Text string
+}
+
+// splitStatements splits a script at semicolons outside literals, quoted
+// identifiers, comments and dollar quotes. A MySQL DELIMITER line changes
+// the terminator, and the BEGIN ... END body of a CREATE TRIGGER (SQLite)
+// is kept whole. Statements that are only comments are dropped. Backslash
+// escapes in literals are honoured only where driver has them.
+func splitStatements(script, driver string) []scriptStatement {
+	s := []rune(script)
+	n := len(s)
+	backslash := backslashEscapes(driver)
+	var out []scriptStatement
+	delim := []rune(";")
+	start := 0
+	first, trigger, depth := "", false, 0
+	// begun is set once the statement has more than blanks and comments
+	begun := false
+
+	line, counted := 1, 0
+	lineAt := func(pos int) int {
+		for ; counted < pos; counted++ {
+			if s[counted] == '\n' {
+				line++
+			}
+		}
+		return line
+	}
+	flush := func(end int) {
+		text := strings.TrimSpace(string(s[start:end]))
+		if len(tokenizeSQL(text)) > 0 {
+			out = append(out, scriptStatement{Line: lineAt(start), Text: text})
+		}
+		first, trigger, depth, begun = "", false, 0, false
+	}
+
+	atDelim := func(i int) bool {
+		return depth == 0 && i+len(delim) <= n && string(s[i:i+len(delim)]) == string(delim)
+	}
+
+	for i := 0; i < n; {
+		r := s[i]
+		blank := false
+		switch {
+		case atDelim(i):
+			flush(i)
+			i += len(delim)
+			start = i
+			continue
+		case unicode.IsSpace(r):
+			i++
+			blank = true
+		case r == '-' && i+1 < n && s[i+1] == '-':
+			for i < n && s[i] != '\n' {
+				i++
+			}
+			blank = true
+		case r == '/' && i+1 < n && s[i+1] == '*':
+			i = min(indexRunes(s, i+2, "*/")+2, n)
+			blank = true
+		case r == '\'' || r == '"' || r == '`':
+			i = quotedEnd(s, i, backslash)
+		case r == '$' && i+1 < n && (s[i+1] == '$' || unicode.IsLetter(s[i+1])):
+			j := i + 1
+			for j < n && (unicode.IsLetter(s[j]) || s[j] == '_') {
+				j++
+			}
+			if j < n && s[j] == '$' {
+				tag := string(s[i : j+1])
+				i = min(indexRunes(s, j+1, tag)+len(tag), n)
+			} else {
+				i++
+			}
+		case isWordRune(r):
+			j := i
+			for j < n && isWordRune(s[j]) && !atDelim(j) {
+				j++
+			}
+			word := strings.ToUpper(string(s[i:j]))
+			if first == "" && word == "DELIMITER" {
+				// a client directive, it runs to the end of the line
+				end := i
+				for end < n && s[end] != '\n' {
+					end++
+				}
+				if d := strings.TrimSpace(string(s[j:end])); d != "" {
+					delim = []rune(d)
+				}
+				i = end
+				start = i
+				continue
+			}
+			switch {
+			case first == "":
+				first = word
+			case first == "CREATE" && word == "TRIGGER" && depth == 0:
+				trigger = true
+			case trigger && (word == "BEGIN" || word == "CASE"):
+				depth++
+			case trigger && word == "END" && depth > 0:
+				depth--
+			}
+			i = j
+		default:
+			i++
+		}
+		if !blank {
+			begun = true
+		} else if !begun {
+			// leading blanks and comments stay out of the statement
+			start = i
+		}
+	}
+	flush(n)
+	return out
+}
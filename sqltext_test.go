@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatementsBackslash(t *testing.T) {
+	tests := []struct {
+		driver string
+		script string
+		want   []string
+	}{
+		// a backslash is an ordinary character in standard SQL literals
+		{"postgres", `SELECT 'C:\'; SELECT 1`, []string{`SELECT 'C:\'`, `SELECT 1`}},
+		{"sqlite", `SELECT 'C:\'; SELECT 1`, []string{`SELECT 'C:\'`, `SELECT 1`}},
+		{"postgres", `SELECT 'a\'; SELECT 'b'';'; SELECT 2`, []string{`SELECT 'a\'`, `SELECT 'b'';'`, `SELECT 2`}},
+		// and escapes the next character in MySQL and ClickHouse
+		{"mysql", `SELECT 'it\'s; fine'; SELECT 1`, []string{`SELECT 'it\'s; fine'`, `SELECT 1`}},
+		{"clickhouse", `SELECT 'it\'s; fine'; SELECT 1`, []string{`SELECT 'it\'s; fine'`, `SELECT 1`}},
+		{"mysql", `SELECT 'C:\\'; SELECT 1`, []string{`SELECT 'C:\\'`, `SELECT 1`}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, st := range splitStatements(tt.script, tt.driver) {
+			got = append(got, st.Text)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitStatements(%q, %s) = %q, want %q", tt.script, tt.driver, got, tt.want)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		driver string
+		script string
+		want   []scriptStatement
+	}{
+		{"plain", "postgres", "SELECT 1;\nSELECT 2;\n",
+			[]scriptStatement{{1, "SELECT 1"}, {2, "SELECT 2"}}},
+		{"no trailing semicolon", "postgres", "SELECT 1;\n\n  SELECT 2",
+			[]scriptStatement{{1, "SELECT 1"}, {3, "SELECT 2"}}},
+		{"semicolons in literals and identifiers", "postgres", "INSERT INTO \"a;b\" VALUES ('x;y');\nSELECT 1",
+			[]scriptStatement{{1, `INSERT INTO "a;b" VALUES ('x;y')`}, {2, "SELECT 1"}}},
+		{"backquoted identifier", "mysql", "SELECT `a;b` FROM t; SELECT 2",
+			[]scriptStatement{{1, "SELECT `a;b` FROM t"}, {1, "SELECT 2"}}},
+		{"comments", "postgres", "-- header; still a comment\nSELECT 1; /* a; b */ SELECT 2;\n-- only a comment;\n",
+			[]scriptStatement{{2, "SELECT 1"}, {2, "SELECT 2"}}},
+		{"comment-only statement", "postgres", "SELECT 1;\n/* ; */;\nSELECT 2",
+			[]scriptStatement{{1, "SELECT 1"}, {3, "SELECT 2"}}},
+		{"dollar quotes", "postgres", "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;\nDO $body$ BEGIN PERFORM 1; END $body$;",
+			[]scriptStatement{
+				{1, "CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql"},
+				{2, "DO $body$ BEGIN PERFORM 1; END $body$"},
+			}},
+		{"delimiter", "mysql", "DELIMITER //\nCREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END//\nDELIMITER ;\nCALL p();",
+			[]scriptStatement{
+				{2, "CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END"},
+				{4, "CALL p()"},
+			}},
+		{"trigger body", "sqlite", "CREATE TRIGGER tr AFTER INSERT ON t BEGIN\n  UPDATE u SET n = n + 1;\n  SELECT CASE WHEN 1 THEN 2 END;\nEND;\nSELECT 1;",
+			[]scriptStatement{
+				{1, "CREATE TRIGGER tr AFTER INSERT ON t BEGIN\n  UPDATE u SET n = n + 1;\n  SELECT CASE WHEN 1 THEN 2 END;\nEND"},
+				{5, "SELECT 1"},
+			}},
+		{"parenthesised", "postgres", "(SELECT 1) UNION (SELECT 2); SELECT 3;",
+			[]scriptStatement{{1, "(SELECT 1) UNION (SELECT 2)"}, {1, "SELECT 3"}}},
+		{"comment before a parenthesis", "postgres", "-- first\n(SELECT 1);",
+			[]scriptStatement{{2, "(SELECT 1)"}}},
+		{"empty", "postgres", " ;\n-- nothing\n", nil},
+	}
+	for _, tt := range tests {
+		if got := splitStatements(tt.script, tt.driver); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: splitStatements(%q) = %q, want %q", tt.name, tt.script, got, tt.want)
+		}
+	}
+}
+
+func TestTokenizeBackslash(t *testing.T) {
+	tests := []struct {
+		driver string
+		query  string
+		want   int
+	}{
+		{"postgres", `SELECT 'C:\', 1`, 4},
+		{"mysql", `SELECT 'it\'s', 1`, 4},
+		{"mysql", `SELECT 'C:\', 1`, 2},
+	}
+	for _, tt := range tests {
+		if got := lexSQL(tt.query, tt.driver, false); len(got) != tt.want {
+			t.Errorf("lexSQL(%q, %s) = %d tokens %q, want %d", tt.query, tt.driver, len(got), got, tt.want)
+		}
+	}
+}
+
+func TestReturnsRows(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT 1", true},
+		{"  -- note\n(SELECT 1)", true},
+		{"with x as (select 1) select * from x", true},
+		{"SHOW TABLES", true},
+		{"INSERT INTO t VALUES (1) RETURNING id", true},
+		{"delete from t where id = 1 returning *", true},
+		{"UPDATE t SET note = 'returning'", false},
+		{"UPDATE t SET returning_at = now()", false},
+		{`UPDATE t SET "returning" = 1`, false},
+		{"DELETE FROM t /* RETURNING */", false},
+		{"DELETE FROM t -- returning", false},
+		{"CREATE TABLE t (id int)", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := returnsRows(tt.query); got != tt.want {
+			t.Errorf("returnsRows(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
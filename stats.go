@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// postgresBlockSize turns EXPLAIN's buffer counts into bytes; it is the
+// default BLCKSZ, which few builds change.
+const postgresBlockSize = 8192
+
+// queryStats is what the result page reports about a statement's run. The
+// drivers fill in what their server tells through the context: affected
+// rows from Exec, ClickHouse its ProfileEvents; EXPLAIN ANALYZE the rest
+// on PostgreSQL when asked for.
+type queryStats struct {
+	Elapsed time.Duration
+	// Rows is how many rows the result has, -1 for a statement without one
+	Rows      int
+	Truncated bool
+	// Affected is -1 when the driver can't tell
+	Affected int64
+	// RowsRead and BytesRead are what the server scanned, known when
+	// Source names who counted them
+	RowsRead  int64
+	BytesRead int64
+	Source    string
+}
+
+type statsKey struct{}
+
+// withStats starts collecting a statement's stats in the context.
+func withStats(ctx context.Context) (context.Context, *queryStats) {
+	s := &queryStats{Rows: -1, Affected: -1}
+	return context.WithValue(ctx, statsKey{}, s), s
+}
+
+// statsFrom is the collector of the context, nil when nobody asked.
+func statsFrom(ctx context.Context) *queryStats {
+	s, _ := ctx.Value(statsKey{}).(*queryStats)
+	return s
+}
+
+// recordAffected notes the rows a statement changed, for the drivers.
+func recordAffected(ctx context.Context, affected int64) {
+	if s := statsFrom(ctx); s != nil {
+		s.Affected = affected
+	}
+}
+
+// clickhouseProfileEvents adds up what the server read from the
+// SelectedRows and SelectedBytes increments every thread reports.
+func clickhouseProfileEvents(s *queryStats) clickhouse.QueryOption {
+	return clickhouse.WithProfileEvents(func(events []clickhouse.ProfileEvent) {
+		for _, e := range events {
+			if e.Type != "increment" {
+				continue
+			}
+			switch e.Name {
+			case "SelectedRows":
+				s.RowsRead += e.Value
+			case "SelectedBytes":
+				s.BytesRead += e.Value
+			default:
+				continue
+			}
+			s.Source = "ClickHouse ProfileEvents"
+		}
+	})
+}
+
+// explainAnalyze runs a PostgreSQL read again under EXPLAIN ANALYZE and
+// takes the rows its scans read and the buffers it touched. The query
+// runs twice, so this is only done when the form asks and never for a
+// statement that could write.
+func explainAnalyze(ctx context.Context, conn dbConn, query string, s *queryStats) error {
+	rs, err := conn.Query(ctx, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "+query, 0)
+	if err != nil {
+		return err
+	}
+	if len(rs.Rows) == 0 || len(rs.Rows[0]) == 0 {
+		return fmt.Errorf("EXPLAIN returned no plan")
+	}
+	doc, ok := decodeJSON(rs.Rows[0][0])
+	plans, _ := doc.([]interface{})
+	if !ok || len(plans) == 0 {
+		return fmt.Errorf("EXPLAIN returned no plan")
+	}
+	top, _ := plans[0].(map[string]interface{})
+	plan, _ := top["Plan"].(map[string]interface{})
+	if plan == nil {
+		return fmt.Errorf("EXPLAIN returned no plan")
+	}
+	s.RowsRead = scannedRows(plan)
+	s.BytesRead = (planNumber(plan, "Shared Hit Blocks") + planNumber(plan, "Shared Read Blocks") +
+		planNumber(plan, "Local Hit Blocks") + planNumber(plan, "Local Read Blocks")) * postgresBlockSize
+	s.Source = "EXPLAIN ANALYZE"
+	return nil
+}
+
+// scannedRows adds up the rows every scan node looked at, the ones its
+// filter removed included, over all its loops.
+func scannedRows(node map[string]interface{}) int64 {
+	var rows int64
+	if nodeType, _ := node["Node Type"].(string); strings.HasSuffix(nodeType, "Scan") {
+		loops := planNumber(node, "Actual Loops")
+		if loops == 0 {
+			loops = 1
+		}
+		rows += (planNumber(node, "Actual Rows") + planNumber(node, "Rows Removed by Filter")) * loops
+	}
+	children, _ := node["Plans"].([]interface{})
+	for _, child := range children {
+		if child, ok := child.(map[string]interface{}); ok {
+			rows += scannedRows(child)
+		}
+	}
+	return rows
+}
+
+func planNumber(node map[string]interface{}, key string) int64 {
+	n, ok := node[key].(json.Number)
+	if !ok {
+		return 0
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return int64(f)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// store is the app's own metadata database.
+var store *sql.DB
+
+// storeSchema is applied in order on every start, so statements must be
+// idempotent.
+var storeSchema = []string{
+	`CREATE TABLE IF NOT EXISTS connections (
+		name     TEXT PRIMARY KEY,
+		driver   TEXT NOT NULL,
+		server   TEXT NOT NULL DEFAULT '',
+		username TEXT NOT NULL DEFAULT '',
+		password TEXT NOT NULL DEFAULT '',
+		database TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE TABLE IF NOT EXISTS temp_credentials (
+		username   TEXT PRIMARY KEY,
+		driver     TEXT NOT NULL,
+		params     TEXT NOT NULL,
+		access     TEXT NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		dropped_at INTEGER
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id     INTEGER PRIMARY KEY AUTOINCREMENT,
+		at     INTEGER NOT NULL,
+		user   TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		query  TEXT NOT NULL DEFAULT '',
+		ref    TEXT NOT NULL DEFAULT '',
+		detail TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_ref ON audit_log (ref) WHERE ref != ''`,
+	`CREATE TABLE IF NOT EXISTS api_tokens (
+		id           TEXT PRIMARY KEY,
+		name         TEXT NOT NULL DEFAULT '',
+		user         TEXT NOT NULL,
+		groups       TEXT NOT NULL DEFAULT '',
+		secret_hash  TEXT NOT NULL,
+		created_at   INTEGER NOT NULL,
+		expires_at   INTEGER,
+		last_used_at INTEGER,
+		revoked_at   INTEGER
+	)`,
+	`CREATE TABLE IF NOT EXISTS filter_presets (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		target     TEXT NOT NULL,
+		table_name TEXT NOT NULL,
+		name       TEXT NOT NULL,
+		filters    TEXT NOT NULL,
+		sort       TEXT NOT NULL DEFAULT '',
+		descending INTEGER NOT NULL DEFAULT 0,
+		shared     INTEGER NOT NULL DEFAULT 0,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		UNIQUE (target, table_name, name, created_by)
+	)`,
+	`CREATE TABLE IF NOT EXISTS saved_queries (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		name           TEXT NOT NULL UNIQUE,
+		connection     TEXT NOT NULL,
+		query          TEXT NOT NULL,
+		assertions     TEXT NOT NULL DEFAULT '[]',
+		check_interval INTEGER NOT NULL DEFAULT 0,
+		created_by     TEXT NOT NULL DEFAULT '',
+		created_at     INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS check_runs (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		query_id   INTEGER NOT NULL,
+		at         INTEGER NOT NULL,
+		user       TEXT NOT NULL DEFAULT '',
+		passed     INTEGER NOT NULL,
+		row_count  INTEGER NOT NULL DEFAULT 0,
+		elapsed_ms INTEGER NOT NULL DEFAULT 0,
+		error      TEXT NOT NULL DEFAULT '',
+		results    TEXT NOT NULL DEFAULT '[]'
+	)`,
+	`CREATE INDEX IF NOT EXISTS check_runs_query ON check_runs (query_id, id)`,
+	`CREATE TABLE IF NOT EXISTS shared_results (
+		id         TEXT PRIMARY KEY,
+		title      TEXT NOT NULL DEFAULT '',
+		target     TEXT NOT NULL DEFAULT '',
+		query      TEXT NOT NULL,
+		result     TEXT NOT NULL,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS schema_snapshots (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		connection TEXT NOT NULL,
+		at         INTEGER NOT NULL,
+		checksum   TEXT NOT NULL,
+		tables     TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS schema_snapshots_connection ON schema_snapshots (connection, id)`,
+	`CREATE TABLE IF NOT EXISTS recent_connections (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner           TEXT NOT NULL,
+		driver          TEXT NOT NULL,
+		server          TEXT NOT NULL DEFAULT '',
+		username        TEXT NOT NULL DEFAULT '',
+		database        TEXT NOT NULL DEFAULT '',
+		tls_fingerprint TEXT NOT NULL DEFAULT '',
+		query_tags      TEXT NOT NULL DEFAULT '',
+		used_at         INTEGER NOT NULL,
+		UNIQUE (owner, driver, server, username, database)
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_preferences (
+		owner TEXT NOT NULL,
+		name  TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (owner, name)
+	)`,
+}
+
+// storeColumns are added to existing tables; SQLite has no ADD COLUMN IF
+// NOT EXISTS, so each is checked against the table first.
+var storeColumns = []struct{ table, column, definition string }{
+	{"connections", "tls_fingerprint", "TEXT NOT NULL DEFAULT ''"},
+	{"connections", "query_tags", "TEXT NOT NULL DEFAULT ''"},
+	{"connections", "dial_timeout", "INTEGER NOT NULL DEFAULT 0"},
+	{"connections", "read_timeout", "INTEGER NOT NULL DEFAULT 0"},
+	{"connections", "write_timeout", "INTEGER NOT NULL DEFAULT 0"},
+	{"connections", "keepalive", "INTEGER NOT NULL DEFAULT 0"},
+	{"connections", "charset", "TEXT NOT NULL DEFAULT ''"},
+	{"connections", "result_encoding", "TEXT NOT NULL DEFAULT ''"},
+	{"recent_connections", "charset", "TEXT NOT NULL DEFAULT ''"},
+	{"recent_connections", "result_encoding", "TEXT NOT NULL DEFAULT ''"},
+	{"saved_queries", "schedule", "TEXT NOT NULL DEFAULT ''"},
+	{"saved_queries", "next_run", "INTEGER NOT NULL DEFAULT 0"},
+	{"check_runs", "result", "TEXT NOT NULL DEFAULT ''"},
+	{"temp_credentials", "connection", "TEXT NOT NULL DEFAULT ''"},
+}
+
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	var n int
+	err := db.QueryRow("SELECT count(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+func openStore(path string) error {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return err
+	}
+	for _, stmt := range storeSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return fmt.Errorf("migrate store: %w", err)
+		}
+	}
+	for _, col := range storeColumns {
+		if err := ensureColumn(db, col.table, col.column, col.definition); err != nil {
+			db.Close()
+			return fmt.Errorf("migrate store: %w", err)
+		}
+	}
+	store = db
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newColumn is one column row of the create table form. Type and Default
+// are SQL typed in by the user; names are quoted.
+type newColumn struct {
+	Name     string
+	Type     string
+	Nullable bool
+	Primary  bool
+	Default  string
+}
+
+// newTable is the create table form. Engine, OrderBy and PartitionBy only
+// apply to ClickHouse.
+type newTable struct {
+	Name        string
+	Columns     []newColumn
+	Engine      string
+	OrderBy     string
+	PartitionBy string
+}
+
+const newTableColumns = 3
+
+// columnTypeHints feed the type suggestions of the form.
+var columnTypeHints = map[string][]string{
+	"postgres":   {"bigint", "integer", "bigserial", "text", "varchar(255)", "boolean", "numeric(12,2)", "timestamptz", "date", "jsonb", "uuid", "bytea"},
+	"mysql":      {"BIGINT", "INT", "VARCHAR(255)", "TEXT", "TINYINT(1)", "DECIMAL(12,2)", "DATETIME", "DATE", "JSON", "BLOB"},
+	"sqlite":     {"INTEGER", "TEXT", "REAL", "NUMERIC", "BLOB"},
+	"clickhouse": {"UInt64", "Int64", "UInt32", "String", "LowCardinality(String)", "Float64", "Decimal(12,2)", "DateTime", "Date", "UUID", "Bool"},
+}
+
+// newTableFromForm reads the form. The add action appends an empty column,
+// remove=<i> drops one.
+func newTableFromForm(c *gin.Context) newTable {
+	t := newTable{
+		Name:        strings.TrimSpace(c.PostForm("table")),
+		Engine:      strings.TrimSpace(c.DefaultPostForm("engine", "MergeTree")),
+		OrderBy:     strings.TrimSpace(c.PostForm("order_by")),
+		PartitionBy: strings.TrimSpace(c.PostForm("partition_by")),
+	}
+	n, err := strconv.Atoi(c.PostForm("columns"))
+	if err != nil {
+		n = newTableColumns
+	}
+	remove := -1
+	if r, err := strconv.Atoi(c.PostForm("remove")); err == nil {
+		remove = r
+	}
+	for i := 0; i < n; i++ {
+		if i == remove {
+			continue
+		}
+		field := func(name string) string { return c.PostForm(name + "." + strconv.Itoa(i)) }
+		t.Columns = append(t.Columns, newColumn{
+			Name:     strings.TrimSpace(field("name")),
+			Type:     strings.TrimSpace(field("type")),
+			Nullable: field("null") != "",
+			Primary:  field("pk") != "",
+			Default:  strings.TrimSpace(field("default")),
+		})
+	}
+	if c.PostForm("add") != "" {
+		t.Columns = append(t.Columns, newColumn{})
+	}
+	return t
+}
+
+// createTableSQL assembles CREATE TABLE for the driver. Rows without a name
+// are skipped, so spare rows of the form don't matter.
+func createTableSQL(driver string, t newTable) (string, error) {
+	if t.Name == "" {
+		return "", fmt.Errorf("table name is required")
+	}
+	var defs, pk []string
+	for _, col := range t.Columns {
+		if col.Name == "" {
+			continue
+		}
+		if col.Type == "" {
+			return "", fmt.Errorf("column %s needs a type", col.Name)
+		}
+		if strings.Contains(col.Type+col.Default, ";") {
+			return "", fmt.Errorf("column %s: type and default can't contain ';'", col.Name)
+		}
+		typ := col.Type
+		if driver == "clickhouse" && col.Nullable && !strings.HasPrefix(typ, "Nullable(") {
+			typ = "Nullable(" + typ + ")"
+		}
+		def := quoteIdent(driver, col.Name) + " " + typ
+		if col.Default != "" {
+			def += " DEFAULT " + col.Default
+		}
+		if driver != "clickhouse" && (!col.Nullable || col.Primary) {
+			def += " NOT NULL"
+		}
+		defs = append(defs, def)
+		if col.Primary {
+			pk = append(pk, quoteIdent(driver, col.Name))
+		}
+	}
+	if len(defs) == 0 {
+		return "", fmt.Errorf("add at least one column")
+	}
+
+	if driver != "clickhouse" {
+		if len(pk) > 0 {
+			defs = append(defs, "PRIMARY KEY ("+strings.Join(pk, ", ")+")")
+		}
+		return fmt.Sprintf("CREATE TABLE %s (\n    %s\n)", quoteIdent(driver, t.Name), strings.Join(defs, ",\n    ")), nil
+	}
+
+	engine := t.Engine
+	if engine == "" {
+		engine = "MergeTree"
+	}
+	if strings.ContainsAny(engine+t.OrderBy+t.PartitionBy, ";") {
+		return "", fmt.Errorf("engine options can't contain ';'")
+	}
+	if !strings.Contains(engine, "(") {
+		engine += "()"
+	}
+	stmt := fmt.Sprintf("CREATE TABLE %s (\n    %s\n)\nENGINE = %s", quoteIdent(driver, t.Name), strings.Join(defs, ",\n    "), engine)
+	// the MergeTree family needs ORDER BY; the primary key must be its prefix
+	if strings.Contains(engine, "MergeTree") {
+		if t.PartitionBy != "" {
+			stmt += "\nPARTITION BY " + t.PartitionBy
+		}
+		switch {
+		case t.OrderBy != "":
+			stmt += "\nORDER BY (" + t.OrderBy + ")"
+			if len(pk) > 0 {
+				stmt += "\nPRIMARY KEY (" + strings.Join(pk, ", ") + ")"
+			}
+		case len(pk) > 0:
+			stmt += "\nORDER BY (" + strings.Join(pk, ", ") + ")"
+		default:
+			stmt += "\nORDER BY tuple()"
+		}
+	}
+	return stmt, nil
+}
+
+// createTableHandler renders the create table form, previews the statement
+// and runs it once the previewed statement is confirmed.
+func createTableHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	t := newTableFromForm(c)
+	page := createTableView{
+		Form:       t,
+		Count:      len(t.Columns),
+		ClickHouse: p.Driver == "clickhouse",
+		Types:      columnTypeHints[p.Driver],
+	}
+	if c.PostForm("submitted") == "" || c.PostForm("add") != "" || c.PostForm("remove") != "" {
+		render(c, http.StatusOK, page)
+		return
+	}
+
+	query, err := createTableSQL(p.Driver, t)
+	if err != nil {
+		page.Problem = err.Error()
+		render(c, http.StatusBadRequest, page)
+		return
+	}
+	st := rowStatement{Query: query}
+	if c.PostForm("confirm") != st.Digest() {
+		page.Statement = &st
+		render(c, http.StatusOK, page)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		page.Problem = fmt.Sprintf("Failed to connect to database: %v", err)
+		render(c, http.StatusServiceUnavailable, page)
+		return
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		page.Problem = fmt.Sprintf("CREATE TABLE failed: %v", err)
+		render(c, http.StatusBadRequest, page)
+		return
+	}
+	invalidateSchema(p)
+
+	user := currentIdentity(c).User
+	log.Printf("%s created table %s on %s", user, t.Name, p.address())
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   user,
+		Action: "create_table",
+		Target: p.auditTarget(),
+		Query:  query,
+	})
+	render(c, http.StatusOK, createTableView{Done: fmt.Sprintf("Created table %s.", t.Name), Statement: &st})
+}
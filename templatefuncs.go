@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// cellMaxRunes is where long text cells are cut; the full value stays in
+// the title attribute.
+const cellMaxRunes = 200
+
+var templateFuncs = template.FuncMap{
+	"formatBytes":    formatBytes,
+	"formatDuration": formatDuration,
+	"truncate":       truncate,
+	"jsonPretty":     jsonPretty,
+	"linkify":        linkify,
+	"cell":           renderCell,
+	"jsonCell":       renderJSONCell,
+	"isBinary":       isBinary,
+}
+
+// toFloat converts any numeric value, reporting whether it was one.
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.Pointer:
+		if !rv.IsNil() {
+			return toFloat(rv.Elem().Interface())
+		}
+	}
+	return 0, false
+}
+
+// formatBytes renders a byte count with binary units: 1536 -> "1.5 KiB".
+func formatBytes(v interface{}) string {
+	n, ok := toFloat(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := 0
+	for math.Abs(n) >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// formatDuration renders a time.Duration, or a number of milliseconds as
+// servers usually report them, rounded to a readable precision.
+func formatDuration(v interface{}) string {
+	d, ok := v.(time.Duration)
+	if !ok {
+		ms, isNumber := toFloat(v)
+		if !isNumber {
+			return fmt.Sprint(v)
+		}
+		d = time.Duration(ms * float64(time.Millisecond))
+	}
+	switch {
+	case d >= time.Minute:
+		return d.Round(time.Second).String()
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond).String()
+	}
+	return d.String()
+}
+
+// truncate cuts s to n runes with an ellipsis; the argument order suits
+// pipelines: {{.Query | truncate 80}}.
+func truncate(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+// jsonPretty indents JSON given as text, or marshals any other value.
+// Text that isn't JSON comes back unchanged.
+func jsonPretty(v interface{}) string {
+	var raw []byte
+	switch t := v.(type) {
+	case string:
+		raw = []byte(t)
+	case []byte:
+		raw = t
+	default:
+		out, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(out)
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw, "", "  "); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"']+[^\s<>"'.,;:!?)\]]`)
+
+// linkify escapes s and turns http(s) URLs into links.
+func linkify(s string) template.HTML {
+	var b strings.Builder
+	last := 0
+	for _, m := range urlPattern.FindAllStringIndex(s, -1) {
+		b.WriteString(template.HTMLEscapeString(s[last:m[0]]))
+		u := template.HTMLEscapeString(s[m[0]:m[1]])
+		fmt.Fprintf(&b, `<a href="%s" target="_blank" rel="noopener noreferrer">%s</a>`, u, u)
+		last = m[1]
+	}
+	b.WriteString(template.HTMLEscapeString(s[last:]))
+	return template.HTML(b.String())
+}
+
+// looksLikeJSON is a cheap check before trying to indent a text cell.
+func looksLikeJSON(s string) bool {
+	s = strings.TrimSpace(s)
+	return len(s) > 1 && (s[0] == '{' && s[len(s)-1] == '}' || s[0] == '[' && s[len(s)-1] == ']') && json.Valid([]byte(s))
+}
+
+// renderCell renders a result value by its Go type, the same whatever the
+// driver: NULL, times in the display zone and layout, booleans, binary as
+// its size with the start in hex in the title (pages add a download
+// button), JSON documents indented, long text truncated with the full
+// value in the title, URLs as links.
+func renderCell(v interface{}) template.HTML {
+	switch t := v.(type) {
+	case nil:
+		return `<span class="null-value">null</span>`
+	case time.Time:
+		return template.HTML(template.HTMLEscapeString(displayTime(t)))
+	case bool:
+		return template.HTML(fmt.Sprintf(`<span class="bool-value">%t</span>`, t))
+	case []byte:
+		return template.HTML(fmt.Sprintf(`<span class="binary-value" title="%s">binary, %s</span>`,
+			template.HTMLEscapeString(displayBinary(t)), formatBytes(len(t))))
+	case string:
+		if looksLikeJSON(t) {
+			return template.HTML(`<pre class="json-value">` + template.HTMLEscapeString(jsonPretty(t)) + `</pre>`)
+		}
+		if utf8.RuneCountInString(t) > cellMaxRunes {
+			return template.HTML(fmt.Sprintf(`<span title="%s">%s</span>`,
+				template.HTMLEscapeString(t), linkify(truncate(cellMaxRunes, t))))
+		}
+		return linkify(t)
+	case fmt.Stringer:
+		return template.HTML(template.HTMLEscapeString(t.String()))
+	}
+	if _, ok := toFloat(v); ok {
+		return template.HTML(template.HTMLEscapeString(fmt.Sprint(v)))
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Map || rv.Kind() == reflect.Slice {
+		return template.HTML(`<pre class="json-value">` + template.HTMLEscapeString(jsonPretty(v)) + `</pre>`)
+	}
+	return template.HTML(template.HTMLEscapeString(fmt.Sprint(v)))
+}
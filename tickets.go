@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ticketDefaultMaxRows = 1000
+
+// ticketConfig sets up the issue trackers results can be attached to.
+// Tokens are read from the environment variables named here.
+type ticketConfig struct {
+	Jira   *jiraConfig   `json:"jira"`
+	GitLab *gitlabConfig `json:"gitlab"`
+	// MaxRows caps the rows of a snapshot; 1000 when zero
+	MaxRows int `json:"max_rows"`
+}
+
+type jiraConfig struct {
+	// URL is the site, e.g. https://example.atlassian.net
+	URL      string `json:"url"`
+	User     string `json:"user"`
+	TokenEnv string `json:"token_env"`
+}
+
+type gitlabConfig struct {
+	// URL is the instance, e.g. https://gitlab.com
+	URL      string `json:"url"`
+	TokenEnv string `json:"token_env"`
+}
+
+// ticketFile is a result snapshot to attach.
+type ticketFile struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// ticketTracker is the integration point for issue trackers.
+type ticketTracker interface {
+	// Attach adds file and a comment to the issue and returns a link to it
+	Attach(ctx context.Context, issue string, file ticketFile, comment string) (string, error)
+}
+
+// ticketTrackers returns the configured trackers by name.
+func ticketTrackers() map[string]ticketTracker {
+	trackers := make(map[string]ticketTracker)
+	client := &http.Client{Timeout: 60 * time.Second}
+	if cfg := config.Tickets.Jira; cfg != nil && cfg.URL != "" {
+		trackers["jira"] = &jiraTracker{cfg: *cfg, token: os.Getenv(cfg.TokenEnv), http: client}
+	}
+	if cfg := config.Tickets.GitLab; cfg != nil && cfg.URL != "" {
+		trackers["gitlab"] = &gitlabTracker{cfg: *cfg, token: os.Getenv(cfg.TokenEnv), http: client}
+	}
+	return trackers
+}
+
+// multipartFile encodes file as the single "file" part of a form.
+func multipartFile(file ticketFile) (*bytes.Buffer, string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, file.Name))
+	header.Set("Content-Type", file.ContentType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(file.Data); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return &body, w.FormDataContentType(), nil
+}
+
+// doTracker sends req and decodes a JSON answer into out when given.
+func doTracker(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %s: %s", req.URL.Host, resp.Status, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type jiraTracker struct {
+	cfg   jiraConfig
+	token string
+	http  *http.Client
+}
+
+// Attach uploads the file to a Jira issue like "OPS-123" and comments on it.
+func (j *jiraTracker) Attach(ctx context.Context, issue string, file ticketFile, comment string) (string, error) {
+	base := strings.TrimRight(j.cfg.URL, "/") + "/rest/api/2/issue/" + url.PathEscape(issue)
+
+	body, contentType, err := multipartFile(file)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/attachments", body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Atlassian-Token", "no-check")
+	req.SetBasicAuth(j.cfg.User, j.token)
+	if err := doTracker(j.http, req, nil); err != nil {
+		return "", err
+	}
+
+	note, _ := json.Marshal(gin.H{"body": comment + "\n\nAttached: " + file.Name})
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, base+"/comment", bytes.NewReader(note))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(j.cfg.User, j.token)
+	if err := doTracker(j.http, req, nil); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(j.cfg.URL, "/") + "/browse/" + url.PathEscape(issue), nil
+}
+
+type gitlabTracker struct {
+	cfg   gitlabConfig
+	token string
+	http  *http.Client
+}
+
+// Attach uploads the file to the project of an issue like "group/app#42"
+// and links it from a new note on the issue.
+func (g *gitlabTracker) Attach(ctx context.Context, issue string, file ticketFile, comment string) (string, error) {
+	project, iid, ok := strings.Cut(issue, "#")
+	if !ok || project == "" || iid == "" {
+		return "", fmt.Errorf("GitLab issues are written as group/project#42")
+	}
+	site := strings.TrimRight(g.cfg.URL, "/")
+	base := site + "/api/v4/projects/" + url.PathEscape(project)
+
+	body, contentType, err := multipartFile(file)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/uploads", body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("PRIVATE-TOKEN", g.token)
+	var upload struct {
+		Markdown string `json:"markdown"`
+	}
+	if err := doTracker(g.http, req, &upload); err != nil {
+		return "", err
+	}
+
+	note, _ := json.Marshal(gin.H{"body": comment + "\n\n" + upload.Markdown})
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, base+"/issues/"+url.PathEscape(iid)+"/notes", bytes.NewReader(note))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("PRIVATE-TOKEN", g.token)
+	if err := doTracker(g.http, req, nil); err != nil {
+		return "", err
+	}
+	return site + "/" + project + "/-/issues/" + iid, nil
+}
+
+// snapshotText renders a value as plain text for CSV and Markdown.
+func snapshotText(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "NULL"
+	case time.Time:
+		return t.Format("2006-01-02 15:04:05.999999999 -07:00")
+	case []byte:
+		return fmt.Sprintf("binary, %s", formatBytes(len(t)))
+	}
+	return fmt.Sprint(v)
+}
+
+func snapshotCSV(rs *resultSet) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(rs.Columns)
+	for _, row := range rs.Rows {
+		record := make([]string, len(row))
+		for i, v := range row {
+			record[i] = snapshotText(v)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func snapshotMarkdown(rs *resultSet) []byte {
+	cell := func(s string) string {
+		return strings.NewReplacer("|", `\|`, "\r", " ", "\n", " ").Replace(s)
+	}
+	var buf bytes.Buffer
+	header := make([]string, len(rs.Columns))
+	rule := make([]string, len(rs.Columns))
+	for i, col := range rs.Columns {
+		header[i], rule[i] = cell(col), "---"
+	}
+	fmt.Fprintf(&buf, "| %s |\n| %s |\n", strings.Join(header, " | "), strings.Join(rule, " | "))
+	for _, row := range rs.Rows {
+		record := make([]string, len(row))
+		for i, v := range row {
+			record[i] = cell(snapshotText(v))
+		}
+		fmt.Fprintf(&buf, "| %s |\n", strings.Join(record, " | "))
+	}
+	return buf.Bytes()
+}
+
+// ticketHandler runs the query of the form again and attaches the result
+// to an issue as CSV or Markdown, with a comment naming the query, the
+// connection and who sent it. It is audited like an export.
+func ticketHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	query := c.PostForm("query")
+	issue := strings.TrimSpace(c.PostForm("issue"))
+	format := c.PostForm("format")
+	if format != "md" {
+		format = "csv"
+	}
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "ticket.html", format, args...)
+	}
+
+	tracker, ok := ticketTrackers()[c.PostForm("tracker")]
+	if !ok {
+		fail(http.StatusBadRequest, "Issue tracker %q is not configured", c.PostForm("tracker"))
+		return
+	}
+	if issue == "" {
+		fail(http.StatusBadRequest, "Enter the issue to attach the result to")
+		return
+	}
+	if !returnsRows(query) {
+		fail(http.StatusBadRequest, "Only queries that return rows can be attached")
+		return
+	}
+	guard, err := guardQuery(c.Request.Context(), newQueryEvent(c, p, "ticket", query))
+	if err != nil {
+		fail(http.StatusForbidden, "%v", err)
+		return
+	}
+	defer guard.doneAfter(c)
+	release, err := acquireQuerySlot(c.Request.Context(), p, "")
+	if err != nil {
+		fail(http.StatusServiceUnavailable, "%v", err)
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	limit := config.Tickets.MaxRows
+	if limit <= 0 {
+		limit = ticketDefaultMaxRows
+	}
+	rs, err := fetchResultMax(ctx, db, limit, query)
+	if err == nil {
+		err = p.transcodeRows(rs.Rows)
+	}
+	if err != nil {
+		fail(http.StatusBadRequest, "Query failed: %v", err)
+		return
+	}
+
+	mark := exportMark{ID: randomID(8), User: currentIdentity(c).User, At: time.Now()}
+	file := ticketFile{Name: fmt.Sprintf("result-%s.csv", mark.ID), ContentType: "text/csv"}
+	if format == "md" {
+		file = ticketFile{Name: fmt.Sprintf("result-%s.md", mark.ID), ContentType: "text/markdown", Data: snapshotMarkdown(rs)}
+	} else if file.Data, err = snapshotCSV(rs); err != nil {
+		fail(http.StatusInternalServerError, "Failed to write CSV: %v", err)
+		return
+	}
+
+	comment := fmt.Sprintf("Query result from %s, %d rows", p.auditTarget(), len(rs.Rows))
+	if rs.Truncated {
+		comment += " (cut at the row limit)"
+	}
+	comment += fmt.Sprintf(", attached by %s at %s (export %s):\n\n%s",
+		mark.User, mark.At.Format(time.RFC3339), mark.ID, query)
+
+	link, err := tracker.Attach(ctx, issue, file, comment)
+	if err != nil {
+		log.Printf("Attaching a result to %s failed: %v", issue, err)
+		fail(http.StatusBadGateway, "Failed to attach to %s: %v", issue, err)
+		return
+	}
+	auditExport(c, mark, p, "ticket "+c.PostForm("tracker")+" "+issue+", "+format, query, len(rs.Rows))
+	render(c, http.StatusOK, ticketView{
+		Issue:     issue,
+		Link:      link,
+		File:      file.Name,
+		Rows:      len(rs.Rows),
+		Truncated: rs.Truncated,
+	})
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API tokens let scripts and editor plugins call /api/v1 as the user who
+// created them, with that user's groups at the time. A token reads
+// "sat_<id>_<secret>"; the store keeps only a hash of the secret.
+const (
+	apiTokenPrefix = "sat_"
+	apiTokenMaxTTL = 365 * 24 * time.Hour
+)
+
+type apiToken struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	User      string     `json:"user"`
+	Groups    []string   `json:"groups,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+type apiTokenRequest struct {
+	Name string `json:"name" binding:"required"`
+	// TTLDays is how long the token is valid; 0 means a year
+	TTLDays int `json:"ttl_days"`
+}
+
+type apiTokenResponse struct {
+	apiToken
+	// Token is only returned once, when the token is created
+	Token string `json:"token"`
+}
+
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func issueToken(ctx context.Context, id *identity, name string, ttl time.Duration) (apiTokenResponse, error) {
+	now := time.Now()
+	expires := now.Add(ttl)
+	t := apiToken{
+		ID:        randomID(6),
+		Name:      name,
+		User:      id.User,
+		Groups:    id.Groups,
+		CreatedAt: now,
+		ExpiresAt: &expires,
+	}
+	secret := randomID(24)
+	_, err := store.ExecContext(ctx, `
+		INSERT INTO api_tokens (id, name, user, groups, secret_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.Name, t.User, strings.Join(t.Groups, ","), hashTokenSecret(secret), now.Unix(), expires.Unix())
+	if err != nil {
+		return apiTokenResponse{}, err
+	}
+	return apiTokenResponse{apiToken: t, Token: apiTokenPrefix + t.ID + "_" + secret}, nil
+}
+
+func listTokens(ctx context.Context, user string) ([]apiToken, error) {
+	rows, err := store.QueryContext(ctx, `
+		SELECT id, name, user, groups, created_at, expires_at, last_used_at
+		FROM api_tokens
+		WHERE user = ? AND revoked_at IS NULL
+		ORDER BY created_at DESC`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []apiToken{}
+	for rows.Next() {
+		var t apiToken
+		var groups string
+		var created int64
+		var expires, used sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.Name, &t.User, &groups, &created, &expires, &used); err != nil {
+			return nil, err
+		}
+		if groups != "" {
+			t.Groups = strings.Split(groups, ",")
+		}
+		t.CreatedAt = time.Unix(created, 0)
+		if expires.Valid {
+			at := time.Unix(expires.Int64, 0)
+			t.ExpiresAt = &at
+		}
+		if used.Valid {
+			at := time.Unix(used.Int64, 0)
+			t.LastUsed = &at
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+var errTokenNotFound = errors.New("token not found")
+
+func revokeToken(ctx context.Context, id, user string) error {
+	res, err := store.ExecContext(ctx,
+		"UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND user = ? AND revoked_at IS NULL",
+		time.Now().Unix(), id, user)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", errTokenNotFound, id)
+	}
+	return nil
+}
+
+// tokenIdentity checks a raw token and returns the identity it stands for.
+func tokenIdentity(ctx context.Context, raw string) (*identity, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(raw, apiTokenPrefix), "_")
+	if !ok {
+		return nil, errUnauthenticated
+	}
+	var user, groups, hash string
+	var expires sql.NullInt64
+	err := store.QueryRowContext(ctx, `
+		SELECT user, groups, secret_hash, expires_at
+		FROM api_tokens
+		WHERE id = ? AND revoked_at IS NULL`, id,
+	).Scan(&user, &groups, &hash, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashTokenSecret(secret))) != 1 {
+		return nil, errUnauthenticated
+	}
+	if expires.Valid && time.Now().Unix() > expires.Int64 {
+		return nil, errUnauthenticated
+	}
+	store.ExecContext(ctx, "UPDATE api_tokens SET last_used_at = ? WHERE id = ?", time.Now().Unix(), id)
+
+	ident := &identity{User: user, Provider: "token"}
+	if groups != "" {
+		ident.Groups = strings.Split(groups, ",")
+	}
+	return ident, nil
+}
+
+// bearerToken returns the API token of the request, if it carries one.
+func bearerToken(c *gin.Context) (string, bool) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || !strings.HasPrefix(token, apiTokenPrefix) {
+		return "", false
+	}
+	return token, true
+}
+
+func apiListTokens(c *gin.Context) {
+	tokens, err := listTokens(c.Request.Context(), currentIdentity(c).User)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "internal", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// apiCreateToken issues a token for the caller. A token cannot be used to
+// create further tokens, so a leaked one can be revoked for good.
+func apiCreateToken(c *gin.Context) {
+	id := currentIdentity(c)
+	if id.Provider == "token" {
+		apiError(c, http.StatusForbidden, "forbidden", "tokens cannot be created with a token")
+		return
+	}
+	var req apiTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	ttl := time.Duration(req.TTLDays) * 24 * time.Hour
+	if req.TTLDays <= 0 || ttl > apiTokenMaxTTL {
+		ttl = apiTokenMaxTTL
+	}
+	resp, err := issueToken(c.Request.Context(), id, req.Name, ttl)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "internal", err.Error())
+		return
+	}
+	recordAudit(c.Request.Context(), auditEntry{
+		User:   id.User,
+		Action: "token_create",
+		Ref:    resp.ID,
+		Detail: fmt.Sprintf("%s, expires %s", resp.Name, resp.ExpiresAt.Format(time.RFC3339)),
+	})
+	c.JSON(http.StatusCreated, resp)
+}
+
+func apiRevokeToken(c *gin.Context) {
+	user := currentIdentity(c).User
+	err := revokeToken(c.Request.Context(), c.Param("id"), user)
+	if errors.Is(err, errTokenNotFound) {
+		apiError(c, http.StatusNotFound, "token_not_found", err.Error())
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "internal", err.Error())
+		return
+	}
+	recordAudit(c.Request.Context(), auditEntry{User: user, Action: "token_revoke", Ref: c.Param("id")})
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// txSession is an open transaction pinned to one browser session. It keeps
+// its own connection until COMMIT/ROLLBACK or the idle timeout.
+type txSession struct {
+	params   connParams
+	db       *sql.DB
+	tx       *sql.Tx
+	started  time.Time
+	lastUsed time.Time
+	mu       sync.Mutex
+}
+
+const txIdleTimeout = 10 * time.Minute
+
+var (
+	txSessionsMu sync.Mutex
+	txSessions   = make(map[string]*txSession)
+	txSweeper    sync.Once
+)
+
+func activeTx(c *gin.Context) *txSession {
+	txSessionsMu.Lock()
+	defer txSessionsMu.Unlock()
+	return txSessions[txKey(c)]
+}
+
+// txKey pins a transaction to the browser session and connection tab, so
+// each tab can have its own.
+func txKey(c *gin.Context) string {
+	return sessionID(c) + "/" + c.PostForm("conn_tab")
+}
+
+// sweepIdleTx rolls back transactions nobody has touched for a while so
+// their locks and connections don't linger after a closed tab. The
+// rollbacks go over the network, so they run after txSessionsMu is
+// released rather than holding up every other transaction request.
+func sweepIdleTx() {
+	for range time.Tick(time.Minute) {
+		var expired []*txSession
+		txSessionsMu.Lock()
+		for id, s := range txSessions {
+			// a session busy with a statement is not idle
+			if !s.mu.TryLock() {
+				continue
+			}
+			idle := time.Since(s.lastUsed)
+			s.mu.Unlock()
+			if idle > txIdleTimeout {
+				log.Printf("Rolling back transaction idle for %s", idle.Round(time.Second))
+				expired = append(expired, s)
+				delete(txSessions, id)
+			}
+		}
+		txSessionsMu.Unlock()
+		for _, s := range expired {
+			s.finish(false)
+		}
+	}
+}
+
+func (s *txSession) finish(commit bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.db.Close()
+	if commit {
+		return s.tx.Commit()
+	}
+	return s.tx.Rollback()
+}
+
+// txControl recognises statements that drive the transaction itself.
+func txControl(query string) string {
+	stmt := strings.ToUpper(strings.TrimSpace(strings.TrimRight(strings.TrimSpace(query), ";")))
+	switch stmt {
+	case "BEGIN", "BEGIN TRANSACTION", "BEGIN WORK", "START TRANSACTION":
+		return "begin"
+	case "COMMIT", "COMMIT WORK", "END":
+		return "commit"
+	case "ROLLBACK", "ROLLBACK WORK", "ABORT":
+		return "rollback"
+	}
+	return ""
+}
+
+func beginTx(c *gin.Context) {
+	p := connParamsFromForm(c)
+	id := txKey(c)
+
+	if activeTx(c) != nil {
+		render(c, http.StatusConflict, txStatusView{
+			Error: "A transaction is already open, commit or roll it back first",
+			Open:  true,
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	caps, err := capabilitiesFor(ctx, p)
+	if err != nil {
+		render(c, http.StatusServiceUnavailable, txStatusView{Error: fmt.Sprintf("Failed to connect to database: %v", err)})
+		return
+	}
+	if !caps.Features["transactions"] {
+		render(c, http.StatusBadRequest, txStatusView{Error: fmt.Sprintf("%s does not support interactive transactions", p.Driver)})
+		return
+	}
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		render(c, http.StatusServiceUnavailable, txStatusView{Error: fmt.Sprintf("Failed to connect to database: %v", err)})
+		return
+	}
+	// The transaction outlives this request, so it must not use its context
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		db.Close()
+		render(c, http.StatusInternalServerError, txStatusView{Error: fmt.Sprintf("Failed to begin transaction: %v", err)})
+		return
+	}
+
+	now := time.Now()
+	txSessionsMu.Lock()
+	// a BEGIN sent at the same time may have opened one meanwhile
+	_, raced := txSessions[id]
+	if !raced {
+		txSessions[id] = &txSession{params: p, db: db, tx: tx, started: now, lastUsed: now}
+	}
+	txSessionsMu.Unlock()
+	if raced {
+		tx.Rollback()
+		db.Close()
+		render(c, http.StatusConflict, txStatusView{
+			Error: "A transaction is already open, commit or roll it back first",
+			Open:  true,
+		})
+		return
+	}
+	txSweeper.Do(func() { go sweepIdleTx() })
+
+	log.Printf("Transaction started on %s database at %s", p.Driver, p.address())
+	render(c, http.StatusOK, txStatusView{Open: true, Started: now})
+}
+
+func endTx(c *gin.Context, commit bool) {
+	id := txKey(c)
+	txSessionsMu.Lock()
+	s, ok := txSessions[id]
+	delete(txSessions, id)
+	txSessionsMu.Unlock()
+	if !ok {
+		render(c, http.StatusBadRequest, txStatusView{Error: "No open transaction"})
+		return
+	}
+
+	action := "rolled back"
+	if commit {
+		action = "committed"
+	}
+	if err := s.finish(commit); err != nil {
+		render(c, http.StatusInternalServerError, txStatusView{Error: fmt.Sprintf("Transaction could not be %s: %v", action, err)})
+		return
+	}
+	render(c, http.StatusOK, txStatusView{Message: "Transaction " + action})
+}
+
+func commitTx(c *gin.Context)   { endTx(c, true) }
+func rollbackTx(c *gin.Context) { endTx(c, false) }
+
+// queryInTx runs the statement on the session's open transaction.
+func queryInTx(c *gin.Context, s *txSession, query string) {
+	if p := connParamsFromForm(c); p.cacheKey() != s.params.cacheKey() {
+		render(c, http.StatusConflict, resultError(nil,
+			"A transaction is open on %s (%s), commit or roll it back before switching connections",
+			s.params.address(), s.params.Database))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastUsed = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !returnsRows(query) {
+		res, err := s.tx.ExecContext(ctx, query)
+		if err != nil {
+			log.Printf("Statement execution failed: %v", err)
+			render(c, http.StatusBadRequest, resultError(nil, "Query error: %v", err))
+			return
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			affected = -1
+		}
+		s.warnings(ctx, c)
+		render(c, http.StatusOK, resultMessage(requestNotices(c), execSummary(affected)+" (not committed yet)"))
+		return
+	}
+
+	rows, err := s.tx.QueryContext(ctx, query)
+	if err != nil {
+		log.Printf("Query execution failed: %v", err)
+		render(c, http.StatusBadRequest, resultError(nil, "Query error: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	rs, err := scanResultMax(rows, config.MaxRows)
+	if err != nil {
+		render(c, http.StatusInternalServerError, resultError(nil, "Error during row iteration: %v", err))
+		return
+	}
+	rows.Close()
+	s.warnings(ctx, c)
+
+	renderResultSet(c, rs, time.Time{})
+}
+
+// warnings adds MySQL warnings of the last statement to the request.
+func (s *txSession) warnings(ctx context.Context, c *gin.Context) {
+	if s.params.Driver != "mysql" {
+		return
+	}
+	if err := mysqlWarnings(ctx, s.tx, requestNotices(c)); err != nil {
+		log.Printf("Failed to read warnings: %v", err)
+	}
+}
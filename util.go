@@ -0,0 +1,15 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// randomID returns n random bytes hex-encoded, for job and session ids.
+func randomID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+
+	"github.com/google/uuid"
+)
+
+// uuidValue is a UUID column's value however the driver returned it: pgx's
+// [16]byte, ClickHouse's uuid.UUID, or MySQL BINARY(16) with binary_uuids
+// on. It shows and marshals in the canonical 8-4-4-4-12 form and goes back
+// to a driver as its 16 bytes.
+type uuidValue [16]byte
+
+func (u uuidValue) String() string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+func (u uuidValue) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+func (u uuidValue) Value() (driver.Value, error) {
+	return u[:], nil
+}
+
+// canonicalUUID turns the UUID types drivers decode into into a uuidValue;
+// other values are returned as they are.
+func canonicalUUID(v interface{}) interface{} {
+	switch u := v.(type) {
+	case [16]byte:
+		return uuidValue(u)
+	case uuid.UUID:
+		return uuidValue(u)
+	}
+	return v
+}
+
+// isBinaryUUID tells the columns whose 16-byte values binary_uuids decodes:
+// MySQL's BINARY, the usual home of UUID_TO_BIN.
+func isBinaryUUID(dbType string) bool {
+	return config.BinaryUUIDs && baseType(dbType) == "BINARY"
+}
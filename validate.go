@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const validateTimeout = 10 * time.Second
+
+// validationProblem is a statement the server refused to parse or plan.
+// Line and Column are 1-based in the submitted text; 0 when the server
+// didn't say where.
+type validationProblem struct {
+	Statement int    `json:"statement"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	Message   string `json:"message"`
+	// Source is the offending line, Caret points at the column under it
+	Source string `json:"source,omitempty"`
+	Caret  string `json:"-"`
+}
+
+var (
+	mysqlNearLine     = regexp.MustCompile(`near '((?s).*)' at line (\d+)`)
+	sqliteNear        = regexp.MustCompile(`near "([^"]*)"`)
+	clickhousePos     = regexp.MustCompile(`at position (\d+)`)
+	clickhouseExplain = "EXPLAIN AST "
+)
+
+// checkStatement asks the server to parse and plan a statement without
+// running it: PREPARE on PostgreSQL, MySQL and SQLite, EXPLAIN AST on
+// ClickHouse, which prepares client-side only. Along with the error comes
+// the 1-based character offset of the problem when the server gives one.
+func checkStatement(ctx context.Context, db *sql.DB, driver, stmt string) (int, error) {
+	if driver == "clickhouse" {
+		rows, err := db.QueryContext(ctx, clickhouseExplain+stmt)
+		if err != nil {
+			if m := clickhousePos.FindStringSubmatch(err.Error()); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				return len([]rune(stmt[:clampOffset(stmt, n-len(clickhouseExplain))])) + 1, err
+			}
+			return 0, err
+		}
+		rows.Close()
+		return 0, nil
+	}
+
+	prepared, err := db.PrepareContext(ctx, stmt)
+	if err == nil {
+		prepared.Close()
+		return 0, nil
+	}
+	var pgErr *pgconn.PgError
+	var myErr *mysql.MySQLError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Position > 0:
+		return int(pgErr.Position), err
+	case errors.As(err, &myErr):
+		if m := mysqlNearLine.FindStringSubmatch(myErr.Message); m != nil {
+			return offsetOfNear(stmt, m[1], m[2]), err
+		}
+	case driver == "sqlite":
+		if m := sqliteNear.FindStringSubmatch(err.Error()); m != nil {
+			return offsetOfNear(stmt, m[1], ""), err
+		}
+	}
+	return 0, err
+}
+
+func clampOffset(s string, n int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > len(s) {
+		return len(s)
+	}
+	return n
+}
+
+// offsetOfNear finds the text an error message quotes, on the given line
+// when the message names one. MySQL quotes the rest of the statement from
+// the problem on, SQLite the offending token.
+func offsetOfNear(stmt, near, line string) int {
+	// long quotes are cut short by the server, the first line is enough
+	near = firstLine(near)
+	if near == "" {
+		return 0
+	}
+	start := 0
+	if n, err := strconv.Atoi(line); err == nil {
+		for i := 1; i < n; i++ {
+			next := strings.IndexByte(stmt[start:], '\n')
+			if next < 0 {
+				break
+			}
+			start += next + 1
+		}
+	}
+	i := strings.Index(stmt[start:], near)
+	if i < 0 {
+		return 0
+	}
+	return len([]rune(stmt[:start+i])) + 1
+}
+
+// validateSQL checks every statement of the text, reporting positions in
+// the text as submitted.
+func validateSQL(ctx context.Context, db *sql.DB, driver, text string) []validationProblem {
+	var problems []validationProblem
+	cursor := 0
+	for n, st := range splitStatements(text, driver) {
+		// statements are trimmed slices of the text, in order
+		at := cursor + max(strings.Index(text[cursor:], st.Text), 0)
+		cursor = at + len(st.Text)
+
+		offset, err := checkStatement(ctx, db, driver, st.Text)
+		if err == nil {
+			continue
+		}
+		p := validationProblem{Statement: n + 1, Message: err.Error()}
+		if offset > 0 {
+			runes := []rune(st.Text)
+			before := text[:at] + string(runes[:min(offset-1, len(runes))])
+			lineStart := strings.LastIndexByte(before, '\n') + 1
+			p.Line = strings.Count(before, "\n") + 1
+			p.Column = len([]rune(before[lineStart:])) + 1
+			p.Source = strings.TrimRight(firstLine(text[lineStart:]), "\r")
+			p.Caret = strings.Repeat(" ", p.Column-1) + "^"
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// validateHandler checks the query form's SQL without running it.
+func validateHandler(c *gin.Context) {
+	p := connParamsFromForm(c)
+	query := c.PostForm("query")
+
+	fail := func(status int, format string, args ...interface{}) {
+		renderError(c, status, "validate.html", format, args...)
+	}
+	if strings.TrimSpace(query) == "" {
+		fail(http.StatusBadRequest, "Nothing to validate")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+
+	db, err := openDB(ctx, p)
+	if err != nil {
+		log.Printf("Database connection failed: %v", err)
+		fail(http.StatusServiceUnavailable, "Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	render(c, http.StatusOK, validateView{
+		Statements: len(splitStatements(query, p.Driver)),
+		Problems:   validateSQL(ctx, db, p.Driver, query),
+	})
+}
+
+type apiValidateResponse struct {
+	Valid    bool                `json:"valid"`
+	Problems []validationProblem `json:"problems"`
+}
+
+// apiValidate is validateHandler for editors: the query request's
+// statements are parsed and planned, never run.
+func apiValidate(c *gin.Context) {
+	var req apiQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+
+	db, p, ok := openTarget(ctx, c, req.apiTarget)
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	problems := validateSQL(ctx, db, p.Driver, req.Query)
+	if problems == nil {
+		problems = []validationProblem{}
+	}
+	c.JSON(http.StatusOK, apiValidateResponse{Valid: len(problems) == 0, Problems: problems})
+}
@@ -0,0 +1,947 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// A view is the data one template reads. Its fields are the template's
+// contract: a template that reads a field the view lacks fails to render,
+// where a gin.H would have rendered an empty string.
+type view interface {
+	templateName() string
+}
+
+// render writes v with its template, its messages in the request's
+// language.
+func render(c *gin.Context, status int, v view) {
+	if l, ok := v.(localizedView); ok {
+		v = l.localize(c)
+	}
+	c.HTML(status, v.templateName(), v)
+}
+
+// errorView is the failure of any fragment whose template starts with
+// {{if .Error}} and reads nothing else on that branch.
+type errorView struct {
+	Template string
+	Error    string
+}
+
+func (v errorView) templateName() string { return v.Template }
+
+func (v errorView) localize(c *gin.Context) view {
+	v.Error = tr(c, v.Error)
+	return v
+}
+
+// renderError renders a formatted error into the template.
+func renderError(c *gin.Context, status int, template, format string, args ...interface{}) {
+	render(c, status, errorView{Template: template, Error: fmt.Sprintf(format, args...)})
+}
+
+// resultView is result.html: an error, a message or a table, each with the
+// notices the server sent.
+type resultView struct {
+	Error string
+	// Exception and QueryID explain a failed ClickHouse query
+	Exception *clickhouse.Exception
+	QueryID   string
+
+	Message string
+
+	Columns []string
+	Rows    []resultRow
+	// JSONColumns marks JSON-typed columns; the last JSONKeys columns are
+	// keys expanded out of them
+	JSONColumns []bool
+	JSONKeys    int
+	// TimeZone is the zone times are shown in, "" when each keeps the one
+	// the driver returned; ServerZone the server's own, when known
+	TimeZone   string
+	ServerZone string
+	HasTimes   bool
+	// Stats describe the statement's run, nil when not known
+	Stats *queryStats
+	// Removed duplicates hidden by "distinct", Duplicated rows highlighted
+	Removed    int
+	Duplicated int
+	// TruncatedAt is the row cap when the result had more rows
+	TruncatedAt int
+	// Cached is set when the rows came from the result cache, CachedAge
+	// is how old they are
+	Cached    bool
+	CachedAge time.Duration
+
+	Notices []serverNotice
+}
+
+func (resultView) templateName() string { return "result.html" }
+
+// IsJSON tells the template to render column col as a JSON tree.
+func (v resultView) IsJSON(col int) bool {
+	return col < len(v.JSONColumns) && v.JSONColumns[col]
+}
+
+// IsJSONKey tells a virtual column expanded from a JSON key.
+func (v resultView) IsJSONKey(col int) bool {
+	return col >= len(v.Columns)-v.JSONKeys
+}
+
+func (v resultView) localize(c *gin.Context) view {
+	v.Error, v.Message = tr(c, v.Error), tr(c, v.Message)
+	return v
+}
+
+// resultError is a failed statement; notices may be nil.
+func resultError(notices *noticeLog, format string, args ...interface{}) resultView {
+	v := resultView{Error: fmt.Sprintf(format, args...)}
+	if notices != nil {
+		v.Notices = notices.list()
+	}
+	return v
+}
+
+// resultMessage is a statement that returned no rows.
+func resultMessage(notices *noticeLog, message string) resultView {
+	v := resultView{Message: message}
+	if notices != nil {
+		v.Notices = notices.list()
+	}
+	return v
+}
+
+// databasesView is browse.html.
+type databasesView struct {
+	Error     string
+	Databases []string
+	Current   string
+}
+
+func (databasesView) templateName() string { return "browse.html" }
+
+func (v databasesView) localize(c *gin.Context) view {
+	v.Error = tr(c, v.Error)
+	return v
+}
+
+// schemaView is tables.html, the tables of one database.
+type schemaView struct {
+	Error  string
+	Tables []tableSummary
+	// Destructive offers DROP and TRUNCATE, Dump a per-table dump
+	Destructive bool
+	Dump        bool
+	// CacheAge is how old the cached schema is, zero when just loaded
+	CacheAge time.Duration
+}
+
+func (schemaView) templateName() string { return "tables.html" }
+
+func (v schemaView) localize(c *gin.Context) view {
+	v.Error = tr(c, v.Error)
+	return v
+}
+
+// structureView is structure.html, the columns of one table.
+type structureView struct {
+	Error string
+	Name  string
+	Table tableInfo
+}
+
+func (structureView) templateName() string { return "structure.html" }
+
+func (v structureView) localize(c *gin.Context) view {
+	v.Error = tr(c, v.Error)
+	return v
+}
+
+// rowDetailView is rowdetail.html, one row laid out vertically.
+type rowDetailView struct {
+	Error  string
+	Table  string
+	Key    string
+	Fields []rowDetailField
+	// JSON is the whole row as an object, for copying
+	JSON         string
+	References   []rowLink
+	ReferencedBy []rowLink
+}
+
+func (rowDetailView) templateName() string { return "rowdetail.html" }
+
+// savedQueriesView is savedqueries.html, the saved queries with their
+// latest run.
+type savedQueriesView struct {
+	Error   string
+	Message string
+	Queries []savedQuery
+	// User may delete the queries they saved
+	User string
+}
+
+func (savedQueriesView) templateName() string { return "savedqueries.html" }
+
+func (v savedQueriesView) localize(c *gin.Context) view {
+	v.Message = tr(c, v.Message)
+	return v
+}
+
+// checkRunsView is checkruns.html, the run history of one saved query.
+type checkRunsView struct {
+	Error string
+	Query savedQuery
+	Runs  []checkRun
+}
+
+func (checkRunsView) templateName() string { return "checkruns.html" }
+
+// schemaHistoryView is schemahistory.html, the schema snapshots of a saved
+// connection with what changed in each.
+type schemaHistoryView struct {
+	Error      string
+	Message    string
+	Connection string
+	Revisions  []schemaRevision
+}
+
+func (schemaHistoryView) templateName() string { return "schemahistory.html" }
+
+func (v schemaHistoryView) localize(c *gin.Context) view {
+	v.Message = tr(c, v.Message)
+	return v
+}
+
+// migrationsView is migrations.html, the migrations of a directory against
+// a database: what is applied, what is pending and what applying did.
+type migrationsView struct {
+	Error   string
+	Message string
+	// Problem is a failed dry run or apply; the plan is still shown
+	Problem string
+	Plan    *migrationPlan
+	Target  string
+	// DryRun offers running the pending migrations in a rolled back
+	// transaction
+	DryRun bool
+}
+
+func (migrationsView) templateName() string { return "migrations.html" }
+
+func (v migrationsView) localize(c *gin.Context) view {
+	v.Message, v.Problem = tr(c, v.Message), tr(c, v.Problem)
+	return v
+}
+
+// recentConnectionsView is recent.html, the connections the query form
+// used lately.
+type recentConnectionsView struct {
+	Error  string
+	Recent []recentConnection
+}
+
+func (recentConnectionsView) templateName() string { return "recent.html" }
+
+// queryVariablesView is queryvars.html, the form for the variables of a
+// saved query about to run. When a value was wrong, Values are the ones
+// posted and Message says which.
+type queryVariablesView struct {
+	Error     string
+	Query     savedQuery
+	Variables []queryVariable
+	Values    map[string]string
+	Message   string
+}
+
+func (queryVariablesView) templateName() string { return "queryvars.html" }
+
+func (v queryVariablesView) localize(c *gin.Context) view {
+	v.Message = tr(c, v.Message)
+	return v
+}
+
+// findValueView is findvalue.html, the columns holding a searched value.
+type findValueView struct {
+	Error   string
+	Value   string
+	Partial bool
+	Matches []valueMatch
+	// Searched counts the candidate columns queried, Failed the ones whose
+	// query errored or timed out
+	Searched   int
+	Failed     []string
+	Incomplete bool
+	Elapsed    time.Duration
+}
+
+func (findValueView) templateName() string { return "findvalue.html" }
+
+// connImportView is connimport.html, the outcome of a connection import.
+type connImportView struct {
+	Error    string
+	Format   string
+	Imported []string
+	// Notes explain the entries that were skipped or merged
+	Notes []string
+}
+
+func (connImportView) templateName() string { return "connimport.html" }
+
+// jobView is job.html, a background query still running.
+type jobView struct {
+	Error   string
+	ID      string
+	Status  string
+	Target  string
+	Query   string
+	Elapsed time.Duration
+	// Rows is how many rows were read so far
+	Rows int64
+	// Position is the place in the server's queue while queued
+	Position int
+	// Export is the file format of an export job, Download its file
+	// once done
+	Export   string
+	Download string
+}
+
+func (jobView) templateName() string { return "job.html" }
+
+// validateView is validate.html, the statements the server refused.
+type validateView struct {
+	Error      string
+	Statements int
+	Problems   []validationProblem
+}
+
+func (validateView) templateName() string { return "validate.html" }
+
+// chartView is chart.html, a result drawn as lines. Left, Right, Top and
+// Bottom bound the plot area inside the Width by Height drawing.
+type chartView struct {
+	Error                    string
+	Width, Height            int
+	Left, Right, Top, Bottom int
+	Lines                    []chartLine
+	XTicks, YTicks           []chartTick
+	// Points is the number of labels on the x axis
+	Points        int
+	OmittedSeries int
+	Truncated     bool
+}
+
+func (chartView) templateName() string { return "chart.html" }
+
+// compareView is compare.html, how two results differ. Left and Right name
+// the connections; Truncated is set when either result was cut at the row
+// limit, so rows past it show as added or removed.
+type compareView struct {
+	Error       string
+	Diff        *resultDiff
+	Left, Right string
+	Truncated   bool
+}
+
+func (compareView) templateName() string { return "compare.html" }
+
+// copyView is copy.html, a table copy between connections. Status is
+// "queued", "running", "done", "canceled" or "failed"; Percent is of the source's row
+// estimate and only a guide, Rate is rows per second.
+type copyView struct {
+	Error       string
+	ID          string
+	Status      string
+	Position    int
+	Source      string
+	Target      string
+	Table       string
+	TargetTable string
+	Created     string
+	Skipped     []string
+	Copied      int64
+	Estimate    int64
+	Percent     float64
+	Rate        int64
+	Elapsed     time.Duration
+	Failure     string
+}
+
+func (copyView) templateName() string { return "copy.html" }
+
+func (v copyView) localize(c *gin.Context) view {
+	v.Error, v.Failure = tr(c, v.Error), tr(c, v.Failure)
+	return v
+}
+
+// shareView is share.html, the link to a new snapshot.
+type shareView struct {
+	Error   string
+	Link    string
+	Rows    int
+	Expires time.Time
+}
+
+func (shareView) templateName() string { return "share.html" }
+
+// sharedView is shared.html, the page a share link opens.
+type sharedView struct {
+	Error  string
+	Share  sharedResult
+	Result resultView
+}
+
+func (sharedView) templateName() string { return "shared.html" }
+
+// connTabsView is conntabs.html, the tab bar. Active is the tab to select,
+// a newly opened one; Message says why opening one failed.
+type connTabsView struct {
+	Error       string
+	Tabs        []connTab
+	Active      string
+	Message     string
+	Connections []string
+}
+
+func (connTabsView) templateName() string { return "conntabs.html" }
+
+func (v connTabsView) localize(c *gin.Context) view {
+	v.Message = tr(c, v.Message)
+	return v
+}
+
+// mapView is map.html, a full page drawing a result's geometries; Features
+// is the GeoJSON FeatureCollection and Skipped counts rows without one.
+type mapView struct {
+	Error    string
+	Features json.RawMessage
+	Count    int
+	Skipped  int
+	Notice   string
+}
+
+func (mapView) templateName() string { return "map.html" }
+
+// txStatusView is tx_status.html, the state of the session's transaction.
+// Started is zero when the page doesn't know when it began.
+type txStatusView struct {
+	Error   string
+	Open    bool
+	Started time.Time
+	Message string
+}
+
+func (txStatusView) templateName() string { return "tx_status.html" }
+
+func (v txStatusView) localize(c *gin.Context) view {
+	v.Error, v.Message = tr(c, v.Error), tr(c, v.Message)
+	return v
+}
+
+// assistView is assist.html, a statement the assistant drafted.
+type assistView struct {
+	Error string
+	Draft string
+}
+
+func (assistView) templateName() string { return "assist.html" }
+
+// progressView is progress.html, the InnoDB DDL stages in progress.
+// Instrumented is false when the server has stage reporting switched off;
+// Polling refreshes the fragment while anything is running.
+type progressView struct {
+	Error        string
+	Stages       []stageProgress
+	Instrumented bool
+	Polling      bool
+}
+
+func (progressView) templateName() string { return "progress.html" }
+
+// indexBuildView is index_build.html, a CREATE INDEX in the background.
+// Progress is nil until the server reports any, Failed the error of a
+// finished build and Cleanup what was done about the index it left.
+type indexBuildView struct {
+	Error     string
+	ID        string
+	Statement string
+	Elapsed   time.Duration
+	Running   bool
+	Progress  *indexProgress
+	Failed    string
+	Cleanup   string
+}
+
+func (indexBuildView) templateName() string { return "index_build.html" }
+
+// columnCryptView is columncrypt.html: either an encrypted value or a
+// result with the columns of a key decrypted, marked in Decrypted.
+type columnCryptView struct {
+	Error string
+	// Ciphertext is an encrypted value, Hex set when it is hex of raw bytes
+	Ciphertext string
+	Hex        bool
+
+	Columns   []string
+	Decrypted []bool
+	Rows      [][]interface{}
+	Truncated bool
+	// Failed counts the values that did not decrypt
+	Failed int
+}
+
+func (columnCryptView) templateName() string { return "columncrypt.html" }
+
+// indexesView is indexes.html, the indexes and constraints of a table.
+type indexesView struct {
+	Error       string
+	Name        string
+	Indexes     []indexInfo
+	Constraints []constraintInfo
+}
+
+func (indexesView) templateName() string { return "indexes.html" }
+
+// homeView is index.html, the main page. The flags offer the optional
+// panels that are configured.
+type homeView struct {
+	Assistant   bool
+	Jira        bool
+	GitLab      bool
+	Keys        []string
+	Drivers     []driverOption
+	Connections []string
+	Migrations  []string
+	// TimeZone is the user's default zone for results, "" for none
+	TimeZone string
+}
+
+func (homeView) templateName() string { return "index.html" }
+
+// alterView is alter.html, the ALTER TABLE form of a table. Statement is
+// the previewed change, Checked set when its dry run succeeded; Done says
+// what was changed.
+type alterView struct {
+	Error   string
+	Done    string
+	Table   string
+	Columns []columnInfo
+	Op      alterOp
+	Types   []string
+	// DryRun offers trying the change in a rolled back transaction
+	DryRun    bool
+	Problem   string
+	Statement *rowStatement
+	Checked   bool
+}
+
+func (alterView) templateName() string { return "alter.html" }
+
+func (v alterView) localize(c *gin.Context) view {
+	v.Error, v.Done, v.Problem = tr(c, v.Error), tr(c, v.Done), tr(c, v.Problem)
+	return v
+}
+
+// createTableView is createtable.html, the create table wizard with Count
+// column rows.
+type createTableView struct {
+	Done       string
+	Form       newTable
+	Count      int
+	ClickHouse bool
+	Types      []string
+	Problem    string
+	Statement  *rowStatement
+}
+
+func (createTableView) templateName() string { return "createtable.html" }
+
+func (v createTableView) localize(c *gin.Context) view {
+	v.Done, v.Problem = tr(c, v.Done), tr(c, v.Problem)
+	return v
+}
+
+// rowEditView is rowedit.html, the edit form of a row. Orig is the row as
+// the form was loaded, Update the previewed statement and Matches the rows
+// it matches; Conflicts lists the columns changed on both sides.
+type rowEditView struct {
+	Error     string
+	Done      string
+	Table     string
+	Key       string
+	Version   string
+	Fields    []rowField
+	Orig      []rowField
+	Problem   string
+	Conflicts []rowConflict
+	Update    *rowStatement
+	Matches   int64
+}
+
+func (rowEditView) templateName() string { return "rowedit.html" }
+
+func (v rowEditView) localize(c *gin.Context) view {
+	v.Error, v.Done, v.Problem = tr(c, v.Error), tr(c, v.Done), tr(c, v.Problem)
+	return v
+}
+
+// rowInsertView is rowinsert.html, the insert form of a table and its
+// previewed statement.
+type rowInsertView struct {
+	Error     string
+	Done      string
+	Table     string
+	Fields    []rowField
+	Problem   string
+	Statement *rowStatement
+}
+
+func (rowInsertView) templateName() string { return "rowinsert.html" }
+
+func (v rowInsertView) localize(c *gin.Context) view {
+	v.Error, v.Done, v.Problem = tr(c, v.Error), tr(c, v.Done), tr(c, v.Problem)
+	return v
+}
+
+// rowDeleteView is rowdelete.html, a DELETE by key with the number of rows
+// it matches and the first of them.
+type rowDeleteView struct {
+	Error     string
+	Done      string
+	Table     string
+	Key       string
+	Statement rowStatement
+	Matches   int64
+	Columns   []string
+	Rows      [][]interface{}
+	Problem   string
+}
+
+func (rowDeleteView) templateName() string { return "rowdelete.html" }
+
+func (v rowDeleteView) localize(c *gin.Context) view {
+	v.Error, v.Done, v.Problem = tr(c, v.Error), tr(c, v.Done), tr(c, v.Problem)
+	return v
+}
+
+// explainView is explain.html, what a query does in sentences and, once
+// asked for, the assistant's explanation.
+type explainView struct {
+	Sentences   []string
+	Warnings    []string
+	Assistant   bool
+	Error       string
+	Explanation string
+}
+
+func (explainView) templateName() string { return "explain.html" }
+
+func (v explainView) localize(c *gin.Context) view {
+	v.Error = tr(c, v.Error)
+	return v
+}
+
+// bulkView is bulk.html, the outcome of a bulk run or import: the summary
+// and the first failures, More of them not shown.
+type bulkView struct {
+	Summary  bulkSummary
+	Total    int
+	Failures []bulkRow
+	More     int
+	// Report is set when the failures are in the CSV report
+	Report bool
+	// DryRun is set when nothing was written; Halted says why
+	DryRun  bool
+	Halted  string
+	Ignored []string
+}
+
+func (bulkView) templateName() string { return "bulk.html" }
+
+func (v bulkView) localize(c *gin.Context) view {
+	v.Halted = tr(c, v.Halted)
+	return v
+}
+
+// csvImportView is csvimport.html, the column mapping of an uploaded CSV
+// of Rows rows and Width columns.
+type csvImportView struct {
+	Table   string
+	Columns []columnInfo
+	Mapping []importColumn
+	Width   int
+	Header  bool
+	Rows    int
+	Problem string
+}
+
+func (csvImportView) templateName() string { return "csvimport.html" }
+
+func (v csvImportView) localize(c *gin.Context) view {
+	v.Problem = tr(c, v.Problem)
+	return v
+}
+
+// clustersView is clusters.html, the nodes of the ClickHouse clusters and
+// the parts and merges of the chosen one.
+type clustersView struct {
+	Clusters []string
+	Cluster  string
+	Nodes    []clusterNode
+	Parts    []replicaParts
+	Merges   []replicaMerge
+	Problem  string
+}
+
+func (clustersView) templateName() string { return "clusters.html" }
+
+func (v clustersView) localize(c *gin.Context) view {
+	v.Problem = tr(c, v.Problem)
+	return v
+}
+
+// clusterDDLView is clusterddl.html, a statement run ON CLUSTER: previewed
+// with its Digest, or Done with the status of every host.
+type clusterDDLView struct {
+	Done      bool
+	Statement string
+	Digest    string
+	Columns   []string
+	Rows      [][]interface{}
+}
+
+func (clusterDDLView) templateName() string { return "clusterddl.html" }
+
+// credentialView is credential.html, a temporary credential shown once.
+type credentialView struct {
+	Credential *tempCredential
+}
+
+func (credentialView) templateName() string { return "credential.html" }
+
+// ddlView is ddl.html, the CREATE statement of a table.
+type ddlView struct {
+	Name string
+	DDL  string
+}
+
+func (ddlView) templateName() string { return "ddl.html" }
+
+// destructiveView is destructive.html, the confirmation of a DROP or
+// TRUNCATE by typing the table's name. Rows is the estimated row count, nil
+// when unknown.
+type destructiveView struct {
+	Done      string
+	Table     string
+	Kind      string
+	Action    string
+	Statement string
+	Rows      *int64
+	Problem   string
+}
+
+func (destructiveView) templateName() string { return "destructive.html" }
+
+func (v destructiveView) localize(c *gin.Context) view {
+	v.Done, v.Problem = tr(c, v.Done), tr(c, v.Problem)
+	return v
+}
+
+// erdView is erd.html, the foreign key diagram laid out in a Width by
+// Height SVG.
+type erdView struct {
+	Boxes  []erdBox
+	Links  []erdLink
+	Width  int
+	Height int
+	Tables int
+	Keys   int
+}
+
+func (erdView) templateName() string { return "erd.html" }
+
+// gridView is grid.html, one page of a table. Keys holds the encoded
+// primary key of every row, nil when rows can't be edited; Next is the
+// cursor of the next page, "" on the last.
+type gridView struct {
+	State   gridState
+	History string
+	Headers []gridHeader
+	Rows    [][]interface{}
+	Next    string
+	Page    int
+	Keyset  bool
+	Keys    []string
+	Presets []filterPreset
+	Notice  string
+	User    string
+}
+
+func (gridView) templateName() string { return "grid.html" }
+
+func (v gridView) localize(c *gin.Context) view {
+	v.Notice = tr(c, v.Notice)
+	return v
+}
+
+// impactView is impact.html, the server counters before and after a
+// query with its first rows, Total of them, or its Message.
+type impactView struct {
+	Message  string
+	Total    int
+	Elapsed  time.Duration
+	Counters []serverCounter
+	Columns  []string
+	Rows     [][]interface{}
+}
+
+func (impactView) templateName() string { return "impact.html" }
+
+func (v impactView) localize(c *gin.Context) view {
+	v.Message = tr(c, v.Message)
+	return v
+}
+
+// accountsView is accounts.html, the users of the server and their grants.
+type accountsView struct {
+	Accounts   []dbAccount
+	Privileges []string
+	MySQL      bool
+}
+
+func (accountsView) templateName() string { return "accounts.html" }
+
+// grantPlanView is grantplan.html, the statements of a grant: previewed
+// with their Digest, or Done.
+type grantPlanView struct {
+	Done       bool
+	Statements string
+	Digest     string
+}
+
+func (grantPlanView) templateName() string { return "grantplan.html" }
+
+// insightsView is insights.html, the most expensive statements in the
+// given Order. Hint says how to enable the statistics a failure lacked.
+type insightsView struct {
+	Error      string
+	Hint       string
+	Stats      []queryStat
+	Order      string
+	ClickHouse bool
+}
+
+func (insightsView) templateName() string { return "insights.html" }
+
+func (v insightsView) localize(c *gin.Context) view {
+	v.Error, v.Hint = tr(c, v.Error), tr(c, v.Hint)
+	return v
+}
+
+// replicationView is replication.html, the server's replication Role and
+// links as Checked at a time of day.
+type replicationView struct {
+	Role    string
+	Links   []replicationLink
+	Checked string
+}
+
+func (replicationView) templateName() string { return "replication.html" }
+
+// reportView is report.html, a printable report of Rows rows in pages.
+type reportView struct {
+	Title      string
+	Query      string
+	Connection string
+	Mark       exportMark
+	Watermark  string
+	Generated  string
+	Columns    []string
+	Pages      []reportPage
+	PageCount  int
+	Rows       int
+	Truncated  bool
+}
+
+func (reportView) templateName() string { return "report.html" }
+
+// scriptView is script.html, the progress of a script run. Current is the
+// statement in flight while Running; Stopped says why a run ended early.
+type scriptView struct {
+	ID       string
+	File     string
+	Total    int
+	Done     int
+	Failed   int
+	Affected int64
+	Errors   []scriptError
+	More     int
+	Running  bool
+	Stopped  string
+	Elapsed  time.Duration
+	Current  *scriptStatement
+}
+
+func (scriptView) templateName() string { return "script.html" }
+
+func (v scriptView) localize(c *gin.Context) view {
+	v.Stopped = tr(c, v.Stopped)
+	return v
+}
+
+// sessionsView is sessions.html, the sessions on the server and the
+// outcome of stopping one.
+type sessionsView struct {
+	Sessions []serverSession
+	// Terminate offers ending a session, not only cancelling its query
+	Terminate bool
+	Done      string
+	Problem   string
+}
+
+func (sessionsView) templateName() string { return "sessions.html" }
+
+func (v sessionsView) localize(c *gin.Context) view {
+	v.Done, v.Problem = tr(c, v.Done), tr(c, v.Problem)
+	return v
+}
+
+// settingsView is settings.html, the server settings matching Search out
+// of Total. Details is set when the server describes its settings.
+type settingsView struct {
+	Settings []serverSetting
+	Total    int
+	Search   string
+	Details  bool
+}
+
+func (settingsView) templateName() string { return "settings.html" }
+
+// sizesView is sizes.html, the tables by the space they take, with the
+// database's Total, Data and Index bytes. Estimated is set when the
+// server's sizes are estimates.
+type sizesView struct {
+	Tables     []tableSize
+	Total      int64
+	Data       int64
+	Index      int64
+	Estimated  bool
+	ClickHouse bool
+}
+
+func (sizesView) templateName() string { return "sizes.html" }
+
+// ticketView is ticket.html, a result of Rows rows attached to an issue.
+type ticketView struct {
+	Issue     string
+	Link      string
+	File      string
+	Rows      int
+	Truncated bool
+}
+
+func (ticketView) templateName() string { return "ticket.html" }